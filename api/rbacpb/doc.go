@@ -0,0 +1,5 @@
+// Package rbacpb contains the protocol buffer messages and gRPC service
+// generated from rbac.proto
+package rbacpb
+
+//go:generate protoc -I ../.. --go_out=paths=source_relative:../.. --go-grpc_out=paths=source_relative:../.. api/rbacpb/rbac.proto
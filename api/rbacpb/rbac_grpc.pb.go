@@ -0,0 +1,393 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.5.1-go
+// source: api/rbacpb/rbac.proto
+
+package rbacpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// RbacClient is the client API for Rbac service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RbacClient interface {
+	// EnumerateBindings returns the role bindings in a namespace that refer to
+	// any of the subjects
+	EnumerateBindings(ctx context.Context, in *EnumerateBindingsRequest, opts ...grpc.CallOption) (*EnumerateBindingsResponse, error)
+	// StreamBindings streams the role bindings EnumerateBindings would return,
+	// in the order they are listed in rather than sorted
+	StreamBindings(ctx context.Context, in *EnumerateBindingsRequest, opts ...grpc.CallOption) (Rbac_StreamBindingsClient, error)
+	// EffectivePermissions returns the permissions granted to any of the
+	// subjects, and the bindings that grant them
+	EffectivePermissions(ctx context.Context, in *EffectivePermissionsRequest, opts ...grpc.CallOption) (*EffectivePermissionsResponse, error)
+	// StreamEffectivePermissions streams the permissions EffectivePermissions
+	// would return, each as soon as a binding grants it rather than sorted
+	StreamEffectivePermissions(ctx context.Context, in *EffectivePermissionsRequest, opts ...grpc.CallOption) (Rbac_StreamEffectivePermissionsClient, error)
+	// WhoCan returns the subjects allowed to make a request, and the bindings
+	// that allow it
+	WhoCan(ctx context.Context, in *WhoCanRequest, opts ...grpc.CallOption) (*WhoCanResponse, error)
+	// StreamWhoCan streams the subjects WhoCan would return, each with one of
+	// the bindings that allow it as soon as it is found, so subjects allowed by
+	// several bindings are sent once for each of them
+	StreamWhoCan(ctx context.Context, in *WhoCanRequest, opts ...grpc.CallOption) (Rbac_StreamWhoCanClient, error)
+}
+
+type rbacClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRbacClient(cc grpc.ClientConnInterface) RbacClient {
+	return &rbacClient{cc}
+}
+
+func (c *rbacClient) EnumerateBindings(ctx context.Context, in *EnumerateBindingsRequest, opts ...grpc.CallOption) (*EnumerateBindingsResponse, error) {
+	out := new(EnumerateBindingsResponse)
+	err := c.cc.Invoke(ctx, "/gokubeapi.rbac.v1.Rbac/EnumerateBindings", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rbacClient) StreamBindings(ctx context.Context, in *EnumerateBindingsRequest, opts ...grpc.CallOption) (Rbac_StreamBindingsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Rbac_ServiceDesc.Streams[0], "/gokubeapi.rbac.v1.Rbac/StreamBindings", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rbacStreamBindingsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Rbac_StreamBindingsClient interface {
+	Recv() (*RoleBinding, error)
+	grpc.ClientStream
+}
+
+type rbacStreamBindingsClient struct {
+	grpc.ClientStream
+}
+
+func (x *rbacStreamBindingsClient) Recv() (*RoleBinding, error) {
+	m := new(RoleBinding)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *rbacClient) EffectivePermissions(ctx context.Context, in *EffectivePermissionsRequest, opts ...grpc.CallOption) (*EffectivePermissionsResponse, error) {
+	out := new(EffectivePermissionsResponse)
+	err := c.cc.Invoke(ctx, "/gokubeapi.rbac.v1.Rbac/EffectivePermissions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rbacClient) StreamEffectivePermissions(ctx context.Context, in *EffectivePermissionsRequest, opts ...grpc.CallOption) (Rbac_StreamEffectivePermissionsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Rbac_ServiceDesc.Streams[1], "/gokubeapi.rbac.v1.Rbac/StreamEffectivePermissions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rbacStreamEffectivePermissionsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Rbac_StreamEffectivePermissionsClient interface {
+	Recv() (*Permission, error)
+	grpc.ClientStream
+}
+
+type rbacStreamEffectivePermissionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *rbacStreamEffectivePermissionsClient) Recv() (*Permission, error) {
+	m := new(Permission)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *rbacClient) WhoCan(ctx context.Context, in *WhoCanRequest, opts ...grpc.CallOption) (*WhoCanResponse, error) {
+	out := new(WhoCanResponse)
+	err := c.cc.Invoke(ctx, "/gokubeapi.rbac.v1.Rbac/WhoCan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rbacClient) StreamWhoCan(ctx context.Context, in *WhoCanRequest, opts ...grpc.CallOption) (Rbac_StreamWhoCanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Rbac_ServiceDesc.Streams[2], "/gokubeapi.rbac.v1.Rbac/StreamWhoCan", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &rbacStreamWhoCanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Rbac_StreamWhoCanClient interface {
+	Recv() (*SubjectBindings, error)
+	grpc.ClientStream
+}
+
+type rbacStreamWhoCanClient struct {
+	grpc.ClientStream
+}
+
+func (x *rbacStreamWhoCanClient) Recv() (*SubjectBindings, error) {
+	m := new(SubjectBindings)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RbacServer is the server API for Rbac service.
+// All implementations must embed UnimplementedRbacServer
+// for forward compatibility
+type RbacServer interface {
+	// EnumerateBindings returns the role bindings in a namespace that refer to
+	// any of the subjects
+	EnumerateBindings(context.Context, *EnumerateBindingsRequest) (*EnumerateBindingsResponse, error)
+	// StreamBindings streams the role bindings EnumerateBindings would return,
+	// in the order they are listed in rather than sorted
+	StreamBindings(*EnumerateBindingsRequest, Rbac_StreamBindingsServer) error
+	// EffectivePermissions returns the permissions granted to any of the
+	// subjects, and the bindings that grant them
+	EffectivePermissions(context.Context, *EffectivePermissionsRequest) (*EffectivePermissionsResponse, error)
+	// StreamEffectivePermissions streams the permissions EffectivePermissions
+	// would return, each as soon as a binding grants it rather than sorted
+	StreamEffectivePermissions(*EffectivePermissionsRequest, Rbac_StreamEffectivePermissionsServer) error
+	// WhoCan returns the subjects allowed to make a request, and the bindings
+	// that allow it
+	WhoCan(context.Context, *WhoCanRequest) (*WhoCanResponse, error)
+	// StreamWhoCan streams the subjects WhoCan would return, each with one of
+	// the bindings that allow it as soon as it is found, so subjects allowed by
+	// several bindings are sent once for each of them
+	StreamWhoCan(*WhoCanRequest, Rbac_StreamWhoCanServer) error
+	mustEmbedUnimplementedRbacServer()
+}
+
+// UnimplementedRbacServer must be embedded to have forward compatible implementations.
+type UnimplementedRbacServer struct {
+}
+
+func (UnimplementedRbacServer) EnumerateBindings(context.Context, *EnumerateBindingsRequest) (*EnumerateBindingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnumerateBindings not implemented")
+}
+func (UnimplementedRbacServer) StreamBindings(*EnumerateBindingsRequest, Rbac_StreamBindingsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamBindings not implemented")
+}
+func (UnimplementedRbacServer) EffectivePermissions(context.Context, *EffectivePermissionsRequest) (*EffectivePermissionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EffectivePermissions not implemented")
+}
+func (UnimplementedRbacServer) StreamEffectivePermissions(*EffectivePermissionsRequest, Rbac_StreamEffectivePermissionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEffectivePermissions not implemented")
+}
+func (UnimplementedRbacServer) WhoCan(context.Context, *WhoCanRequest) (*WhoCanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WhoCan not implemented")
+}
+func (UnimplementedRbacServer) StreamWhoCan(*WhoCanRequest, Rbac_StreamWhoCanServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamWhoCan not implemented")
+}
+func (UnimplementedRbacServer) mustEmbedUnimplementedRbacServer() {}
+
+// UnsafeRbacServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RbacServer will
+// result in compilation errors.
+type UnsafeRbacServer interface {
+	mustEmbedUnimplementedRbacServer()
+}
+
+func RegisterRbacServer(s grpc.ServiceRegistrar, srv RbacServer) {
+	s.RegisterService(&Rbac_ServiceDesc, srv)
+}
+
+func _Rbac_EnumerateBindings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnumerateBindingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RbacServer).EnumerateBindings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gokubeapi.rbac.v1.Rbac/EnumerateBindings",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RbacServer).EnumerateBindings(ctx, req.(*EnumerateBindingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rbac_StreamBindings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EnumerateBindingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RbacServer).StreamBindings(m, &rbacStreamBindingsServer{stream})
+}
+
+type Rbac_StreamBindingsServer interface {
+	Send(*RoleBinding) error
+	grpc.ServerStream
+}
+
+type rbacStreamBindingsServer struct {
+	grpc.ServerStream
+}
+
+func (x *rbacStreamBindingsServer) Send(m *RoleBinding) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Rbac_EffectivePermissions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EffectivePermissionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RbacServer).EffectivePermissions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gokubeapi.rbac.v1.Rbac/EffectivePermissions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RbacServer).EffectivePermissions(ctx, req.(*EffectivePermissionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rbac_StreamEffectivePermissions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EffectivePermissionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RbacServer).StreamEffectivePermissions(m, &rbacStreamEffectivePermissionsServer{stream})
+}
+
+type Rbac_StreamEffectivePermissionsServer interface {
+	Send(*Permission) error
+	grpc.ServerStream
+}
+
+type rbacStreamEffectivePermissionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *rbacStreamEffectivePermissionsServer) Send(m *Permission) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Rbac_WhoCan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WhoCanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RbacServer).WhoCan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gokubeapi.rbac.v1.Rbac/WhoCan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RbacServer).WhoCan(ctx, req.(*WhoCanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rbac_StreamWhoCan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WhoCanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RbacServer).StreamWhoCan(m, &rbacStreamWhoCanServer{stream})
+}
+
+type Rbac_StreamWhoCanServer interface {
+	Send(*SubjectBindings) error
+	grpc.ServerStream
+}
+
+type rbacStreamWhoCanServer struct {
+	grpc.ServerStream
+}
+
+func (x *rbacStreamWhoCanServer) Send(m *SubjectBindings) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Rbac_ServiceDesc is the grpc.ServiceDesc for Rbac service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Rbac_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gokubeapi.rbac.v1.Rbac",
+	HandlerType: (*RbacServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EnumerateBindings",
+			Handler:    _Rbac_EnumerateBindings_Handler,
+		},
+		{
+			MethodName: "EffectivePermissions",
+			Handler:    _Rbac_EffectivePermissions_Handler,
+		},
+		{
+			MethodName: "WhoCan",
+			Handler:    _Rbac_WhoCan_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamBindings",
+			Handler:       _Rbac_StreamBindings_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamEffectivePermissions",
+			Handler:       _Rbac_StreamEffectivePermissions_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamWhoCan",
+			Handler:       _Rbac_StreamWhoCan_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/rbacpb/rbac.proto",
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// commands that can be run instead of the server, given their arguments
+	commands = map[string]func(args []string) error{
+		"diff":              diffCommand,
+		"hygiene":           hygieneCommand,
+		"dangling-subjects": danglingSubjectsCommand,
+		"graph":             graphCommand,
+		"matrix":            matrixCommand,
+	}
+)
+
+// runCommand runs the named command and exits
+func runCommand(name string, args []string) {
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command:", name)
+		os.Exit(2)
+	}
+	if err := command(args); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// outputFlag registers the flag that selects the output format
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("output", "text", "output format, one of text, json or yaml")
+}
+
+// writeOutput writes the value in the given format, text uses the given func
+func writeOutput(w io.Writer, format string, v interface{}, text func(io.Writer) error) error {
+	switch format {
+	case "text":
+		return text(w)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		return yaml.NewEncoder(w).Encode(v)
+	}
+	return fmt.Errorf("unknown output format %s", format)
+}
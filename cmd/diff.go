@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/geoah/go-kube-api/internal/diff"
+)
+
+// diffCommand compares two RBAC states
+func diffCommand(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	from := flags.String("from", "", "state to compare from, live, snapshot:<RFC3339 time> or a manifest file")
+	to := flags.String("to", liveSource, "state to compare to, live, snapshot:<RFC3339 time> or a manifest file")
+	output := outputFlag(flags)
+	opts := stateFlags(flags)
+	flags.Parse(args)
+
+	if *from == "" {
+		return errors.New("missing -from")
+	}
+
+	fromState, err := loadState(*from, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *from, err)
+	}
+	toState, err := loadState(*to, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *to, err)
+	}
+
+	d := diff.New(*fromState, *toState)
+	return writeOutput(os.Stdout, *output, d, d.WriteText)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/geoah/go-kube-api/internal/graph"
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+// graphCommand exports the graph of subjects, bindings, roles and permissions
+func graphCommand(args []string) error {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	source := flags.String("source", liveSource, "state to export, live, snapshot:<RFC3339 time> or a manifest file")
+	scope := flags.String("scope", "", "namespace of the role bindings to include, all if empty")
+	subjectNames := flags.String("subjects", "", "comma separated subject names or regular expressions bindings have to refer to, all if empty")
+	matchType := flags.String("match", "", "how subjects are matched, one of exact, prefix, glob or regex, exact names or regular expressions if empty")
+	format := flags.String("format", string(graph.FormatDOT), "output format, one of dot, graphml or json")
+	opts := stateFlags(flags)
+	flags.Parse(args)
+
+	graphFormat, err := graph.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	filters := []rbac.RoleBindingFilter{}
+	switch {
+	case *subjectNames == "":
+	case *matchType == "":
+		filters, err = rbac.FiltersBySubjectNames(strings.Split(*subjectNames, ","))
+	default:
+		patterns := []rbac.Pattern{}
+		for _, subjectName := range strings.Split(*subjectNames, ",") {
+			patterns = append(patterns, rbac.Pattern{
+				Pattern:   subjectName,
+				MatchType: rbac.MatchType(*matchType),
+			})
+		}
+		filters, err = rbac.FiltersBySubjectPatterns(patterns)
+	}
+	if err != nil {
+		return err
+	}
+
+	state, err := loadState(*source, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *source, err)
+	}
+
+	g := graph.New(*state, graph.Options{
+		Namespace: *scope,
+		Filters:   filters,
+	})
+	return g.Write(os.Stdout, graphFormat)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/geoah/go-kube-api/internal/hygiene"
+)
+
+// hygieneCommand reports dangling bindings, orphaned roles and bindings
+// without subjects
+func hygieneCommand(args []string) error {
+	flags := flag.NewFlagSet("hygiene", flag.ExitOnError)
+	source := flags.String("source", liveSource, "state to check, live, snapshot:<RFC3339 time> or a manifest file")
+	output := outputFlag(flags)
+	opts := stateFlags(flags)
+	flags.Parse(args)
+
+	state, err := loadState(*source, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *source, err)
+	}
+
+	report := hygiene.New(*state)
+	return writeOutput(os.Stdout, *output, report, report.WriteText)
+}
@@ -2,29 +2,48 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/geoah/go-kube-api/api/rbacpb"
 	"github.com/geoah/go-kube-api/internal/api"
+	"github.com/geoah/go-kube-api/internal/audit"
+	"github.com/geoah/go-kube-api/internal/auth"
+	"github.com/geoah/go-kube-api/internal/config"
+	"github.com/geoah/go-kube-api/internal/graphqlapi"
+	"github.com/geoah/go-kube-api/internal/groups"
+	"github.com/geoah/go-kube-api/internal/grpcapi"
+	"github.com/geoah/go-kube-api/internal/limits"
+	"github.com/geoah/go-kube-api/internal/notifier"
 	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+	"github.com/geoah/go-kube-api/internal/subjects"
+	"github.com/geoah/go-kube-api/internal/workloads"
 
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
-	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
-type config struct {
-	BindAddress string `envconfig:"bind_address" default:"localhost:8080"`
-}
-
 func main() {
+	// run a command instead of serving, if one was given rather than flags
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1], os.Args[2:])
+	}
+
 	// construct a logger
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -34,16 +53,30 @@ func main() {
 	// flushes buffer, if any
 	defer logger.Sync()
 
-	// parse configuration
-	config := config{}
-	if err := envconfig.Process("", &config); err != nil {
-		logger.Fatal("error parsing config", zap.Error(err))
+	// load configuration from the config file, environment and flags
+	conf, configPath, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		logger.Fatal("error loading config", zap.Error(err))
 	}
 
-	// construct an in-cluster config
-	kubeConfig, err := rest.InClusterConfig()
+	// limit the regular expressions of requests
+	rbac.SetRegexpLimits(rbac.RegexpLimits{
+		MaxLength:      conf.Regexps.MaxLength,
+		MaxProgramSize: conf.Regexps.MaxProgramSize,
+		CacheSize:      conf.Regexps.CacheSize,
+	})
+
+	// construct the config of the cluster from the kubeconfig, if
+	// configured, or in-cluster
+	kubeConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: conf.Cluster.Kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: conf.Cluster.Context},
+	).ClientConfig()
 	if err != nil {
-		logger.Fatal("error constructing in-cluster config", zap.Error(err))
+		logger.Fatal("error constructing cluster config", zap.Error(err))
 	}
 
 	// construct the clientset
@@ -58,35 +91,286 @@ func main() {
 		logger.Fatal("error constructing rbac enumerator", zap.Error(err))
 	}
 
+	// background tasks run until we shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// construct and start the notifier, if configured
+	if conf.Notifier.Config != "" {
+		notifierConfig, err := notifier.LoadConfig(conf.Notifier.Config)
+		if err != nil {
+			logger.Fatal("error loading notifier config", zap.Error(err))
+		}
+		// dead letters go to stderr unless a file is configured
+		deadLetters := os.Stderr
+		if conf.Notifier.DeadLetterPath != "" {
+			deadLetters, err = os.OpenFile(conf.Notifier.DeadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				logger.Fatal("error opening notifier dead letter log", zap.Error(err))
+			}
+			defer deadLetters.Close()
+		}
+		notifier, err := notifier.New(rbacEnumerator, *notifierConfig, deadLetters, logger)
+		if err != nil {
+			logger.Fatal("error constructing notifier", zap.Error(err))
+		}
+		go notifier.Run(ctx)
+	}
+
+	// check service accounts against the cluster, and users and groups
+	// against the directory if configured
+	serviceAccounts := subjects.NewServiceAccounts(kubeClient.CoreV1())
+	apiOptions := []api.Option{
+		api.WithServiceAccounts(serviceAccounts),
+		api.WithWorkloads(workloads.New(kubeClient.CoreV1(), kubeClient.AppsV1())),
+		api.WithMaxSubjectNames(conf.Limits.MaxSubjectNames),
+	}
+
+	// cache enumeration responses, if configured
+	if conf.Cache.TTL > 0 {
+		apiOptions = append(apiOptions, api.WithResponseCache(time.Duration(conf.Cache.TTL), conf.Cache.MaxSize))
+	}
+
+	// check users and groups against the directory, if configured
+	if conf.Directory.SubjectsPath != "" {
+		directory, err := subjects.LoadDirectory(conf.Directory.SubjectsPath)
+		if err != nil {
+			logger.Fatal("error loading subjects directory", zap.Error(err))
+		}
+		apiOptions = append(apiOptions, api.WithDirectory(directory))
+	}
+
+	// expand groups using the static file too, if configured
+	if conf.Directory.GroupsPath != "" {
+		staticGroups, err := groups.LoadStatic(conf.Directory.GroupsPath)
+		if err != nil {
+			logger.Fatal("error loading groups", zap.Error(err))
+		}
+		apiOptions = append(apiOptions, api.WithGroups(groups.Chain(groups.Builtin{}, staticGroups)))
+	}
+
+	// run the configured audit checks, if any, instead of the default ones
+	if conf.Audit.RulesPath != "" {
+		auditChecks, err := audit.LoadRules(conf.Audit.RulesPath)
+		if err != nil {
+			logger.Fatal("error loading audit rules", zap.Error(err))
+		}
+		apiOptions = append(apiOptions, api.WithAuditChecks(auditChecks))
+	}
+
+	// the GraphQL and gRPC servers are configured like the API
+	graphqlOptions := []graphqlapi.Option{
+		graphqlapi.WithMaxComplexity(conf.GraphQL.MaxComplexity),
+		graphqlapi.WithMaxDepth(conf.GraphQL.MaxDepth),
+	}
+	rbacServerOptions := []grpcapi.Option{
+		grpcapi.WithMaxSubjectNames(conf.Limits.MaxSubjectNames),
+	}
+
+	// construct and start the snapshotter, if configured
+	if conf.Snapshots.Path != "" {
+		snapshotStore, err := snapshot.New(conf.Snapshots.Path)
+		if err != nil {
+			logger.Fatal("error opening snapshot store", zap.Error(err))
+		}
+		defer snapshotStore.Close()
+		snapshotter, err := snapshot.NewSnapshotter(
+			snapshotStore,
+			rbacEnumerator,
+			time.Duration(conf.Snapshots.Interval),
+			time.Duration(conf.Snapshots.Retention),
+			logger,
+			snapshot.WithServiceAccounts(serviceAccounts),
+		)
+		if err != nil {
+			logger.Fatal("error constructing snapshotter", zap.Error(err))
+		}
+		go snapshotter.Run(ctx)
+		apiOptions = append(apiOptions, api.WithSnapshots(snapshotStore))
+		graphqlOptions = append(graphqlOptions, graphqlapi.WithSnapshots(snapshotStore))
+		rbacServerOptions = append(rbacServerOptions, grpcapi.WithSnapshots(snapshotStore))
+	}
+
 	// construct API
-	api, err := api.New(rbacEnumerator)
+	api, err := api.New(rbacEnumerator, apiOptions...)
 	if err != nil {
 		logger.Fatal("error constructing api", zap.Error(err))
 	}
 
-	// construct HTTP router
+	// construct GraphQL server
+	graphqlServer, err := graphqlapi.New(rbacEnumerator, graphqlOptions...)
+	if err != nil {
+		logger.Fatal("error constructing graphql server", zap.Error(err))
+	}
+
+	// construct HTTP router, which only takes the client IP from forwarded
+	// headers if they come from trusted proxies
+	trustedProxies, err := limits.ParseProxies(conf.Limits.TrustedProxies)
+	if err != nil {
+		logger.Fatal("error parsing trusted proxies", zap.Error(err))
+	}
 	router := gin.New()
+	router.ForwardedByClientIP = len(trustedProxies) > 0
 
 	// add the ginzap middleware to make gin log through zap
 	router.Use(ginzap.Ginzap(logger, time.RFC3339, true))
 	router.Use(ginzap.RecoveryWithZap(logger, true))
 
-	// setup routes
-	router.POST("/v1/rbac/enumerateBySubjectNames", api.RbacEnummerateByBindings)
+	// limit the size of requests, and how many each caller can make if
+	// configured
+	bodySizeLimiter := limits.NewBodySizeLimiter(conf.Limits.MaxRequestBodyBytes)
+	var rateLimiter *limits.RateLimiter
+	if conf.Limits.RateLimit > 0 {
+		rateLimiter, err = limits.NewRateLimiter(
+			conf.Limits.RateLimit,
+			conf.Limits.RateLimitBurst,
+			limits.WithCallerHeader(conf.Limits.RateLimitCallerHeader),
+			limits.WithTrustedProxies(trustedProxies),
+		)
+		if err != nil {
+			logger.Fatal("error constructing rate limiter", zap.Error(err))
+		}
+		if conf.Limits.RateLimitCallerHeader != "" && len(trustedProxies) == 0 {
+			logger.Warn("rate limit caller header is ignored without trusted proxies")
+		}
+	}
+
+	// authenticate callers, if configured
+	var tokens *auth.Tokens
+	if conf.Auth.TokensPath != "" {
+		tokens, err = auth.LoadTokens(conf.Auth.TokensPath)
+		if err != nil {
+			logger.Fatal("error loading auth tokens", zap.Error(err))
+		}
+	}
+
+	// construct the gRPC service, served if configured
+	rbacServer, err := grpcapi.New(rbacEnumerator, rbacServerOptions...)
+	if err != nil {
+		logger.Fatal("error constructing grpc server", zap.Error(err))
+	}
+
+	// apply the configuration changes that are safe to apply while serving,
+	// when the config file changes or on SIGHUP
+	configWatcher := config.NewWatcher(os.Args[1:], conf, configPath, func(previous, current *config.Config) {
+		if current.Regexps != previous.Regexps {
+			rbac.SetRegexpLimits(rbac.RegexpLimits{
+				MaxLength:      current.Regexps.MaxLength,
+				MaxProgramSize: current.Regexps.MaxProgramSize,
+				CacheSize:      current.Regexps.CacheSize,
+			})
+		}
+		api.SetMaxSubjectNames(current.Limits.MaxSubjectNames)
+		rbacServer.SetMaxSubjectNames(current.Limits.MaxSubjectNames)
+		bodySizeLimiter.SetMaxBytes(current.Limits.MaxRequestBodyBytes)
+		graphqlServer.SetLimits(current.GraphQL.MaxComplexity, current.GraphQL.MaxDepth)
+		if rateLimiter != nil && current.Limits.RateLimit > 0 {
+			if err := rateLimiter.SetLimits(current.Limits.RateLimit, current.Limits.RateLimitBurst); err != nil {
+				logger.Error("error changing rate limits", zap.Error(err))
+			}
+			rateLimiter.SetCallerHeader(current.Limits.RateLimitCallerHeader)
+		}
+	}, logger)
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go configWatcher.Run(ctx, hangups)
+
+	// health checks are registered before authentication and the limits so
+	// they aren't limited, callers are authenticated before they are rate
+	// limited so they are limited by name
 	router.GET("/healthz", api.Health)
+	if tokens != nil {
+		router.Use(tokens.Authenticate)
+	}
+	router.Use(bodySizeLimiter.Limit)
+	if rateLimiter != nil {
+		router.Use(rateLimiter.Limit)
+	}
+
+	// setup routes
+	api.RegisterRoutes(router)
+	router.POST("/v1/graphql", graphqlServer.GraphQL)
 
-	// construct HTTP server
+	// serves HTTP, over TLS if configured
+	listenAndServe := func(srv *http.Server) {
+		var err error
+		if conf.TLS.CertFile != "" {
+			err = srv.ListenAndServeTLS(conf.TLS.CertFile, conf.TLS.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatal("error serving HTTP", zap.Error(err), zap.String("address", srv.Addr))
+		}
+	}
+
+	// construct and start HTTP server
 	srv := &http.Server{
-		Addr:    config.BindAddress,
+		Addr:    conf.Listen.HTTP,
 		Handler: router,
 	}
+	go listenAndServe(srv)
 
-	// start HTTP server
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("error serving HTTP", zap.Error(err))
+	// construct and start the admin HTTP server, if configured, which serves
+	// the configuration and metrics apart from the API since they describe
+	// the deployment
+	var adminSrv *http.Server
+	if conf.Listen.Admin != "" {
+		adminRouter := gin.New()
+		adminRouter.Use(ginzap.Ginzap(logger, time.RFC3339, true))
+		adminRouter.Use(ginzap.RecoveryWithZap(logger, true))
+		if tokens != nil {
+			adminRouter.Use(tokens.Authenticate)
+		}
+		adminRouter.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+		adminRouter.GET("/admin/config", configWatcher.Handler)
+		adminSrv = &http.Server{
+			Addr:    conf.Listen.Admin,
+			Handler: adminRouter,
+		}
+		go listenAndServe(adminSrv)
+	}
+
+	// construct and start the gRPC server, if configured
+	var grpcServer *grpc.Server
+	if conf.Listen.GRPC != "" {
+		listener, err := net.Listen("tcp", conf.Listen.GRPC)
+		if err != nil {
+			logger.Fatal("error listening for gRPC", zap.Error(err))
+		}
+		// calls are authenticated and rate limited like HTTP requests, and
+		// messages larger than the body size limit at startup aren't received
+		// at all
+		var unaryInterceptors []grpc.UnaryServerInterceptor
+		var streamInterceptors []grpc.StreamServerInterceptor
+		if tokens != nil {
+			unaryInterceptors = append(unaryInterceptors, tokens.UnaryServerInterceptor())
+			streamInterceptors = append(streamInterceptors, tokens.StreamServerInterceptor())
 		}
-	}()
+		if rateLimiter != nil {
+			unaryInterceptors = append(unaryInterceptors, rateLimiter.UnaryServerInterceptor())
+			streamInterceptors = append(streamInterceptors, rateLimiter.StreamServerInterceptor())
+		}
+		grpcOptions := []grpc.ServerOption{
+			grpc.MaxRecvMsgSize(int(conf.Limits.MaxRequestBodyBytes)),
+			grpc.ChainUnaryInterceptor(unaryInterceptors...),
+			grpc.ChainStreamInterceptor(streamInterceptors...),
+		}
+		if conf.TLS.CertFile != "" {
+			creds, err := credentials.NewServerTLSFromFile(conf.TLS.CertFile, conf.TLS.KeyFile)
+			if err != nil {
+				logger.Fatal("error loading TLS certificate for gRPC", zap.Error(err))
+			}
+			grpcOptions = append(grpcOptions, grpc.Creds(creds))
+		}
+		grpcServer = grpc.NewServer(grpcOptions...)
+		rbacpb.RegisterRbacServer(grpcServer, rbacServer)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Fatal("error serving gRPC", zap.Error(err))
+			}
+		}()
+	}
 
 	// wait for any signal that we should stop serving HTTP requests
 	done := make(chan os.Signal, 1)
@@ -95,14 +379,25 @@ func main() {
 
 	logger.Info("shutting down HTTP server")
 
+	// stop background tasks
+	cancel()
+
 	// we allow 5 seconds for any remaining requests to be processed
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
 
 	// shut down the server
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Fatal("error while shutting down server", zap.Error(err))
 	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			logger.Fatal("error while shutting down admin server", zap.Error(err))
+		}
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
 
 	// graceful shutdown completed
 	logger.Info("server shut down")
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/geoah/go-kube-api/internal/matrix"
+)
+
+// matrixCommand writes the matrix of subjects against the permissions they
+// are granted
+func matrixCommand(args []string) error {
+	flags := flag.NewFlagSet("matrix", flag.ExitOnError)
+	source := flags.String("source", liveSource, "state to report on, live, snapshot:<RFC3339 time> or a manifest file")
+	scope := flags.String("scope", "", "namespace to report on, the whole cluster if empty")
+	format := flags.String("format", string(matrix.FormatCSV), "output format, one of csv, excel-csv, html or json")
+	opts := stateFlags(flags)
+	flags.Parse(args)
+
+	matrixFormat, err := matrix.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadState(*source, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *source, err)
+	}
+
+	m := matrix.New(*state, *scope)
+	if matrixFormat == matrix.FormatJSON {
+		return writeOutput(os.Stdout, string(matrixFormat), m, nil)
+	}
+	return m.Write(os.Stdout, matrixFormat)
+}
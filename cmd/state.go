@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+	"github.com/geoah/go-kube-api/internal/subjects"
+)
+
+const (
+	// liveSource loads the state from the cluster
+	liveSource = "live"
+	// snapshotSourcePrefix loads the state from the snapshot at a given time
+	snapshotSourcePrefix = "snapshot:"
+)
+
+type (
+	// stateOptions are needed by some of the sources states are loaded from
+	stateOptions struct {
+		kubeconfig    string
+		snapshotsPath string
+		namespace     string
+	}
+)
+
+// stateFlags registers the flags needed to load states
+func stateFlags(flags *flag.FlagSet) *stateOptions {
+	opts := &stateOptions{}
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", os.Getenv("KUBECONFIG"), "kubeconfig of the live cluster, in-cluster config if empty")
+	flags.StringVar(&opts.snapshotsPath, "snapshots", os.Getenv("SNAPSHOTS_PATH"), "snapshot database")
+	flags.StringVar(&opts.namespace, "namespace", "default", "namespace of manifests that don't specify one")
+	return opts
+}
+
+// loadState loads the RBAC state from a source, which is either "live",
+// "snapshot:" followed by an RFC3339 time, or the path of a manifest file
+func loadState(source string, opts *stateOptions) (*rbac.State, error) {
+	switch {
+	case source == liveSource:
+		kubeClient, err := newKubeClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		enumerator, err := rbac.New(kubeClient.RbacV1())
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct rbac enumerator: %w", err)
+		}
+		return enumerator.State()
+
+	case strings.HasPrefix(source, snapshotSourcePrefix):
+		s, err := loadSnapshot(source, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &s.State, nil
+
+	default:
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open manifests: %w", err)
+		}
+		defer f.Close()
+		return rbac.LoadManifests(f, opts.namespace)
+	}
+}
+
+// newKubeClient constructs a clientset for the live cluster
+func newKubeClient(opts *stateOptions) (*kubernetes.Clientset, error) {
+	kubeConfig, err := clientcmd.BuildConfigFromFlags("", opts.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct kube config: %w", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct clientset: %w", err)
+	}
+	return kubeClient, nil
+}
+
+// loadServiceAccounts loads the service accounts of the same source as
+// loadState, nil if they weren't recorded with the snapshot
+func loadServiceAccounts(source string, opts *stateOptions) (map[rbac.SubjectKey]bool, error) {
+	switch {
+	case source == liveSource:
+		kubeClient, err := newKubeClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		return subjects.NewServiceAccounts(kubeClient.CoreV1()).List()
+
+	case strings.HasPrefix(source, snapshotSourcePrefix):
+		s, err := loadSnapshot(source, opts)
+		if err != nil {
+			return nil, err
+		}
+		return subjects.Set(s.ServiceAccounts), nil
+
+	default:
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open manifests: %w", err)
+		}
+		defer f.Close()
+		serviceAccounts, err := rbac.LoadServiceAccountManifests(f, opts.namespace)
+		if err != nil {
+			return nil, err
+		}
+		return subjects.Set(serviceAccounts), nil
+	}
+}
+
+// loadSnapshot loads the snapshot of a "snapshot:" source
+func loadSnapshot(source string, opts *stateOptions) (*snapshot.Snapshot, error) {
+	asOf, err := time.Parse(time.RFC3339, strings.TrimPrefix(source, snapshotSourcePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot time: %w", err)
+	}
+	if opts.snapshotsPath == "" {
+		return nil, fmt.Errorf("missing snapshot database")
+	}
+	store, err := snapshot.New(opts.snapshotsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot database: %w", err)
+	}
+	defer store.Close()
+	s, err := store.At(asOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	return s, nil
+}
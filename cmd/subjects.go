@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/subjects"
+)
+
+// danglingSubjectsCommand reports the subjects of bindings that do not exist
+func danglingSubjectsCommand(args []string) error {
+	flags := flag.NewFlagSet("dangling-subjects", flag.ExitOnError)
+	source := flags.String("source", liveSource, "state to check, live, snapshot:<RFC3339 time> or a manifest file")
+	checkServiceAccounts := flags.Bool("service-accounts", true, "check service accounts against the source's, the cluster's, the snapshot's or the manifests'")
+	directoryPath := flags.String("directory", os.Getenv("SUBJECTS_DIRECTORY_PATH"), "yaml file listing the users and groups that exist")
+	output := outputFlag(flags)
+	opts := stateFlags(flags)
+	flags.Parse(args)
+
+	if !*checkServiceAccounts && *directoryPath == "" {
+		return errors.New("nothing to check subjects against, missing -directory")
+	}
+
+	state, err := loadState(*source, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", *source, err)
+	}
+
+	var serviceAccounts map[rbac.SubjectKey]bool
+	if *checkServiceAccounts {
+		serviceAccounts, err = loadServiceAccounts(*source, opts)
+		if err != nil {
+			return fmt.Errorf("failed to load service accounts of %s: %w", *source, err)
+		}
+	}
+
+	var directory *subjects.Directory
+	if *directoryPath != "" {
+		directory, err = subjects.LoadDirectory(*directoryPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	report := subjects.Dangling(*state, serviceAccounts, directory)
+	return writeOutput(os.Stdout, *output, report, report.WriteText)
+}
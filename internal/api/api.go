@@ -1,37 +1,178 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
-	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/rbac/v1"
 
+	"github.com/geoah/go-kube-api/internal/audit"
+	"github.com/geoah/go-kube-api/internal/groups"
 	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+	"github.com/geoah/go-kube-api/internal/subjects"
+	"github.com/geoah/go-kube-api/internal/workloads"
 )
 
 var (
-	namespaceRegexp                   = regexp.MustCompile("^[0-9A-Za-z]+$")
-	roleBindingExactSubjectNameRegexp = regexp.MustCompile("^[0-9A-Za-z]+$")
+	namespaceRegexp = regexp.MustCompile("^[0-9A-Za-z]+$")
+	// errResolveGroups is returned when the groups of subjects could not be
+	// resolved
+	errResolveGroups = errors.New("could not resolve groups")
+	// errTooManySubjectNames is returned when a request has more subject
+	// names and patterns than allowed
+	errTooManySubjectNames = errors.New("too many subject names in request")
 )
 
 type (
 	// API provides the handlers for the echo HTTP server
 	API struct {
-		rbac rbac.Enumerator
+		rbac            rbac.Enumerator
+		snapshots       Snapshots
+		serviceAccounts ServiceAccounts
+		directory       *subjects.Directory
+		workloads       Workloads
+		groups          groups.Resolver
+		maxSubjectNames *int64
+		cache           *responseCache
+		auditChecks     []audit.Check
+	}
+	// Option configures optional features of the API
+	Option func(*API)
+	// Snapshots provides past RBAC states
+	Snapshots interface {
+		At(asOf time.Time) (*snapshot.Snapshot, error)
+	}
+	// ServiceAccounts lists the service accounts that currently exist
+	ServiceAccounts interface {
+		List() (map[rbac.SubjectKey]bool, error)
+	}
+	// Workloads retrieves pods and deployments and the service accounts they
+	// run as
+	Workloads interface {
+		Pods(namespace string) ([]workloads.Workload, error)
+		Pod(namespace, name string) (*workloads.Workload, error)
+		Deployment(namespace, name string) (*workloads.Workload, error)
 	}
 	// rbacEnumerateByBindingsRequest
 	rbacEnumerateByBindingsRequest struct {
 		Namespace    string   `json:"namespace" yaml:"namespace"`
 		SubjectNames []string `json:"subjectNames" yaml:"subjectNames"`
+		// Subjects are matched as their match type says, in addition to
+		// subject names
+		Subjects []rbac.Pattern `json:"subjects,omitempty" yaml:"subjects,omitempty"`
+		// bindingFilters narrow down the bindings matching the subjects
+		bindingFilters `json:",inline" yaml:",inline"`
+		// AsOf queries the latest snapshot taken at or before the given time
+		// instead of the live cluster
+		AsOf *time.Time `json:"asOf,omitempty" yaml:"asOf,omitempty"`
+		// ExpandGroups also matches bindings to the groups of subject names
+		// that are not regular expressions, and of exact subjects
+		ExpandGroups bool `json:"expandGroups,omitempty" yaml:"expandGroups,omitempty"`
+		// Limit is how many role bindings to return at most, all if zero
+		Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
+		// Continue is the token returned with the previous page, to get the
+		// role bindings after it
+		Continue string `json:"continue,omitempty" yaml:"continue,omitempty"`
+	}
+	// roleBindingMatch is a role binding matched by expanding groups, with
+	// the groups it was matched through
+	roleBindingMatch struct {
+		v1.RoleBinding `json:",inline" yaml:",inline"`
+		Via            []groupPath `json:"via,omitempty" yaml:"via,omitempty"`
+	}
+	// enumeration is a validated enumeration request with its filters
+	enumeration struct {
+		req            rbacEnumerateByBindingsRequest
+		subjectFilters []rbac.RoleBindingFilter
+		narrowing      []rbac.RoleBindingFilter
+		groupUsers     map[string][]string
+		after          *pageKey
+	}
+	// groupPath is a user's membership of a group
+	groupPath struct {
+		User  string `json:"user" yaml:"user"`
+		Group string `json:"group" yaml:"group"`
 	}
 )
 
-// New API given an RbacEnumerator
-func New(rbac rbac.Enumerator) (*API, error) {
-	return &API{
-		rbac: rbac,
-	}, nil
+// New API given an RbacEnumerator and any options
+func New(rbac rbac.Enumerator, options ...Option) (*API, error) {
+	api := &API{
+		rbac:            rbac,
+		groups:          groups.Builtin{},
+		maxSubjectNames: new(int64),
+		auditChecks:     audit.Checks,
+	}
+	for _, option := range options {
+		option(api)
+	}
+	return api, nil
+}
+
+// WithSnapshots allows requests to query past RBAC states using asOf
+func WithSnapshots(snapshots Snapshots) Option {
+	return func(api *API) {
+		api.snapshots = snapshots
+	}
+}
+
+// WithServiceAccounts allows checking bindings for service accounts that do
+// not exist
+func WithServiceAccounts(serviceAccounts ServiceAccounts) Option {
+	return func(api *API) {
+		api.serviceAccounts = serviceAccounts
+	}
+}
+
+// WithDirectory allows checking bindings for users and groups that are not
+// in the directory
+func WithDirectory(directory *subjects.Directory) Option {
+	return func(api *API) {
+		api.directory = directory
+	}
+}
+
+// WithWorkloads allows mapping pods and deployments to their permissions
+func WithWorkloads(workloads Workloads) Option {
+	return func(api *API) {
+		api.workloads = workloads
+	}
+}
+
+// WithGroups replaces the builtin group resolver used to expand groups, use
+// groups.Chain to keep the builtin groups
+func WithGroups(resolver groups.Resolver) Option {
+	return func(api *API) {
+		api.groups = resolver
+	}
+}
+
+// WithAuditChecks replaces the default checks audits run, use
+// audit.LoadRules to disable or add to them
+func WithAuditChecks(checks []audit.Check) Option {
+	return func(api *API) {
+		api.auditChecks = checks
+	}
+}
+
+// WithMaxSubjectNames limits how many subject names and patterns a request
+// can have, each of which is matched against every binding
+func WithMaxSubjectNames(max int) Option {
+	return func(api *API) {
+		api.SetMaxSubjectNames(max)
+	}
+}
+
+// SetMaxSubjectNames changes how many subject names and patterns a request
+// can have, zero for no limit
+func (api API) SetMaxSubjectNames(max int) {
+	atomic.StoreInt64(api.maxSubjectNames, int64(max))
 }
 
 // Health handles liveness and health requests by querying the rbac enumerator
@@ -46,6 +187,25 @@ func (api API) Health(c *gin.Context) {
 	c.String(http.StatusOK, "OK")
 }
 
+// RegisterRoutes registers the handlers of the API's endpoints, other than
+// the health check which is registered before any middleware limiting
+// callers
+func (api API) RegisterRoutes(router gin.IRoutes) {
+	router.POST("/v1/rbac/enumerateBySubjectNames", api.RbacEnummerateByBindings)
+	router.GET("/v1/namespaces/:namespace/rolebindings", api.RbacRoleBindings)
+	router.POST("/v1/rbac/batch", api.RbacBatch)
+	router.POST("/v1/rbac/watchBySubjectNames", api.RbacWatchBySubjectNames)
+	router.GET("/v1/rbac/watchBySubjectNames/ws", api.RbacWatchBySubjectNamesWebSocket)
+	router.POST("/v1/rbac/diff", api.RbacDiff)
+	router.POST("/v1/rbac/audit", api.RbacAudit)
+	router.POST("/v1/rbac/hygiene", api.RbacHygiene)
+	router.POST("/v1/rbac/danglingSubjects", api.RbacDanglingSubjects)
+	router.POST("/v1/rbac/graph", api.RbacGraph)
+	router.GET("/v1/rbac/matrix", api.RbacMatrix)
+	router.POST("/v1/rbac/workloadPermissions", api.RbacWorkloadPermissions)
+	router.POST("/v1/rbac/podsBySubject", api.RbacPodsBySubject)
+}
+
 // RbacEnummerateByBindings handles requests to enumerate role bindings filtered
 // by subject names
 func (api API) RbacEnummerateByBindings(c *gin.Context) {
@@ -56,47 +216,308 @@ func (api API) RbacEnummerateByBindings(c *gin.Context) {
 		return
 	}
 
-	// validate namespace
-	if req.Namespace == "" {
-		c.Render(http.StatusBadRequest, renderer(c, "missing namespace in request"))
+	api.enumerate(c, req, false)
+}
+
+// enumerate handles enumeration requests however they were constructed,
+// conditional requests are answered with not modified if the client already
+// has the same response
+func (api API) enumerate(c *gin.Context, req rbacEnumerateByBindingsRequest, conditional bool) {
+	// validate request and construct rbac filters
+	e, err := api.compile(req)
+	switch {
+	case errors.Is(err, errResolveGroups):
+		c.Render(http.StatusInternalServerError, renderer(c, err.Error()))
+		return
+	case err != nil:
+		c.Render(http.StatusBadRequest, renderer(c, err.Error()))
 		return
 	}
 
-	// validate subject names
-	if len(req.SubjectNames) == 0 {
-		c.Render(http.StatusBadRequest, renderer(c, "missing subject names in request"))
+	// serve repeated requests to the live cluster from the cache, unless the
+	// client asks for a fresh response
+	cacheKey := ""
+	if api.cache != nil && req.AsOf == nil {
+		cacheKey = req.cacheKey()
+		if !noCache(c) {
+			if entry, ok := api.cache.get(cacheKey); ok {
+				api.cache.setHeaders(c, entry, true)
+				if conditional && notModified(c, req, entry.resp, entry.continueToken) {
+					return
+				}
+				api.respond(c, entry.resp, entry.continueToken)
+				return
+			}
+		}
+	}
+
+	// use the live cluster or a snapshot
+	enumerator, ok := api.enumerator(c, req.AsOf)
+	if !ok {
 		return
 	}
 
-	// go through subject names and construct rbac filters
-	filters := make([]rbac.RoleBindingFilter, len(req.SubjectNames))
-	for i, subjectName := range req.SubjectNames {
-		// check if subject name is simple enough to be an exact match
-		if roleBindingExactSubjectNameRegexp.MatchString(subjectName) {
-			filters[i] = rbac.FilterBySubjectName(subjectName)
-			continue
-		}
-		// else we assume it's a regular expression which needs to be compiled
-		subjectNameRegexp, err := regexp.Compile(subjectName)
+	// permissions are resolved against the roles of the namespace and the
+	// cluster roles its bindings refer to, and the bindings are matched from
+	// the same state
+	var state *rbac.State
+	if len(req.Permissions) > 0 {
+		state, err = enumerator.NamespaceState(req.Namespace)
 		if err != nil {
-			c.Render(http.StatusBadRequest, renderer(c, "invalid regular expression or subject name"))
+			c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve rbac state"))
 			return
 		}
-		filters[i] = rbac.FilterBySubjectNameRegex(*subjectNameRegexp)
+		enumerator = rbac.NewStatic(*state)
 	}
 
 	// retrieve filtered role bindings
-	roleBindings, err := api.rbac.EnumberateByRoleBindings(req.Namespace, filters...)
+	roleBindings, err := enumerator.EnumberateByRoleBindings(req.Namespace, e.filters(state)...)
 	if err != nil {
 		c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve role bindings"))
 		return
 	}
 
-	// sort role bindings by role name
-	sort.Slice(roleBindings, func(i, j int) bool {
-		return roleBindings[i].RoleRef.Name < roleBindings[j].RoleRef.Name
-	})
+	// return response, caching it if enabled
+	resp, continueToken := e.response(roleBindings)
+	if cacheKey != "" {
+		entry := api.cache.set(cacheKey, resp, continueToken)
+		api.cache.setHeaders(c, entry, false)
+	}
+	if conditional && notModified(c, req, resp, continueToken) {
+		return
+	}
+	api.respond(c, resp, continueToken)
+}
+
+// respond renders the enumeration response, letting the client know where to
+// continue from if there are more role bindings
+func (api API) respond(c *gin.Context, resp interface{}, continueToken string) {
+	if continueToken != "" {
+		c.Header("X-Continue", continueToken)
+	}
+	c.Render(http.StatusOK, renderer(c, resp))
+}
+
+// compile validates the request and constructs its filters, expanding the
+// groups of its subjects if requested
+func (api API) compile(req rbacEnumerateByBindingsRequest) (*enumeration, error) {
+	if api.tooManySubjectNames(req.SubjectNames, req.Subjects) {
+		return nil, errTooManySubjectNames
+	}
+	subjectFilters, err := req.subjectFilters()
+	if err != nil {
+		return nil, err
+	}
+	narrowing, err := req.bindingFilters.filters()
+	if err != nil {
+		return nil, err
+	}
+
+	// validate pagination
+	if req.Limit < 0 {
+		return nil, errors.New("invalid limit in request")
+	}
+	var after *pageKey
+	if req.Continue != "" {
+		after, err = parseContinue(req.Continue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// match the groups of the subjects too
+	var groupUsers map[string][]string
+	if req.ExpandGroups {
+		groupUsers, err = api.groupUsers(req.exactNames())
+		if err != nil {
+			return nil, errResolveGroups
+		}
+		for group := range groupUsers {
+			subjectFilters = append(subjectFilters, rbac.FilterBySubject(v1.GroupKind, group))
+		}
+	}
+
+	return &enumeration{
+		req:            req,
+		subjectFilters: subjectFilters,
+		narrowing:      narrowing,
+		groupUsers:     groupUsers,
+		after:          after,
+	}, nil
+}
+
+// filters returns the enumeration's rbac filters, resolving permissions
+// against the state's roles, which is only needed if there are any
+func (e enumeration) filters(state *rbac.State) []rbac.RoleBindingFilter {
+	narrowing := e.narrowing
+	if state != nil {
+		narrowing = append(narrowing, e.req.permissionFilters(state)...)
+	}
+	return narrow(e.subjectFilters, narrowing)
+}
+
+// response sorts the matching role bindings by role name, returns the
+// requested page adding the groups they were matched through if requested,
+// and the token to continue from if there are more
+func (e enumeration) response(roleBindings []v1.RoleBinding) (interface{}, string) {
+	rbac.SortRoleBindings(roleBindings)
+	roleBindings, continueToken := page(roleBindings, e.after, e.req.Limit)
+	if e.req.ExpandGroups {
+		return withGroupPaths(roleBindings, e.groupUsers), continueToken
+	}
+	return roleBindings, continueToken
+}
+
+// groupUsers resolves the groups of the subject names, returns the users of
+// each group
+func (api API) groupUsers(subjectNames []string) (map[string][]string, error) {
+	groupUsers := map[string][]string{}
+	for _, subjectName := range subjectNames {
+		userGroups, err := api.groups.Groups(subjectName)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range userGroups {
+			groupUsers[group] = append(groupUsers[group], subjectName)
+		}
+	}
+	return groupUsers, nil
+}
+
+// withGroupPaths adds the groups each role binding was matched through
+func withGroupPaths(roleBindings []v1.RoleBinding, groupUsers map[string][]string) []roleBindingMatch {
+	matches := make([]roleBindingMatch, len(roleBindings))
+	for i, roleBinding := range roleBindings {
+		matches[i].RoleBinding = roleBinding
+		for _, subject := range roleBinding.Subjects {
+			if subject.Kind != v1.GroupKind {
+				continue
+			}
+			for _, user := range groupUsers[subject.Name] {
+				matches[i].Via = append(matches[i].Via, groupPath{
+					User:  user,
+					Group: subject.Name,
+				})
+			}
+		}
+	}
+	return matches
+}
+
+// enumerator returns the live enumerator, or if asOf is set one for the
+// latest snapshot at or before it, rendering an error response if it fails
+func (api API) enumerator(c *gin.Context, asOf *time.Time) (rbac.Enumerator, bool) {
+	if asOf == nil {
+		return api.rbac, true
+	}
+
+	s, ok := api.snapshot(c, *asOf)
+	if !ok {
+		return nil, false
+	}
+	return rbac.NewStatic(s.State), true
+}
+
+// snapshot returns the latest snapshot at or before asOf, rendering an error
+// response if it fails
+func (api API) snapshot(c *gin.Context, asOf time.Time) (*snapshot.Snapshot, bool) {
+	if api.snapshots == nil {
+		c.Render(http.StatusBadRequest, renderer(c, "snapshots are not enabled"))
+		return nil, false
+	}
+
+	s, err := api.snapshots.At(asOf)
+	switch {
+	case errors.Is(err, snapshot.ErrNotFound):
+		c.Render(http.StatusNotFound, renderer(c, "no snapshot found at or before asOf"))
+		return nil, false
+	case err != nil:
+		c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve snapshot"))
+		return nil, false
+	}
+
+	// let the client know how old the state actually is
+	c.Header("X-Snapshot-Timestamp", s.Timestamp.Format(time.RFC3339))
+	return s, true
+}
+
+// tooManySubjectNames checks if there are more subject names and patterns
+// than allowed, if limited
+func (api API) tooManySubjectNames(subjectNames []string, subjects []rbac.Pattern) bool {
+	max := atomic.LoadInt64(api.maxSubjectNames)
+	return max > 0 && int64(len(subjectNames)+len(subjects)) > max
+}
+
+// filters validates the request and constructs the rbac filters for its
+// subject names and other filters, for watching
+func (req rbacEnumerateByBindingsRequest) filters() ([]rbac.RoleBindingFilter, error) {
+	filters, err := req.subjectFilters()
+	if err != nil {
+		return nil, err
+	}
+	narrowing, err := req.bindingFilters.filters()
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Permissions) > 0 {
+		return nil, errPermissionsWatch
+	}
+	return narrow(filters, narrowing), nil
+}
+
+// subjectFilters validates the request and constructs the rbac filters for
+// its subject names
+func (req rbacEnumerateByBindingsRequest) subjectFilters() ([]rbac.RoleBindingFilter, error) {
+	// validate namespace
+	if req.Namespace == "" {
+		return nil, errors.New("missing namespace in request")
+	}
+
+	// validate subject names
+	if len(req.SubjectNames) == 0 && len(req.Subjects) == 0 && req.bindingFilters.empty() {
+		return nil, errors.New("missing subject names in request")
+	}
+
+	return subjectFilters(req.SubjectNames, req.Subjects)
+}
+
+// subjectFilters constructs the rbac filters for subject names and patterns,
+// describing which of them is invalid
+func subjectFilters(subjectNames []string, subjects []rbac.Pattern) ([]rbac.RoleBindingFilter, error) {
+	filters, err := rbac.FiltersBySubjectNames(subjectNames)
+	if err != nil {
+		return nil, invalidPattern("invalid regular expression or subject name", "subjectNames", err)
+	}
+	patternFilters, err := rbac.FiltersBySubjectPatterns(subjects)
+	if err != nil {
+		return nil, invalidPattern("invalid subject pattern or match type", "subjects", err)
+	}
+	return append(filters, patternFilters...), nil
+}
+
+// invalidPattern describes which of the patterns of the request field is
+// invalid and why, or returns the message if it isn't known which
+func invalidPattern(message, field string, err error) error {
+	patternErr := &rbac.PatternError{}
+	if !errors.As(err, &patternErr) {
+		return errors.New(message)
+	}
+	return fmt.Errorf("%s[%d]: %v", field, patternErr.Index, patternErr.Err)
+}
 
-	// return response
-	c.Render(http.StatusOK, renderer(c, roleBindings))
+// exactNames returns the subject names that are not regular expressions and
+// the patterns of exact subjects
+func (req rbacEnumerateByBindingsRequest) exactNames() []string {
+	names := []string{}
+	for _, subjectName := range req.SubjectNames {
+		if regexp.QuoteMeta(subjectName) == subjectName {
+			names = append(names, subjectName)
+		}
+	}
+	for _, subject := range req.Subjects {
+		if subject.IsExact() {
+			names = append(names, subject.Pattern)
+		}
+	}
+	return names
 }
@@ -6,8 +6,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
@@ -15,20 +17,34 @@ import (
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
 	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kfake "k8s.io/client-go/kubernetes/fake"
 
+	"github.com/geoah/go-kube-api/internal/groups"
 	"github.com/geoah/go-kube-api/internal/rbac"
 	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
 	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+	"github.com/geoah/go-kube-api/pkg/client"
 )
 
 const (
 	nsDefault = "default"
 )
 
+// snapshotsFunc implements Snapshots with a function
+type snapshotsFunc func(asOf time.Time) (*snapshot.Snapshot, error)
+
+func (f snapshotsFunc) At(asOf time.Time) (*snapshot.Snapshot, error) {
+	return f(asOf)
+}
+
 func TestAPI_RbacEnummerateByBindings(t *testing.T) {
 	type fields struct {
-		rbac func(t *testing.T) rbac.Enumerator
+		rbac            func(t *testing.T) rbac.Enumerator
+		snapshots       Snapshots
+		groups          groups.Resolver
+		maxSubjectNames int
 	}
 	type args struct {
 		requestBody    string
@@ -79,6 +95,314 @@ func TestAPI_RbacEnummerateByBindings(t *testing.T) {
 				assert.Equal(t, expResp, resp)
 			},
 		},
+		{
+			name: "expand groups, req/resp json, faked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					// role 2 is bound to subject 1's team, role 3 to everyone
+					roleBindingRole2Team1 := fixtures.RoleBindingRole2Subject2
+					roleBindingRole2Team1.Subjects = []v1.Subject{{Kind: v1.GroupKind, Name: "team1"}}
+					roleBindingRole3Authenticated := fixtures.RoleBindingRole3Subject3and4
+					roleBindingRole3Authenticated.Subjects = []v1.Subject{{Kind: v1.GroupKind, Name: "system:authenticated"}}
+
+					fakeClient := kfake.NewSimpleClientset()
+					fakeRbac := fakeClient.RbacV1()
+					_, err := fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&roleBindingRole2Team1)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&roleBindingRole3Authenticated)
+					require.NoError(t, err, "failed to create sample role binding")
+					fakeEnumerator, err := rbac.New(fakeRbac)
+					require.NoError(t, err)
+					return fakeEnumerator
+				},
+				groups: groups.Chain(groups.Builtin{}, &groups.Static{
+					Members: map[string][]string{
+						"team1": {"subject1"},
+						"team2": {"subject2"},
+					},
+				}),
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"expandGroups":true}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := []roleBindingMatch{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp, 3)
+				assert.Equal(t, fixtures.RoleBindingRole1Subject1, resp[0].RoleBinding)
+				assert.Empty(t, resp[0].Via)
+				assert.Equal(t, "role2-for-subject2", resp[1].Name)
+				assert.Equal(t, []groupPath{{User: "subject1", Group: "team1"}}, resp[1].Via)
+				assert.Equal(t, "role3-for-subject3and4", resp[2].Name)
+				assert.Equal(t, []groupPath{{User: "subject1", Group: "system:authenticated"}}, resp[2].Via)
+			},
+		},
+		{
+			name: "filter by subject patterns, req/resp json, faked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					fakeClient := kfake.NewSimpleClientset()
+					fakeRbac := fakeClient.RbacV1()
+					_, err := fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole2Subject2)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole3Subject3and4)
+					require.NoError(t, err, "failed to create sample role binding")
+					fakeEnumerator, err := rbac.New(fakeRbac)
+					require.NoError(t, err)
+					return fakeEnumerator
+				},
+			},
+			args: args{
+				// the regex is anchored, so it does not match subject1
+				requestBody: `{"namespace":"default","subjects":[{"pattern":"subject?","matchType":"glob"},{"pattern":"ubject1","matchType":"regex"}]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				expResp := []v1.RoleBinding{
+					fixtures.RoleBindingRole1Subject1,
+					fixtures.RoleBindingRole2Subject2,
+					fixtures.RoleBindingRole3Subject3and4,
+				}
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, expResp, resp)
+			},
+		},
+		{
+			name: "filter by subject names and expression, req/resp json, faked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					fakeClient := kfake.NewSimpleClientset()
+					fakeRbac := fakeClient.RbacV1()
+					_, err := fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole2Subject2)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole3Subject3and4)
+					require.NoError(t, err, "failed to create sample role binding")
+					fakeEnumerator, err := rbac.New(fakeRbac)
+					require.NoError(t, err)
+					return fakeEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1","subject2"],"expression":"binding.roleRef.name != \"role1\""}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				expResp := []v1.RoleBinding{
+					fixtures.RoleBindingRole2Subject2,
+				}
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, expResp, resp)
+			},
+		},
+		{
+			name: "filter by invalid expression, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","expression":"binding.subject.size() > 0"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "undefined field 'subject'")
+			},
+		},
+		{
+			name: "filter by role ref and labels only, req/resp json, faked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					// only role 3's binding is labeled
+					roleBindingRole3Labeled := fixtures.RoleBindingRole3Subject3and4
+					roleBindingRole3Labeled.Labels = map[string]string{"team": "a"}
+					roleBindingRole2Labeled := fixtures.RoleBindingRole2Subject2
+					roleBindingRole2Labeled.Labels = map[string]string{"team": "b"}
+
+					fakeClient := kfake.NewSimpleClientset()
+					fakeRbac := fakeClient.RbacV1()
+					_, err := fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&roleBindingRole2Labeled)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&roleBindingRole3Labeled)
+					require.NoError(t, err, "failed to create sample role binding")
+					fakeEnumerator, err := rbac.New(fakeRbac)
+					require.NoError(t, err)
+					return fakeEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","roleRef":{"kind":"Role","name":"role[23]","matchType":"regex"},"labelSelector":"team=a"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp, 1)
+				assert.Equal(t, "role3-for-subject3and4", resp[0].Name)
+			},
+		},
+		{
+			name: "filter by invalid label selector, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"labelSelector":"team in a"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid labelSelector in request")
+			},
+		},
+		{
+			name: "filter by invalid created within, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"createdWithin":"a day"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid createdWithin in request")
+			},
+		},
+		{
+			name: "filter by permissions, req/resp json, faked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					fakeClient := kfake.NewSimpleClientset()
+					fakeRbac := fakeClient.RbacV1()
+					_, err := fakeRbac.Roles(nsDefault).Create(&v1.Role{
+						ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: nsDefault},
+						Rules: []v1.PolicyRule{{
+							APIGroups: []string{"apps"},
+							Resources: []string{"deployments"},
+							Verbs:     []string{"*"},
+						}},
+					})
+					require.NoError(t, err, "failed to create sample role")
+					_, err = fakeRbac.Roles(nsDefault).Create(&v1.Role{
+						ObjectMeta: metav1.ObjectMeta{Name: "role2", Namespace: nsDefault},
+						Rules: []v1.PolicyRule{{
+							APIGroups: []string{"apps"},
+							Resources: []string{"deployments"},
+							Verbs:     []string{"get"},
+						}},
+					})
+					require.NoError(t, err, "failed to create sample role")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+					require.NoError(t, err, "failed to create sample role binding")
+					_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole2Subject2)
+					require.NoError(t, err, "failed to create sample role binding")
+					fakeEnumerator, err := rbac.New(fakeRbac)
+					require.NoError(t, err)
+					return fakeEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","permissions":[{"verb":"delete","apiGroup":"apps","resource":"deployments"}]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				expResp := []v1.RoleBinding{
+					fixtures.RoleBindingRole1Subject1,
+				}
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, expResp, resp)
+			},
+		},
+		{
+			name: "filter by permissions without verb, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","permissions":[{"resource":"deployments"}]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "missing verb in request permissions")
+			},
+		},
+		{
+			name: "filter by invalid match type, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjects":[{"pattern":"subject1","matchType":"fuzzy"}]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), `subjects[0]: invalid match type \"fuzzy\"`)
+			},
+		},
 		{
 			name: "filter by both exact and regexp, req/resp json, mocked rbac, success",
 			fields: fields{
@@ -173,6 +497,87 @@ func TestAPI_RbacEnummerateByBindings(t *testing.T) {
 				assert.Equal(t, resp[2].RoleRef.Name, "role3")
 			},
 		},
+		{
+			name: "filter by both exact and regexp as of snapshot, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+				snapshots: snapshotsFunc(func(asOf time.Time) (*snapshot.Snapshot, error) {
+					assert.Equal(t, time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC), asOf)
+					return &snapshot.Snapshot{
+						Timestamp: time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC),
+						State: rbac.State{
+							RoleBindings: []v1.RoleBinding{
+								fixtures.RoleBindingRole3Subject3and4,
+								fixtures.RoleBindingRole2Subject2,
+								fixtures.RoleBindingRole1Subject1,
+							},
+						},
+					}, nil
+				}),
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1","subject[3,4]"],"asOf":"2020-03-03T12:00:00Z"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "2020-03-03T00:00:00Z", rr.Header().Get("X-Snapshot-Timestamp"))
+				expResp := []v1.RoleBinding{
+					fixtures.RoleBindingRole1Subject1,
+					fixtures.RoleBindingRole3Subject3and4,
+				}
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, expResp, resp)
+			},
+		},
+		{
+			name: "as of missing snapshot, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+				snapshots: snapshotsFunc(func(asOf time.Time) (*snapshot.Snapshot, error) {
+					return nil, snapshot.ErrNotFound
+				}),
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"asOf":"2020-03-03T12:00:00Z"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "no snapshot found")
+			},
+		},
+		{
+			name: "as of without snapshots enabled, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"asOf":"2020-03-03T12:00:00Z"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "snapshots are not enabled")
+			},
+		},
 		{
 			name: "filter by regexp, rbac error, failure",
 			fields: fields{
@@ -214,7 +619,7 @@ func TestAPI_RbacEnummerateByBindings(t *testing.T) {
 			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				assert.Equal(t, http.StatusBadRequest, rr.Code)
 				respBody, _ := ioutil.ReadAll(rr.Body)
-				assert.Contains(t, string(respBody), "invalid regular expression")
+				assert.Contains(t, string(respBody), `"subjectNames[0]: invalid regular expression or subject name \"[[\": `)
 			},
 		},
 		{
@@ -274,11 +679,57 @@ func TestAPI_RbacEnummerateByBindings(t *testing.T) {
 				assert.Contains(t, string(respBody), "missing subject names")
 			},
 		},
+		{
+			name: "invalid regexp points at the pattern, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"subjects":[{"pattern":"subject2"},{"pattern":"(a","matchType":"regex"}]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), `"subjects[1]: invalid regular expression \"(a\": `)
+			},
+		},
+		{
+			name: "too many subject names, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+				maxSubjectNames: 2,
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1","subject2"],"subjects":[{"pattern":"subject3"}]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "too many subject names")
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rbacMock := tt.fields.rbac(t)
-			api, err := New(rbacMock)
+			options := []Option{
+				WithSnapshots(tt.fields.snapshots),
+				WithMaxSubjectNames(tt.fields.maxSubjectNames),
+			}
+			if tt.fields.groups != nil {
+				options = append(options, WithGroups(tt.fields.groups))
+			}
+			api, err := New(rbacMock, options...)
 			require.NoError(t, err, "failed to create new api")
 
 			r := gin.Default()
@@ -353,3 +804,127 @@ func TestAPI_Health(t *testing.T) {
 		})
 	}
 }
+
+func TestClientTypes(t *testing.T) {
+	// populate sets every field of v to a non-zero value, so that fields
+	// missing from either side of a pair of types are noticed. Role bindings
+	// are the same type on both sides and interfaces are left to the caller.
+	var populate func(v reflect.Value)
+	populate = func(v reflect.Value) {
+		switch {
+		case v.Type() == reflect.TypeOf(v1.RoleBinding{}):
+			v.Set(reflect.ValueOf(fixtures.RoleBindingRole1Subject1))
+			return
+		case v.Type() == reflect.TypeOf(time.Time{}):
+			v.Set(reflect.ValueOf(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)))
+			return
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Field(i).CanSet() || v.Type().Field(i).Anonymous {
+					populate(v.Field(i))
+				}
+			}
+		case reflect.Ptr:
+			v.Set(reflect.New(v.Type().Elem()))
+			populate(v.Elem())
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+			populate(v.Index(0))
+		case reflect.Map:
+			v.Set(reflect.MakeMap(v.Type()))
+			key := reflect.New(v.Type().Key()).Elem()
+			value := reflect.New(v.Type().Elem()).Elem()
+			populate(key)
+			populate(value)
+			v.SetMapIndex(key, value)
+		case reflect.String:
+			v.SetString("value")
+		case reflect.Bool:
+			v.SetBool(true)
+		case reflect.Int, reflect.Int64:
+			v.SetInt(1)
+		}
+	}
+	populated := func(v interface{}) interface{} {
+		populate(reflect.ValueOf(v).Elem())
+		return v
+	}
+	// batch results' role bindings are an interface on the server
+	populatedBatchResponse := func(v interface{}) interface{} {
+		populated(v)
+		roleBindings := reflect.ValueOf(v).Elem().FieldByName("Results").Index(0).FieldByName("RoleBindings")
+		if roleBindings.Kind() == reflect.Interface {
+			roleBindings.Set(reflect.ValueOf(populated(&[]roleBindingMatch{})).Elem())
+		}
+		return v
+	}
+	tests := []struct {
+		name     string
+		server   interface{}
+		client   interface{}
+		populate func(v interface{}) interface{}
+		yaml     bool
+	}{
+		{
+			name:     "enumerate request",
+			server:   &rbacEnumerateByBindingsRequest{},
+			client:   &client.EnumerateRequest{},
+			populate: populated,
+			yaml:     true,
+		},
+		{
+			name:     "batch request",
+			server:   &rbacBatchRequest{},
+			client:   &client.BatchRequest{},
+			populate: populated,
+			yaml:     true,
+		},
+		{
+			name:     "role binding match",
+			server:   &roleBindingMatch{},
+			client:   &client.RoleBindingMatch{},
+			populate: populated,
+		},
+		{
+			name:     "batch response",
+			server:   &rbacBatchResponse{},
+			client:   &client.BatchResponse{},
+			populate: populatedBatchResponse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// server types encode into client types and back, and the other
+			// way around, without unknown or lost fields
+			for _, pair := range []struct {
+				from interface{}
+				to   interface{}
+			}{
+				{tt.populate(tt.server), reflect.New(reflect.TypeOf(tt.client).Elem()).Interface()},
+				{tt.populate(reflect.New(reflect.TypeOf(tt.client).Elem()).Interface()), reflect.New(reflect.TypeOf(tt.server).Elem()).Interface()},
+			} {
+				b, err := json.Marshal(pair.from)
+				require.NoError(t, err)
+				decoder := json.NewDecoder(strings.NewReader(string(b)))
+				decoder.DisallowUnknownFields()
+				require.NoError(t, decoder.Decode(pair.to), "unknown field decoding %T into %T", pair.from, pair.to)
+				roundTrip, err := json.Marshal(pair.to)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(b), string(roundTrip), "fields lost decoding %T into %T", pair.from, pair.to)
+
+				if !tt.yaml {
+					continue
+				}
+				b, err = yaml.Marshal(pair.from)
+				require.NoError(t, err)
+				to := reflect.New(reflect.TypeOf(pair.to).Elem()).Interface()
+				require.NoError(t, yaml.UnmarshalStrict(b, to), "unknown field decoding %T into %T", pair.from, pair.to)
+				roundTrip, err = yaml.Marshal(to)
+				require.NoError(t, err)
+				assert.Equal(t, string(b), string(roundTrip), "fields lost decoding %T into %T", pair.from, pair.to)
+			}
+		})
+	}
+}
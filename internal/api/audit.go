@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geoah/go-kube-api/internal/audit"
+)
+
+type (
+	// rbacAuditRequest
+	rbacAuditRequest struct {
+		stateSource `json:",inline" yaml:",inline"`
+		Namespace   string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		MinSeverity string `json:"minSeverity,omitempty" yaml:"minSeverity,omitempty"`
+	}
+)
+
+// RbacAudit handles requests to audit roles and cluster roles for dangerous
+// grants
+func (api API) RbacAudit(c *gin.Context) {
+	// construct request
+	req := rbacAuditRequest{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// validate request
+	minSeverity, err := audit.ParseSeverity(req.MinSeverity)
+	if err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "invalid minSeverity in request"))
+		return
+	}
+
+	// load state
+	state, ok := api.state(c, req.stateSource)
+	if !ok {
+		return
+	}
+
+	report := audit.RunChecks(*state, audit.Options{
+		Namespace:   req.Namespace,
+		MinSeverity: minSeverity,
+	}, api.auditChecks)
+
+	// return response
+	c.Render(http.StatusOK, renderer(c, report))
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/audit"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+const (
+	// manifestsSecretsReader allows reading secrets in the default namespace
+	manifestsSecretsReader = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: role1
+rules:
+- apiGroups: [""]
+  resources: ["secrets"]
+  verbs: ["get"]
+`
+)
+
+func TestAPI_RbacAudit(t *testing.T) {
+	type fields struct {
+		rbac    func(t *testing.T) rbac.Enumerator
+		options []Option
+	}
+	type args struct {
+		requestBody    string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "live, json, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(&rbac.State{
+						ClusterRoles: []v1.ClusterRole{
+							{
+								ObjectMeta: metav1.ObjectMeta{Name: "clusterrole1"},
+								Rules: []v1.PolicyRule{{
+									APIGroups: []string{"*"},
+									Resources: []string{"*"},
+									Verbs:     []string{"*"},
+								}},
+							},
+						},
+						ClusterRoleBindings: []v1.ClusterRoleBinding{
+							fixtures.ClusterRoleBindingClusterRole1Subject1,
+						},
+					}, nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"minSeverity":"critical"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := audit.Report{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.NotEmpty(t, resp.Findings)
+				for _, finding := range resp.Findings {
+					assert.Equal(t, audit.SeverityCritical, finding.Severity)
+					assert.Equal(t, "clusterrole1", finding.Role.Name)
+					assert.Equal(t, []rbac.SubjectKey{{Kind: "User", Name: "subject1"}}, finding.Subjects)
+				}
+				assert.Equal(t, len(resp.Findings), resp.Summary[audit.SeverityCritical])
+			},
+		},
+		{
+			name: "manifests, json, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: func() string {
+					b, _ := json.Marshal(map[string]string{
+						"manifests": manifestsRole1Subject1 + "---" + manifestsSecretsReader,
+					})
+					return string(b)
+				}(),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := audit.Report{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp.Findings, 1)
+				assert.Equal(t, "secrets-read", resp.Findings[0].Check)
+				assert.Equal(t, []audit.Path{{
+					Subject: rbac.SubjectKey{Kind: "User", Name: "subject1"},
+					Binding: rbac.Key{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-subject1"},
+					Role:    rbac.Key{Kind: rbac.KindRole, Namespace: "default", Name: "role1"},
+				}}, resp.Findings[0].Paths)
+			},
+		},
+		{
+			name: "manifests, configured checks, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+				options: []Option{WithAuditChecks([]audit.Check{{
+					ID:       "secrets-get",
+					Severity: audit.SeverityMedium,
+					Matches: func(rule v1.PolicyRule) bool {
+						return rbac.RuleAllows(rule, rbac.Attributes{Verb: "get", Resource: "secrets"})
+					},
+				}})},
+			},
+			args: args{
+				requestBody: func() string {
+					b, _ := json.Marshal(map[string]string{
+						"manifests": manifestsRole1Subject1 + "---" + manifestsSecretsReader,
+					})
+					return string(b)
+				}(),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := audit.Report{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp.Findings, 1)
+				assert.Equal(t, "secrets-get", resp.Findings[0].Check)
+				assert.Equal(t, audit.SeverityMedium, resp.Findings[0].Severity)
+			},
+		},
+		{
+			name: "invalid severity, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"minSeverity":"urgent"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid minSeverity in request")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock, tt.fields.options...)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacAudit)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
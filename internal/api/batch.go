@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// maxBatchQueries is the most queries a batch request can have
+	maxBatchQueries = 1000
+	// batchParallelism is how many lists or queries of a batch request run
+	// at the same time
+	batchParallelism = 8
+)
+
+type (
+	// rbacBatchRequest
+	rbacBatchRequest struct {
+		// AsOf queries the latest snapshot taken at or before the given time
+		// instead of the live cluster, for all queries
+		AsOf *time.Time `json:"asOf,omitempty" yaml:"asOf,omitempty"`
+		// Queries are enumeration requests, without asOf
+		Queries []rbacEnumerateByBindingsRequest `json:"queries" yaml:"queries"`
+	}
+	// rbacBatchResponse has a result for each query, in the same order
+	rbacBatchResponse struct {
+		Results []batchResult `json:"results" yaml:"results"`
+	}
+	// batchResult is either the role bindings a query matched, with the
+	// token to continue from if there are more, or the error it failed with
+	batchResult struct {
+		RoleBindings interface{} `json:"roleBindings,omitempty" yaml:"roleBindings,omitempty"`
+		Continue     string      `json:"continue,omitempty" yaml:"continue,omitempty"`
+		Error        string      `json:"error,omitempty" yaml:"error,omitempty"`
+	}
+	// namespaceRoleBindings are the role bindings of a namespace, along with
+	// the roles they refer to if any of its queries has permissions, or the
+	// error listing them failed with
+	namespaceRoleBindings struct {
+		needsState   bool
+		roleBindings []v1.RoleBinding
+		state        *rbac.State
+		err          error
+	}
+)
+
+// RbacBatch handles requests to run many enumeration queries at once.
+// Role bindings are only listed once per namespace, along with the roles they
+// refer to for queries with permissions, and the queries are then matched
+// against them, with bounded parallelism. Queries that fail don't
+// fail the whole request, their results have an error instead.
+func (api API) RbacBatch(c *gin.Context) {
+	// construct request
+	req := rbacBatchRequest{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// validate request
+	if len(req.Queries) == 0 {
+		c.Render(http.StatusBadRequest, renderer(c, "missing queries in request"))
+		return
+	}
+	if len(req.Queries) > maxBatchQueries {
+		c.Render(http.StatusBadRequest, renderer(c, "too many queries in request"))
+		return
+	}
+
+	// validate queries and construct their filters
+	results := make([]batchResult, len(req.Queries))
+	enumerations := make([]*enumeration, len(req.Queries))
+	namespaces := map[string]*namespaceRoleBindings{}
+	for i, query := range req.Queries {
+		if query.AsOf != nil {
+			results[i].Error = "asOf is only supported for the whole batch"
+			continue
+		}
+		e, err := api.compile(query)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		enumerations[i] = e
+		list, ok := namespaces[query.Namespace]
+		if !ok {
+			list = &namespaceRoleBindings{}
+			namespaces[query.Namespace] = list
+		}
+		list.needsState = list.needsState || len(query.Permissions) > 0
+	}
+
+	// use the live cluster or a snapshot
+	enumerator, ok := api.enumerator(c, req.AsOf)
+	if !ok {
+		return
+	}
+
+	// list each queried namespace once, namespaces with queries with
+	// permissions need the roles and cluster roles their bindings refer to
+	// as well
+	names := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		names = append(names, namespace)
+	}
+	parallel(len(names), func(i int) {
+		list := namespaces[names[i]]
+		if list.needsState {
+			list.state, list.err = enumerator.NamespaceState(names[i])
+			if list.err == nil {
+				list.roleBindings = list.state.RoleBindings
+			}
+			return
+		}
+		// all filters matching means no filters
+		list.roleBindings, list.err = enumerator.EnumberateByRoleBindings(names[i], rbac.FilterAll())
+	})
+
+	// match the queries
+	parallel(len(enumerations), func(i int) {
+		e := enumerations[i]
+		if e == nil {
+			return
+		}
+		list := namespaces[e.req.Namespace]
+		if list.err != nil {
+			results[i].Error = "could not retrieve role bindings"
+			return
+		}
+		queryEnumerator := rbac.NewStatic(rbac.State{RoleBindings: list.roleBindings})
+		roleBindings, err := queryEnumerator.EnumberateByRoleBindings(e.req.Namespace, e.filters(list.state)...)
+		if err != nil {
+			results[i].Error = "could not retrieve role bindings"
+			return
+		}
+		results[i].RoleBindings, results[i].Continue = e.response(roleBindings)
+	})
+
+	// return response
+	c.Render(http.StatusOK, renderer(c, rbacBatchResponse{
+		Results: results,
+	}))
+}
+
+// parallel calls f with every index up to n, running at most
+// batchParallelism calls at the same time
+func parallel(n int, f func(i int)) {
+	semaphore := make(chan struct{}, batchParallelism)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+func TestAPI_RbacBatch(t *testing.T) {
+	// batchResultResponse is a batch result with its role bindings decoded
+	type batchResultResponse struct {
+		RoleBindings []v1.RoleBinding `json:"roleBindings"`
+		Error        string           `json:"error"`
+	}
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		requestBody    string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "queries in two namespaces, lists each once, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().EnumberateByRoleBindings(nsDefault, gomock.Any()).DoAndReturn(
+						func(namespace string, filters ...rbac.RoleBindingFilter) ([]v1.RoleBinding, error) {
+							return rbac.NewStatic(rbac.State{
+								RoleBindings: []v1.RoleBinding{
+									fixtures.RoleBindingRole1Subject1,
+									fixtures.RoleBindingRole2Subject2,
+									fixtures.RoleBindingRole3Subject3and4,
+								},
+							}).EnumberateByRoleBindings(namespace, filters...)
+						},
+					).Times(1)
+					mockEnumerator.EXPECT().EnumberateByRoleBindings("other", gomock.Any()).Return(nil, errors.New("some error")).Times(1)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"queries":[
+					{"namespace":"default","subjectNames":["subject1"]},
+					{"namespace":"default","subjects":[{"pattern":"subject","matchType":"prefix"}],"roleRef":{"name":"role1"}},
+					{"namespace":"default"},
+					{"namespace":"other","subjectNames":["subject1"]}
+				]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := struct {
+					Results []batchResultResponse `json:"results"`
+				}{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp.Results, 4)
+				assert.Equal(t, batchResultResponse{
+					RoleBindings: []v1.RoleBinding{fixtures.RoleBindingRole1Subject1},
+				}, resp.Results[0])
+				assert.Equal(t, batchResultResponse{
+					RoleBindings: []v1.RoleBinding{fixtures.RoleBindingRole1Subject1},
+				}, resp.Results[1])
+				assert.Equal(t, batchResultResponse{
+					Error: "missing subject names in request",
+				}, resp.Results[2])
+				assert.Equal(t, batchResultResponse{
+					Error: "could not retrieve role bindings",
+				}, resp.Results[3])
+			},
+		},
+		{
+			name: "queries with permissions, retrieves their namespace's state once, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().NamespaceState(nsDefault).Return(&rbac.State{
+						Roles: []v1.Role{{
+							ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: nsDefault},
+							Rules: []v1.PolicyRule{{
+								APIGroups: []string{""},
+								Resources: []string{"pods"},
+								Verbs:     []string{"get"},
+							}},
+						}},
+						RoleBindings: []v1.RoleBinding{
+							fixtures.RoleBindingRole1Subject1,
+							fixtures.RoleBindingRole2Subject2,
+						},
+					}, nil).Times(1)
+					// namespaces without queries with permissions are only listed
+					mockEnumerator.EXPECT().EnumberateByRoleBindings("other", gomock.Any()).Return([]v1.RoleBinding{}, nil).Times(1)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"queries":[
+					{"namespace":"default","subjectNames":["subject1","subject2"],"permissions":[{"verb":"get","resource":"pods"}]},
+					{"namespace":"default","subjectNames":["subject2"]},
+					{"namespace":"other","subjectNames":["subject2"]}
+				]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := struct {
+					Results []batchResultResponse `json:"results"`
+				}{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp.Results, 3)
+				assert.Equal(t, []v1.RoleBinding{fixtures.RoleBindingRole1Subject1}, resp.Results[0].RoleBindings)
+				assert.Equal(t, []v1.RoleBinding{fixtures.RoleBindingRole2Subject2}, resp.Results[1].RoleBindings)
+				assert.Empty(t, resp.Results[2].RoleBindings)
+				assert.Empty(t, resp.Results[2].Error)
+			},
+		},
+		{
+			name: "missing queries, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"queries":[]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "missing queries in request")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacBatch)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
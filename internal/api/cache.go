@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+var (
+	// cacheMetrics counts the enumeration responses served from the cache,
+	// the ones that weren't, and the ones evicted to make room
+	cacheMetrics = expvar.NewMap("api_response_cache")
+)
+
+type (
+	// responseCache keeps enumeration responses for a short time, for
+	// clients repeating the same requests
+	responseCache struct {
+		ttl        time.Duration
+		maxEntries int
+		now        func() time.Time
+		mutex      sync.Mutex
+		entries    map[string]cachedResponse
+	}
+	// cachedResponse is an enumeration response and when it expires
+	cachedResponse struct {
+		resp          interface{}
+		continueToken string
+		expires       time.Time
+	}
+)
+
+// WithResponseCache keeps the responses of enumeration requests to the live
+// cluster for the ttl, up to the given number of responses, so that
+// repeated requests don't list role bindings again
+func WithResponseCache(ttl time.Duration, maxEntries int) Option {
+	return func(api *API) {
+		api.cache = &responseCache{
+			ttl:        ttl,
+			maxEntries: maxEntries,
+			now:        time.Now,
+			entries:    map[string]cachedResponse{},
+		}
+	}
+}
+
+// get returns the cached response for the key, if it hasn't expired
+func (rc *responseCache) get(key string) (cachedResponse, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	entry, ok := rc.entries[key]
+	if !ok || !rc.now().Before(entry.expires) {
+		cacheMetrics.Add("misses", 1)
+		return cachedResponse{}, false
+	}
+	cacheMetrics.Add("hits", 1)
+	return entry, true
+}
+
+// set caches the response for the key, evicting expired responses, or the
+// one expiring the soonest, if the cache is full
+func (rc *responseCache) set(key string, resp interface{}, continueToken string) cachedResponse {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	now := rc.now()
+	if _, ok := rc.entries[key]; !ok && len(rc.entries) >= rc.maxEntries {
+		rc.evict(now)
+	}
+	entry := cachedResponse{
+		resp:          resp,
+		continueToken: continueToken,
+		expires:       now.Add(rc.ttl),
+	}
+	rc.entries[key] = entry
+	return entry
+}
+
+// evict removes expired responses, or the one expiring the soonest if none
+// have expired
+func (rc *responseCache) evict(now time.Time) {
+	soonest := ""
+	for key, entry := range rc.entries {
+		if !now.Before(entry.expires) {
+			delete(rc.entries, key)
+			continue
+		}
+		if soonest == "" || entry.expires.Before(rc.entries[soonest].expires) {
+			soonest = key
+		}
+	}
+	if len(rc.entries) >= rc.maxEntries && soonest != "" {
+		delete(rc.entries, soonest)
+		cacheMetrics.Add("evictions", 1)
+	}
+}
+
+// setHeaders lets the client know whether the response came from the cache
+// and how long it can keep it for
+func (rc *responseCache) setHeaders(c *gin.Context, entry cachedResponse, hit bool) {
+	maxAge := int(entry.expires.Sub(rc.now()).Seconds())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+	if hit {
+		c.Header("X-Cache", "hit")
+	} else {
+		c.Header("X-Cache", "miss")
+	}
+}
+
+// noCache checks if the client asked for a fresh response
+func noCache(c *gin.Context) bool {
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		directive = strings.TrimSpace(strings.ToLower(directive))
+		if directive == "no-cache" || directive == "no-store" {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey returns the request with its subjects and permissions sorted, so
+// that requests for the same role bindings share a key
+func (req rbacEnumerateByBindingsRequest) cacheKey() string {
+	subjectNames := append([]string{}, req.SubjectNames...)
+	sort.Strings(subjectNames)
+	req.SubjectNames = subjectNames
+
+	subjects := make([]rbac.Pattern, len(req.Subjects))
+	for i, subject := range req.Subjects {
+		if subject.IsExact() {
+			subject.MatchType = rbac.MatchExact
+		}
+		subjects[i] = subject
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].MatchType != subjects[j].MatchType {
+			return subjects[i].MatchType < subjects[j].MatchType
+		}
+		return subjects[i].Pattern < subjects[j].Pattern
+	})
+	req.Subjects = subjects
+
+	permissions := append([]rbac.Attributes{}, req.Permissions...)
+	sort.Slice(permissions, func(i, j int) bool {
+		return fmt.Sprint(permissions[i]) < fmt.Sprint(permissions[j])
+	})
+	req.Permissions = permissions
+
+	b, _ := json.Marshal(req)
+	return string(b)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+func TestAPI_RbacEnummerateByBindings_cache(t *testing.T) {
+	type request struct {
+		after            time.Duration
+		body             string
+		cacheControl     string
+		wantCache        string
+		wantCacheControl string
+	}
+	tests := []struct {
+		name       string
+		maxEntries int
+		wantLists  int
+		requests   []request
+	}{
+		{
+			name:       "same subjects in another order, hit",
+			maxEntries: 10,
+			wantLists:  1,
+			requests: []request{
+				{
+					body:             `{"namespace":"default","subjectNames":["subject1","subject2"],"subjects":[{"pattern":"subject3"}]}`,
+					wantCache:        "miss",
+					wantCacheControl: "private, max-age=10",
+				},
+				{
+					after:            4 * time.Second,
+					body:             `{"namespace":"default","subjectNames":["subject2","subject1"],"subjects":[{"pattern":"subject3","matchType":"exact"}]}`,
+					wantCache:        "hit",
+					wantCacheControl: "private, max-age=6",
+				},
+			},
+		},
+		{
+			name:       "expired, miss",
+			maxEntries: 10,
+			wantLists:  2,
+			requests: []request{
+				{body: `{"namespace":"default","subjectNames":["subject1"]}`, wantCache: "miss", wantCacheControl: "private, max-age=10"},
+				{after: 10 * time.Second, body: `{"namespace":"default","subjectNames":["subject1"]}`, wantCache: "miss", wantCacheControl: "private, max-age=10"},
+			},
+		},
+		{
+			name:       "no-cache, miss",
+			maxEntries: 10,
+			wantLists:  2,
+			requests: []request{
+				{body: `{"namespace":"default","subjectNames":["subject1"]}`, wantCache: "miss", wantCacheControl: "private, max-age=10"},
+				{body: `{"namespace":"default","subjectNames":["subject1"]}`, cacheControl: "no-cache", wantCache: "miss", wantCacheControl: "private, max-age=10"},
+				{body: `{"namespace":"default","subjectNames":["subject1"]}`, wantCache: "hit", wantCacheControl: "private, max-age=10"},
+			},
+		},
+		{
+			name:       "evicted, miss",
+			maxEntries: 1,
+			wantLists:  3,
+			requests: []request{
+				{body: `{"namespace":"default","subjectNames":["subject1"]}`, wantCache: "miss", wantCacheControl: "private, max-age=10"},
+				{body: `{"namespace":"default","subjectNames":["subject2"]}`, wantCache: "miss", wantCacheControl: "private, max-age=10"},
+				{body: `{"namespace":"default","subjectNames":["subject1"]}`, wantCache: "miss", wantCacheControl: "private, max-age=10"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+			mockEnumerator.EXPECT().EnumberateByRoleBindings(
+				nsDefault,
+				gomock.Any(),
+			).Return([]v1.RoleBinding{
+				fixtures.RoleBindingRole1Subject1,
+			}, nil).Times(tt.wantLists)
+
+			api, err := New(mockEnumerator, WithResponseCache(10*time.Second, tt.maxEntries))
+			require.NoError(t, err, "failed to create new api")
+			now := time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC)
+			api.cache.now = func() time.Time {
+				return now
+			}
+
+			r := gin.Default()
+			r.POST("/", api.RbacEnummerateByBindings)
+
+			for i, request := range tt.requests {
+				now = now.Add(request.after)
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("POST", "/", strings.NewReader(request.body))
+				req.Header.Set("Content-Type", "application/json")
+				if request.cacheControl != "" {
+					req.Header.Set("Cache-Control", request.cacheControl)
+				}
+				r.ServeHTTP(w, req)
+				assert.Equal(t, http.StatusOK, w.Code, "request %d", i)
+				assert.Equal(t, request.wantCache, w.Header().Get("X-Cache"), "request %d", i)
+				assert.Equal(t, request.wantCacheControl, w.Header().Get("Cache-Control"), "request %d", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geoah/go-kube-api/internal/diff"
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// manifestsNamespace is the namespace of namespaced objects in manifests
+	// that don't specify one
+	manifestsNamespace = "default"
+)
+
+type (
+	// stateSource describes where to load RBAC state from, either a snapshot,
+	// inline manifests, or the live cluster if neither is set
+	stateSource struct {
+		AsOf      *time.Time `json:"asOf,omitempty" yaml:"asOf,omitempty"`
+		Manifests string     `json:"manifests,omitempty" yaml:"manifests,omitempty"`
+	}
+	// rbacDiffRequest
+	rbacDiffRequest struct {
+		From stateSource `json:"from" yaml:"from"`
+		To   stateSource `json:"to" yaml:"to"`
+	}
+)
+
+// RbacDiff handles requests to compare two RBAC states, responding with a
+// human-readable diff if the client accepts text/plain
+func (api API) RbacDiff(c *gin.Context) {
+	// construct request
+	req := rbacDiffRequest{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// load both states
+	from, ok := api.state(c, req.From)
+	if !ok {
+		return
+	}
+	to, ok := api.state(c, req.To)
+	if !ok {
+		return
+	}
+
+	d := diff.New(*from, *to)
+
+	// return response
+	if strings.Contains(c.GetHeader("Accept"), "text/plain") {
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		d.WriteText(c.Writer)
+		return
+	}
+	c.Render(http.StatusOK, renderer(c, d))
+}
+
+// state loads the RBAC state described by the source, rendering an error
+// response if it fails
+func (api API) state(c *gin.Context, source stateSource) (*rbac.State, bool) {
+	if source.Manifests != "" {
+		if source.AsOf != nil {
+			c.Render(http.StatusBadRequest, renderer(c, "only one of asOf and manifests can be set"))
+			return nil, false
+		}
+		state, err := rbac.LoadManifests(strings.NewReader(source.Manifests), manifestsNamespace)
+		if err != nil {
+			c.Render(http.StatusBadRequest, renderer(c, "could not parse manifests"))
+			return nil, false
+		}
+		return state, true
+	}
+
+	enumerator, ok := api.enumerator(c, source.AsOf)
+	if !ok {
+		return nil, false
+	}
+
+	state, err := enumerator.State()
+	if err != nil {
+		c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve rbac state"))
+		return nil, false
+	}
+
+	return state, true
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/diff"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+const (
+	// manifestsRole1Subject1 binds role1 to subject1 in the default namespace
+	manifestsRole1Subject1 = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: role1-for-subject1
+roleRef:
+  name: role1
+subjects:
+- kind: User
+  name: subject1
+`
+)
+
+func TestAPI_RbacDiff(t *testing.T) {
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		requestBody    string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "manifests to live, json, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(&rbac.State{
+						RoleBindings: []v1.RoleBinding{
+							fixtures.RoleBindingRole1Subject1,
+							fixtures.RoleBindingRole2Subject2,
+						},
+					}, nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: func() string {
+					b, _ := json.Marshal(rbacDiffRequest{
+						From: stateSource{
+							Manifests: manifestsRole1Subject1,
+						},
+					})
+					return string(b)
+				}(),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := diff.Diff{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp.AddedBindings, 1)
+				assert.Equal(t, fixtures.RoleBindingRole2Subject2.Name, resp.AddedBindings[0].Name)
+				assert.Empty(t, resp.RemovedBindings)
+				assert.Empty(t, resp.ChangedBindings)
+			},
+		},
+		{
+			name: "live to manifests, text, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(&rbac.State{
+						RoleBindings: []v1.RoleBinding{
+							fixtures.RoleBindingRole1Subject1,
+							fixtures.RoleBindingRole2Subject2,
+						},
+					}, nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: func() string {
+					b, _ := json.Marshal(rbacDiffRequest{
+						To: stateSource{
+							Manifests: manifestsRole1Subject1,
+						},
+					})
+					return string(b)
+				}(),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+					"Accept":       []string{"text/plain"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Equal(t, "Removed bindings:\n  - RoleBinding/default/role2-for-subject2 -> Role/default/role2: User/subject2\n", string(respBody))
+			},
+		},
+		{
+			name: "invalid manifests, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"from":{"manifests":"{{"}}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "could not parse manifests")
+			},
+		},
+		{
+			name: "rbac error, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(nil, errors.New("some error"))
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusInternalServerError, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "could not retrieve rbac state")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacDiff)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
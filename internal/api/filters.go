@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+type (
+	// bindingFilters narrow down the bindings matched by subjects, bindings
+	// have to match all of them
+	bindingFilters struct {
+		// RoleRef bindings have to refer to
+		RoleRef *roleRefFilter `json:"roleRef,omitempty" yaml:"roleRef,omitempty"`
+		// LabelSelector bindings' labels have to match, such as
+		// "team=a,env in (prod)"
+		LabelSelector string `json:"labelSelector,omitempty" yaml:"labelSelector,omitempty"`
+		// Annotations bindings have to have, with the same values
+		Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+		// Owner one of the bindings' owner references has to match
+		Owner *ownerFilter `json:"owner,omitempty" yaml:"owner,omitempty"`
+		// CreatedAfter and CreatedBefore bound when bindings were created
+		CreatedAfter  *time.Time `json:"createdAfter,omitempty" yaml:"createdAfter,omitempty"`
+		CreatedBefore *time.Time `json:"createdBefore,omitempty" yaml:"createdBefore,omitempty"`
+		// CreatedWithin is how long ago bindings were created at most, such
+		// as "24h"
+		CreatedWithin string `json:"createdWithin,omitempty" yaml:"createdWithin,omitempty"`
+		// Expression is a CEL expression bindings have to match
+		Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
+		// Permissions bindings' roles have to grant all of
+		Permissions []rbac.Attributes `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	}
+	// roleRefFilter matches the kind of role, any if empty, and its name
+	roleRefFilter struct {
+		Kind      string         `json:"kind,omitempty" yaml:"kind,omitempty"`
+		Name      string         `json:"name" yaml:"name"`
+		MatchType rbac.MatchType `json:"matchType,omitempty" yaml:"matchType,omitempty"`
+	}
+	// ownerFilter matches the kind and name of owner references, either can
+	// be empty to match any
+	ownerFilter struct {
+		Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+		Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	}
+)
+
+// empty checks if no filters are set
+func (f bindingFilters) empty() bool {
+	return f.RoleRef == nil &&
+		f.LabelSelector == "" &&
+		len(f.Annotations) == 0 &&
+		f.Owner == nil &&
+		f.CreatedAfter == nil &&
+		f.CreatedBefore == nil &&
+		f.CreatedWithin == "" &&
+		f.Expression == "" &&
+		len(f.Permissions) == 0
+}
+
+// filters validates the filters and constructs the rbac filters for the ones
+// that are set, except for permissions which need the roles
+func (f bindingFilters) filters() ([]rbac.RoleBindingFilter, error) {
+	filters := []rbac.RoleBindingFilter{}
+
+	for _, permission := range f.Permissions {
+		if permission.Verb == "" {
+			return nil, errors.New("missing verb in request permissions")
+		}
+		if permission.NonResourceURL != "" && (permission.Resource != "" || permission.APIGroup != "") {
+			return nil, errors.New("permissions are either for resources or non-resource urls")
+		}
+	}
+
+	if f.RoleRef != nil {
+		filter, err := rbac.FilterByRoleRef(f.RoleRef.Kind, rbac.Pattern{
+			Pattern:   f.RoleRef.Name,
+			MatchType: f.RoleRef.MatchType,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid roleRef in request: %w", err)
+		}
+		filters = append(filters, filter)
+	}
+
+	if f.LabelSelector != "" {
+		selector, err := labels.Parse(f.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labelSelector in request: %w", err)
+		}
+		filters = append(filters, rbac.FilterByLabelSelector(selector))
+	}
+
+	if len(f.Annotations) > 0 {
+		filters = append(filters, rbac.FilterByAnnotations(f.Annotations))
+	}
+
+	if f.Owner != nil {
+		filters = append(filters, rbac.FilterByOwner(f.Owner.Kind, f.Owner.Name))
+	}
+
+	after, before := time.Time{}, time.Time{}
+	if f.CreatedAfter != nil {
+		after = *f.CreatedAfter
+	}
+	if f.CreatedBefore != nil {
+		before = *f.CreatedBefore
+	}
+	if f.CreatedWithin != "" {
+		within, err := time.ParseDuration(f.CreatedWithin)
+		if err != nil || within <= 0 {
+			return nil, errors.New("invalid createdWithin in request")
+		}
+		// the more recent bound wins if after is set too
+		if since := time.Now().Add(-within); since.After(after) {
+			after = since
+		}
+	}
+	if !after.IsZero() || !before.IsZero() {
+		filters = append(filters, rbac.FilterByCreationTimestamp(after, before))
+	}
+
+	if f.Expression != "" {
+		filter, err := rbac.FilterByExpression(f.Expression)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// permissionFilters constructs the rbac filters for the permissions, if any,
+// resolving the roles of bindings in the state
+func (f bindingFilters) permissionFilters(state *rbac.State) []rbac.RoleBindingFilter {
+	if len(f.Permissions) == 0 {
+		return nil
+	}
+	return []rbac.RoleBindingFilter{rbac.FilterByPermissions(state.RoleRules(), f.Permissions...)}
+}
+
+// narrow narrows the subject filters down to bindings that also match all of
+// the filters, all bindings are narrowed down if there are no subject filters
+func narrow(subjectFilters, filters []rbac.RoleBindingFilter) []rbac.RoleBindingFilter {
+	if len(filters) == 0 {
+		return subjectFilters
+	}
+	if len(subjectFilters) > 0 {
+		filters = append([]rbac.RoleBindingFilter{rbac.FilterAny(subjectFilters...)}, filters...)
+	}
+	return []rbac.RoleBindingFilter{rbac.FilterAll(filters...)}
+}
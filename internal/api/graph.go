@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geoah/go-kube-api/internal/graph"
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+type (
+	// rbacGraphRequest
+	rbacGraphRequest struct {
+		stateSource `json:",inline" yaml:",inline"`
+		// Namespace of the role bindings to include, all if empty
+		Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		// SubjectNames bindings have to refer to, all bindings if empty
+		SubjectNames []string `json:"subjectNames,omitempty" yaml:"subjectNames,omitempty"`
+		// Subjects bindings have to refer to, as well as subject names
+		Subjects []rbac.Pattern `json:"subjects,omitempty" yaml:"subjects,omitempty"`
+		// bindingFilters narrow down the bindings matching the subjects
+		bindingFilters `json:",inline" yaml:",inline"`
+		// Format of the graph, json if empty
+		Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	}
+)
+
+// RbacGraph handles requests to export the graph of subjects, bindings, roles
+// and permissions as json, graphviz dot or graphml
+func (api API) RbacGraph(c *gin.Context) {
+	// construct request
+	req := rbacGraphRequest{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// validate request
+	format, err := graph.ParseFormat(req.Format)
+	if err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "invalid format in request"))
+		return
+	}
+	if api.tooManySubjectNames(req.SubjectNames, req.Subjects) {
+		c.Render(http.StatusBadRequest, renderer(c, errTooManySubjectNames.Error()))
+		return
+	}
+	filters, err := subjectFilters(req.SubjectNames, req.Subjects)
+	if err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, err.Error()))
+		return
+	}
+	narrowing, err := req.bindingFilters.filters()
+	if err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, err.Error()))
+		return
+	}
+
+	// load state
+	state, ok := api.state(c, req.stateSource)
+	if !ok {
+		return
+	}
+
+	// permissions are resolved against the state's roles
+	narrowing = append(narrowing, req.permissionFilters(state)...)
+	filters = narrow(filters, narrowing)
+
+	g := graph.New(*state, graph.Options{
+		Namespace: req.Namespace,
+		Filters:   filters,
+	})
+
+	// return response, json follows the request's content type like other
+	// responses
+	if format == graph.FormatJSON {
+		c.Render(http.StatusOK, renderer(c, g))
+		return
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", format.ContentType())
+	g.Write(c.Writer, format)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/graph"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+func TestAPI_RbacGraph(t *testing.T) {
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		requestBody    string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "live, json, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(&rbac.State{
+						RoleBindings: []v1.RoleBinding{
+							fixtures.RoleBindingRole1Subject1,
+							fixtures.RoleBindingRole2Subject2,
+						},
+					}, nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject2"]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := graph.Graph{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, graph.Graph{
+					Nodes: []graph.Node{
+						{ID: "binding:RoleBinding/default/role2-for-subject2", Kind: graph.KindBinding, Label: "RoleBinding/default/role2-for-subject2"},
+						{ID: "role:Role/default/role2", Kind: graph.KindRole, Label: "Role/default/role2"},
+						{ID: "subject:User/subject2", Kind: graph.KindSubject, Label: "User/subject2"},
+					},
+					Edges: []graph.Edge{
+						{Source: "binding:RoleBinding/default/role2-for-subject2", Target: "role:Role/default/role2"},
+						{Source: "subject:User/subject2", Target: "binding:RoleBinding/default/role2-for-subject2"},
+					},
+				}, resp)
+			},
+		},
+		{
+			name: "manifests, dot, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: func() string {
+					b, _ := json.Marshal(rbacGraphRequest{
+						stateSource: stateSource{
+							Manifests: manifestsRole1Subject1,
+						},
+						Format: "dot",
+					})
+					return string(b)
+				}(),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "text/vnd.graphviz; charset=utf-8", rr.Header().Get("Content-Type"))
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), `"subject:User/subject1" -> "binding:RoleBinding/default/role1-for-subject1";`)
+			},
+		},
+		{
+			name: "invalid format, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"format":"png"}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid format in request")
+			},
+		},
+		{
+			name: "invalid subject names, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"subjectNames":["("]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), `subjectNames[0]: invalid regular expression or subject name \"(\"`)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacGraph)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geoah/go-kube-api/internal/hygiene"
+)
+
+// RbacHygiene handles requests to find dangling bindings, orphaned roles and
+// bindings without subjects, responding with a human-readable report if the
+// client accepts text/plain
+func (api API) RbacHygiene(c *gin.Context) {
+	// construct request
+	req := stateSource{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// load state
+	state, ok := api.state(c, req)
+	if !ok {
+		return
+	}
+
+	report := hygiene.New(*state)
+
+	// return response
+	if strings.Contains(c.GetHeader("Accept"), "text/plain") {
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		report.WriteText(c.Writer)
+		return
+	}
+	c.Render(http.StatusOK, renderer(c, report))
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/hygiene"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+func TestAPI_RbacHygiene(t *testing.T) {
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		requestBody    string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "live, json, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(&rbac.State{
+						RoleBindings: []v1.RoleBinding{
+							fixtures.RoleBindingRole1Subject1,
+						},
+					}, nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := hygiene.Report{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp.DanglingBindings, 1)
+				assert.Equal(t, fixtures.RoleBindingRole1Subject1.Name, resp.DanglingBindings[0].Name)
+				assert.Empty(t, resp.OrphanedRoles)
+				assert.Empty(t, resp.EmptyBindings)
+			},
+		},
+		{
+			name: "manifests, text, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: func() string {
+					b, _ := json.Marshal(stateSource{
+						Manifests: manifestsSecretsReader,
+					})
+					return string(b)
+				}(),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+					"Accept":       []string{"text/plain"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Equal(t, "Roles without bindings:\n  Role/default/role1\n", string(respBody))
+			},
+		},
+		{
+			name: "rbac error, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(nil, errors.New("some error"))
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusInternalServerError, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "could not retrieve rbac state")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacHygiene)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
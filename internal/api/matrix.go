@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geoah/go-kube-api/internal/matrix"
+)
+
+// RbacMatrix handles requests for the matrix of subjects against the
+// permissions they are granted in a namespace, or the whole cluster.
+// It's a GET so the html format can be opened in a browser, the namespace,
+// asOf and format are query parameters.
+func (api API) RbacMatrix(c *gin.Context) {
+	// construct request
+	source := stateSource{}
+	if asOf := c.Query("asOf"); asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			c.Render(http.StatusBadRequest, renderer(c, "invalid asOf in request"))
+			return
+		}
+		source.AsOf = &t
+	}
+
+	// validate request
+	format, err := matrix.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "invalid format in request"))
+		return
+	}
+
+	// load state
+	state, ok := api.state(c, source)
+	if !ok {
+		return
+	}
+
+	m := matrix.New(*state, c.Query("namespace"))
+
+	// return response
+	if format == matrix.FormatJSON {
+		c.Render(http.StatusOK, renderer(c, m))
+		return
+	}
+	if format == matrix.FormatCSV || format == matrix.FormatExcelCSV {
+		c.Header("Content-Disposition", `attachment; filename="rbac-matrix.csv"`)
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", format.ContentType())
+	m.Write(c.Writer, format)
+}
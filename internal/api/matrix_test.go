@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/matrix"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+func TestAPI_RbacMatrix(t *testing.T) {
+	// live state where subject1 can list pods in the default namespace
+	liveState := func(t *testing.T) rbac.Enumerator {
+		ctrl := gomock.NewController(t)
+		mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+		mockEnumerator.EXPECT().State().Return(&rbac.State{
+			Roles: []v1.Role{{
+				ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "default"},
+				Rules: []v1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"list"},
+				}},
+			}},
+			RoleBindings: []v1.RoleBinding{
+				fixtures.RoleBindingRole1Subject1,
+			},
+		}, nil)
+		return mockEnumerator
+	}
+
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		query string
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "json, success",
+			fields: fields{rbac: liveState},
+			args:   args{query: "?namespace=default"},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := matrix.Matrix{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, "default", resp.Namespace)
+				require.Len(t, resp.Rows, 1)
+				assert.Equal(t, []matrix.Cell{{
+					Granted:  true,
+					Bindings: []rbac.Key{{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-subject1"}},
+				}}, resp.Rows[0].Cells)
+			},
+		},
+		{
+			name:   "csv, success",
+			fields: fields{rbac: liveState},
+			args:   args{query: "?format=csv"},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename="rbac-matrix.csv"`, rr.Header().Get("Content-Disposition"))
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Equal(t, "subject,list pods in default\nUser/subject1,granted by RoleBinding/default/role1-for-subject1\n", string(respBody))
+			},
+		},
+		{
+			name:   "html, success",
+			fields: fields{rbac: liveState},
+			args:   args{query: "?format=html"},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "<th>User/subject1</th>")
+			},
+		},
+		{
+			name: "invalid format, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{query: "?format=xlsx"},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid format in request")
+			},
+		},
+		{
+			name: "invalid asOf, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{query: "?asOf=yesterday"},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid asOf in request")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.GET("/", api.RbacMatrix)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/"+tt.args.query, nil)
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
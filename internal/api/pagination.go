@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+type (
+	// pageKey is the position of a role binding in the sorted results, pages
+	// continue after the last role binding of the previous one
+	pageKey struct {
+		RoleName  string
+		Namespace string
+		Name      string
+	}
+)
+
+// page returns the sorted role bindings after the key, if any, up to the
+// limit, if any, and the continue token if there are more
+func page(roleBindings []v1.RoleBinding, after *pageKey, limit int) ([]v1.RoleBinding, string) {
+	if after != nil {
+		start := sort.Search(len(roleBindings), func(i int) bool {
+			return after.less(newPageKey(roleBindings[i]))
+		})
+		roleBindings = roleBindings[start:]
+	}
+	if limit == 0 || len(roleBindings) <= limit {
+		return roleBindings, ""
+	}
+	roleBindings = roleBindings[:limit]
+	return roleBindings, newPageKey(roleBindings[limit-1]).String()
+}
+
+// newPageKey returns the position of the role binding
+func newPageKey(roleBinding v1.RoleBinding) pageKey {
+	return pageKey{
+		RoleName:  roleBinding.RoleRef.Name,
+		Namespace: roleBinding.Namespace,
+		Name:      roleBinding.Name,
+	}
+}
+
+// less orders keys by role name, namespace and name, like
+// rbac.SortRoleBindings
+func (k pageKey) less(other pageKey) bool {
+	if k.RoleName != other.RoleName {
+		return k.RoleName < other.RoleName
+	}
+	if k.Namespace != other.Namespace {
+		return k.Namespace < other.Namespace
+	}
+	return k.Name < other.Name
+}
+
+// String returns the key as an opaque continue token
+func (k pageKey) String() string {
+	b, _ := json.Marshal([]string{k.RoleName, k.Namespace, k.Name})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseContinue parses a continue token
+func parseContinue(token string) (*pageKey, error) {
+	errInvalid := errors.New("invalid continue in request")
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalid
+	}
+	fields := []string{}
+	if err := json.Unmarshal(b, &fields); err != nil || len(fields) != 3 {
+		return nil, errInvalid
+	}
+	return &pageKey{
+		RoleName:  fields[0],
+		Namespace: fields[1],
+		Name:      fields[2],
+	}, nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+// RbacRoleBindings handles GET requests to enumerate a namespace's role
+// bindings, with the same filters as RbacEnummerateByBindings given as query
+// parameters so responses can be bookmarked and cached.
+// Responses from the live cluster carry an ETag based on the query and the
+// matched role bindings' resource versions, and If-None-Match requests are
+// answered with not modified if they haven't changed.
+func (api API) RbacRoleBindings(c *gin.Context) {
+	// construct request
+	req, err := roleBindingsRequest(c)
+	if err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, err.Error()))
+		return
+	}
+
+	api.enumerate(c, *req, true)
+}
+
+// roleBindingsRequest constructs an enumeration request from the namespace
+// path parameter and the query parameters
+func roleBindingsRequest(c *gin.Context) (*rbacEnumerateByBindingsRequest, error) {
+	req := &rbacEnumerateByBindingsRequest{
+		Namespace: c.Param("namespace"),
+	}
+
+	// subjects, with a parameter per match type
+	subjectParameters := []struct {
+		name      string
+		matchType rbac.MatchType
+	}{
+		{"subject", rbac.MatchExact},
+		{"subjectPrefix", rbac.MatchPrefix},
+		{"subjectGlob", rbac.MatchGlob},
+		{"subjectRegex", rbac.MatchRegex},
+	}
+	for _, parameter := range subjectParameters {
+		for _, pattern := range c.QueryArray(parameter.name) {
+			req.Subjects = append(req.Subjects, rbac.Pattern{
+				Pattern:   pattern,
+				MatchType: parameter.matchType,
+			})
+		}
+	}
+
+	// binding filters
+	if roleRef := c.Query("roleRef"); roleRef != "" {
+		req.RoleRef = &roleRefFilter{
+			Kind:      c.Query("roleRefKind"),
+			Name:      roleRef,
+			MatchType: rbac.MatchType(c.Query("roleRefMatchType")),
+		}
+	}
+	req.LabelSelector = c.Query("labelSelector")
+	if ownerKind, ownerName := c.Query("ownerKind"), c.Query("ownerName"); ownerKind != "" || ownerName != "" {
+		req.Owner = &ownerFilter{
+			Kind: ownerKind,
+			Name: ownerName,
+		}
+	}
+	var err error
+	if req.CreatedAfter, err = timeQuery(c, "createdAfter"); err != nil {
+		return nil, err
+	}
+	if req.CreatedBefore, err = timeQuery(c, "createdBefore"); err != nil {
+		return nil, err
+	}
+	req.CreatedWithin = c.Query("createdWithin")
+	req.Expression = c.Query("expression")
+
+	// source and group expansion
+	if req.AsOf, err = timeQuery(c, "asOf"); err != nil {
+		return nil, err
+	}
+	if expandGroups := c.Query("expandGroups"); expandGroups != "" {
+		req.ExpandGroups, err = strconv.ParseBool(expandGroups)
+		if err != nil {
+			return nil, errors.New("invalid expandGroups in request")
+		}
+	}
+
+	// pagination
+	if limit := c.Query("limit"); limit != "" {
+		req.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, errors.New("invalid limit in request")
+		}
+	}
+	req.Continue = c.Query("continue")
+
+	return req, nil
+}
+
+// timeQuery parses the RFC3339 query parameter, nil if it's not set
+func timeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in request", name)
+	}
+	return &t, nil
+}
+
+// notModified sets the ETag of the response, and responds with not modified
+// if the request's If-None-Match has it. Returns true if a response was
+// rendered.
+// Snapshots have no resource versions and bindings created within a duration
+// change over time, so neither have an ETag.
+func notModified(c *gin.Context, req rbacEnumerateByBindingsRequest, resp interface{}, continueToken string) bool {
+	if req.AsOf != nil || req.CreatedWithin != "" {
+		return false
+	}
+	etag, ok := responseETag(req, resp, continueToken)
+	if !ok {
+		return false
+	}
+
+	// the same response is rendered as json or yaml depending on the request
+	c.Header("ETag", etag)
+	c.Header("Vary", "Content-Type")
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// responseETag hashes the normalised query with the namespace, name and
+// resource version of each role binding in the response, and the groups they
+// were matched through. Returns false if any role binding has no resource
+// version, since changes to it couldn't be told apart.
+func responseETag(req rbacEnumerateByBindingsRequest, resp interface{}, continueToken string) (string, bool) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", req.cacheKey(), continueToken)
+	addRoleBinding := func(roleBinding v1.RoleBinding) bool {
+		fmt.Fprintf(hash, "%s/%s@%s\n", roleBinding.Namespace, roleBinding.Name, roleBinding.ResourceVersion)
+		return roleBinding.ResourceVersion != ""
+	}
+	switch roleBindings := resp.(type) {
+	case []v1.RoleBinding:
+		for _, roleBinding := range roleBindings {
+			if !addRoleBinding(roleBinding) {
+				return "", false
+			}
+		}
+	case []roleBindingMatch:
+		for _, match := range roleBindings {
+			if !addRoleBinding(match.RoleBinding) {
+				return "", false
+			}
+			for _, via := range match.Via {
+				fmt.Fprintf(hash, "via %s/%s\n", via.Group, via.User)
+			}
+		}
+	default:
+		return "", false
+	}
+	return fmt.Sprintf(`W/"%x"`, hash.Sum(nil)[:16]), true
+}
+
+// etagMatches checks if the If-None-Match header matches the etag, using the
+// weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+func TestAPI_RbacRoleBindings(t *testing.T) {
+	// the sample role bindings at resource version 42
+	roleBinding1 := fixtures.RoleBindingRole1Subject1
+	roleBinding1.ResourceVersion = "42"
+	roleBinding2 := fixtures.RoleBindingRole2Subject2
+	roleBinding2.ResourceVersion = "42"
+	roleBinding3 := fixtures.RoleBindingRole3Subject3and4
+	roleBinding3.ResourceVersion = "42"
+	// subject1Request is the query for subject1's role bindings
+	subject1Request := rbacEnumerateByBindingsRequest{
+		Namespace: nsDefault,
+		Subjects: []rbac.Pattern{{
+			Pattern:   "subject1",
+			MatchType: rbac.MatchExact,
+		}},
+	}
+	currentETag, _ := responseETag(subject1Request, []v1.RoleBinding{roleBinding1}, "")
+	roleBinding1Old := roleBinding1
+	roleBinding1Old.ResourceVersion = "41"
+	oldETag, _ := responseETag(subject1Request, []v1.RoleBinding{roleBinding1Old}, "")
+	// staticRbac enumerates the sample role bindings
+	staticRbac := func(t *testing.T) rbac.Enumerator {
+		ctrl := gomock.NewController(t)
+		mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+		mockEnumerator.EXPECT().EnumberateByRoleBindings(nsDefault, gomock.Any()).DoAndReturn(
+			func(namespace string, filters ...rbac.RoleBindingFilter) ([]v1.RoleBinding, error) {
+				return rbac.NewStatic(rbac.State{
+					RoleBindings: []v1.RoleBinding{
+						roleBinding1,
+						roleBinding2,
+						roleBinding3,
+					},
+				}).EnumberateByRoleBindings(namespace, filters...)
+			},
+		).AnyTimes()
+		return mockEnumerator
+	}
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		url            string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "filter by subjects and role ref, success",
+			fields: fields{
+				rbac: staticRbac,
+			},
+			args: args{
+				url:            "/v1/namespaces/default/rolebindings?subject=subject1&subjectRegex=subject%5B23%5D&roleRef=role%5B12%5D&roleRefMatchType=regex",
+				requestHeaders: http.Header{},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, rr.Header().Get("ETag"))
+				expResp := []v1.RoleBinding{
+					roleBinding1,
+					roleBinding2,
+				}
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, expResp, resp)
+			},
+		},
+		{
+			name: "if none match current version, not modified",
+			fields: fields{
+				rbac: staticRbac,
+			},
+			args: args{
+				url: "/v1/namespaces/default/rolebindings?subject=subject1",
+				requestHeaders: http.Header{
+					"If-None-Match": []string{oldETag + ", " + currentETag},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotModified, rr.Code)
+				assert.Equal(t, currentETag, rr.Header().Get("ETag"))
+				assert.Empty(t, rr.Body.String())
+			},
+		},
+		{
+			name: "if none match old version, success",
+			fields: fields{
+				rbac: staticRbac,
+			},
+			args: args{
+				url: "/v1/namespaces/default/rolebindings?subject=subject1",
+				requestHeaders: http.Header{
+					"If-None-Match": []string{oldETag},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, []v1.RoleBinding{roleBinding1}, resp)
+			},
+		},
+		{
+			name: "other query, success",
+			fields: fields{
+				rbac: staticRbac,
+			},
+			args: args{
+				url: "/v1/namespaces/default/rolebindings?subject=subject1&subject=subject9",
+				requestHeaders: http.Header{
+					"If-None-Match": []string{currentETag},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.NotEqual(t, currentETag, rr.Header().Get("ETag"))
+			},
+		},
+		{
+			name: "no resource versions, no etag, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().EnumberateByRoleBindings(nsDefault, gomock.Any()).Return([]v1.RoleBinding{
+						fixtures.RoleBindingRole1Subject1,
+					}, nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				url: "/v1/namespaces/default/rolebindings?subject=subject1",
+				requestHeaders: http.Header{
+					"If-None-Match": []string{`W/""`},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Empty(t, rr.Header().Get("ETag"))
+			},
+		},
+		{
+			name: "created within, no etag, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().EnumberateByRoleBindings(nsDefault, gomock.Any()).Return([]v1.RoleBinding{}, nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				url:            "/v1/namespaces/default/rolebindings?subject=subject1&createdWithin=24h",
+				requestHeaders: http.Header{},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Empty(t, rr.Header().Get("ETag"))
+			},
+		},
+		{
+			name: "invalid createdAfter, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				url:            "/v1/namespaces/default/rolebindings?subject=subject1&createdAfter=yesterday",
+				requestHeaders: http.Header{},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid createdAfter in request")
+			},
+		},
+		{
+			name: "first page, continue header, success",
+			fields: fields{
+				rbac: staticRbac,
+			},
+			args: args{
+				url:            "/v1/namespaces/default/rolebindings?subjectPrefix=subject&limit=2",
+				requestHeaders: http.Header{},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, newPageKey(roleBinding2).String(), rr.Header().Get("X-Continue"))
+				expResp := []v1.RoleBinding{
+					roleBinding1,
+					roleBinding2,
+				}
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, expResp, resp)
+			},
+		},
+		{
+			name: "last page, no continue header, success",
+			fields: fields{
+				rbac: staticRbac,
+			},
+			args: args{
+				url:            "/v1/namespaces/default/rolebindings?subjectPrefix=subject&limit=2&continue=" + newPageKey(roleBinding2).String(),
+				requestHeaders: http.Header{},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Empty(t, rr.Header().Get("X-Continue"))
+				expResp := []v1.RoleBinding{
+					roleBinding3,
+				}
+				resp := []v1.RoleBinding{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, expResp, resp)
+			},
+		},
+		{
+			name: "invalid continue, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+			},
+			args: args{
+				url:            "/v1/namespaces/default/rolebindings?subject=subject1&continue=nope",
+				requestHeaders: http.Header{},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid continue in request")
+			},
+		},
+		{
+			name: "missing subjects, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				url:            "/v1/namespaces/default/rolebindings",
+				requestHeaders: http.Header{},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "missing subject names")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.GET("/v1/namespaces/:namespace/rolebindings", api.RbacRoleBindings)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.args.url, nil)
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
+
+func TestResponseETag(t *testing.T) {
+	roleBinding := fixtures.RoleBindingRole1Subject1
+	roleBinding.ResourceVersion = "42"
+	req := rbacEnumerateByBindingsRequest{
+		Namespace:    nsDefault,
+		SubjectNames: []string{"subject1"},
+		ExpandGroups: true,
+	}
+	etag := func(via ...groupPath) string {
+		etag, ok := responseETag(req, []roleBindingMatch{{
+			RoleBinding: roleBinding,
+			Via:         via,
+		}}, "")
+		require.True(t, ok)
+		return etag
+	}
+
+	// the groups role bindings were matched through are part of the response
+	assert.Equal(t, etag(groupPath{User: "subject1", Group: "team1"}), etag(groupPath{User: "subject1", Group: "team1"}))
+	assert.NotEqual(t, etag(groupPath{User: "subject1", Group: "team1"}), etag(groupPath{User: "subject1", Group: "team2"}))
+	assert.NotEqual(t, etag(), etag(groupPath{User: "subject1", Group: "team1"}))
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/subjects"
+)
+
+// RbacDanglingSubjects handles requests to find the subjects of bindings
+// that do not exist, responding with a human-readable report if the client
+// accepts text/plain
+func (api API) RbacDanglingSubjects(c *gin.Context) {
+	if api.serviceAccounts == nil && api.directory == nil {
+		c.Render(http.StatusBadRequest, renderer(c, "subject checks are not enabled"))
+		return
+	}
+
+	// construct request
+	req := stateSource{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// load state, and the service accounts that exist alongside it
+	state, ok := api.state(c, req)
+	if !ok {
+		return
+	}
+	serviceAccounts, ok := api.sourceServiceAccounts(c, req)
+	if !ok {
+		return
+	}
+
+	report := subjects.Dangling(*state, serviceAccounts, api.directory)
+
+	// return response
+	if strings.Contains(c.GetHeader("Accept"), "text/plain") {
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		report.WriteText(c.Writer)
+		return
+	}
+	c.Render(http.StatusOK, renderer(c, report))
+}
+
+// sourceServiceAccounts returns the service accounts of the same source as
+// the state, the ones among the manifests, the ones recorded with the
+// snapshot, or the live cluster's, rendering an error response if it fails.
+// Returns nil if service accounts aren't checked, or weren't recorded with
+// the snapshot.
+func (api API) sourceServiceAccounts(c *gin.Context, source stateSource) (map[rbac.SubjectKey]bool, bool) {
+	if api.serviceAccounts == nil {
+		return nil, true
+	}
+
+	switch {
+	case source.Manifests != "":
+		keys, err := rbac.LoadServiceAccountManifests(strings.NewReader(source.Manifests), manifestsNamespace)
+		if err != nil {
+			c.Render(http.StatusBadRequest, renderer(c, "could not parse manifests"))
+			return nil, false
+		}
+		return subjects.Set(keys), true
+	case source.AsOf != nil:
+		s, ok := api.snapshot(c, *source.AsOf)
+		if !ok {
+			return nil, false
+		}
+		return subjects.Set(s.ServiceAccounts), true
+	}
+
+	serviceAccounts, err := api.serviceAccounts.List()
+	if err != nil {
+		c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve service accounts"))
+		return nil, false
+	}
+	return serviceAccounts, true
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+	"github.com/geoah/go-kube-api/internal/subjects"
+)
+
+// serviceAccountsFunc implements ServiceAccounts with a function
+type serviceAccountsFunc func() (map[rbac.SubjectKey]bool, error)
+
+func (f serviceAccountsFunc) List() (map[rbac.SubjectKey]bool, error) {
+	return f()
+}
+
+func TestAPI_RbacDanglingSubjects(t *testing.T) {
+	// manifests binding role1 to a service account
+	manifestsRole1ServiceAccount1 := `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: role1-for-serviceaccount1
+roleRef:
+  name: role1
+subjects:
+- kind: ServiceAccount
+  name: serviceaccount1
+  namespace: default
+- kind: User
+  name: subject1
+`
+	// the same bindings, along with a service account that exists
+	manifestsWithServiceAccount2 := manifestsRole1ServiceAccount1 + `- kind: ServiceAccount
+  name: serviceaccount2
+  namespace: default
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: serviceaccount2
+`
+	requestBody := func(source stateSource) string {
+		b, _ := json.Marshal(source)
+		return string(b)
+	}
+	state, err := rbac.LoadManifests(strings.NewReader(manifestsRole1ServiceAccount1), nsDefault)
+	require.NoError(t, err, "failed to load manifests")
+	asOf := time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC)
+	// serviceAccounts is the live cluster's only service account
+	serviceAccounts := WithServiceAccounts(serviceAccountsFunc(func() (map[rbac.SubjectKey]bool, error) {
+		return map[rbac.SubjectKey]bool{
+			{Kind: "ServiceAccount", Namespace: "default", Name: "serviceaccount1"}: true,
+		}, nil
+	}))
+	// danglingServiceAccount1 is the report of the binding to the missing
+	// service account
+	danglingServiceAccount1 := subjects.Report{
+		Subjects: []subjects.DanglingSubject{
+			{
+				Subject: rbac.SubjectKey{Kind: "ServiceAccount", Namespace: "default", Name: "serviceaccount1"},
+				Bindings: []rbac.Key{
+					{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-serviceaccount1"},
+				},
+			},
+		},
+	}
+	testReport := func(want subjects.Report) func(t *testing.T, rr *httptest.ResponseRecorder) {
+		return func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, rr.Code)
+			resp := subjects.Report{}
+			respBody, _ := ioutil.ReadAll(rr.Body)
+			err := json.Unmarshal(respBody, &resp)
+			require.NoError(t, err, "could not unmarshal resp")
+			assert.Equal(t, want, resp)
+		}
+	}
+
+	type fields struct {
+		options []Option
+	}
+	type args struct {
+		requestBody    string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "manifests, checked against their service accounts, json, success",
+			fields: fields{
+				options: []Option{
+					serviceAccounts,
+					WithDirectory(&subjects.Directory{
+						Users: []string{"subject1"},
+					}),
+				},
+			},
+			args: args{
+				requestBody: requestBody(stateSource{Manifests: manifestsWithServiceAccount2}),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: testReport(danglingServiceAccount1),
+		},
+		{
+			name: "snapshot, checked against its service accounts, success",
+			fields: fields{
+				options: []Option{
+					serviceAccounts,
+					WithSnapshots(snapshotsFunc(func(time.Time) (*snapshot.Snapshot, error) {
+						return &snapshot.Snapshot{
+							Timestamp:       asOf,
+							State:           *state,
+							ServiceAccounts: []rbac.SubjectKey{},
+						}, nil
+					})),
+				},
+			},
+			args: args{
+				requestBody: requestBody(stateSource{AsOf: &asOf}),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: testReport(danglingServiceAccount1),
+		},
+		{
+			name: "snapshot without service accounts, not checked, success",
+			fields: fields{
+				options: []Option{
+					serviceAccounts,
+					WithSnapshots(snapshotsFunc(func(time.Time) (*snapshot.Snapshot, error) {
+						return &snapshot.Snapshot{
+							Timestamp: asOf,
+							State:     *state,
+						}, nil
+					})),
+				},
+			},
+			args: args{
+				requestBody: requestBody(stateSource{AsOf: &asOf}),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: testReport(subjects.Report{Subjects: []subjects.DanglingSubject{}}),
+		},
+		{
+			name: "live, checked against the cluster's service accounts, success",
+			fields: fields{
+				options: []Option{serviceAccounts},
+			},
+			args: args{
+				requestBody: `{}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: testReport(subjects.Report{Subjects: []subjects.DanglingSubject{}}),
+		},
+		{
+			name: "directory only, text, success",
+			fields: fields{
+				options: []Option{
+					WithDirectory(&subjects.Directory{}),
+				},
+			},
+			args: args{
+				requestBody: requestBody(stateSource{Manifests: manifestsRole1ServiceAccount1}),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+					"Accept":       []string{"text/plain"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Equal(t, "Dangling subjects:\n  User/subject1\n      RoleBinding/default/role1-for-serviceaccount1\n", string(respBody))
+			},
+		},
+		{
+			name: "service accounts error, failure",
+			fields: fields{
+				options: []Option{
+					WithServiceAccounts(serviceAccountsFunc(func() (map[rbac.SubjectKey]bool, error) {
+						return nil, errors.New("some error")
+					})),
+				},
+			},
+			args: args{
+				requestBody: `{}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusInternalServerError, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "could not retrieve service accounts")
+			},
+		},
+		{
+			name:   "not enabled, failure",
+			fields: fields{},
+			args: args{
+				requestBody: requestBody(stateSource{Manifests: manifestsRole1ServiceAccount1}),
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "subject checks are not enabled")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, err := New(rbac.NewStatic(*state), tt.fields.options...)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacDanglingSubjects)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
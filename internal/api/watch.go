@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// webSocketCloseTimeout is how long we wait for close messages to be sent
+	webSocketCloseTimeout = time.Second
+)
+
+var (
+	// upgrader for websocket connections, with the default origin checks
+	upgrader = websocket.Upgrader{}
+	// errAsOfWatch is returned when watch requests ask for a snapshot
+	errAsOfWatch = errors.New("asOf is not supported when watching")
+	// errPermissionsWatch is returned when watch requests filter by
+	// permissions, since roles can change while watching
+	errPermissionsWatch = errors.New("permissions are not supported when watching")
+)
+
+type (
+	// rbacWatchBySubjectNamesRequest extends the enumeration request with the
+	// resource versions the watch should be resumed from
+	rbacWatchBySubjectNamesRequest struct {
+		rbacEnumerateByBindingsRequest `yaml:",inline"`
+		ResourceVersions               rbac.ResourceVersions `json:"resourceVersions" yaml:"resourceVersions"`
+	}
+)
+
+// RbacWatchBySubjectNames handles requests to watch role bindings and cluster
+// role bindings filtered by subject names, streaming matching changes as
+// server-sent events. Clients can resume a watch using the Last-Event-ID
+// header or the request's resource versions.
+func (api API) RbacWatchBySubjectNames(c *gin.Context) {
+	// construct request
+	req := rbacWatchBySubjectNamesRequest{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// validate request and construct rbac filters
+	if api.tooManySubjectNames(req.SubjectNames, req.Subjects) {
+		c.Render(http.StatusBadRequest, renderer(c, errTooManySubjectNames.Error()))
+		return
+	}
+	filters, err := req.filters()
+	if err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, err.Error()))
+		return
+	}
+	if req.AsOf != nil {
+		c.Render(http.StatusBadRequest, renderer(c, errAsOfWatch.Error()))
+		return
+	}
+
+	// the last event id takes precedence as it is set by reconnecting clients
+	resourceVersions := req.ResourceVersions
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		resourceVersions, err = parseEventID(lastEventID)
+		if err != nil {
+			c.Render(http.StatusBadRequest, renderer(c, err.Error()))
+			return
+		}
+	}
+
+	// start watching, the watch stops when the client goes away
+	events, err := api.rbac.WatchRoleBindings(c.Request.Context(), req.Namespace, resourceVersions, filters...)
+	if err != nil {
+		c.Render(http.StatusInternalServerError, renderer(c, "could not watch role bindings"))
+		return
+	}
+
+	// flush the headers so the client knows the watch has started
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	// stream events until the watch ends
+	for event := range events {
+		c.Render(-1, sse.Event{
+			Id:    eventID(event.ResourceVersions),
+			Event: string(event.Type),
+			Data:  event,
+		})
+		c.Writer.Flush()
+	}
+}
+
+// RbacWatchBySubjectNamesWebSocket handles websocket connections to watch role
+// bindings and cluster role bindings filtered by subject names.
+// The first message from the client must be the json watch request, after
+// which matching changes are sent as json messages.
+func (api API) RbacWatchBySubjectNamesWebSocket(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already responded with an error
+		return
+	}
+	defer conn.Close()
+
+	// construct request from the first message
+	req := rbacWatchBySubjectNamesRequest{}
+	if err := conn.ReadJSON(&req); err != nil {
+		closeWebSocket(conn, websocket.CloseInvalidFramePayloadData, "could not parse request")
+		return
+	}
+
+	// validate request and construct rbac filters
+	if api.tooManySubjectNames(req.SubjectNames, req.Subjects) {
+		closeWebSocket(conn, websocket.ClosePolicyViolation, errTooManySubjectNames.Error())
+		return
+	}
+	filters, err := req.filters()
+	if err != nil {
+		closeWebSocket(conn, websocket.ClosePolicyViolation, err.Error())
+		return
+	}
+	if req.AsOf != nil {
+		closeWebSocket(conn, websocket.ClosePolicyViolation, errAsOfWatch.Error())
+		return
+	}
+
+	// hijacked connections don't cancel the request's context, so we need to
+	// keep reading in order to find out when the client goes away
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// start watching
+	events, err := api.rbac.WatchRoleBindings(ctx, req.Namespace, req.ResourceVersions, filters...)
+	if err != nil {
+		closeWebSocket(conn, websocket.CloseInternalServerErr, "could not watch role bindings")
+		return
+	}
+
+	// send events until the watch ends
+	for event := range events {
+		if err := conn.WriteJSON(event); err != nil {
+			return
+		}
+	}
+
+	closeWebSocket(conn, websocket.CloseNormalClosure, "")
+}
+
+// closeWebSocket sends a close message with the given code and reason
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(webSocketCloseTimeout),
+	)
+}
+
+// eventID encodes resource versions as a server-sent event id
+func eventID(resourceVersions rbac.ResourceVersions) string {
+	return resourceVersions.RoleBindings + "," + resourceVersions.ClusterRoleBindings
+}
+
+// parseEventID decodes the resource versions of a server-sent event id
+func parseEventID(id string) (rbac.ResourceVersions, error) {
+	parts := strings.Split(id, ",")
+	if len(parts) != 2 {
+		return rbac.ResourceVersions{}, errors.New("invalid last event id")
+	}
+	return rbac.ResourceVersions{
+		RoleBindings:        parts[0],
+		ClusterRoleBindings: parts[1],
+	}, nil
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+// closedEvents returns a closed channel containing the given events
+func closedEvents(events ...rbac.Event) <-chan rbac.Event {
+	ch := make(chan rbac.Event, len(events))
+	for _, event := range events {
+		ch <- event
+	}
+	close(ch)
+	return ch
+}
+
+func TestAPI_RbacWatchBySubjectNames(t *testing.T) {
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		requestBody    string
+		requestHeaders http.Header
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "watch by exact and regexp, mocked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().WatchRoleBindings(
+						gomock.Any(),
+						nsDefault,
+						rbac.ResourceVersions{},
+						gomock.Any(),
+						gomock.Any(),
+					).Return(closedEvents(
+						rbac.Event{
+							Type:        watch.Added,
+							Kind:        rbac.KindRoleBinding,
+							RoleBinding: &fixtures.RoleBindingRole1Subject1,
+							ResourceVersions: rbac.ResourceVersions{
+								RoleBindings:        "2",
+								ClusterRoleBindings: "1",
+							},
+						},
+					), nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1","subject[3,4]"]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				lines := strings.Split(string(respBody), "\n")
+				require.True(t, len(lines) >= 3, "expected a full event, got %q", respBody)
+				assert.Equal(t, "id:2,1", lines[0])
+				assert.Equal(t, "event:ADDED", lines[1])
+				event := rbac.Event{}
+				err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data:")), &event)
+				require.NoError(t, err, "could not unmarshal event")
+				assert.Equal(t, rbac.KindRoleBinding, event.Kind)
+				assert.Equal(t, fixtures.RoleBindingRole1Subject1, *event.RoleBinding)
+			},
+		},
+		{
+			name: "resume from last event id, mocked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().WatchRoleBindings(
+						gomock.Any(),
+						nsDefault,
+						rbac.ResourceVersions{
+							RoleBindings:        "10",
+							ClusterRoleBindings: "11",
+						},
+						gomock.Any(),
+					).Return(closedEvents(), nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"resourceVersions":{"roleBindings":"1"}}`,
+				requestHeaders: http.Header{
+					"Content-Type":  []string{"application/json"},
+					"Last-Event-Id": []string{"10,11"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+			},
+		},
+		{
+			name: "invalid last event id, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"]}`,
+				requestHeaders: http.Header{
+					"Content-Type":  []string{"application/json"},
+					"Last-Event-Id": []string{"10"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "invalid last event id")
+			},
+		},
+		{
+			name: "rbac error, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().WatchRoleBindings(
+						gomock.Any(),
+						nsDefault,
+						rbac.ResourceVersions{},
+						gomock.Any(),
+					).Return(nil, errors.New("some error"))
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusInternalServerError, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "could not watch")
+			},
+		},
+		{
+			name: "missing subject names, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":[]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "missing subject names")
+			},
+		},
+		{
+			name: "permissions, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				requestBody: `{"namespace":"default","subjectNames":["subject1"],"permissions":[{"verb":"get","resource":"pods"}]}`,
+				requestHeaders: http.Header{
+					"Content-Type": []string{"application/json"},
+				},
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "permissions are not supported when watching")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacWatchBySubjectNames)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = tt.args.requestHeaders
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
+
+func TestAPI_RbacWatchBySubjectNamesWebSocket(t *testing.T) {
+	type fields struct {
+		rbac func(t *testing.T) rbac.Enumerator
+	}
+	type args struct {
+		request string
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		wantEvents []rbac.Event
+		wantClose  int
+	}{
+		{
+			name: "watch by exact, mocked rbac, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().WatchRoleBindings(
+						gomock.Any(),
+						nsDefault,
+						rbac.ResourceVersions{
+							RoleBindings: "1",
+						},
+						gomock.Any(),
+					).Return(closedEvents(
+						rbac.Event{
+							Type:        watch.Deleted,
+							Kind:        rbac.KindRoleBinding,
+							RoleBinding: &fixtures.RoleBindingRole1Subject1,
+						},
+					), nil)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				request: `{"namespace":"default","subjectNames":["subject1"],"resourceVersions":{"roleBindings":"1"}}`,
+			},
+			wantEvents: []rbac.Event{
+				{
+					Type:        watch.Deleted,
+					Kind:        rbac.KindRoleBinding,
+					RoleBinding: &fixtures.RoleBindingRole1Subject1,
+				},
+			},
+			wantClose: websocket.CloseNormalClosure,
+		},
+		{
+			name: "missing namespace, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				request: `{"subjectNames":["subject1"]}`,
+			},
+			wantEvents: []rbac.Event{},
+			wantClose:  websocket.ClosePolicyViolation,
+		},
+		{
+			name: "invalid request, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return nil
+				},
+			},
+			args: args{
+				request: `{"a`,
+			},
+			wantEvents: []rbac.Event{},
+			wantClose:  websocket.CloseInvalidFramePayloadData,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacMock := tt.fields.rbac(t)
+			api, err := New(rbacMock)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.GET("/", api.RbacWatchBySubjectNamesWebSocket)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/"
+			conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+			require.NoError(t, err, "failed to dial websocket")
+			defer conn.Close()
+
+			err = conn.WriteMessage(websocket.TextMessage, []byte(tt.args.request))
+			require.NoError(t, err, "failed to write request")
+
+			gotEvents := []rbac.Event{}
+			for {
+				event := rbac.Event{}
+				err := conn.ReadJSON(&event)
+				if err != nil {
+					assert.True(t, websocket.IsCloseError(err, tt.wantClose), "unexpected close error: %v", err)
+					break
+				}
+				gotEvents = append(gotEvents, event)
+			}
+			assert.Equal(t, tt.wantEvents, gotEvents)
+		})
+	}
+}
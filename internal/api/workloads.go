@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/workloads"
+)
+
+type (
+	// rbacWorkloadPermissionsRequest
+	rbacWorkloadPermissionsRequest struct {
+		Namespace string `json:"namespace" yaml:"namespace"`
+		// Pod or Deployment to resolve, all pods in the namespace if neither
+		Pod        string `json:"pod,omitempty" yaml:"pod,omitempty"`
+		Deployment string `json:"deployment,omitempty" yaml:"deployment,omitempty"`
+	}
+	// rbacPodsBySubjectRequest
+	rbacPodsBySubjectRequest struct {
+		Subject rbac.SubjectKey `json:"subject" yaml:"subject"`
+	}
+)
+
+// RbacWorkloadPermissions handles requests to resolve the service accounts
+// of a namespace's pods, or a single pod or deployment, and the permissions
+// they are granted
+func (api API) RbacWorkloadPermissions(c *gin.Context) {
+	if api.workloads == nil {
+		c.Render(http.StatusBadRequest, renderer(c, "workloads are not enabled"))
+		return
+	}
+
+	// construct request
+	req := rbacWorkloadPermissionsRequest{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// validate request
+	if req.Namespace == "" {
+		c.Render(http.StatusBadRequest, renderer(c, "missing namespace in request"))
+		return
+	}
+	if req.Pod != "" && req.Deployment != "" {
+		c.Render(http.StatusBadRequest, renderer(c, "only one of pod and deployment can be set"))
+		return
+	}
+
+	// retrieve workloads
+	var (
+		resolved []workloads.Workload
+		err      error
+	)
+	switch {
+	case req.Pod != "":
+		var workload *workloads.Workload
+		workload, err = api.workloads.Pod(req.Namespace, req.Pod)
+		if workload != nil {
+			resolved = []workloads.Workload{*workload}
+		}
+	case req.Deployment != "":
+		var workload *workloads.Workload
+		workload, err = api.workloads.Deployment(req.Namespace, req.Deployment)
+		if workload != nil {
+			resolved = []workloads.Workload{*workload}
+		}
+	default:
+		resolved, err = api.workloads.Pods(req.Namespace)
+	}
+	switch {
+	case errors.Is(err, workloads.ErrNotFound):
+		c.Render(http.StatusNotFound, renderer(c, "workload not found"))
+		return
+	case err != nil:
+		c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve workloads"))
+		return
+	}
+
+	// resolve permissions against the live state, like the workloads, in
+	// their namespace and cluster-wide
+	state, err := rbac.PermissionsState(api.rbac, req.Namespace)
+	if err != nil {
+		c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve rbac state"))
+		return
+	}
+	for i := range resolved {
+		resolved[i].ResolvePermissions(*state)
+	}
+
+	// return response
+	c.Render(http.StatusOK, renderer(c, resolved))
+}
+
+// RbacPodsBySubject handles requests to list the pods running as a subject,
+// either a service account or one of the users and groups service accounts
+// authenticate as
+func (api API) RbacPodsBySubject(c *gin.Context) {
+	if api.workloads == nil {
+		c.Render(http.StatusBadRequest, renderer(c, "workloads are not enabled"))
+		return
+	}
+
+	// construct request
+	req := rbacPodsBySubjectRequest{}
+	if err := c.Bind(&req); err != nil {
+		c.Render(http.StatusBadRequest, renderer(c, "could not parse request"))
+		return
+	}
+
+	// validate request
+	if req.Subject.Kind == "" || req.Subject.Name == "" {
+		c.Render(http.StatusBadRequest, renderer(c, "missing subject kind or name in request"))
+		return
+	}
+	if req.Subject.Kind == v1.ServiceAccountKind && req.Subject.Namespace == "" {
+		c.Render(http.StatusBadRequest, renderer(c, "missing service account namespace in request"))
+		return
+	}
+
+	// service accounts only run pods in their namespace, other subjects can
+	// be groups that span namespaces
+	pods, err := api.workloads.Pods(req.Subject.Namespace)
+	if err != nil {
+		c.Render(http.StatusInternalServerError, renderer(c, "could not retrieve workloads"))
+		return
+	}
+
+	running := []workloads.Workload{}
+	for _, pod := range pods {
+		if pod.RunsAs(req.Subject) {
+			running = append(running, pod)
+		}
+	}
+
+	// return response
+	c.Render(http.StatusOK, renderer(c, running))
+}
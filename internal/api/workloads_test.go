@@ -0,0 +1,300 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+	"github.com/geoah/go-kube-api/internal/workloads"
+)
+
+// fakeWorkloads implements Workloads with a fixed set of pods
+type fakeWorkloads struct {
+	pods []workloads.Workload
+	err  error
+}
+
+func (f fakeWorkloads) Pods(namespace string) ([]workloads.Workload, error) {
+	pods := []workloads.Workload{}
+	for _, pod := range f.pods {
+		if namespace == "" || pod.Namespace == namespace {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, f.err
+}
+
+func (f fakeWorkloads) Pod(namespace, name string) (*workloads.Workload, error) {
+	for _, pod := range f.pods {
+		if pod.Namespace == namespace && pod.Name == name {
+			return &pod, f.err
+		}
+	}
+	return nil, workloads.ErrNotFound
+}
+
+func (f fakeWorkloads) Deployment(namespace, name string) (*workloads.Workload, error) {
+	return nil, workloads.ErrNotFound
+}
+
+func TestAPI_RbacWorkloadPermissions(t *testing.T) {
+	pods := fakeWorkloads{
+		pods: []workloads.Workload{
+			{Kind: workloads.KindPod, Namespace: "default", Name: "pod1", ServiceAccount: "subject4", AutomountToken: true},
+			{Kind: workloads.KindPod, Namespace: "default", Name: "pod2", ServiceAccount: "default", AutomountToken: false},
+		},
+	}
+
+	// subject 4 is a service account that can list pods in its namespace,
+	// and get nodes cluster-wide
+	liveState := func(t *testing.T) rbac.Enumerator {
+		subject4 := []v1.Subject{
+			{Kind: v1.ServiceAccountKind, Namespace: "default", Name: "subject4"},
+		}
+		roleBindingRole1Subject4 := fixtures.RoleBindingRole1Subject1
+		roleBindingRole1Subject4.Subjects = subject4
+		clusterRoleBindingClusterRole1Subject4 := fixtures.ClusterRoleBindingClusterRole1Subject1
+		clusterRoleBindingClusterRole1Subject4.Subjects = subject4
+		ctrl := gomock.NewController(t)
+		mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+		mockEnumerator.EXPECT().NamespaceState("default").Return(&rbac.State{
+			Roles: []v1.Role{{
+				ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "default"},
+				Rules: []v1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"list"},
+				}},
+			}},
+			RoleBindings: []v1.RoleBinding{roleBindingRole1Subject4},
+		}, nil)
+		mockEnumerator.EXPECT().ClusterState().Return(&rbac.State{
+			ClusterRoles: []v1.ClusterRole{{
+				ObjectMeta: metav1.ObjectMeta{Name: clusterRoleBindingClusterRole1Subject4.RoleRef.Name},
+				Rules: []v1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"nodes"},
+					Verbs:     []string{"get"},
+				}},
+			}},
+			ClusterRoleBindings: []v1.ClusterRoleBinding{clusterRoleBindingClusterRole1Subject4},
+		}, nil)
+		return mockEnumerator
+	}
+
+	type fields struct {
+		rbac      func(t *testing.T) rbac.Enumerator
+		workloads Workloads
+	}
+	type args struct {
+		requestBody string
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "pod, success",
+			fields: fields{rbac: liveState, workloads: pods},
+			args:   args{requestBody: `{"namespace":"default","pod":"pod1"}`},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := []workloads.Workload{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, []workloads.Workload{{
+					Kind:           workloads.KindPod,
+					Namespace:      "default",
+					Name:           "pod1",
+					ServiceAccount: "subject4",
+					AutomountToken: true,
+					Permissions: []rbac.Permission{
+						{Verb: "get", Resource: "nodes"},
+						{Namespace: "default", Verb: "list", Resource: "pods"},
+					},
+					Bindings: []rbac.Key{
+						{Kind: rbac.KindClusterRoleBinding, Name: fixtures.ClusterRoleBindingClusterRole1Subject1.Name},
+						{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-subject1"},
+					},
+				}}, resp)
+			},
+		},
+		{
+			name:   "namespace, success",
+			fields: fields{rbac: liveState, workloads: pods},
+			args:   args{requestBody: `{"namespace":"default"}`},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := []workloads.Workload{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.Len(t, resp, 2)
+				assert.Len(t, resp[0].Permissions, 2)
+				assert.Empty(t, resp[1].Permissions)
+				assert.False(t, resp[1].AutomountToken)
+			},
+		},
+		{
+			name: "deployment not found, failure",
+			fields: fields{
+				rbac:      func(t *testing.T) rbac.Enumerator { return nil },
+				workloads: pods,
+			},
+			args: args{requestBody: `{"namespace":"default","deployment":"deployment1"}`},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "workload not found")
+			},
+		},
+		{
+			name: "missing namespace, failure",
+			fields: fields{
+				rbac:      func(t *testing.T) rbac.Enumerator { return nil },
+				workloads: pods,
+			},
+			args: args{requestBody: `{"pod":"pod1"}`},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "missing namespace in request")
+			},
+		},
+		{
+			name: "workloads error, failure",
+			fields: fields{
+				rbac:      func(t *testing.T) rbac.Enumerator { return nil },
+				workloads: fakeWorkloads{err: errors.New("some error")},
+			},
+			args: args{requestBody: `{"namespace":"default"}`},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusInternalServerError, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "could not retrieve workloads")
+			},
+		},
+		{
+			name: "not enabled, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator { return nil },
+			},
+			args: args{requestBody: `{"namespace":"default"}`},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "workloads are not enabled")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := []Option{}
+			if tt.fields.workloads != nil {
+				options = append(options, WithWorkloads(tt.fields.workloads))
+			}
+			api, err := New(tt.fields.rbac(t), options...)
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacWorkloadPermissions)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header = http.Header{"Content-Type": []string{"application/json"}}
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
+
+func TestAPI_RbacPodsBySubject(t *testing.T) {
+	pods := fakeWorkloads{
+		pods: []workloads.Workload{
+			{Kind: workloads.KindPod, Namespace: "default", Name: "pod1", ServiceAccount: "subject4", AutomountToken: true},
+			{Kind: workloads.KindPod, Namespace: "default", Name: "pod2", ServiceAccount: "default", AutomountToken: false},
+			{Kind: workloads.KindPod, Namespace: "other", Name: "pod3", ServiceAccount: "subject4", AutomountToken: true},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		requestBody string
+		testResp    func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "service account, success",
+			requestBody: `{"subject":{"kind":"ServiceAccount","namespace":"default","name":"subject4"}}`,
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := []workloads.Workload{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, []workloads.Workload{pods.pods[0]}, resp)
+			},
+		},
+		{
+			name:        "group, success",
+			requestBody: `{"subject":{"kind":"Group","name":"system:serviceaccounts"}}`,
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := []workloads.Workload{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				assert.Equal(t, pods.pods, resp)
+			},
+		},
+		{
+			name:        "service account without namespace, failure",
+			requestBody: `{"subject":{"kind":"ServiceAccount","name":"subject4"}}`,
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "missing service account namespace in request")
+			},
+		},
+		{
+			name:        "missing subject, failure",
+			requestBody: `{}`,
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "missing subject kind or name in request")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, err := New(nil, WithWorkloads(pods))
+			require.NoError(t, err, "failed to create new api")
+
+			r := gin.Default()
+			r.POST("/", api.RbacPodsBySubject)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.requestBody))
+			req.Header = http.Header{"Content-Type": []string{"application/json"}}
+			r.ServeHTTP(w, req)
+			tt.testResp(t, w)
+		})
+	}
+}
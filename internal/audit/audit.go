@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// SeverityLow for grants that are worth knowing about
+	SeverityLow Severity = "low"
+	// SeverityMedium for grants that should be reviewed
+	SeverityMedium Severity = "medium"
+	// SeverityHigh for grants that give access to sensitive data or workloads
+	SeverityHigh Severity = "high"
+	// SeverityCritical for grants that are equivalent to cluster admin
+	SeverityCritical Severity = "critical"
+)
+
+type (
+	// Severity of a finding
+	Severity string
+	// Options of an audit
+	Options struct {
+		// Namespace to audit, roles and bindings of other namespaces are
+		// ignored, cluster role bindings always apply.
+		// All namespaces if empty.
+		Namespace string
+		// MinSeverity of the findings to report, all if empty
+		MinSeverity Severity
+	}
+	// Report of an audit
+	Report struct {
+		Findings []Finding        `json:"findings" yaml:"findings"`
+		Summary  map[Severity]int `json:"summary" yaml:"summary"`
+	}
+	// Finding is a role that grants what a check is looking for
+	Finding struct {
+		Check       string            `json:"check" yaml:"check"`
+		Severity    Severity          `json:"severity" yaml:"severity"`
+		Description string            `json:"description" yaml:"description"`
+		Role        rbac.Key          `json:"role" yaml:"role"`
+		Rules       []v1.PolicyRule   `json:"rules" yaml:"rules"`
+		Subjects    []rbac.SubjectKey `json:"subjects" yaml:"subjects"`
+		Paths       []Path            `json:"paths" yaml:"paths"`
+	}
+	// Path is how a subject is granted a role
+	Path struct {
+		Subject rbac.SubjectKey `json:"subject" yaml:"subject"`
+		Binding rbac.Key        `json:"binding" yaml:"binding"`
+		Role    rbac.Key        `json:"role" yaml:"role"`
+	}
+)
+
+// ParseSeverity validates a severity, empty defaults to low
+func ParseSeverity(s string) (Severity, error) {
+	switch severity := Severity(s); severity {
+	case "":
+		return SeverityLow, nil
+	case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+		return severity, nil
+	default:
+		return "", fmt.Errorf("invalid severity %q", s)
+	}
+}
+
+// rank orders severities from low to critical
+func (s Severity) rank() int {
+	switch s {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityCritical:
+		return 4
+	}
+	return 0
+}
+
+// Run audits the state's roles and cluster roles against the default checks
+func Run(state rbac.State, options Options) Report {
+	return RunChecks(state, options, Checks)
+}
+
+// RunChecks audits the state's roles and cluster roles against the given
+// checks, findings are sorted by severity, check and role
+func RunChecks(state rbac.State, options Options, checks []Check) Report {
+	// find the paths through which subjects are granted each role
+	paths := map[rbac.Key][]Path{}
+	for _, binding := range state.Bindings() {
+		if options.Namespace != "" && binding.Namespace != "" && binding.Namespace != options.Namespace {
+			continue
+		}
+		roleKey := binding.RoleKey()
+		// make sure roles with bindings but no subjects are still audited
+		if _, ok := paths[roleKey]; !ok {
+			paths[roleKey] = []Path{}
+		}
+		for _, subject := range binding.Subjects {
+			paths[roleKey] = append(paths[roleKey], Path{
+				Subject: rbac.NewSubjectKey(subject),
+				Binding: binding.Key(),
+				Role:    roleKey,
+			})
+		}
+	}
+
+	report := Report{
+		Findings: []Finding{},
+		Summary:  map[Severity]int{},
+	}
+	for role, rules := range state.RoleRules() {
+		if options.Namespace != "" {
+			// cluster roles are only of interest if they are bound
+			_, bound := paths[role]
+			if role.Namespace != options.Namespace && !(role.Kind == rbac.KindClusterRole && bound) {
+				continue
+			}
+		}
+		for _, check := range checks {
+			if check.Severity.rank() < options.MinSeverity.rank() {
+				continue
+			}
+			matching := []v1.PolicyRule{}
+			for _, rule := range rules {
+				if check.Matches(rule) {
+					matching = append(matching, rule)
+				}
+			}
+			if len(matching) == 0 {
+				continue
+			}
+			report.Findings = append(report.Findings, Finding{
+				Check:       check.ID,
+				Severity:    check.Severity,
+				Description: check.Description,
+				Role:        role,
+				Rules:       matching,
+				Subjects:    subjects(paths[role]),
+				Paths:       append([]Path{}, paths[role]...),
+			})
+			report.Summary[check.Severity]++
+		}
+	}
+
+	checkOrder := map[string]int{}
+	for i, check := range checks {
+		checkOrder[check.ID] = i
+	}
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity.rank() > b.Severity.rank()
+		}
+		if a.Check != b.Check {
+			return checkOrder[a.Check] < checkOrder[b.Check]
+		}
+		return a.Role.Less(b.Role)
+	})
+
+	return report
+}
+
+// subjects returns the unique subjects of the paths, sorted
+func subjects(paths []Path) []rbac.SubjectKey {
+	seen := map[rbac.SubjectKey]bool{}
+	subjects := []rbac.SubjectKey{}
+	for _, path := range paths {
+		if seen[path.Subject] {
+			continue
+		}
+		seen[path.Subject] = true
+		subjects = append(subjects, path.Subject)
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].String() < subjects[j].String()
+	})
+	return subjects
+}
@@ -0,0 +1,287 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+var (
+	readSecrets = v1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"secrets"},
+		Verbs:     []string{"get", "list"},
+	}
+	execPods = v1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"pods/exec"},
+		Verbs:     []string{"create"},
+	}
+	listPods = v1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"list"},
+	}
+	everything = v1.PolicyRule{
+		APIGroups: []string{"*"},
+		Resources: []string{"*"},
+		Verbs:     []string{"*"},
+	}
+)
+
+func TestRun(t *testing.T) {
+	state := rbac.State{
+		Roles: []v1.Role{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "default"},
+				Rules:      []v1.PolicyRule{readSecrets, listPods},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role2", Namespace: "default"},
+				Rules:      []v1.PolicyRule{listPods},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "other"},
+				Rules:      []v1.PolicyRule{execPods},
+			},
+		},
+		ClusterRoles: []v1.ClusterRole{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "clusterrole1"},
+				Rules:      []v1.PolicyRule{everything},
+			},
+		},
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+		},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{
+			fixtures.ClusterRoleBindingClusterRole1Subject1,
+		},
+	}
+
+	subject1 := rbac.SubjectKey{Kind: "User", Name: "subject1"}
+	role1 := rbac.Key{Kind: rbac.KindRole, Namespace: "default", Name: "role1"}
+	otherRole1 := rbac.Key{Kind: rbac.KindRole, Namespace: "other", Name: "role1"}
+	clusterRole1 := rbac.Key{Kind: rbac.KindClusterRole, Name: "clusterrole1"}
+	clusterRole1Paths := []Path{{
+		Subject: subject1,
+		Binding: rbac.Key{Kind: rbac.KindClusterRoleBinding, Name: "clusterrole1-for-subject1"},
+		Role:    clusterRole1,
+	}}
+	role1Paths := []Path{{
+		Subject: subject1,
+		Binding: rbac.Key{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-subject1"},
+		Role:    role1,
+	}}
+
+	// finding returns the check's finding for a role
+	finding := func(id string, role rbac.Key, rule v1.PolicyRule, subjects []rbac.SubjectKey, paths []Path) Finding {
+		for _, check := range Checks {
+			if check.ID == id {
+				return Finding{
+					Check:       check.ID,
+					Severity:    check.Severity,
+					Description: check.Description,
+					Role:        role,
+					Rules:       []v1.PolicyRule{rule},
+					Subjects:    subjects,
+					Paths:       paths,
+				}
+			}
+		}
+		t.Fatalf("unknown check %s", id)
+		return Finding{}
+	}
+	clusterRole1Finding := func(id string) Finding {
+		return finding(id, clusterRole1, everything, []rbac.SubjectKey{subject1}, clusterRole1Paths)
+	}
+	criticalFindings := []Finding{
+		clusterRole1Finding("wildcard-verbs"),
+		clusterRole1Finding("wildcard-resources"),
+		clusterRole1Finding("escalate"),
+		clusterRole1Finding("bind"),
+		clusterRole1Finding("impersonate"),
+		clusterRole1Finding("nodes-proxy"),
+	}
+
+	tests := []struct {
+		name    string
+		options Options
+		want    Report
+	}{
+		{
+			name:    "all namespaces",
+			options: Options{},
+			want: Report{
+				Findings: append(
+					criticalFindings,
+					clusterRole1Finding("pods-exec"),
+					finding("pods-exec", otherRole1, execPods, []rbac.SubjectKey{}, []Path{}),
+					clusterRole1Finding("secrets-read"),
+					finding("secrets-read", role1, readSecrets, []rbac.SubjectKey{subject1}, role1Paths),
+					clusterRole1Finding("rolebindings-write"),
+					clusterRole1Finding("token-request"),
+				),
+				Summary: map[Severity]int{
+					SeverityCritical: 6,
+					SeverityHigh:     6,
+				},
+			},
+		},
+		{
+			name:    "other namespace only includes its roles and bound cluster roles",
+			options: Options{Namespace: "other"},
+			want: Report{
+				Findings: append(
+					criticalFindings,
+					clusterRole1Finding("pods-exec"),
+					finding("pods-exec", otherRole1, execPods, []rbac.SubjectKey{}, []Path{}),
+					clusterRole1Finding("secrets-read"),
+					clusterRole1Finding("rolebindings-write"),
+					clusterRole1Finding("token-request"),
+				),
+				Summary: map[Severity]int{
+					SeverityCritical: 6,
+					SeverityHigh:     5,
+				},
+			},
+		},
+		{
+			name:    "critical only",
+			options: Options{MinSeverity: SeverityCritical},
+			want: Report{
+				Findings: criticalFindings,
+				Summary: map[Severity]int{
+					SeverityCritical: 6,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Run(state, tt.options)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	got, err := ParseSeverity("")
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, SeverityLow, got)
+
+	got, err = ParseSeverity("high")
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, SeverityHigh, got)
+
+	_, err = ParseSeverity("urgent")
+	require.Error(t, err, "expected error but got none")
+}
+
+func TestLoadRules(t *testing.T) {
+	defaultIDs := func(except ...string) []string {
+		ids := []string{}
+		for _, check := range Checks {
+			if !contains(except, check.ID) {
+				ids = append(ids, check.ID)
+			}
+		}
+		return ids
+	}
+	tests := []struct {
+		name    string
+		rules   string
+		wantIDs []string
+		wantErr string
+	}{
+		{
+			name:    "no rules, default checks",
+			rules:   "{}",
+			wantIDs: defaultIDs(),
+		},
+		{
+			name: "disabled and added checks, success",
+			rules: `
+disable: [secrets-read, pods-exec]
+checks:
+  - id: pods-list
+    severity: medium
+    description: can list pods
+    allows:
+      - verb: list
+        resource: pods
+`,
+			wantIDs: append(defaultIDs("secrets-read", "pods-exec"), "pods-list"),
+		},
+		{
+			name:    "unknown disabled check, failure",
+			rules:   "disable: [secrets-write]\n",
+			wantErr: `can not disable unknown check "secrets-write"`,
+		},
+		{
+			name:    "existing check, failure",
+			rules:   "checks:\n  - id: bind\n    allows: [{verb: bind}]\n",
+			wantErr: `check "bind" already exists`,
+		},
+		{
+			name:    "check without requests, failure",
+			rules:   "checks:\n  - id: pods-list\n",
+			wantErr: `check "pods-list" is missing the requests it allows`,
+		},
+		{
+			name:    "invalid severity, failure",
+			rules:   "checks:\n  - id: pods-list\n    severity: urgent\n    allows: [{verb: list, resource: pods}]\n",
+			wantErr: `check "pods-list" has an invalid severity "urgent"`,
+		},
+		{
+			name:    "unknown field, failure",
+			rules:   "checks:\n  - id: pods-list\n    allow: [{verb: list, resource: pods}]\n",
+			wantErr: "failed to parse rules",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "audit")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "rules.yaml")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tt.rules), 0600))
+
+			checks, err := LoadRules(path)
+			if tt.wantErr != "" {
+				require.Error(t, err, "expected error but got none")
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err, "did not expect error")
+			ids := []string{}
+			for _, check := range checks {
+				ids = append(ids, check.ID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+
+	// added checks match the rules allowing their requests
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("checks:\n  - id: pods-list\n    severity: medium\n    allows: [{verb: list, resource: pods}]\n"), 0600))
+	checks, err := LoadRules(path)
+	require.NoError(t, err, "did not expect error")
+	podsList := checks[len(checks)-1]
+	assert.Equal(t, SeverityMedium, podsList.Severity)
+	assert.True(t, podsList.Matches(listPods))
+	assert.False(t, podsList.Matches(execPods))
+}
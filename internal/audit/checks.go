@@ -0,0 +1,142 @@
+package audit
+
+import (
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	rbacAPIGroup = "rbac.authorization.k8s.io"
+)
+
+type (
+	// Check looks for a single kind of dangerous grant in policy rules
+	Check struct {
+		ID          string   `json:"id" yaml:"id"`
+		Severity    Severity `json:"severity" yaml:"severity"`
+		Description string   `json:"description" yaml:"description"`
+		// Matches checks if the rule grants what the check is looking for
+		Matches func(rule v1.PolicyRule) bool `json:"-" yaml:"-"`
+	}
+)
+
+// Checks are the checks the audit runs by default
+var Checks = []Check{
+	{
+		ID:          "wildcard-verbs",
+		Severity:    SeverityCritical,
+		Description: "grants all verbs",
+		Matches: func(rule v1.PolicyRule) bool {
+			return contains(rule.Verbs, v1.VerbAll)
+		},
+	},
+	{
+		ID:          "wildcard-resources",
+		Severity:    SeverityCritical,
+		Description: "grants access to all resources",
+		Matches: func(rule v1.PolicyRule) bool {
+			return contains(rule.Resources, v1.ResourceAll)
+		},
+	},
+	{
+		ID:          "escalate",
+		Severity:    SeverityCritical,
+		Description: "can grant permissions it does not have by escalating roles",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "escalate", APIGroup: rbacAPIGroup, Resource: "roles"},
+			rbac.Attributes{Verb: "escalate", APIGroup: rbacAPIGroup, Resource: "clusterroles"},
+		),
+	},
+	{
+		ID:          "bind",
+		Severity:    SeverityCritical,
+		Description: "can bind roles with permissions it does not have",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "bind", APIGroup: rbacAPIGroup, Resource: "roles"},
+			rbac.Attributes{Verb: "bind", APIGroup: rbacAPIGroup, Resource: "clusterroles"},
+		),
+	},
+	{
+		ID:          "impersonate",
+		Severity:    SeverityCritical,
+		Description: "can impersonate other users, groups or service accounts",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "impersonate", Resource: "users"},
+			rbac.Attributes{Verb: "impersonate", Resource: "groups"},
+			rbac.Attributes{Verb: "impersonate", Resource: "serviceaccounts"},
+		),
+	},
+	{
+		ID:          "pods-exec",
+		Severity:    SeverityHigh,
+		Description: "can execute commands in pods",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "create", Resource: "pods", Subresource: "exec"},
+		),
+	},
+	{
+		ID:          "secrets-read",
+		Severity:    SeverityHigh,
+		Description: "can read secrets",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "get", Resource: "secrets"},
+			rbac.Attributes{Verb: "list", Resource: "secrets"},
+			rbac.Attributes{Verb: "watch", Resource: "secrets"},
+		),
+	},
+	{
+		ID:          "nodes-proxy",
+		Severity:    SeverityCritical,
+		Description: "can access the kubelet api through the node proxy",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "get", Resource: "nodes", Subresource: "proxy"},
+			rbac.Attributes{Verb: "create", Resource: "nodes", Subresource: "proxy"},
+		),
+	},
+	{
+		ID:          "rolebindings-write",
+		Severity:    SeverityHigh,
+		Description: "can create or modify role bindings",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "create", APIGroup: rbacAPIGroup, Resource: "rolebindings"},
+			rbac.Attributes{Verb: "update", APIGroup: rbacAPIGroup, Resource: "rolebindings"},
+			rbac.Attributes{Verb: "patch", APIGroup: rbacAPIGroup, Resource: "rolebindings"},
+			rbac.Attributes{Verb: "create", APIGroup: rbacAPIGroup, Resource: "clusterrolebindings"},
+			rbac.Attributes{Verb: "update", APIGroup: rbacAPIGroup, Resource: "clusterrolebindings"},
+			rbac.Attributes{Verb: "patch", APIGroup: rbacAPIGroup, Resource: "clusterrolebindings"},
+		),
+	},
+	{
+		ID:          "token-request",
+		Severity:    SeverityHigh,
+		Description: "can request tokens for service accounts",
+		Matches: allowsAny(
+			rbac.Attributes{Verb: "create", Resource: "serviceaccounts", Subresource: "token"},
+		),
+	},
+}
+
+// allowsAny returns a matcher for rules that allow any of the requests,
+// requests have no resource name so rules restricted to specific resource
+// names do not match
+func allowsAny(requests ...rbac.Attributes) func(rule v1.PolicyRule) bool {
+	return func(rule v1.PolicyRule) bool {
+		for _, request := range requests {
+			if rbac.RuleAllows(rule, request) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// contains checks if the string is in the slice
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
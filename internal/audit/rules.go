@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+type (
+	// Rules change the checks audits run, default checks can be disabled
+	// and checks for other grants added
+	Rules struct {
+		Disable []string `json:"disable,omitempty" yaml:"disable,omitempty"`
+		Checks  []Rule   `json:"checks,omitempty" yaml:"checks,omitempty"`
+	}
+	// Rule is a check for policy rules that allow any of the requests
+	Rule struct {
+		ID          string            `json:"id" yaml:"id"`
+		Severity    Severity          `json:"severity" yaml:"severity"`
+		Description string            `json:"description" yaml:"description"`
+		Allows      []rbac.Attributes `json:"allows" yaml:"allows"`
+	}
+)
+
+// LoadRules loads audit rules from a yaml file, and returns the checks they
+// make up
+func LoadRules(path string) ([]Check, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	rules := &Rules{}
+	if err := yaml.UnmarshalStrict(b, rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	checks, err := rules.checks()
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+	return checks, nil
+}
+
+// checks returns the default checks that aren't disabled, followed by the
+// checks of the rules
+func (r *Rules) checks() ([]Check, error) {
+	disabled := map[string]bool{}
+	for _, id := range r.Disable {
+		if !isDefaultCheck(id) {
+			return nil, fmt.Errorf("can not disable unknown check %q", id)
+		}
+		disabled[id] = true
+	}
+
+	checks := []Check{}
+	ids := map[string]bool{}
+	for _, check := range Checks {
+		ids[check.ID] = true
+		if !disabled[check.ID] {
+			checks = append(checks, check)
+		}
+	}
+	for _, rule := range r.Checks {
+		switch {
+		case rule.ID == "":
+			return nil, errors.New("check is missing an id")
+		case ids[rule.ID]:
+			return nil, fmt.Errorf("check %q already exists", rule.ID)
+		case len(rule.Allows) == 0:
+			return nil, fmt.Errorf("check %q is missing the requests it allows", rule.ID)
+		}
+		severity, err := ParseSeverity(string(rule.Severity))
+		if err != nil {
+			return nil, fmt.Errorf("check %q has an %w", rule.ID, err)
+		}
+		ids[rule.ID] = true
+		checks = append(checks, Check{
+			ID:          rule.ID,
+			Severity:    severity,
+			Description: rule.Description,
+			Matches:     allowsAny(rule.Allows...),
+		})
+	}
+	return checks, nil
+}
+
+// isDefaultCheck checks if the id is one of the default checks
+func isDefaultCheck(id string) bool {
+	for _, check := range Checks {
+		if check.ID == id {
+			return true
+		}
+	}
+	return false
+}
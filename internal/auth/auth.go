@@ -0,0 +1,175 @@
+// Package auth authenticates the callers of HTTP requests and gRPC calls by
+// the bearer tokens they present
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+
+	"github.com/geoah/go-kube-api/internal/respond"
+)
+
+const (
+	// CallerKey is the key of the name of the authenticated caller in the
+	// gin context
+	CallerKey = "caller"
+	// bearerPrefix is the scheme of authorization headers with tokens
+	bearerPrefix = "bearer "
+)
+
+type (
+	// Tokens authenticates callers by their bearer token, tokens are only
+	// kept hashed
+	Tokens struct {
+		callers map[[sha256.Size]byte]string
+	}
+	// Caller is a named caller with its token
+	Caller struct {
+		Name  string `json:"name" yaml:"name"`
+		Token string `json:"token" yaml:"token"`
+	}
+	// authenticatedStream is a gRPC stream whose context has the name of its
+	// authenticated caller
+	authenticatedStream struct {
+		grpc.ServerStream
+		ctx context.Context
+	}
+	// callerContextKey is the key of the name of the authenticated caller in
+	// the context of gRPC calls
+	callerContextKey struct{}
+	// tokensFile lists the callers allowed to call the service
+	tokensFile struct {
+		Callers []Caller `json:"callers" yaml:"callers"`
+	}
+)
+
+// NewTokens given the callers allowed to call the service, names and tokens
+// have to be set and unique
+func NewTokens(callers []Caller) (*Tokens, error) {
+	t := &Tokens{
+		callers: map[[sha256.Size]byte]string{},
+	}
+	names := map[string]bool{}
+	for i, caller := range callers {
+		hash := sha256.Sum256([]byte(caller.Token))
+		switch {
+		case caller.Name == "":
+			return nil, fmt.Errorf("caller %d is missing a name", i)
+		case caller.Token == "":
+			return nil, fmt.Errorf("caller %q is missing a token", caller.Name)
+		case names[caller.Name]:
+			return nil, fmt.Errorf("caller %q already exists", caller.Name)
+		case t.callers[hash] != "":
+			return nil, fmt.Errorf("caller %q has the token of another caller", caller.Name)
+		}
+		names[caller.Name] = true
+		t.callers[hash] = caller.Name
+	}
+	return t, nil
+}
+
+// LoadTokens loads the callers allowed to call the service from a yaml file
+func LoadTokens(path string) (*Tokens, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	file := &tokensFile{}
+	if err := yaml.UnmarshalStrict(b, file); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens: %w", err)
+	}
+	t, err := NewTokens(file.Callers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tokens: %w", err)
+	}
+	return t, nil
+}
+
+// Caller returns the name of the caller of the authorization header, if its
+// bearer token is known
+func (t *Tokens) Caller(authorization string) (string, bool) {
+	if len(authorization) <= len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	// tokens are looked up by their hash, so how long the lookup takes says
+	// nothing about the tokens
+	name, ok := t.callers[sha256.Sum256([]byte(authorization[len(bearerPrefix):]))]
+	return name, ok
+}
+
+// Authenticate handles requests only if their caller is known, and sets its
+// name in the context. Other requests get a 401 Unauthorized response.
+func (t *Tokens) Authenticate(c *gin.Context) {
+	name, ok := t.Caller(c.GetHeader("Authorization"))
+	if !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		respond.Abort(c, http.StatusUnauthorized, "missing or unknown bearer token")
+		return
+	}
+	c.Set(CallerKey, name)
+	c.Next()
+}
+
+// UnaryServerInterceptor authenticates gRPC calls the same way as HTTP
+// requests, and sets the caller's name in the context. Unknown callers get an
+// unauthenticated error.
+func (t *Tokens) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := t.authenticateCall(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates gRPC streams the same way as HTTP
+// requests, and sets the caller's name in the context. Unknown callers get an
+// unauthenticated error.
+func (t *Tokens) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := t.authenticateCall(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{
+			ServerStream: stream,
+			ctx:          ctx,
+		})
+	}
+}
+
+// authenticateCall returns the context with the name of the gRPC call's
+// caller, or an unauthenticated error if the caller is unknown
+func (t *Tokens) authenticateCall(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md.Get("authorization") {
+		if name, ok := t.Caller(authorization); ok {
+			return context.WithValue(ctx, callerContextKey{}, name), nil
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing or unknown bearer token")
+}
+
+// CallerFromContext returns the name of the authenticated caller of a gRPC
+// call, if it was authenticated
+func CallerFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(callerContextKey{}).(string)
+	return name, ok
+}
+
+// Context returns the context of the stream with its caller
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	callers = []Caller{
+		{Name: "ci", Token: "token1"},
+		{Name: "dashboard", Token: "token2"},
+	}
+)
+
+func TestLoadTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  string
+		wantErr string
+	}{
+		{
+			name:   "callers, success",
+			tokens: "callers:\n  - name: ci\n    token: token1\n  - name: dashboard\n    token: token2\n",
+		},
+		{
+			name:    "missing name, failure",
+			tokens:  "callers:\n  - token: token1\n",
+			wantErr: "caller 0 is missing a name",
+		},
+		{
+			name:    "missing token, failure",
+			tokens:  "callers:\n  - name: ci\n",
+			wantErr: `caller "ci" is missing a token`,
+		},
+		{
+			name:    "duplicate name, failure",
+			tokens:  "callers:\n  - name: ci\n    token: token1\n  - name: ci\n    token: token2\n",
+			wantErr: `caller "ci" already exists`,
+		},
+		{
+			name:    "duplicate token, failure",
+			tokens:  "callers:\n  - name: ci\n    token: token1\n  - name: dashboard\n    token: token1\n",
+			wantErr: `caller "dashboard" has the token of another caller`,
+		},
+		{
+			name:    "unknown field, failure",
+			tokens:  "callers:\n  - name: ci\n    secret: token1\n",
+			wantErr: "failed to parse tokens",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "auth")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "tokens.yaml")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tt.tokens), 0600))
+
+			tokens, err := LoadTokens(path)
+			if tt.wantErr != "" {
+				require.Error(t, err, "expected error but got none")
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err, "did not expect error")
+			name, ok := tokens.Caller("Bearer token2")
+			assert.True(t, ok)
+			assert.Equal(t, "dashboard", name)
+		})
+	}
+}
+
+func TestTokens_Authenticate(t *testing.T) {
+	tokens, err := NewTokens(callers)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+		wantCaller    string
+	}{
+		{
+			name:          "known token, success",
+			authorization: "Bearer token1",
+			wantCode:      http.StatusOK,
+			wantCaller:    "ci",
+		},
+		{
+			name:          "scheme is case insensitive, success",
+			authorization: "bearer token2",
+			wantCode:      http.StatusOK,
+			wantCaller:    "dashboard",
+		},
+		{
+			name:     "missing token, unauthorized",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "unknown token, unauthorized",
+			authorization: "Bearer token3",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "other scheme, unauthorized",
+			authorization: "Basic token1",
+			wantCode:      http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(tokens.Authenticate)
+			r.GET("/", func(c *gin.Context) {
+				c.String(http.StatusOK, c.GetString(CallerKey))
+			})
+
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode != http.StatusOK {
+				assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+				assert.Contains(t, rr.Body.String(), "missing or unknown bearer token")
+				return
+			}
+			assert.Equal(t, tt.wantCaller, rr.Body.String())
+		})
+	}
+}
+
+func TestTokens_UnaryServerInterceptor(t *testing.T) {
+	tokens, err := NewTokens(callers)
+	require.NoError(t, err)
+	interceptor := tokens.UnaryServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		name, _ := CallerFromContext(ctx)
+		return name, nil
+	}
+	call := func(authorization ...string) (interface{}, error) {
+		ctx := context.Background()
+		if len(authorization) > 0 {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization[0]))
+		}
+		return interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	}
+
+	name, err := call("Bearer token1")
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", name)
+	_, err = call("Bearer token3")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = call()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,398 @@
+// Package config loads the service's configuration from a yaml file, the
+// environment and flags, and reloads it when it changes
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v2"
+
+	"github.com/geoah/go-kube-api/internal/graphqlapi"
+	"github.com/geoah/go-kube-api/internal/limits"
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+type (
+	// Config of the service. Every setting can be set in the config file,
+	// as an environment variable named after its envconfig tag, or as a flag
+	// named after it with dashes, each overriding the ones before it.
+	Config struct {
+		Listen    Listen    `json:"listen" yaml:"listen"`
+		TLS       TLS       `json:"tls" yaml:"tls"`
+		Cluster   Cluster   `json:"cluster" yaml:"cluster"`
+		Auth      Auth      `json:"auth" yaml:"auth"`
+		Limits    Limits    `json:"limits" yaml:"limits"`
+		Regexps   Regexps   `json:"regexps" yaml:"regexps"`
+		Cache     Cache     `json:"cache" yaml:"cache"`
+		GraphQL   GraphQL   `json:"graphql" yaml:"graphql"`
+		Snapshots Snapshots `json:"snapshots" yaml:"snapshots"`
+		Notifier  Notifier  `json:"notifier" yaml:"notifier"`
+		Directory Directory `json:"directory" yaml:"directory"`
+		Audit     Audit     `json:"audit" yaml:"audit"`
+	}
+	// Listen are the addresses to serve on. The admin address defaults to
+	// localhost, so the configuration and metrics are only reachable from
+	// within the pod, such as with kubectl port-forward, unless it is set to
+	// an address of the pod network.
+	Listen struct {
+		HTTP  string `json:"http" yaml:"http" envconfig:"bind_address" desc:"address to serve HTTP on"`
+		GRPC  string `json:"grpc,omitempty" yaml:"grpc,omitempty" envconfig:"grpc_bind_address" desc:"address to serve gRPC on, if any"`
+		Admin string `json:"admin,omitempty" yaml:"admin,omitempty" envconfig:"admin_bind_address" desc:"address to serve the configuration and metrics on, if any"`
+	}
+	// TLS are the certificate and key to serve HTTP and gRPC with, plaintext
+	// is served if not set
+	TLS struct {
+		CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty" envconfig:"tls_cert_file" desc:"path of the TLS certificate"`
+		KeyFile  string `json:"keyFile,omitempty" yaml:"keyFile,omitempty" envconfig:"tls_key_file" desc:"path of the TLS key"`
+	}
+	// Cluster is the cluster whose bindings are served, connected to with
+	// the in-cluster config unless a kubeconfig is set. Only a single cluster
+	// is served per instance, serving a list of clusters is out of scope
+	// since every API would have to say which cluster it is about, one
+	// instance is deployed per cluster instead.
+	Cluster struct {
+		Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty" envconfig:"kubeconfig" desc:"path of the kubeconfig to connect to the cluster with, in-cluster config if empty"`
+		Context    string `json:"context,omitempty" yaml:"context,omitempty" envconfig:"kube_context" desc:"context of the kubeconfig to use, its current context if empty"`
+	}
+	// Auth configures how callers authenticate, anyone can call the service
+	// unless it has tokens
+	Auth struct {
+		TokensPath string `json:"tokensPath,omitempty" yaml:"tokensPath,omitempty" envconfig:"auth_tokens_path" desc:"path of the bearer tokens callers authenticate with"`
+	}
+	// Limits bound how many and how large requests callers can make
+	Limits struct {
+		RateLimit             float64  `json:"rateLimit" yaml:"rateLimit" envconfig:"rate_limit" desc:"requests per second each caller can make, unlimited if 0"`
+		RateLimitBurst        int      `json:"rateLimitBurst" yaml:"rateLimitBurst" envconfig:"rate_limit_burst" desc:"requests each caller can make at once"`
+		RateLimitCallerHeader string   `json:"rateLimitCallerHeader,omitempty" yaml:"rateLimitCallerHeader,omitempty" envconfig:"rate_limit_caller_header" desc:"request header identifying callers instead of their IP"`
+		MaxRequestBodyBytes   int64    `json:"maxRequestBodyBytes" yaml:"maxRequestBodyBytes" envconfig:"max_request_body_bytes" desc:"largest request body accepted"`
+		MaxSubjectNames       int      `json:"maxSubjectNames" yaml:"maxSubjectNames" envconfig:"max_subject_names" desc:"most subject names and patterns per request, unlimited if 0"`
+		TrustedProxies        []string `json:"trustedProxies,omitempty" yaml:"trustedProxies,omitempty" envconfig:"trusted_proxies" desc:"comma separated IPs or CIDRs of proxies trusted to set X-Forwarded-For and the caller header"`
+	}
+	// Regexps bound the regular expressions of requests
+	Regexps struct {
+		MaxLength      int `json:"maxLength" yaml:"maxLength" envconfig:"regexp_max_length" desc:"longest regular expression or glob in bytes, unlimited if 0"`
+		MaxProgramSize int `json:"maxProgramSize" yaml:"maxProgramSize" envconfig:"regexp_max_program_size" desc:"most instructions a regular expression can compile to, unlimited if 0"`
+		CacheSize      int `json:"cacheSize" yaml:"cacheSize" envconfig:"regexp_cache_size" desc:"compiled regular expressions to keep"`
+	}
+	// Cache configures the response cache, disabled unless it has a ttl
+	Cache struct {
+		TTL     Duration `json:"ttl" yaml:"ttl" envconfig:"response_cache_ttl" desc:"how long to cache responses for, disabled if 0"`
+		MaxSize int      `json:"maxSize" yaml:"maxSize" envconfig:"response_cache_max_size" desc:"most responses to cache"`
+	}
+	// GraphQL bounds the queries of the GraphQL endpoint
+	GraphQL struct {
+		MaxComplexity int `json:"maxComplexity" yaml:"maxComplexity" envconfig:"graphql_max_complexity" desc:"maximum estimated cost of queries"`
+		MaxDepth      int `json:"maxDepth" yaml:"maxDepth" envconfig:"graphql_max_depth" desc:"maximum depth of queries"`
+	}
+	// Snapshots configures periodic snapshots, disabled unless they have a
+	// path
+	Snapshots struct {
+		Path      string   `json:"path,omitempty" yaml:"path,omitempty" envconfig:"snapshots_path" desc:"path of the snapshot database"`
+		Interval  Duration `json:"interval" yaml:"interval" envconfig:"snapshots_interval" desc:"how often to take snapshots"`
+		Retention Duration `json:"retention" yaml:"retention" envconfig:"snapshots_retention" desc:"how long to keep snapshots for, forever if 0"`
+	}
+	// Notifier configures webhook notifications, disabled unless they have a
+	// config
+	Notifier struct {
+		Config         string `json:"config,omitempty" yaml:"config,omitempty" envconfig:"notifier_config" desc:"path of the notifier config"`
+		DeadLetterPath string `json:"deadLetterPath,omitempty" yaml:"deadLetterPath,omitempty" envconfig:"notifier_dead_letter_path" desc:"path of the log of notifications that could not be delivered"`
+	}
+	// Directory configures the users and groups subjects are checked and
+	// expanded against
+	Directory struct {
+		SubjectsPath string `json:"subjectsPath,omitempty" yaml:"subjectsPath,omitempty" envconfig:"subjects_directory_path" desc:"path of the subjects directory"`
+		GroupsPath   string `json:"groupsPath,omitempty" yaml:"groupsPath,omitempty" envconfig:"groups_path" desc:"path of the static groups"`
+	}
+	// Audit configures the checks audits run, the default ones unless it has
+	// rules
+	Audit struct {
+		RulesPath string `json:"rulesPath,omitempty" yaml:"rulesPath,omitempty" envconfig:"audit_rules_path" desc:"path of the audit rules disabling and adding checks"`
+	}
+)
+
+// Default returns the configuration used for anything that isn't set
+func Default() *Config {
+	return &Config{
+		Listen: Listen{
+			HTTP:  "localhost:8080",
+			Admin: "localhost:8081",
+		},
+		Limits: Limits{
+			RateLimitBurst:      20,
+			MaxRequestBodyBytes: 10 << 20,
+			MaxSubjectNames:     1000,
+		},
+		Regexps: Regexps{
+			MaxLength:      rbac.DefaultMaxRegexpLength,
+			MaxProgramSize: rbac.DefaultMaxRegexpProgramSize,
+			CacheSize:      rbac.DefaultRegexpCacheSize,
+		},
+		Cache: Cache{
+			MaxSize: 1000,
+		},
+		GraphQL: GraphQL{
+			MaxComplexity: graphqlapi.DefaultMaxComplexity,
+			MaxDepth:      graphqlapi.DefaultMaxDepth,
+		},
+		Snapshots: Snapshots{
+			Interval: Duration(time.Hour),
+		},
+	}
+}
+
+// Load the configuration from the config file, given by the -config flag or
+// the CONFIG_PATH environment variable, the environment and the flags in
+// args. Returns the path of the config file, if any.
+func Load(args []string) (*Config, string, error) {
+	// flags are parsed first to find the config file, and applied last
+	flags := flag.NewFlagSet("go-kube-api", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_PATH"), "path of the yaml config file")
+	flagged := Default()
+	if err := registerFlags(flags, flagged); err != nil {
+		return nil, "", err
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	config := Default()
+	if *path != "" {
+		b, err := ioutil.ReadFile(*path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(b, config); err != nil {
+			return nil, "", fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	if err := envconfig.Process("", config); err != nil {
+		return nil, "", fmt.Errorf("failed to parse environment: %w", err)
+	}
+	overrides := fields(flagged)
+	current := fields(config)
+	flags.Visit(func(f *flag.Flag) {
+		if field, ok := overrides[f.Name]; ok {
+			current[f.Name].Set(field)
+		}
+	})
+
+	if err := config.Validate(); err != nil {
+		return nil, "", err
+	}
+	return config, *path, nil
+}
+
+// Validate checks that the configuration makes sense
+func (c *Config) Validate() error {
+	switch {
+	case c.Listen.HTTP == "":
+		return errors.New("invalid listen.http, must be set")
+	case c.Listen.Admin != "" && c.Listen.Admin == c.Listen.HTTP:
+		return errors.New("invalid listen.admin, must not be listen.http")
+	case (c.TLS.CertFile == "") != (c.TLS.KeyFile == ""):
+		return errors.New("invalid tls, certFile and keyFile must be set together")
+	case c.Cluster.Context != "" && c.Cluster.Kubeconfig == "":
+		return errors.New("invalid cluster.context, cluster.kubeconfig must be set")
+	case c.Limits.RateLimit < 0:
+		return errors.New("invalid limits.rateLimit, must not be negative")
+	case c.Limits.RateLimit > 0 && c.Limits.RateLimitBurst <= 0:
+		return errors.New("invalid limits.rateLimitBurst, must be positive")
+	case c.Limits.MaxRequestBodyBytes <= 0:
+		return errors.New("invalid limits.maxRequestBodyBytes, must be positive")
+	case c.Limits.MaxSubjectNames < 0:
+		return errors.New("invalid limits.maxSubjectNames, must not be negative")
+	case !validProxies(c.Limits.TrustedProxies):
+		return errors.New("invalid limits.trustedProxies, must be IPs or CIDRs")
+	case c.Regexps.MaxLength < 0, c.Regexps.MaxProgramSize < 0, c.Regexps.CacheSize < 0:
+		return errors.New("invalid regexps, limits must not be negative")
+	case c.Cache.TTL < 0:
+		return errors.New("invalid cache.ttl, must not be negative")
+	case c.Cache.TTL > 0 && c.Cache.MaxSize <= 0:
+		return errors.New("invalid cache.maxSize, must be positive")
+	case c.GraphQL.MaxComplexity <= 0:
+		return errors.New("invalid graphql.maxComplexity, must be positive")
+	case c.GraphQL.MaxDepth <= 0:
+		return errors.New("invalid graphql.maxDepth, must be positive")
+	case c.Snapshots.Path != "" && c.Snapshots.Interval <= 0:
+		return errors.New("invalid snapshots.interval, must be positive")
+	case c.Snapshots.Retention < 0:
+		return errors.New("invalid snapshots.retention, must not be negative")
+	}
+	return nil
+}
+
+// RestartRequired returns the sections of the configuration that changed
+// since the previous one but can't be changed without restarting
+func (c *Config) RestartRequired(previous *Config) []string {
+	changed := []string{}
+	if c.Listen != previous.Listen {
+		changed = append(changed, "listen")
+	}
+	if c.TLS != previous.TLS {
+		changed = append(changed, "tls")
+	}
+	if c.Cluster != previous.Cluster {
+		changed = append(changed, "cluster")
+	}
+	if c.Auth != previous.Auth {
+		changed = append(changed, "auth")
+	}
+	// the rate limiter is only constructed if rate limiting is enabled
+	if (c.Limits.RateLimit > 0) != (previous.Limits.RateLimit > 0) {
+		changed = append(changed, "limits.rateLimit")
+	}
+	// so are the router and the trusted proxies of the rate limiter
+	if !reflect.DeepEqual(c.Limits.TrustedProxies, previous.Limits.TrustedProxies) {
+		changed = append(changed, "limits.trustedProxies")
+	}
+	if c.Cache != previous.Cache {
+		changed = append(changed, "cache")
+	}
+	if c.Snapshots != previous.Snapshots {
+		changed = append(changed, "snapshots")
+	}
+	if c.Notifier != previous.Notifier {
+		changed = append(changed, "notifier")
+	}
+	if c.Directory != previous.Directory {
+		changed = append(changed, "directory")
+	}
+	if c.Audit != previous.Audit {
+		changed = append(changed, "audit")
+	}
+	return changed
+}
+
+// validProxies checks that every trusted proxy is an IP or a CIDR
+func validProxies(proxies []string) bool {
+	_, err := limits.ParseProxies(proxies)
+	return err == nil
+}
+
+// inEffect returns the configuration in effect once c is applied while
+// serving with previous, which keeps the settings that can't be changed
+// without restarting
+func (c *Config) inEffect(previous *Config) *Config {
+	config := *c
+	config.Listen = previous.Listen
+	config.TLS = previous.TLS
+	config.Cluster = previous.Cluster
+	config.Auth = previous.Auth
+	if (c.Limits.RateLimit > 0) != (previous.Limits.RateLimit > 0) {
+		config.Limits.RateLimit = previous.Limits.RateLimit
+		config.Limits.RateLimitBurst = previous.Limits.RateLimitBurst
+		config.Limits.RateLimitCallerHeader = previous.Limits.RateLimitCallerHeader
+	}
+	config.Limits.TrustedProxies = previous.Limits.TrustedProxies
+	config.Cache = previous.Cache
+	config.Snapshots = previous.Snapshots
+	config.Notifier = previous.Notifier
+	config.Directory = previous.Directory
+	config.Audit = previous.Audit
+	return &config
+}
+
+// registerFlags registers a flag for every setting of the configuration,
+// named after its environment variable
+func registerFlags(flags *flag.FlagSet, config *Config) error {
+	v := reflect.ValueOf(config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		section := v.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			tag := section.Type().Field(j)
+			value, err := newFlagValue(section.Field(j))
+			if err != nil {
+				return fmt.Errorf("failed to register flag for %s: %w", tag.Name, err)
+			}
+			flags.Var(value, flagName(tag), tag.Tag.Get("desc"))
+		}
+	}
+	return nil
+}
+
+// fields returns the settings of the configuration by flag name
+func fields(config *Config) map[string]reflect.Value {
+	settings := map[string]reflect.Value{}
+	v := reflect.ValueOf(config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		section := v.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			settings[flagName(section.Type().Field(j))] = section.Field(j)
+		}
+	}
+	return settings
+}
+
+// flagName returns the name of the setting's flag
+func flagName(field reflect.StructField) string {
+	return strings.Replace(field.Tag.Get("envconfig"), "_", "-", -1)
+}
+
+type (
+	// flagValue sets a setting from a flag
+	flagValue struct {
+		field reflect.Value
+	}
+)
+
+// newFlagValue returns a flag.Value for the setting, if its type is
+// supported
+func newFlagValue(field reflect.Value) (flag.Value, error) {
+	if value, ok := field.Addr().Interface().(flag.Value); ok {
+		return value, nil
+	}
+	switch field.Kind() {
+	case reflect.String, reflect.Int, reflect.Int64, reflect.Float64:
+		return flagValue{field: field}, nil
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			return flagValue{field: field}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported type %s", field.Type())
+}
+
+// String returns the setting's value
+func (f flagValue) String() string {
+	if !f.field.IsValid() {
+		return ""
+	}
+	if values, ok := f.field.Interface().([]string); ok {
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(f.field.Interface())
+}
+
+// Set parses the setting's value
+func (f flagValue) Set(value string) error {
+	switch f.field.Kind() {
+	case reflect.String:
+		f.field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.field.SetInt(i)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.field.SetFloat(n)
+
+	case reflect.Slice:
+		// comma separated, like the environment variables
+		f.field.Set(reflect.ValueOf(strings.Split(value, ",")))
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeFile writes the config file in a temporary directory and returns its
+// path
+func writeFile(t *testing.T, dir, contents string) string {
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	// the kubeconfig is commonly set in the environment
+	if kubeconfig, ok := os.LookupEnv("KUBECONFIG"); ok {
+		os.Unsetenv("KUBECONFIG")
+		defer os.Setenv("KUBECONFIG", kubeconfig)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		want    func(c *Config)
+		wantErr string
+	}{
+		{
+			name: "defaults, success",
+			want: func(c *Config) {},
+		},
+		{
+			name: "file overrides defaults, success",
+			file: `
+listen:
+  http: :8080
+  grpc: :9090
+limits:
+  rateLimit: 10
+cache:
+  ttl: 5s
+`,
+			want: func(c *Config) {
+				c.Listen.HTTP = ":8080"
+				c.Listen.GRPC = ":9090"
+				c.Limits.RateLimit = 10
+				c.Cache.TTL = Duration(5 * time.Second)
+			},
+		},
+		{
+			name: "env overrides file, flags override env, success",
+			file: `
+listen:
+  http: :8080
+limits:
+  rateLimit: 10
+  maxSubjectNames: 10
+`,
+			env: map[string]string{
+				"BIND_ADDRESS":       ":8081",
+				"RATE_LIMIT":         "20",
+				"SNAPSHOTS_PATH":     "/var/lib/snapshots",
+				"SNAPSHOTS_INTERVAL": "30m",
+			},
+			args: []string{"-rate-limit", "30", "-snapshots-interval", "15m"},
+			want: func(c *Config) {
+				c.Listen.HTTP = ":8081"
+				c.Limits.RateLimit = 30
+				c.Limits.MaxSubjectNames = 10
+				c.Snapshots.Path = "/var/lib/snapshots"
+				c.Snapshots.Interval = Duration(15 * time.Minute)
+			},
+		},
+		{
+			name: "trusted proxies flag, success",
+			args: []string{"-trusted-proxies", "10.0.0.0/8,192.168.1.1"},
+			want: func(c *Config) {
+				c.Limits.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+			},
+		},
+		{
+			name:    "invalid trusted proxy, failure",
+			env:     map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8,proxy"},
+			wantErr: "invalid limits.trustedProxies, must be IPs or CIDRs",
+		},
+		{
+			name:    "unknown setting in file, failure",
+			file:    "limits:\n  rateLimt: 10\n",
+			wantErr: "failed to parse config file",
+		},
+		{
+			name:    "invalid flag, failure",
+			args:    []string{"-max-subject-names", "many"},
+			wantErr: "invalid value",
+		},
+		{
+			name: "kubeconfig and context, success",
+			args: []string{"-kubeconfig", "/etc/go-kube-api/kubeconfig", "-kube-context", "production"},
+			want: func(c *Config) {
+				c.Cluster.Kubeconfig = "/etc/go-kube-api/kubeconfig"
+				c.Cluster.Context = "production"
+			},
+		},
+		{
+			name:    "context without kubeconfig, failure",
+			args:    []string{"-kube-context", "production"},
+			wantErr: "invalid cluster.context, cluster.kubeconfig must be set",
+		},
+		{
+			name:    "admin on the http address, failure",
+			env:     map[string]string{"ADMIN_BIND_ADDRESS": "localhost:8080"},
+			wantErr: "invalid listen.admin, must not be listen.http",
+		},
+		{
+			name:    "invalid config, failure",
+			args:    []string{"-tls-cert-file", "cert.pem"},
+			wantErr: "invalid tls, certFile and keyFile must be set together",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "config")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, dir, tt.file)}, args...)
+			}
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			got, _, err := Load(args)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			want := Default()
+			tt.want(want)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestConfig_RestartRequired(t *testing.T) {
+	previous := Default()
+	current := Default()
+	current.Limits.MaxSubjectNames = 10
+	current.Regexps.MaxLength = 10
+	current.GraphQL.MaxDepth = 5
+	assert.Empty(t, current.RestartRequired(previous))
+
+	current.Limits.RateLimit = 10
+	current.Listen.GRPC = ":9090"
+	current.Limits.TrustedProxies = []string{"10.0.0.0/8"}
+	current.Cache.TTL = Duration(time.Second)
+	assert.Equal(t, []string{"listen", "limits.rateLimit", "limits.trustedProxies", "cache"}, current.RestartRequired(previous))
+}
+
+func TestWatcher_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "limits:\n  maxSubjectNames: 10\n")
+	args := []string{"-config", path}
+
+	config, loadedPath, err := Load(args)
+	require.NoError(t, err)
+	assert.Equal(t, path, loadedPath)
+
+	reloads := make(chan *Config, 10)
+	w := NewWatcher(args, config, path, func(previous, current *Config) {
+		reloads <- current
+	}, zap.NewNop(), WithInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal)
+	go w.Run(ctx, signals)
+
+	// changes to the file are applied
+	writeFile(t, dir, "limits:\n  maxSubjectNames: 20\n")
+	select {
+	case current := <-reloads:
+		assert.Equal(t, 20, current.Limits.MaxSubjectNames)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	// settings that require a restart are not
+	writeFile(t, dir, "listen:\n  http: :9090\nlimits:\n  maxSubjectNames: 30\ncache:\n  ttl: 5s\n")
+	select {
+	case current := <-reloads:
+		assert.Equal(t, 30, current.Limits.MaxSubjectNames)
+		assert.Equal(t, Default().Listen, current.Listen)
+		assert.Equal(t, Default().Cache, current.Cache)
+		assert.Equal(t, current, w.Current())
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	// invalid configurations are not
+	writeFile(t, dir, "limits:\n  maxSubjectNames: -1\n")
+	signals <- os.Interrupt
+	// the second signal is only received once the first reload is done
+	signals <- os.Interrupt
+	assert.Equal(t, 30, w.Current().Limits.MaxSubjectNames)
+	select {
+	case <-reloads:
+		t.Fatal("invalid config was reloaded")
+	default:
+	}
+}
+
+func TestWatcher_Handler(t *testing.T) {
+	config := Default()
+	config.Cache.TTL = Duration(5 * time.Second)
+	w := NewWatcher(nil, config, "", func(previous, current *Config) {}, zap.NewNop())
+
+	r := gin.New()
+	r.GET("/", w.Handler)
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"cache":{"ttl":"5s","maxSize":1000}`)
+	assert.Contains(t, rr.Body.String(), `"interval":"1h0m0s"`)
+}
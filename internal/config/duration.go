@@ -0,0 +1,46 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type (
+	// Duration is a time.Duration written as a string such as "1h30m" in the
+	// config file, environment variables, flags and json
+	Duration time.Duration
+)
+
+// String returns the duration such as "1h30m0s"
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set parses the duration, for flags and environment variables
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalYAML parses the duration from a string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	value := ""
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return d.Set(value)
+}
+
+// MarshalYAML returns the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON returns the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultInterval is how often the config file is checked for changes
+	// by default
+	DefaultInterval = 10 * time.Second
+)
+
+type (
+	// Watcher reloads the configuration when the config file changes or when
+	// asked to, such as on SIGHUP, and calls its reload func with the
+	// previous and current configuration if it's valid. Settings that
+	// require a restart keep their previous values in the current one.
+	Watcher struct {
+		args     []string
+		path     string
+		interval time.Duration
+		reload   func(previous, current *Config)
+		logger   *zap.Logger
+		mutex    sync.Mutex
+		current  *Config
+		checksum []byte
+	}
+	// WatcherOption configures optional features of the Watcher
+	WatcherOption func(*Watcher)
+)
+
+// NewWatcher given the args and the configuration loaded from them, the func
+// applying changes and a logger
+func NewWatcher(
+	args []string,
+	config *Config,
+	path string,
+	reload func(previous, current *Config),
+	logger *zap.Logger,
+	options ...WatcherOption,
+) *Watcher {
+	w := &Watcher{
+		args:     args,
+		path:     path,
+		interval: DefaultInterval,
+		reload:   reload,
+		logger:   logger,
+		current:  config,
+		checksum: checksum(path),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	return w
+}
+
+// WithInterval sets how often the config file is checked for changes
+func WithInterval(interval time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// Current returns the configuration currently in effect
+func (w *Watcher) Current() *Config {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.current
+}
+
+// Run reloads the configuration when the config file changes, if there is
+// one, or a signal is received, until the context is done
+func (w *Watcher) Run(ctx context.Context, signals <-chan os.Signal) {
+	// there's nothing to watch without a config file
+	var ticks <-chan time.Time
+	if w.path != "" {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			w.Reload()
+		case <-ticks:
+			w.mutex.Lock()
+			changed := !bytes.Equal(checksum(w.path), w.checksum)
+			w.mutex.Unlock()
+			if changed {
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload loads the configuration again and applies it if it's valid,
+// otherwise the current one stays in effect
+func (w *Watcher) Reload() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.checksum = checksum(w.path)
+	config, _, err := Load(w.args)
+	if err != nil {
+		w.logger.Error("error reloading config, keeping the current one", zap.Error(err))
+		return
+	}
+	if restart := config.RestartRequired(w.current); len(restart) > 0 {
+		w.logger.Warn("config changes require a restart", zap.Strings("sections", restart))
+	}
+	// the settings that require a restart stay as they were until then
+	config = config.inEffect(w.current)
+	w.reload(w.current, config)
+	w.current = config
+	w.logger.Info("config reloaded")
+}
+
+// Handler handles requests for the configuration currently in effect, as
+// yaml if the request is yaml and json otherwise
+func (w *Watcher) Handler(c *gin.Context) {
+	config := w.Current()
+	if strings.Contains(strings.ToLower(c.ContentType()), "yaml") {
+		c.YAML(http.StatusOK, config)
+		return
+	}
+	c.JSON(http.StatusOK, config)
+}
+
+// checksum returns the checksum of the file's contents, nil if it can't be
+// read
+func checksum(path string) []byte {
+	if path == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
@@ -0,0 +1,192 @@
+package diff
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+type (
+	// Diff describes the changes between two RBAC states
+	Diff struct {
+		AddedBindings   []rbac.Binding  `json:"addedBindings" yaml:"addedBindings"`
+		RemovedBindings []rbac.Binding  `json:"removedBindings" yaml:"removedBindings"`
+		ChangedBindings []BindingChange `json:"changedBindings" yaml:"changedBindings"`
+		SubjectChanges  []SubjectChange `json:"subjectChanges" yaml:"subjectChanges"`
+		WidenedRoles    []RoleChange    `json:"widenedRoles" yaml:"widenedRoles"`
+	}
+	// BindingChange describes a binding whose role or subjects changed
+	BindingChange struct {
+		Before          rbac.Binding `json:"before" yaml:"before"`
+		After           rbac.Binding `json:"after" yaml:"after"`
+		AddedSubjects   []v1.Subject `json:"addedSubjects" yaml:"addedSubjects"`
+		RemovedSubjects []v1.Subject `json:"removedSubjects" yaml:"removedSubjects"`
+	}
+	// SubjectChange describes the permissions a subject gained or lost
+	SubjectChange struct {
+		Subject rbac.SubjectKey   `json:"subject" yaml:"subject"`
+		Gained  []rbac.Permission `json:"gained" yaml:"gained"`
+		Lost    []rbac.Permission `json:"lost" yaml:"lost"`
+	}
+	// RoleChange describes the permissions added to an existing role
+	RoleChange struct {
+		Role  rbac.Key          `json:"role" yaml:"role"`
+		Added []rbac.Permission `json:"added" yaml:"added"`
+	}
+)
+
+// New computes the diff between two RBAC states
+func New(from, to rbac.State) Diff {
+	diff := Diff{
+		AddedBindings:   []rbac.Binding{},
+		RemovedBindings: []rbac.Binding{},
+		ChangedBindings: []BindingChange{},
+		SubjectChanges:  []SubjectChange{},
+		WidenedRoles:    []RoleChange{},
+	}
+	diff.diffBindings(from, to)
+	diff.diffSubjects(from, to)
+	diff.diffRoles(from, to)
+	return diff
+}
+
+// Empty checks if there are no differences
+func (d Diff) Empty() bool {
+	return len(d.AddedBindings) == 0 &&
+		len(d.RemovedBindings) == 0 &&
+		len(d.ChangedBindings) == 0 &&
+		len(d.SubjectChanges) == 0 &&
+		len(d.WidenedRoles) == 0
+}
+
+// diffBindings finds added, removed and changed bindings
+func (d *Diff) diffBindings(from, to rbac.State) {
+	fromBindings := map[rbac.Key]rbac.Binding{}
+	for _, binding := range from.Bindings() {
+		fromBindings[binding.Key()] = binding
+	}
+
+	// bindings are sorted, so the results will be too
+	toBindings := map[rbac.Key]bool{}
+	for _, after := range to.Bindings() {
+		toBindings[after.Key()] = true
+		before, ok := fromBindings[after.Key()]
+		if !ok {
+			d.AddedBindings = append(d.AddedBindings, after)
+			continue
+		}
+		added := subtractSubjects(after.Subjects, before.Subjects)
+		removed := subtractSubjects(before.Subjects, after.Subjects)
+		if before.RoleRef == after.RoleRef && len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		d.ChangedBindings = append(d.ChangedBindings, BindingChange{
+			Before:          before,
+			After:           after,
+			AddedSubjects:   added,
+			RemovedSubjects: removed,
+		})
+	}
+
+	for _, before := range from.Bindings() {
+		if !toBindings[before.Key()] {
+			d.RemovedBindings = append(d.RemovedBindings, before)
+		}
+	}
+}
+
+// diffSubjects finds the permissions each subject gained or lost
+func (d *Diff) diffSubjects(from, to rbac.State) {
+	fromPermissions := from.SubjectPermissions()
+	toPermissions := to.SubjectPermissions()
+
+	subjects := map[rbac.SubjectKey]bool{}
+	for subject := range fromPermissions {
+		subjects[subject] = true
+	}
+	for subject := range toPermissions {
+		subjects[subject] = true
+	}
+
+	for subject := range subjects {
+		gained := subtractPermissions(toPermissions[subject], fromPermissions[subject])
+		lost := subtractPermissions(fromPermissions[subject], toPermissions[subject])
+		if len(gained) == 0 && len(lost) == 0 {
+			continue
+		}
+		d.SubjectChanges = append(d.SubjectChanges, SubjectChange{
+			Subject: subject,
+			Gained:  gained,
+			Lost:    lost,
+		})
+	}
+
+	sort.Slice(d.SubjectChanges, func(i, j int) bool {
+		return d.SubjectChanges[i].Subject.String() < d.SubjectChanges[j].Subject.String()
+	})
+}
+
+// diffRoles finds roles that exist in both states and grant more in the
+// latter
+func (d *Diff) diffRoles(from, to rbac.State) {
+	fromRules := from.RoleRules()
+	for role, rules := range to.RoleRules() {
+		before, ok := fromRules[role]
+		if !ok {
+			continue
+		}
+		added := subtractPermissions(
+			permissionSet(rbac.Permissions(role.Namespace, rules)),
+			permissionSet(rbac.Permissions(role.Namespace, before)),
+		)
+		if len(added) == 0 {
+			continue
+		}
+		d.WidenedRoles = append(d.WidenedRoles, RoleChange{
+			Role:  role,
+			Added: added,
+		})
+	}
+
+	sort.Slice(d.WidenedRoles, func(i, j int) bool {
+		return d.WidenedRoles[i].Role.Less(d.WidenedRoles[j].Role)
+	})
+}
+
+// subtractSubjects returns the subjects of a that are not in b
+func subtractSubjects(a, b []v1.Subject) []v1.Subject {
+	inB := map[v1.Subject]bool{}
+	for _, subject := range b {
+		inB[subject] = true
+	}
+	subjects := []v1.Subject{}
+	for _, subject := range a {
+		if !inB[subject] {
+			subjects = append(subjects, subject)
+		}
+	}
+	return subjects
+}
+
+// subtractPermissions returns the sorted permissions of a that are not in b
+func subtractPermissions(a, b map[rbac.Permission]bool) []rbac.Permission {
+	permissions := []rbac.Permission{}
+	for permission := range a {
+		if !b[permission] {
+			permissions = append(permissions, permission)
+		}
+	}
+	rbac.SortPermissions(permissions)
+	return permissions
+}
+
+// permissionSet converts a slice of permissions into a set
+func permissionSet(permissions []rbac.Permission) map[rbac.Permission]bool {
+	set := make(map[rbac.Permission]bool, len(permissions))
+	for _, permission := range permissions {
+		set[permission] = true
+	}
+	return set
+}
@@ -0,0 +1,203 @@
+package diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+const (
+	nsDefault = "default"
+)
+
+// role returns a role in the default namespace with the given rules
+func role(name string, rules ...v1.PolicyRule) v1.Role {
+	return v1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: nsDefault,
+		},
+		Rules: rules,
+	}
+}
+
+var (
+	listPods = v1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"list"},
+	}
+	deletePods = v1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"delete"},
+	}
+)
+
+func TestNew(t *testing.T) {
+	// role binding 2 moves from role2 to role1 and gains subject 3
+	roleBindingRole1Subject2and3 := fixtures.RoleBindingRole2Subject2
+	roleBindingRole1Subject2and3.RoleRef = v1.RoleRef{Kind: rbac.KindRole, Name: "role1"}
+	roleBindingRole1Subject2and3.Subjects = append([]v1.Subject{}, fixtures.RoleBindingRole2Subject2.Subjects...)
+	roleBindingRole1Subject2and3.Subjects = append(roleBindingRole1Subject2and3.Subjects, v1.Subject{Kind: "User", Name: "subject3"})
+
+	tests := []struct {
+		name     string
+		from     rbac.State
+		to       rbac.State
+		want     Diff
+		wantText string
+	}{
+		{
+			name: "no differences",
+			from: rbac.State{
+				Roles:        []v1.Role{role("role1", listPods)},
+				RoleBindings: []v1.RoleBinding{fixtures.RoleBindingRole1Subject1},
+			},
+			to: rbac.State{
+				Roles:        []v1.Role{role("role1", listPods)},
+				RoleBindings: []v1.RoleBinding{fixtures.RoleBindingRole1Subject1},
+			},
+			want: Diff{
+				AddedBindings:   []rbac.Binding{},
+				RemovedBindings: []rbac.Binding{},
+				ChangedBindings: []BindingChange{},
+				SubjectChanges:  []SubjectChange{},
+				WidenedRoles:    []RoleChange{},
+			},
+			wantText: "No differences\n",
+		},
+		{
+			name: "added, removed and changed bindings, widened roles",
+			from: rbac.State{
+				Roles: []v1.Role{
+					role("role1", listPods),
+					role("role2", listPods),
+				},
+				RoleBindings: []v1.RoleBinding{
+					fixtures.RoleBindingRole1Subject1,
+					fixtures.RoleBindingRole2Subject2,
+				},
+			},
+			to: rbac.State{
+				Roles: []v1.Role{
+					role("role1", listPods, deletePods),
+					role("role2", listPods),
+				},
+				RoleBindings: []v1.RoleBinding{
+					roleBindingRole1Subject2and3,
+					fixtures.RoleBindingRole3Subject3and4,
+				},
+			},
+			want: Diff{
+				AddedBindings: []rbac.Binding{
+					{
+						Kind:      rbac.KindRoleBinding,
+						Namespace: nsDefault,
+						Name:      fixtures.RoleBindingRole3Subject3and4.Name,
+						RoleRef:   fixtures.RoleBindingRole3Subject3and4.RoleRef,
+						Subjects:  fixtures.RoleBindingRole3Subject3and4.Subjects,
+					},
+				},
+				RemovedBindings: []rbac.Binding{
+					{
+						Kind:      rbac.KindRoleBinding,
+						Namespace: nsDefault,
+						Name:      fixtures.RoleBindingRole1Subject1.Name,
+						RoleRef:   fixtures.RoleBindingRole1Subject1.RoleRef,
+						Subjects:  fixtures.RoleBindingRole1Subject1.Subjects,
+					},
+				},
+				ChangedBindings: []BindingChange{
+					{
+						Before: rbac.Binding{
+							Kind:      rbac.KindRoleBinding,
+							Namespace: nsDefault,
+							Name:      fixtures.RoleBindingRole2Subject2.Name,
+							RoleRef:   fixtures.RoleBindingRole2Subject2.RoleRef,
+							Subjects:  fixtures.RoleBindingRole2Subject2.Subjects,
+						},
+						After: rbac.Binding{
+							Kind:      rbac.KindRoleBinding,
+							Namespace: nsDefault,
+							Name:      roleBindingRole1Subject2and3.Name,
+							RoleRef:   roleBindingRole1Subject2and3.RoleRef,
+							Subjects:  roleBindingRole1Subject2and3.Subjects,
+						},
+						AddedSubjects:   []v1.Subject{{Kind: "User", Name: "subject3"}},
+						RemovedSubjects: []v1.Subject{},
+					},
+				},
+				SubjectChanges: []SubjectChange{
+					{
+						Subject: rbac.SubjectKey{Kind: "User", Name: "subject1"},
+						Gained:  []rbac.Permission{},
+						Lost: []rbac.Permission{
+							{Namespace: nsDefault, Verb: "list", Resource: "pods"},
+						},
+					},
+					{
+						Subject: rbac.SubjectKey{Kind: "User", Name: "subject2"},
+						Gained: []rbac.Permission{
+							{Namespace: nsDefault, Verb: "delete", Resource: "pods"},
+						},
+						Lost: []rbac.Permission{},
+					},
+					{
+						Subject: rbac.SubjectKey{Kind: "User", Name: "subject3"},
+						Gained: []rbac.Permission{
+							{Namespace: nsDefault, Verb: "delete", Resource: "pods"},
+							{Namespace: nsDefault, Verb: "list", Resource: "pods"},
+						},
+						Lost: []rbac.Permission{},
+					},
+				},
+				WidenedRoles: []RoleChange{
+					{
+						Role: rbac.Key{Kind: rbac.KindRole, Namespace: nsDefault, Name: "role1"},
+						Added: []rbac.Permission{
+							{Namespace: nsDefault, Verb: "delete", Resource: "pods"},
+						},
+					},
+				},
+			},
+			wantText: `Added bindings:
+  + RoleBinding/default/role3-for-subject3and4 -> Role/default/role3: User/subject3, /subject4
+Removed bindings:
+  - RoleBinding/default/role1-for-subject1 -> Role/default/role1: User/subject1
+Changed bindings:
+  ~ RoleBinding/default/role2-for-subject2
+      role Role/default/role2 -> Role/default/role1
+      + subject User/subject3
+Subject permissions:
+  User/subject1
+      - list pods in default
+  User/subject2
+      + delete pods in default
+  User/subject3
+      + delete pods in default
+      + list pods in default
+Widened roles:
+  Role/default/role1
+      + delete pods in default
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.from, tt.to)
+			assert.Equal(t, tt.want, got, "diff did not match expectation")
+
+			text := &bytes.Buffer{}
+			require.NoError(t, got.WriteText(text), "did not expect error")
+			assert.Equal(t, tt.wantText, text.String(), "text did not match expectation")
+		})
+	}
+}
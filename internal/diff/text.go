@@ -0,0 +1,94 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+// WriteText writes a human-readable description of the diff
+func (d Diff) WriteText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	if d.Empty() {
+		fmt.Fprintln(b, "No differences")
+		return b.Flush()
+	}
+
+	if len(d.AddedBindings) > 0 {
+		fmt.Fprintln(b, "Added bindings:")
+		for _, binding := range d.AddedBindings {
+			fmt.Fprintf(b, "  + %s\n", describeBinding(binding))
+		}
+	}
+
+	if len(d.RemovedBindings) > 0 {
+		fmt.Fprintln(b, "Removed bindings:")
+		for _, binding := range d.RemovedBindings {
+			fmt.Fprintf(b, "  - %s\n", describeBinding(binding))
+		}
+	}
+
+	if len(d.ChangedBindings) > 0 {
+		fmt.Fprintln(b, "Changed bindings:")
+		for _, change := range d.ChangedBindings {
+			fmt.Fprintf(b, "  ~ %s\n", change.After.Key())
+			if change.Before.RoleRef != change.After.RoleRef {
+				fmt.Fprintf(b, "      role %s -> %s\n", change.Before.RoleKey(), change.After.RoleKey())
+			}
+			for _, subject := range change.AddedSubjects {
+				fmt.Fprintf(b, "      + subject %s\n", rbac.NewSubjectKey(subject))
+			}
+			for _, subject := range change.RemovedSubjects {
+				fmt.Fprintf(b, "      - subject %s\n", rbac.NewSubjectKey(subject))
+			}
+		}
+	}
+
+	if len(d.SubjectChanges) > 0 {
+		fmt.Fprintln(b, "Subject permissions:")
+		for _, change := range d.SubjectChanges {
+			fmt.Fprintf(b, "  %s\n", change.Subject)
+			for _, permission := range change.Gained {
+				fmt.Fprintf(b, "      + %s\n", permission)
+			}
+			for _, permission := range change.Lost {
+				fmt.Fprintf(b, "      - %s\n", permission)
+			}
+		}
+	}
+
+	if len(d.WidenedRoles) > 0 {
+		fmt.Fprintln(b, "Widened roles:")
+		for _, change := range d.WidenedRoles {
+			fmt.Fprintf(b, "  %s\n", change.Role)
+			for _, permission := range change.Added {
+				fmt.Fprintf(b, "      + %s\n", permission)
+			}
+		}
+	}
+
+	return b.Flush()
+}
+
+// describeBinding returns the binding's key, role, and subjects
+func describeBinding(binding rbac.Binding) string {
+	return fmt.Sprintf("%s -> %s: %s", binding.Key(), binding.RoleKey(), describeSubjects(binding.Subjects))
+}
+
+// describeSubjects returns a comma separated list of subjects
+func describeSubjects(subjects []v1.Subject) string {
+	if len(subjects) == 0 {
+		return "no subjects"
+	}
+	keys := make([]string, len(subjects))
+	for i, subject := range subjects {
+		keys[i] = rbac.NewSubjectKey(subject).String()
+	}
+	return strings.Join(keys, ", ")
+}
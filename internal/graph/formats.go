@@ -0,0 +1,161 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// FormatJSON is a json document of nodes and edges
+	FormatJSON Format = "json"
+	// FormatDOT is a graphviz digraph
+	FormatDOT Format = "dot"
+	// FormatGraphML is a graphml document
+	FormatGraphML Format = "graphml"
+)
+
+type (
+	// Format the graph can be written in
+	Format string
+	// graphML is the root element of graphml documents
+	graphML struct {
+		XMLName xml.Name     `xml:"graphml"`
+		XMLNS   string       `xml:"xmlns,attr"`
+		Keys    []graphMLKey `xml:"key"`
+		Graph   graphMLGraph `xml:"graph"`
+	}
+	// graphMLKey declares a data attribute
+	graphMLKey struct {
+		ID       string `xml:"id,attr"`
+		For      string `xml:"for,attr"`
+		AttrName string `xml:"attr.name,attr"`
+		AttrType string `xml:"attr.type,attr"`
+	}
+	graphMLGraph struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	}
+	graphMLNode struct {
+		ID   string        `xml:"id,attr"`
+		Data []graphMLData `xml:"data"`
+	}
+	graphMLEdge struct {
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+	}
+	graphMLData struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+)
+
+var (
+	// dotShapes of each kind of node
+	dotShapes = map[NodeKind]string{
+		KindSubject:    "ellipse",
+		KindBinding:    "box",
+		KindRole:       "hexagon",
+		KindPermission: "note",
+	}
+)
+
+// ParseFormat validates a format, empty defaults to json
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatDOT, FormatGraphML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid graph format %q", s)
+	}
+}
+
+// ContentType returns the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatDOT:
+		return "text/vnd.graphviz; charset=utf-8"
+	case FormatGraphML:
+		return "application/graphml+xml; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+// Write writes the graph in the given format
+func (g Graph) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatDOT:
+		return g.WriteDOT(w)
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(g)
+	}
+	return fmt.Errorf("invalid graph format %q", format)
+}
+
+// WriteDOT writes the graph as a graphviz digraph, drawn left to right
+func (g Graph) WriteDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph rbac {")
+	fmt.Fprintln(b, "  rankdir=LR;")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(b, "  %s [label=%s, shape=%s];\n", strconv.Quote(node.ID), strconv.Quote(node.Label), dotShapes[node.Kind])
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(b, "  %s -> %s;\n", strconv.Quote(edge.Source), strconv.Quote(edge.Target))
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// WriteGraphML writes the graph as a graphml document, node kinds and labels
+// are data attributes
+func (g Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+		},
+		Graph: graphMLGraph{
+			ID:          "rbac",
+			EdgeDefault: "directed",
+			Nodes:       make([]graphMLNode, len(g.Nodes)),
+			Edges:       make([]graphMLEdge, len(g.Edges)),
+		},
+	}
+	for i, node := range g.Nodes {
+		doc.Graph.Nodes[i] = graphMLNode{
+			ID: node.ID,
+			Data: []graphMLData{
+				{Key: "kind", Value: string(node.Kind)},
+				{Key: "label", Value: node.Label},
+			},
+		}
+	}
+	for i, edge := range g.Edges {
+		doc.Graph.Edges[i] = graphMLEdge{
+			Source: edge.Source,
+			Target: edge.Target,
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
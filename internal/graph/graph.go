@@ -0,0 +1,129 @@
+package graph
+
+import (
+	"sort"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// KindSubject is the kind of nodes for users, groups and service accounts
+	KindSubject NodeKind = "subject"
+	// KindBinding is the kind of nodes for role bindings and cluster role
+	// bindings
+	KindBinding NodeKind = "binding"
+	// KindRole is the kind of nodes for roles and cluster roles
+	KindRole NodeKind = "role"
+	// KindPermission is the kind of nodes for the permissions roles grant
+	KindPermission NodeKind = "permission"
+)
+
+type (
+	// NodeKind is the kind of object a node represents
+	NodeKind string
+	// Graph of subjects, the bindings that refer to them, the roles the
+	// bindings grant and the permissions of the roles
+	Graph struct {
+		Nodes []Node `json:"nodes" yaml:"nodes"`
+		Edges []Edge `json:"edges" yaml:"edges"`
+	}
+	// Node of the graph, ids are unique across kinds
+	Node struct {
+		ID    string   `json:"id" yaml:"id"`
+		Kind  NodeKind `json:"kind" yaml:"kind"`
+		Label string   `json:"label" yaml:"label"`
+	}
+	// Edge from subjects to bindings, bindings to roles, and roles to
+	// permissions
+	Edge struct {
+		Source string `json:"source" yaml:"source"`
+		Target string `json:"target" yaml:"target"`
+	}
+	// Options scope the graph to some of the state's bindings
+	Options struct {
+		// Namespace of the role bindings to include, all if empty, cluster
+		// role bindings are always included
+		Namespace string
+		// Filters bindings have to match, all bindings if empty
+		Filters []rbac.RoleBindingFilter
+	}
+)
+
+// New builds the graph of the state's bindings that match the options, only
+// the subjects, roles and permissions of those bindings are included
+func New(state rbac.State, options Options) Graph {
+	graph := Graph{
+		Nodes: []Node{},
+		Edges: []Edge{},
+	}
+	nodes := map[string]bool{}
+	edges := map[Edge]bool{}
+
+	addNode := func(node Node) {
+		if !nodes[node.ID] {
+			nodes[node.ID] = true
+			graph.Nodes = append(graph.Nodes, node)
+		}
+	}
+	addEdge := func(edge Edge) {
+		if !edges[edge] {
+			edges[edge] = true
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+
+	roles := state.RoleRules()
+	for _, binding := range state.FilterBindings(options.Namespace, options.Filters...) {
+		bindingNode := Node{
+			ID:    string(KindBinding) + ":" + binding.Key().String(),
+			Kind:  KindBinding,
+			Label: binding.Key().String(),
+		}
+		addNode(bindingNode)
+
+		for _, subject := range binding.Subjects {
+			key := rbac.NewSubjectKey(subject)
+			subjectNode := Node{
+				ID:    string(KindSubject) + ":" + key.String(),
+				Kind:  KindSubject,
+				Label: key.String(),
+			}
+			addNode(subjectNode)
+			addEdge(Edge{Source: subjectNode.ID, Target: bindingNode.ID})
+		}
+
+		// bindings to missing roles still point at the role they refer to
+		roleKey := binding.RoleKey()
+		roleNode := Node{
+			ID:    string(KindRole) + ":" + roleKey.String(),
+			Kind:  KindRole,
+			Label: roleKey.String(),
+		}
+		addNode(roleNode)
+		addEdge(Edge{Source: bindingNode.ID, Target: roleNode.ID})
+
+		permissions := rbac.Permissions(roleKey.Namespace, roles[roleKey])
+		rbac.SortPermissions(permissions)
+		for _, permission := range permissions {
+			permissionNode := Node{
+				ID:    string(KindPermission) + ":" + permission.String(),
+				Kind:  KindPermission,
+				Label: permission.String(),
+			}
+			addNode(permissionNode)
+			addEdge(Edge{Source: roleNode.ID, Target: permissionNode.ID})
+		}
+	}
+
+	sort.SliceStable(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Source != graph.Edges[j].Source {
+			return graph.Edges[i].Source < graph.Edges[j].Source
+		}
+		return graph.Edges[i].Target < graph.Edges[j].Target
+	})
+
+	return graph
+}
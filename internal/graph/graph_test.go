@@ -0,0 +1,154 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+var (
+	state = rbac.State{
+		Roles: []v1.Role{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "default"},
+				Rules: []v1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"list"},
+				}},
+			},
+		},
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+		},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{
+			fixtures.ClusterRoleBindingClusterRole1Subject1,
+		},
+	}
+	// subject1Graph is the graph of subject1's bindings
+	subject1Graph = Graph{
+		Nodes: []Node{
+			{ID: "binding:ClusterRoleBinding/clusterrole1-for-subject1", Kind: KindBinding, Label: "ClusterRoleBinding/clusterrole1-for-subject1"},
+			{ID: "binding:RoleBinding/default/role1-for-subject1", Kind: KindBinding, Label: "RoleBinding/default/role1-for-subject1"},
+			{ID: "permission:list pods in default", Kind: KindPermission, Label: "list pods in default"},
+			{ID: "role:ClusterRole/clusterrole1", Kind: KindRole, Label: "ClusterRole/clusterrole1"},
+			{ID: "role:Role/default/role1", Kind: KindRole, Label: "Role/default/role1"},
+			{ID: "subject:User/subject1", Kind: KindSubject, Label: "User/subject1"},
+		},
+		Edges: []Edge{
+			{Source: "binding:ClusterRoleBinding/clusterrole1-for-subject1", Target: "role:ClusterRole/clusterrole1"},
+			{Source: "binding:RoleBinding/default/role1-for-subject1", Target: "role:Role/default/role1"},
+			{Source: "role:Role/default/role1", Target: "permission:list pods in default"},
+			{Source: "subject:User/subject1", Target: "binding:ClusterRoleBinding/clusterrole1-for-subject1"},
+			{Source: "subject:User/subject1", Target: "binding:RoleBinding/default/role1-for-subject1"},
+		},
+	}
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    Graph
+	}{
+		{
+			name: "filtered by subject",
+			options: Options{
+				Filters: []rbac.RoleBindingFilter{rbac.FilterBySubjectName("subject1")},
+			},
+			want: subject1Graph,
+		},
+		{
+			name: "other namespace only includes cluster role bindings",
+			options: Options{
+				Namespace: "other",
+			},
+			want: Graph{
+				Nodes: []Node{
+					{ID: "binding:ClusterRoleBinding/clusterrole1-for-subject1", Kind: KindBinding, Label: "ClusterRoleBinding/clusterrole1-for-subject1"},
+					{ID: "role:ClusterRole/clusterrole1", Kind: KindRole, Label: "ClusterRole/clusterrole1"},
+					{ID: "subject:User/subject1", Kind: KindSubject, Label: "User/subject1"},
+				},
+				Edges: []Edge{
+					{Source: "binding:ClusterRoleBinding/clusterrole1-for-subject1", Target: "role:ClusterRole/clusterrole1"},
+					{Source: "subject:User/subject1", Target: "binding:ClusterRoleBinding/clusterrole1-for-subject1"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(state, tt.options)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestGraph_Write(t *testing.T) {
+	graph := Graph{
+		Nodes: []Node{
+			{ID: "binding:RoleBinding/default/role1-for-subject1", Kind: KindBinding, Label: "RoleBinding/default/role1-for-subject1"},
+			{ID: "subject:User/\"quoted\"", Kind: KindSubject, Label: "User/\"quoted\""},
+		},
+		Edges: []Edge{
+			{Source: "subject:User/\"quoted\"", Target: "binding:RoleBinding/default/role1-for-subject1"},
+		},
+	}
+
+	t.Run("dot", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		err := graph.Write(b, FormatDOT)
+		require.NoError(t, err, "did not expect error")
+		assert.Equal(t, `digraph rbac {
+  rankdir=LR;
+  "binding:RoleBinding/default/role1-for-subject1" [label="RoleBinding/default/role1-for-subject1", shape=box];
+  "subject:User/\"quoted\"" [label="User/\"quoted\"", shape=ellipse];
+  "subject:User/\"quoted\"" -> "binding:RoleBinding/default/role1-for-subject1";
+}
+`, b.String())
+	})
+
+	t.Run("graphml", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		err := graph.Write(b, FormatGraphML)
+		require.NoError(t, err, "did not expect error")
+		got := graphML{}
+		err = xml.Unmarshal(b.Bytes(), &got)
+		require.NoError(t, err, "could not unmarshal graphml")
+		require.Len(t, got.Graph.Nodes, 2)
+		assert.Equal(t, "subject:User/\"quoted\"", got.Graph.Nodes[1].ID)
+		assert.Equal(t, []graphMLData{
+			{Key: "kind", Value: "subject"},
+			{Key: "label", Value: "User/\"quoted\""},
+		}, got.Graph.Nodes[1].Data)
+		assert.Equal(t, []graphMLEdge{{
+			Source: "subject:User/\"quoted\"",
+			Target: "binding:RoleBinding/default/role1-for-subject1",
+		}}, got.Graph.Edges)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		err := graph.Write(b, FormatJSON)
+		require.NoError(t, err, "did not expect error")
+		got := Graph{}
+		err = json.Unmarshal(b.Bytes(), &got)
+		require.NoError(t, err, "could not unmarshal json")
+		assert.Equal(t, graph, got)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		err := graph.Write(&bytes.Buffer{}, Format("png"))
+		require.Error(t, err, "expected error but got none")
+	})
+}
@@ -0,0 +1,142 @@
+package graphqlapi
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	// listMultiplier is how many items fields returning lists are assumed to
+	// return when estimating the cost of their selections
+	listMultiplier = 10
+)
+
+type (
+	// complexity estimates the cost and depth of queries before running them
+	complexity struct {
+		schema    graphql.Schema
+		fragments map[string]*ast.FragmentDefinition
+	}
+)
+
+// estimate returns the estimated cost and the depth of the document's most
+// expensive and deepest operations.
+// Every field costs one, plus the cost of its selections which is
+// multiplied for fields returning lists.
+func estimate(schema graphql.Schema, document *ast.Document) (int, int) {
+	c := complexity{
+		schema:    schema,
+		fragments: map[string]*ast.FragmentDefinition{},
+	}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			c.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	maxCost, maxDepth := 0, 0
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		var root *graphql.Object
+		switch operation.Operation {
+		case ast.OperationTypeQuery:
+			root = schema.QueryType()
+		case ast.OperationTypeMutation:
+			root = schema.MutationType()
+		case ast.OperationTypeSubscription:
+			root = schema.SubscriptionType()
+		}
+		cost, depth := c.selectionSet(operation.SelectionSet, root, map[string]bool{})
+		if cost > maxCost {
+			maxCost = cost
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+	return maxCost, maxDepth
+}
+
+// selectionSet returns the cost and depth of the selections on the parent
+// type, which is nil if unknown.
+// Fragments already being spread are skipped, which only happens for
+// invalid documents with fragment cycles.
+func (c complexity) selectionSet(selectionSet *ast.SelectionSet, parent graphql.Type, spreading map[string]bool) (int, int) {
+	if selectionSet == nil {
+		return 0, 0
+	}
+
+	cost, depth := 0, 0
+	for _, selection := range selectionSet.Selections {
+		selectionCost, selectionDepth := 0, 0
+		switch selection := selection.(type) {
+		case *ast.Field:
+			fieldType := c.fieldType(parent, selection.Name.Value)
+			childCost, childDepth := c.selectionSet(selection.SelectionSet, namedType(fieldType), spreading)
+			if isList(fieldType) {
+				childCost *= listMultiplier
+			}
+			selectionCost, selectionDepth = 1+childCost, 1+childDepth
+		case *ast.InlineFragment:
+			fragmentType := parent
+			if selection.TypeCondition != nil {
+				fragmentType = c.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			selectionCost, selectionDepth = c.selectionSet(selection.SelectionSet, fragmentType, spreading)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok || spreading[name] {
+				continue
+			}
+			spreading[name] = true
+			selectionCost, selectionDepth = c.selectionSet(fragment.SelectionSet, c.schema.Type(fragment.TypeCondition.Name.Value), spreading)
+			delete(spreading, name)
+		}
+		cost += selectionCost
+		if selectionDepth > depth {
+			depth = selectionDepth
+		}
+	}
+	return cost, depth
+}
+
+// fieldType returns the type of the parent's field, or nil if unknown such
+// as for introspection fields
+func (c complexity) fieldType(parent graphql.Type, name string) graphql.Type {
+	object, ok := parent.(*graphql.Object)
+	if !ok || object == nil {
+		return nil
+	}
+	field, ok := object.Fields()[name]
+	if !ok {
+		return nil
+	}
+	return field.Type
+}
+
+// namedType unwraps lists and non-nulls
+func namedType(t graphql.Type) graphql.Type {
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		case *graphql.List:
+			t = wrapped.OfType
+		default:
+			return t
+		}
+	}
+}
+
+// isList checks if the type is a list, nullable or not
+func isList(t graphql.Type) bool {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	_, ok := t.(*graphql.List)
+	return ok
+}
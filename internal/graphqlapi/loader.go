@@ -0,0 +1,181 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+var (
+	// errRetrieveState is returned by resolvers when the state could not be
+	// retrieved
+	errRetrieveState = errors.New("could not retrieve rbac state")
+)
+
+type (
+	// role is a role or cluster role with its rules, including the ones
+	// aggregated from other cluster roles
+	role struct {
+		Key   rbac.Key
+		Rules []v1.PolicyRule
+	}
+	// loader loads the rbac state once per request, and indexes bindings by
+	// subject and role.
+	// Roles are loaded in batches, all roles requested before the first one
+	// is needed are resolved together.
+	loader struct {
+		rbac rbac.Enumerator
+
+		stateOnce sync.Once
+		index     *index
+		stateErr  error
+
+		rolesLock sync.Mutex
+		pending   map[rbac.Key]bool
+		roles     map[rbac.Key]*role
+		// batches is the number of batches roles were loaded in
+		batches int
+	}
+	// index of the state's bindings, and the rules of its roles
+	index struct {
+		roleRules map[rbac.Key][]v1.PolicyRule
+		bindings  []rbac.Binding
+		bySubject map[rbac.SubjectKey][]rbac.Binding
+		byRole    map[rbac.Key][]rbac.Binding
+	}
+	// loaderKey is the context key of the request's loader
+	loaderKey struct{}
+)
+
+// newLoader given an enumerator to load the state from
+func newLoader(enumerator rbac.Enumerator) *loader {
+	return &loader{
+		rbac:    enumerator,
+		pending: map[rbac.Key]bool{},
+		roles:   map[rbac.Key]*role{},
+	}
+}
+
+// withLoader returns a context carrying the loader
+func withLoader(ctx context.Context, l *loader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+// loaderFrom returns the loader of the request
+func loaderFrom(ctx context.Context) *loader {
+	return ctx.Value(loaderKey{}).(*loader)
+}
+
+// load retrieves and indexes the state, and resolves the rules of its roles,
+// the first time it's called
+func (l *loader) load() (*index, error) {
+	l.stateOnce.Do(func() {
+		state, err := l.rbac.State()
+		if err != nil {
+			l.stateErr = errRetrieveState
+			return
+		}
+		l.index = &index{
+			roleRules: state.RoleRules(),
+			bindings:  state.Bindings(),
+			bySubject: map[rbac.SubjectKey][]rbac.Binding{},
+			byRole:    map[rbac.Key][]rbac.Binding{},
+		}
+		for _, binding := range l.index.bindings {
+			l.index.byRole[binding.RoleKey()] = append(l.index.byRole[binding.RoleKey()], binding)
+			seen := map[rbac.SubjectKey]bool{}
+			for _, subject := range binding.Subjects {
+				key := rbac.NewSubjectKey(subject)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				l.index.bySubject[key] = append(l.index.bySubject[key], binding)
+			}
+		}
+	})
+	return l.index, l.stateErr
+}
+
+// role returns a thunk resolving to the role, or nil if it doesn't exist.
+// The role is only looked up once the thunk is called, along with every
+// other role requested until then.
+func (l *loader) role(key rbac.Key) func() (interface{}, error) {
+	l.rolesLock.Lock()
+	if _, ok := l.roles[key]; !ok {
+		l.pending[key] = true
+	}
+	l.rolesLock.Unlock()
+
+	return func() (interface{}, error) {
+		l.rolesLock.Lock()
+		defer l.rolesLock.Unlock()
+		if l.pending[key] {
+			if err := l.loadPending(); err != nil {
+				return nil, err
+			}
+		}
+		// avoid returning a typed nil for missing roles
+		if r := l.roles[key]; r != nil {
+			return r, nil
+		}
+		return nil, nil
+	}
+}
+
+// loadPending resolves every pending role in a single batch, the roles lock
+// must be held
+func (l *loader) loadPending() error {
+	index, err := l.load()
+	if err != nil {
+		return err
+	}
+	l.batches++
+	for key := range l.pending {
+		l.roles[key] = nil
+		if keyRules, ok := index.roleRules[key]; ok {
+			l.roles[key] = &role{
+				Key:   key,
+				Rules: keyRules,
+			}
+		}
+	}
+	l.pending = map[rbac.Key]bool{}
+	return nil
+}
+
+// allRoles returns the roles and cluster roles of the state, sorted
+func (l *loader) allRoles() ([]*role, error) {
+	index, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	roles := []*role{}
+	for key, rules := range index.roleRules {
+		roles = append(roles, &role{
+			Key:   key,
+			Rules: rules,
+		})
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Key.Less(roles[j].Key)
+	})
+	return roles, nil
+}
+
+// subjects returns every bound subject, sorted
+func (i *index) subjects() []rbac.SubjectKey {
+	subjects := make([]rbac.SubjectKey, 0, len(i.bySubject))
+	for subject := range i.bySubject {
+		subjects = append(subjects, subject)
+	}
+	sort.Slice(subjects, func(a, b int) bool {
+		return subjects[a].Less(subjects[b])
+	})
+	return subjects
+}
@@ -0,0 +1,279 @@
+package graphqlapi
+
+import (
+	"github.com/graphql-go/graphql"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+// newSchema constructs the schema of the rbac object graph, subjects are
+// bound to roles through bindings, and roles grant rules
+func newSchema() (graphql.Schema, error) {
+	var subjectType, bindingType, roleType *graphql.Object
+
+	ruleType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Rule",
+		Description: "A policy rule granted by a role",
+		Fields: graphql.Fields{
+			"verbs":           stringsField(func(r v1.PolicyRule) []string { return r.Verbs }),
+			"apiGroups":       stringsField(func(r v1.PolicyRule) []string { return r.APIGroups }),
+			"resources":       stringsField(func(r v1.PolicyRule) []string { return r.Resources }),
+			"resourceNames":   stringsField(func(r v1.PolicyRule) []string { return r.ResourceNames }),
+			"nonResourceURLs": stringsField(func(r v1.PolicyRule) []string { return r.NonResourceURLs }),
+		},
+	})
+
+	roleRefType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "RoleRef",
+		Description: "The role a binding refers to, which may not exist",
+		Fields: graphql.Fields{
+			"apiGroup": stringField(func(source interface{}) string { return source.(v1.RoleRef).APIGroup }),
+			"kind":     stringField(func(source interface{}) string { return source.(v1.RoleRef).Kind }),
+			"name":     stringField(func(source interface{}) string { return source.(v1.RoleRef).Name }),
+		},
+	})
+
+	subjectType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Subject",
+		Description: "A user, group or service account, only service accounts have namespaces",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"kind":      stringField(func(source interface{}) string { return source.(rbac.SubjectKey).Kind }),
+				"namespace": stringField(func(source interface{}) string { return source.(rbac.SubjectKey).Namespace }),
+				"name":      stringField(func(source interface{}) string { return source.(rbac.SubjectKey).Name }),
+				"bindings": &graphql.Field{
+					Description: "The bindings that refer to the subject",
+					Type:        nonNullList(bindingType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						index, err := loaderFrom(p.Context).load()
+						if err != nil {
+							return nil, err
+						}
+						return orEmpty(index.bySubject[p.Source.(rbac.SubjectKey)]), nil
+					},
+				},
+			}
+		}),
+	})
+
+	bindingType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Binding",
+		Description: "A role binding or cluster role binding, cluster role bindings have no namespace",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"kind":      stringField(func(source interface{}) string { return source.(rbac.Binding).Kind }),
+				"namespace": stringField(func(source interface{}) string { return source.(rbac.Binding).Namespace }),
+				"name":      stringField(func(source interface{}) string { return source.(rbac.Binding).Name }),
+				"roleRef": &graphql.Field{
+					Type: graphql.NewNonNull(roleRefType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(rbac.Binding).RoleRef, nil
+					},
+				},
+				"role": &graphql.Field{
+					Description: "The role the binding refers to, null if it does not exist",
+					Type:        roleType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loaderFrom(p.Context).role(p.Source.(rbac.Binding).RoleKey()), nil
+					},
+				},
+				"subjects": &graphql.Field{
+					Type: nonNullList(subjectType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						binding := p.Source.(rbac.Binding)
+						subjects := make([]rbac.SubjectKey, len(binding.Subjects))
+						for i, subject := range binding.Subjects {
+							subjects[i] = rbac.NewSubjectKey(subject)
+						}
+						return subjects, nil
+					},
+				},
+			}
+		}),
+	})
+
+	roleType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Role",
+		Description: "A role or cluster role, cluster roles have no namespace",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"kind":      stringField(func(source interface{}) string { return source.(*role).Key.Kind }),
+				"namespace": stringField(func(source interface{}) string { return source.(*role).Key.Namespace }),
+				"name":      stringField(func(source interface{}) string { return source.(*role).Key.Name }),
+				"rules": &graphql.Field{
+					Description: "The rules of the role, including aggregated ones",
+					Type:        nonNullList(ruleType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*role).Rules, nil
+					},
+				},
+				"bindings": &graphql.Field{
+					Description: "The bindings that refer to the role",
+					Type:        nonNullList(bindingType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						index, err := loaderFrom(p.Context).load()
+						if err != nil {
+							return nil, err
+						}
+						return orEmpty(index.byRole[p.Source.(*role).Key]), nil
+					},
+				},
+			}
+		}),
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"subject": &graphql.Field{
+				Description: "A subject, whether it's bound or not",
+				Type:        graphql.NewNonNull(subjectType),
+				Args: graphql.FieldConfigArgument{
+					"kind":      {Type: graphql.NewNonNull(graphql.String)},
+					"namespace": {Type: graphql.String},
+					"name":      {Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					key := rbac.SubjectKey{
+						Kind: p.Args["kind"].(string),
+						Name: p.Args["name"].(string),
+					}
+					if key.Kind == v1.ServiceAccountKind {
+						key.Namespace, _ = p.Args["namespace"].(string)
+					}
+					return key, nil
+				},
+			},
+			"subjects": &graphql.Field{
+				Description: "Every subject referred to by a binding, optionally of a kind",
+				Type:        nonNullList(subjectType),
+				Args: graphql.FieldConfigArgument{
+					"kind": {Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					index, err := loaderFrom(p.Context).load()
+					if err != nil {
+						return nil, err
+					}
+					kind, _ := p.Args["kind"].(string)
+					subjects := []rbac.SubjectKey{}
+					for _, subject := range index.subjects() {
+						if kind == "" || subject.Kind == kind {
+							subjects = append(subjects, subject)
+						}
+					}
+					return subjects, nil
+				},
+			},
+			"role": &graphql.Field{
+				Description: "A role, or a cluster role if namespace is not set",
+				Type:        roleType,
+				Args: graphql.FieldConfigArgument{
+					"namespace": {Type: graphql.String},
+					"name":      {Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					key := rbac.Key{
+						Kind: rbac.KindClusterRole,
+						Name: p.Args["name"].(string),
+					}
+					if namespace, _ := p.Args["namespace"].(string); namespace != "" {
+						key.Kind = rbac.KindRole
+						key.Namespace = namespace
+					}
+					return loaderFrom(p.Context).role(key), nil
+				},
+			},
+			"roles": &graphql.Field{
+				Description: "Every role and cluster role, or only the roles in a namespace",
+				Type:        nonNullList(roleType),
+				Args: graphql.FieldConfigArgument{
+					"namespace": {Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					roles, err := loaderFrom(p.Context).allRoles()
+					if err != nil {
+						return nil, err
+					}
+					namespace, _ := p.Args["namespace"].(string)
+					if namespace == "" {
+						return roles, nil
+					}
+					filtered := []*role{}
+					for _, role := range roles {
+						if role.Key.Namespace == namespace {
+							filtered = append(filtered, role)
+						}
+					}
+					return filtered, nil
+				},
+			},
+			"bindings": &graphql.Field{
+				Description: "Every cluster role binding and role binding, or only the role bindings in a namespace",
+				Type:        nonNullList(bindingType),
+				Args: graphql.FieldConfigArgument{
+					"namespace": {Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					index, err := loaderFrom(p.Context).load()
+					if err != nil {
+						return nil, err
+					}
+					namespace, _ := p.Args["namespace"].(string)
+					if namespace == "" {
+						return index.bindings, nil
+					}
+					filtered := []rbac.Binding{}
+					for _, binding := range index.bindings {
+						if binding.Namespace == namespace {
+							filtered = append(filtered, binding)
+						}
+					}
+					return filtered, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: queryType,
+	})
+}
+
+// stringField is a non-null string field resolved from its source
+func stringField(resolve func(source interface{}) string) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolve(p.Source), nil
+		},
+	}
+}
+
+// stringsField is a non-null list of strings resolved from a policy rule
+func stringsField(resolve func(rule v1.PolicyRule) []string) *graphql.Field {
+	return &graphql.Field{
+		Type: nonNullList(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			values := resolve(p.Source.(v1.PolicyRule))
+			if values == nil {
+				return []string{}, nil
+			}
+			return values, nil
+		},
+	}
+}
+
+// orEmpty returns an empty list instead of nil, as lists are not nullable
+func orEmpty(bindings []rbac.Binding) []rbac.Binding {
+	if bindings == nil {
+		return []rbac.Binding{}
+	}
+	return bindings
+}
+
+// nonNullList is a non-null list of non-null items of the type
+func nonNullList(itemType graphql.Type) graphql.Type {
+	return graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemType)))
+}
@@ -0,0 +1,191 @@
+package graphqlapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+)
+
+const (
+	// DefaultMaxComplexity is the default maximum estimated cost of queries
+	DefaultMaxComplexity = 5000
+	// DefaultMaxDepth is the default maximum depth of queries
+	DefaultMaxDepth = 10
+)
+
+type (
+	// Server resolves GraphQL queries over the rbac object graph
+	Server struct {
+		rbac          rbac.Enumerator
+		snapshots     Snapshots
+		schema        graphql.Schema
+		mutex         sync.RWMutex
+		maxComplexity int
+		maxDepth      int
+	}
+	// Option configures optional features of the Server
+	Option func(*Server)
+	// Snapshots provides past RBAC states
+	Snapshots interface {
+		At(asOf time.Time) (*snapshot.Snapshot, error)
+	}
+	// graphqlRequest is a GraphQL query, as usually sent over HTTP
+	graphqlRequest struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+		// AsOf queries the latest snapshot taken at or before the given time
+		// instead of the live cluster
+		AsOf *time.Time `json:"asOf,omitempty"`
+	}
+)
+
+// New Server given an RbacEnumerator and any options
+func New(rbac rbac.Enumerator, options ...Option) (*Server, error) {
+	schema, err := newSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct schema: %w", err)
+	}
+	s := &Server{
+		rbac:          rbac,
+		schema:        schema,
+		maxComplexity: DefaultMaxComplexity,
+		maxDepth:      DefaultMaxDepth,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
+}
+
+// WithSnapshots allows querying past RBAC states with asOf
+func WithSnapshots(snapshots Snapshots) Option {
+	return func(s *Server) {
+		s.snapshots = snapshots
+	}
+}
+
+// WithMaxComplexity limits the estimated cost of queries, where every field
+// costs one and the selections of lists are assumed to be repeated ten times
+func WithMaxComplexity(maxComplexity int) Option {
+	return func(s *Server) {
+		s.maxComplexity = maxComplexity
+	}
+}
+
+// WithMaxDepth limits how deeply selections can be nested
+func WithMaxDepth(maxDepth int) Option {
+	return func(s *Server) {
+		s.maxDepth = maxDepth
+	}
+}
+
+// SetLimits changes the maximum estimated cost and depth of queries
+func (s *Server) SetLimits(maxComplexity, maxDepth int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxComplexity = maxComplexity
+	s.maxDepth = maxDepth
+}
+
+// GraphQL handles GraphQL queries, rejecting ones that are too complex
+// before running them
+func (s *Server) GraphQL(c *gin.Context) {
+	// construct request
+	req := graphqlRequest{}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorResult("could not parse request"))
+		return
+	}
+
+	// the document is parsed once, and only run once it's estimated cheap
+	// enough and validated
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: []byte(req.Query),
+			Name: "GraphQL request",
+		}),
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	s.mutex.RLock()
+	maxComplexity, maxDepth := s.maxComplexity, s.maxDepth
+	s.mutex.RUnlock()
+	cost, depth := estimate(s.schema, document)
+	if depth > maxDepth {
+		c.JSON(http.StatusBadRequest, errorResult(fmt.Sprintf("query depth %d exceeds the maximum of %d", depth, maxDepth)))
+		return
+	}
+	if cost > maxComplexity {
+		c.JSON(http.StatusBadRequest, errorResult(fmt.Sprintf("query complexity %d exceeds the maximum of %d", cost, maxComplexity)))
+		return
+	}
+	if validation := graphql.ValidateDocument(&s.schema, document, nil); !validation.IsValid {
+		c.JSON(http.StatusOK, &graphql.Result{Errors: validation.Errors})
+		return
+	}
+
+	enumerator, ok := s.enumerator(c, req.AsOf)
+	if !ok {
+		return
+	}
+
+	// every request loads the state once
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           document,
+		Args:          req.Variables,
+		OperationName: req.OperationName,
+		Context:       withLoader(c.Request.Context(), newLoader(enumerator)),
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// enumerator returns the live enumerator, or if asOf is set one for the
+// latest snapshot at or before it, rendering an error response if it fails
+func (s *Server) enumerator(c *gin.Context, asOf *time.Time) (rbac.Enumerator, bool) {
+	if asOf == nil {
+		return s.rbac, true
+	}
+
+	if s.snapshots == nil {
+		c.JSON(http.StatusBadRequest, errorResult("snapshots are not enabled"))
+		return nil, false
+	}
+
+	snap, err := s.snapshots.At(*asOf)
+	switch {
+	case errors.Is(err, snapshot.ErrNotFound):
+		c.JSON(http.StatusNotFound, errorResult("no snapshot found at or before asOf"))
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, errorResult("could not retrieve snapshot"))
+		return nil, false
+	}
+
+	// let the client know how old the state actually is
+	c.Header("X-Snapshot-Timestamp", snap.Timestamp.Format(time.RFC3339))
+	return rbac.NewStatic(snap.State), true
+}
+
+// errorResult is a result with only the error
+func errorResult(message string) *graphql.Result {
+	return &graphql.Result{
+		Errors: []gqlerrors.FormattedError{
+			gqlerrors.NewFormattedError(message),
+		},
+	}
+}
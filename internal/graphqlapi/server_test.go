@@ -0,0 +1,349 @@
+package graphqlapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+)
+
+const (
+	nsDefault = "default"
+)
+
+var (
+	// state is a sample state with roles for some of the fixtures' bindings
+	state = rbac.State{
+		Roles: []v1.Role{{
+			ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: nsDefault},
+			Rules: []v1.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get"},
+			}},
+		}},
+		ClusterRoles: []v1.ClusterRole{{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterrole1"},
+			Rules: []v1.PolicyRule{{
+				NonResourceURLs: []string{"/metrics"},
+				Verbs:           []string{"get"},
+			}},
+		}},
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+		},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{
+			fixtures.ClusterRoleBindingClusterRole1Subject1,
+		},
+	}
+)
+
+// snapshotsFunc implements Snapshots with a function
+type snapshotsFunc func(asOf time.Time) (*snapshot.Snapshot, error)
+
+func (f snapshotsFunc) At(asOf time.Time) (*snapshot.Snapshot, error) {
+	return f(asOf)
+}
+
+func TestServer_GraphQL(t *testing.T) {
+	type fields struct {
+		rbac    func(t *testing.T) rbac.Enumerator
+		options []Option
+	}
+	type args struct {
+		requestBody string
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		testResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "subject to bindings to roles to rules, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(&state, nil).Times(1)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"query":"{ subject(kind: \"User\", name: \"subject1\") { bindings { kind name role { name rules { verbs resources nonResourceURLs } } } } }"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.JSONEq(t, `{"data":{"subject":{"bindings":[
+					{"kind":"ClusterRoleBinding","name":"clusterrole1-for-subject1","role":{"name":"clusterrole1","rules":[{"verbs":["get"],"resources":[],"nonResourceURLs":["/metrics"]}]}},
+					{"kind":"RoleBinding","name":"role1-for-subject1","role":{"name":"role1","rules":[{"verbs":["get"],"resources":["pods"],"nonResourceURLs":[]}]}}
+				]}}}`, string(respBody))
+			},
+		},
+		{
+			name: "role to bindings to subjects, missing roles are null, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(&state, nil).Times(1)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"query":"query($ns: String) { role(namespace: $ns, name: \"role1\") { bindings { subjects { kind name } } } bindings(namespace: $ns) { name role { name } } }","variables":{"ns":"default"}}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.JSONEq(t, `{"data":{
+					"role":{"bindings":[{"subjects":[{"kind":"User","name":"subject1"}]}]},
+					"bindings":[
+						{"name":"role1-for-subject1","role":{"name":"role1"}},
+						{"name":"role2-for-subject2","role":null}
+					]
+				}}`, string(respBody))
+			},
+		},
+		{
+			name: "state error, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					ctrl := gomock.NewController(t)
+					mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+					mockEnumerator.EXPECT().State().Return(nil, errors.New("some error")).Times(1)
+					return mockEnumerator
+				},
+			},
+			args: args{
+				requestBody: `{"query":"{ subjects { name } roles { name } }"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				resp := struct {
+					Errors []struct {
+						Message string `json:"message"`
+					} `json:"errors"`
+				}{}
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				err := json.Unmarshal(respBody, &resp)
+				require.NoError(t, err, "could not unmarshal resp")
+				require.NotEmpty(t, resp.Errors)
+				assert.Equal(t, "could not retrieve rbac state", resp.Errors[0].Message)
+			},
+		},
+		{
+			name: "too complex, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+				options: []Option{WithMaxComplexity(100)},
+			},
+			args: args{
+				requestBody: `{"query":"{ bindings { ...binding } } fragment binding on Binding { name role { rules { verbs } } }"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "query complexity 131 exceeds the maximum of 100")
+			},
+		},
+		{
+			name: "too deep, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+				options: []Option{WithMaxDepth(3)},
+			},
+			args: args{
+				requestBody: `{"query":"{ roles { bindings { subjects { name } } } }"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "query depth 4 exceeds the maximum of 3")
+			},
+		},
+		{
+			name: "as of a snapshot, success",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					// the live cluster is not queried
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+				options: []Option{
+					WithSnapshots(snapshotsFunc(func(asOf time.Time) (*snapshot.Snapshot, error) {
+						return &snapshot.Snapshot{
+							Timestamp: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+							State: rbac.State{
+								RoleBindings: []v1.RoleBinding{fixtures.RoleBindingRole2Subject2},
+							},
+						}, nil
+					})),
+				},
+			},
+			args: args{
+				requestBody: `{"query":"{ bindings { name } }","asOf":"2020-03-03T00:00:00Z"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				assert.Equal(t, "2020-03-02T00:00:00Z", rr.Header().Get("X-Snapshot-Timestamp"))
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.JSONEq(t, `{"data":{"bindings":[{"name":"role2-for-subject2"}]}}`, string(respBody))
+			},
+		},
+		{
+			name: "as of a snapshot, none that old, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+				options: []Option{
+					WithSnapshots(snapshotsFunc(func(asOf time.Time) (*snapshot.Snapshot, error) {
+						return nil, snapshot.ErrNotFound
+					})),
+				},
+			},
+			args: args{
+				requestBody: `{"query":"{ bindings { name } }","asOf":"2020-03-03T00:00:00Z"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "no snapshot found at or before asOf")
+			},
+		},
+		{
+			name: "as of a snapshot, not enabled, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+			},
+			args: args{
+				requestBody: `{"query":"{ bindings { name } }","asOf":"2020-03-03T00:00:00Z"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "snapshots are not enabled")
+			},
+		},
+		{
+			name: "syntax error, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+			},
+			args: args{
+				requestBody: `{"query":"{ subjects { name "}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "Syntax Error")
+			},
+		},
+		{
+			name: "unknown field, validated before loading the state, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+			},
+			args: args{
+				requestBody: `{"query":"{ subjects { name unknown } }"}`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), `Cannot query field \"unknown\"`)
+			},
+		},
+		{
+			name: "invalid body, failure",
+			fields: fields{
+				rbac: func(t *testing.T) rbac.Enumerator {
+					return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+				},
+			},
+			args: args{
+				requestBody: `{"query":`,
+			},
+			testResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				respBody, _ := ioutil.ReadAll(rr.Body)
+				assert.Contains(t, string(respBody), "could not parse request")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := New(tt.fields.rbac(t), tt.fields.options...)
+			require.NoError(t, err, "failed to create new server")
+
+			r := gin.Default()
+			r.POST("/", server.GraphQL)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.args.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			tt.testResp(t, w)
+		})
+	}
+}
+
+func TestLoader_role(t *testing.T) {
+	l := newLoader(rbac.NewStatic(state))
+	role1 := rbac.Key{Kind: rbac.KindRole, Namespace: nsDefault, Name: "role1"}
+	role2 := rbac.Key{Kind: rbac.KindRole, Namespace: nsDefault, Name: "role2"}
+	clusterRole1 := rbac.Key{Kind: rbac.KindClusterRole, Name: "clusterrole1"}
+
+	// roles requested together are loaded in a single batch
+	thunks := []func() (interface{}, error){
+		l.role(role1),
+		l.role(role2),
+		l.role(clusterRole1),
+	}
+	got := []interface{}{}
+	for _, thunk := range thunks {
+		r, err := thunk()
+		require.NoError(t, err)
+		got = append(got, r)
+	}
+	assert.Equal(t, 1, l.batches)
+	assert.Equal(t, []interface{}{
+		&role{Key: role1, Rules: state.Roles[0].Rules},
+		nil,
+		&role{Key: clusterRole1, Rules: state.ClusterRoles[0].Rules},
+	}, got)
+
+	// loaded roles are not loaded again
+	r, err := l.role(role1)()
+	require.NoError(t, err)
+	assert.Equal(t, &role{Key: role1, Rules: state.Roles[0].Rules}, r)
+	assert.Equal(t, 1, l.batches)
+}
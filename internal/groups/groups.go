@@ -0,0 +1,104 @@
+package groups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Authenticated is the group of all authenticated users
+	Authenticated = "system:authenticated"
+	// ServiceAccounts is the group of all service accounts
+	ServiceAccounts = "system:serviceaccounts"
+	// serviceAccountUserPrefix is the prefix of the users service accounts
+	// authenticate as, followed by namespace:name
+	serviceAccountUserPrefix = "system:serviceaccount:"
+)
+
+type (
+	// Resolver resolves the groups a user is a member of
+	Resolver interface {
+		Groups(user string) ([]string, error)
+	}
+	// Builtin resolves the groups kubernetes itself assigns to users,
+	// system:authenticated for everyone and system:serviceaccounts and
+	// system:serviceaccounts:<namespace> for service accounts
+	Builtin struct{}
+	// Static resolves groups from a fixed list of members, usually loaded
+	// from a yaml file exported from an identity provider
+	Static struct {
+		// Members of each group
+		Members map[string][]string `yaml:"groups"`
+	}
+	// chain resolves groups using multiple resolvers
+	chain []Resolver
+)
+
+// Groups returns the builtin groups of the user
+func (Builtin) Groups(user string) ([]string, error) {
+	groups := []string{Authenticated}
+	if strings.HasPrefix(user, serviceAccountUserPrefix) {
+		parts := strings.SplitN(strings.TrimPrefix(user, serviceAccountUserPrefix), ":", 2)
+		if len(parts) == 2 {
+			groups = append(groups, ServiceAccounts, ServiceAccounts+":"+parts[0])
+		}
+	}
+	return groups, nil
+}
+
+// LoadStatic reads the static groups' yaml file
+func LoadStatic(path string) (*Static, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read groups: %w", err)
+	}
+	static := &Static{}
+	if err := yaml.UnmarshalStrict(b, static); err != nil {
+		return nil, fmt.Errorf("failed to parse groups: %w", err)
+	}
+	return static, nil
+}
+
+// Groups returns the groups the user is listed as a member of, sorted
+func (s *Static) Groups(user string) ([]string, error) {
+	groups := []string{}
+	for group, members := range s.Members {
+		for _, member := range members {
+			if member == user {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// Chain returns a Resolver that returns the groups of all the given
+// resolvers, without duplicates
+func Chain(resolvers ...Resolver) Resolver {
+	return chain(resolvers)
+}
+
+// Groups returns the groups of all the chain's resolvers
+func (c chain) Groups(user string) ([]string, error) {
+	seen := map[string]bool{}
+	groups := []string{}
+	for _, resolver := range c {
+		resolved, err := resolver.Groups(user)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range resolved {
+			if !seen[group] {
+				seen[group] = true
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,93 @@
+package groups
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resolverFunc implements Resolver with a function
+type resolverFunc func(user string) ([]string, error)
+
+func (f resolverFunc) Groups(user string) ([]string, error) {
+	return f(user)
+}
+
+func TestBuiltin_Groups(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		want []string
+	}{
+		{
+			name: "user",
+			user: "alice",
+			want: []string{"system:authenticated"},
+		},
+		{
+			name: "service account",
+			user: "system:serviceaccount:default:subject4",
+			want: []string{"system:authenticated", "system:serviceaccounts", "system:serviceaccounts:default"},
+		},
+		{
+			name: "malformed service account",
+			user: "system:serviceaccount:default",
+			want: []string{"system:authenticated"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Builtin{}.Groups(tt.user)
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "groups")
+	require.NoError(t, err, "did not expect error")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "groups.yaml")
+	err = ioutil.WriteFile(path, []byte("groups:\n  team2: [alice]\n  team1: [alice, bob]\n"), 0600)
+	require.NoError(t, err, "did not expect error")
+	static, err := LoadStatic(path)
+	require.NoError(t, err, "did not expect error")
+
+	got, err := static.Groups("alice")
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, []string{"team1", "team2"}, got)
+
+	got, err = static.Groups("carol")
+	require.NoError(t, err, "did not expect error")
+	assert.Empty(t, got)
+
+	err = ioutil.WriteFile(path, []byte("teams: {}\n"), 0600)
+	require.NoError(t, err, "did not expect error")
+	_, err = LoadStatic(path)
+	require.Error(t, err, "expected error but got none")
+}
+
+func TestChain(t *testing.T) {
+	resolver := Chain(
+		Builtin{},
+		&Static{Members: map[string][]string{
+			"team1":                {"alice"},
+			"system:authenticated": {"alice"},
+		}},
+	)
+	got, err := resolver.Groups("alice")
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, []string{"system:authenticated", "team1"}, got)
+
+	_, err = Chain(Builtin{}, resolverFunc(func(user string) ([]string, error) {
+		return nil, errors.New("some error")
+	})).Groups("alice")
+	require.Error(t, err, "expected error but got none")
+}
@@ -0,0 +1,90 @@
+package grpcapi
+
+import (
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/api/rbacpb"
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+var (
+	// matchTypes maps the protocol buffer match types to the rbac ones
+	matchTypes = map[rbacpb.MatchType]rbac.MatchType{
+		rbacpb.MatchType_MATCH_TYPE_UNSPECIFIED: rbac.MatchExact,
+		rbacpb.MatchType_MATCH_TYPE_EXACT:       rbac.MatchExact,
+		rbacpb.MatchType_MATCH_TYPE_PREFIX:      rbac.MatchPrefix,
+		rbacpb.MatchType_MATCH_TYPE_GLOB:        rbac.MatchGlob,
+		rbacpb.MatchType_MATCH_TYPE_REGEX:       rbac.MatchRegex,
+	}
+)
+
+// toPattern converts a subject pattern, unknown match types are kept as
+// they are so that matching them fails
+func toPattern(subject *rbacpb.SubjectPattern) rbac.Pattern {
+	matchType, ok := matchTypes[subject.MatchType]
+	if !ok {
+		matchType = rbac.MatchType(subject.MatchType.String())
+	}
+	return rbac.Pattern{
+		Pattern:   subject.Pattern,
+		MatchType: matchType,
+	}
+}
+
+func fromRoleBinding(roleBinding v1.RoleBinding) *rbacpb.RoleBinding {
+	subjects := make([]*rbacpb.Subject, len(roleBinding.Subjects))
+	for i, subject := range roleBinding.Subjects {
+		subjects[i] = &rbacpb.Subject{
+			Kind:      subject.Kind,
+			ApiGroup:  subject.APIGroup,
+			Name:      subject.Name,
+			Namespace: subject.Namespace,
+		}
+	}
+	return &rbacpb.RoleBinding{
+		Namespace:   roleBinding.Namespace,
+		Name:        roleBinding.Name,
+		Labels:      roleBinding.Labels,
+		Annotations: roleBinding.Annotations,
+		RoleRef: &rbacpb.RoleRef{
+			ApiGroup: roleBinding.RoleRef.APIGroup,
+			Kind:     roleBinding.RoleRef.Kind,
+			Name:     roleBinding.RoleRef.Name,
+		},
+		Subjects: subjects,
+	}
+}
+
+func fromPermission(permission rbac.Permission) *rbacpb.Permission {
+	return &rbacpb.Permission{
+		Namespace:      permission.Namespace,
+		Verb:           permission.Verb,
+		ApiGroup:       permission.APIGroup,
+		Resource:       permission.Resource,
+		ResourceName:   permission.ResourceName,
+		NonResourceUrl: permission.NonResourceURL,
+	}
+}
+
+func fromKey(key rbac.Key) *rbacpb.Key {
+	return &rbacpb.Key{
+		Kind:      key.Kind,
+		Namespace: key.Namespace,
+		Name:      key.Name,
+	}
+}
+
+func fromSubjectBindings(subject rbac.SubjectBindings) *rbacpb.SubjectBindings {
+	bindings := make([]*rbacpb.Key, len(subject.Bindings))
+	for i, binding := range subject.Bindings {
+		bindings[i] = fromKey(binding)
+	}
+	return &rbacpb.SubjectBindings{
+		Subject: &rbacpb.SubjectKey{
+			Kind:      subject.Subject.Kind,
+			Namespace: subject.Subject.Namespace,
+			Name:      subject.Subject.Name,
+		},
+		Bindings: bindings,
+	}
+}
@@ -0,0 +1,379 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/api/rbacpb"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+)
+
+const (
+	// snapshotTimestampHeader is the header metadata key of the time the
+	// snapshot queried with as_of was actually taken at
+	snapshotTimestampHeader = "x-snapshot-timestamp"
+)
+
+type (
+	// Server implements the gRPC rbac service on top of an enumerator
+	Server struct {
+		rbacpb.UnimplementedRbacServer
+		rbac            rbac.Enumerator
+		snapshots       Snapshots
+		maxSubjectNames int64
+	}
+	// Option configures optional features of the Server
+	Option func(*Server)
+	// Snapshots provides past RBAC states
+	Snapshots interface {
+		At(asOf time.Time) (*snapshot.Snapshot, error)
+	}
+)
+
+// New Server given an RbacEnumerator
+func New(rbac rbac.Enumerator, options ...Option) (*Server, error) {
+	s := &Server{
+		rbac: rbac,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
+}
+
+// WithSnapshots allows querying past RBAC states with as_of
+func WithSnapshots(snapshots Snapshots) Option {
+	return func(s *Server) {
+		s.snapshots = snapshots
+	}
+}
+
+// WithMaxSubjectNames limits how many subjects a request can have, each of
+// which is matched against every binding
+func WithMaxSubjectNames(max int) Option {
+	return func(s *Server) {
+		s.SetMaxSubjectNames(max)
+	}
+}
+
+// SetMaxSubjectNames changes how many subjects a request can have, zero for
+// no limit
+func (s *Server) SetMaxSubjectNames(max int) {
+	atomic.StoreInt64(&s.maxSubjectNames, int64(max))
+}
+
+// tooManySubjects checks if a request has more subjects than allowed
+func (s *Server) tooManySubjects(subjects int) bool {
+	max := atomic.LoadInt64(&s.maxSubjectNames)
+	return max > 0 && int64(subjects) > max
+}
+
+// EnumerateBindings returns the role bindings in a namespace that refer to
+// any of the subjects
+func (s *Server) EnumerateBindings(ctx context.Context, req *rbacpb.EnumerateBindingsRequest) (*rbacpb.EnumerateBindingsResponse, error) {
+	roleBindings, err := s.enumerate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rbacpb.EnumerateBindingsResponse{
+		RoleBindings: make([]*rbacpb.RoleBinding, len(roleBindings)),
+	}
+	for i, roleBinding := range roleBindings {
+		resp.RoleBindings[i] = fromRoleBinding(roleBinding)
+	}
+	return resp, nil
+}
+
+// StreamBindings streams the role bindings EnumerateBindings would return,
+// in the order they are listed in rather than sorted
+func (s *Server) StreamBindings(req *rbacpb.EnumerateBindingsRequest, stream rbacpb.Rbac_StreamBindingsServer) error {
+	filters, err := s.bindingFilters(req)
+	if err != nil {
+		return err
+	}
+	enumerator, err := s.enumerator(stream.Context(), req.AsOf)
+	if err != nil {
+		return err
+	}
+
+	// role bindings are sent in the order they are listed in, without
+	// waiting to sort them
+	roleBindings, err := enumerator.EnumberateByRoleBindings(req.Namespace, filters...)
+	if err != nil {
+		return status.Error(codes.Internal, "could not retrieve role bindings")
+	}
+	for _, roleBinding := range roleBindings {
+		if err := stream.Send(fromRoleBinding(roleBinding)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EffectivePermissions returns the permissions granted to any of the
+// subjects, and the bindings that grant them
+func (s *Server) EffectivePermissions(ctx context.Context, req *rbacpb.EffectivePermissionsRequest) (*rbacpb.EffectivePermissionsResponse, error) {
+	permissions, bindings, err := s.effectivePermissions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rbacpb.EffectivePermissionsResponse{
+		Permissions: make([]*rbacpb.Permission, len(permissions)),
+		Bindings:    make([]*rbacpb.Key, len(bindings)),
+	}
+	for i, permission := range permissions {
+		resp.Permissions[i] = fromPermission(permission)
+	}
+	for i, binding := range bindings {
+		resp.Bindings[i] = fromKey(binding)
+	}
+	return resp, nil
+}
+
+// StreamEffectivePermissions streams the permissions EffectivePermissions
+// would return, each as soon as a binding grants it rather than sorted
+func (s *Server) StreamEffectivePermissions(req *rbacpb.EffectivePermissionsRequest, stream rbacpb.Rbac_StreamEffectivePermissionsServer) error {
+	state, subjects, err := s.permissionsQuery(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return state.EachEffectivePermission(func(permission rbac.Permission) error {
+		return stream.Send(fromPermission(permission))
+	}, subjects...)
+}
+
+// WhoCan returns the subjects allowed to make a request, and the bindings
+// that allow it
+func (s *Server) WhoCan(ctx context.Context, req *rbacpb.WhoCanRequest) (*rbacpb.WhoCanResponse, error) {
+	subjects, err := s.whoCan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rbacpb.WhoCanResponse{
+		Subjects: make([]*rbacpb.SubjectBindings, len(subjects)),
+	}
+	for i, subject := range subjects {
+		resp.Subjects[i] = fromSubjectBindings(subject)
+	}
+	return resp, nil
+}
+
+// StreamWhoCan streams the subjects WhoCan would return, each with one of
+// the bindings that allow it as soon as it is found, so subjects allowed by
+// several bindings are sent once for each of them
+func (s *Server) StreamWhoCan(req *rbacpb.WhoCanRequest, stream rbacpb.Rbac_StreamWhoCanServer) error {
+	state, attributes, err := s.whoCanQuery(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return state.EachWhoCan(req.Namespace, attributes, func(subject rbac.SubjectKey, binding rbac.Key) error {
+		return stream.Send(fromSubjectBindings(rbac.SubjectBindings{
+			Subject:  subject,
+			Bindings: []rbac.Key{binding},
+		}))
+	})
+}
+
+// enumerate validates the request and retrieves the matching role bindings,
+// sorted by role name, namespace and name
+func (s *Server) enumerate(ctx context.Context, req *rbacpb.EnumerateBindingsRequest) ([]v1.RoleBinding, error) {
+	filters, err := s.bindingFilters(req)
+	if err != nil {
+		return nil, err
+	}
+	enumerator, err := s.enumerator(ctx, req.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// retrieve filtered role bindings
+	roleBindings, err := enumerator.EnumberateByRoleBindings(req.Namespace, filters...)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "could not retrieve role bindings")
+	}
+
+	// sorted like the pages of the HTTP API
+	rbac.SortRoleBindings(roleBindings)
+	return roleBindings, nil
+}
+
+// enumerator returns the live enumerator, or if asOf is set one for the
+// latest snapshot at or before it, setting the time it was actually taken at
+// in the header metadata
+func (s *Server) enumerator(ctx context.Context, asOf *timestamppb.Timestamp) (rbac.Enumerator, error) {
+	if asOf == nil {
+		return s.rbac, nil
+	}
+	if err := asOf.CheckValid(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid as_of in request")
+	}
+	if s.snapshots == nil {
+		return nil, status.Error(codes.FailedPrecondition, "snapshots are not enabled")
+	}
+
+	snap, err := s.snapshots.At(asOf.AsTime())
+	switch {
+	case errors.Is(err, snapshot.ErrNotFound):
+		return nil, status.Error(codes.NotFound, "no snapshot found at or before as_of")
+	case err != nil:
+		return nil, status.Error(codes.Internal, "could not retrieve snapshot")
+	}
+
+	// let the client know how old the state actually is
+	if err := grpc.SetHeader(ctx, metadata.Pairs(snapshotTimestampHeader, snap.Timestamp.Format(time.RFC3339))); err != nil {
+		return nil, status.Error(codes.Internal, "could not set snapshot timestamp header")
+	}
+	return rbac.NewStatic(snap.State), nil
+}
+
+// bindingFilters validates the request and constructs the filters of its
+// subjects and expression
+func (s *Server) bindingFilters(req *rbacpb.EnumerateBindingsRequest) ([]rbac.RoleBindingFilter, error) {
+	// validate namespace
+	if req.Namespace == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing namespace in request")
+	}
+
+	// validate subjects
+	if len(req.Subjects) == 0 && req.Expression == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing subjects in request")
+	}
+	if s.tooManySubjects(len(req.Subjects)) {
+		return nil, status.Error(codes.InvalidArgument, "too many subject names in request")
+	}
+
+	// construct rbac filters, the expression narrows down the subjects
+	patterns := make([]rbac.Pattern, len(req.Subjects))
+	for i, subject := range req.Subjects {
+		patterns[i] = toPattern(subject)
+	}
+	filters, err := rbac.FiltersBySubjectPatterns(patterns)
+	if err != nil {
+		patternErr := &rbac.PatternError{}
+		if errors.As(err, &patternErr) {
+			return nil, status.Errorf(codes.InvalidArgument, "subjects[%d]: %v", patternErr.Index, patternErr.Err)
+		}
+		return nil, status.Error(codes.InvalidArgument, "invalid subject pattern or match type")
+	}
+	if req.Expression != "" {
+		expressionFilter, err := rbac.FilterByExpression(req.Expression)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if len(filters) > 0 {
+			expressionFilter = rbac.FilterAll(rbac.FilterAny(filters...), expressionFilter)
+		}
+		filters = []rbac.RoleBindingFilter{expressionFilter}
+	}
+	return filters, nil
+}
+
+// effectivePermissions validates the request and resolves the permissions
+// of its subjects
+func (s *Server) effectivePermissions(ctx context.Context, req *rbacpb.EffectivePermissionsRequest) ([]rbac.Permission, []rbac.Key, error) {
+	state, subjects, err := s.permissionsQuery(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissions, bindings := state.EffectivePermissions(subjects...)
+	return permissions, bindings, nil
+}
+
+// permissionsQuery validates the request and retrieves the state its
+// subjects' permissions are resolved from
+func (s *Server) permissionsQuery(ctx context.Context, req *rbacpb.EffectivePermissionsRequest) (*rbac.State, []rbac.SubjectKey, error) {
+	// validate subjects
+	if len(req.Subjects) == 0 {
+		return nil, nil, status.Error(codes.InvalidArgument, "missing subjects in request")
+	}
+	if s.tooManySubjects(len(req.Subjects)) {
+		return nil, nil, status.Error(codes.InvalidArgument, "too many subject names in request")
+	}
+	subjects := make([]rbac.SubjectKey, len(req.Subjects))
+	for i, subject := range req.Subjects {
+		if subject.Kind == "" || subject.Name == "" {
+			return nil, nil, status.Error(codes.InvalidArgument, "missing subject kind or name in request")
+		}
+		subjects[i] = rbac.SubjectKey{
+			Kind:      subject.Kind,
+			Namespace: subject.Namespace,
+			Name:      subject.Name,
+		}
+	}
+
+	enumerator, err := s.enumerator(ctx, req.AsOf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// permissions in a namespace only need its roles and role bindings
+	var state *rbac.State
+	if req.Namespace != "" {
+		state, err = rbac.PermissionsState(enumerator, req.Namespace)
+	} else {
+		state, err = enumerator.State()
+	}
+	if err != nil {
+		return nil, nil, status.Error(codes.Internal, "could not retrieve rbac state")
+	}
+	return state, subjects, nil
+}
+
+// whoCan validates the request and resolves the subjects allowed to make it
+func (s *Server) whoCan(ctx context.Context, req *rbacpb.WhoCanRequest) ([]rbac.SubjectBindings, error) {
+	state, attributes, err := s.whoCanQuery(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return state.WhoCan(req.Namespace, attributes), nil
+}
+
+// whoCanQuery validates the request and retrieves the state the subjects
+// allowed to make it are resolved from
+func (s *Server) whoCanQuery(ctx context.Context, req *rbacpb.WhoCanRequest) (*rbac.State, rbac.Attributes, error) {
+	// validate attributes
+	attributes := req.Attributes
+	if attributes == nil || attributes.Verb == "" {
+		return nil, rbac.Attributes{}, status.Error(codes.InvalidArgument, "missing verb in request")
+	}
+	if attributes.NonResourceUrl != "" && (attributes.Resource != "" || attributes.ApiGroup != "") {
+		return nil, rbac.Attributes{}, status.Error(codes.InvalidArgument, "requests are either for resources or non-resource urls")
+	}
+
+	enumerator, err := s.enumerator(ctx, req.AsOf)
+	if err != nil {
+		return nil, rbac.Attributes{}, err
+	}
+
+	// only the namespace's bindings and the cluster-wide ones can allow
+	// requests in it
+	state, err := rbac.PermissionsState(enumerator, req.Namespace)
+	if err != nil {
+		return nil, rbac.Attributes{}, status.Error(codes.Internal, "could not retrieve rbac state")
+	}
+
+	return state, rbac.Attributes{
+		Verb:           attributes.Verb,
+		APIGroup:       attributes.ApiGroup,
+		Resource:       attributes.Resource,
+		Subresource:    attributes.Subresource,
+		Name:           attributes.Name,
+		NonResourceURL: attributes.NonResourceUrl,
+	}, nil
+}
@@ -0,0 +1,530 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/api/rbacpb"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+	"github.com/geoah/go-kube-api/internal/snapshot"
+)
+
+const (
+	nsDefault = "default"
+)
+
+var (
+	// state is a sample state with roles for the fixtures' bindings
+	state = rbac.State{
+		Roles: []v1.Role{{
+			ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: nsDefault},
+			Rules: []v1.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list"},
+			}},
+		}},
+		ClusterRoles: []v1.ClusterRole{{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterrole1"},
+			Rules: []v1.PolicyRule{{
+				NonResourceURLs: []string{"/metrics"},
+				Verbs:           []string{"get"},
+			}},
+		}},
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+			fixtures.RoleBindingRole3Subject3and4,
+		},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{
+			fixtures.ClusterRoleBindingClusterRole1Subject1,
+		},
+	}
+	roleBinding1        = &rbacpb.Key{Kind: rbac.KindRoleBinding, Namespace: nsDefault, Name: "role1-for-subject1"}
+	clusterRoleBinding1 = &rbacpb.Key{Kind: rbac.KindClusterRoleBinding, Name: "clusterrole1-for-subject1"}
+)
+
+// snapshotsFunc implements Snapshots with a function
+type snapshotsFunc func(asOf time.Time) (*snapshot.Snapshot, error)
+
+func (f snapshotsFunc) At(asOf time.Time) (*snapshot.Snapshot, error) {
+	return f(asOf)
+}
+
+// dial serves the enumerator over an in-process listener, and returns a
+// client connected to it
+func dial(t *testing.T, enumerator rbac.Enumerator, options ...Option) rbacpb.RbacClient {
+	server, err := New(enumerator, options...)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	rbacpb.RegisterRbacServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return rbacpb.NewRbacClient(conn)
+}
+
+// scopedEnumerator expects the state of the namespace, or only the
+// cluster-wide state if empty, to be retrieved once rather than the whole
+// cluster's
+func scopedEnumerator(t *testing.T, namespace string) rbac.Enumerator {
+	static := rbac.NewStatic(state)
+	ctrl := gomock.NewController(t)
+	mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+	mockEnumerator.EXPECT().ClusterState().DoAndReturn(static.ClusterState).Times(1)
+	if namespace != "" {
+		mockEnumerator.EXPECT().NamespaceState(namespace).DoAndReturn(static.NamespaceState).Times(1)
+	}
+	return mockEnumerator
+}
+
+// staticEnumerator returns a mock enumerator that enumerates the sample
+// state's role bindings
+func staticEnumerator(t *testing.T) rbac.Enumerator {
+	ctrl := gomock.NewController(t)
+	mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+	mockEnumerator.EXPECT().EnumberateByRoleBindings(nsDefault, gomock.Any()).DoAndReturn(
+		func(namespace string, filters ...rbac.RoleBindingFilter) ([]v1.RoleBinding, error) {
+			return rbac.NewStatic(state).EnumberateByRoleBindings(namespace, filters...)
+		},
+	).Times(1)
+	return mockEnumerator
+}
+
+func TestServer_EnumerateBindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		rbac     func(t *testing.T) rbac.Enumerator
+		req      *rbacpb.EnumerateBindingsRequest
+		want     []string
+		wantCode codes.Code
+	}{
+		{
+			name: "exact subject, success",
+			rbac: staticEnumerator,
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+				Subjects:  []*rbacpb.SubjectPattern{{Pattern: "subject1"}},
+			},
+			want: []string{"role1-for-subject1"},
+		},
+		{
+			name: "prefix subjects, sorted by role, success",
+			rbac: staticEnumerator,
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+				Subjects: []*rbacpb.SubjectPattern{{
+					Pattern:   "subject",
+					MatchType: rbacpb.MatchType_MATCH_TYPE_PREFIX,
+				}},
+			},
+			want: []string{"role1-for-subject1", "role2-for-subject2", "role3-for-subject3and4"},
+		},
+		{
+			name: "same role, sorted by name, success",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				roleBinding := func(name string) v1.RoleBinding {
+					roleBinding := fixtures.RoleBindingRole1Subject1
+					roleBinding.Name = name
+					return roleBinding
+				}
+				ctrl := gomock.NewController(t)
+				mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+				mockEnumerator.EXPECT().EnumberateByRoleBindings(nsDefault, gomock.Any()).Return([]v1.RoleBinding{
+					roleBinding("b"),
+					roleBinding("c"),
+					roleBinding("a"),
+				}, nil).Times(1)
+				return mockEnumerator
+			},
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+				Subjects:  []*rbacpb.SubjectPattern{{Pattern: "subject1"}},
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "expression narrows subjects, success",
+			rbac: staticEnumerator,
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+				Subjects: []*rbacpb.SubjectPattern{{
+					Pattern:   "subject[12]",
+					MatchType: rbacpb.MatchType_MATCH_TYPE_REGEX,
+				}},
+				Expression: `binding.roleRef.name == "role2"`,
+			},
+			want: []string{"role2-for-subject2"},
+		},
+		{
+			name: "missing namespace, fails",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+			},
+			req: &rbacpb.EnumerateBindingsRequest{
+				Subjects: []*rbacpb.SubjectPattern{{Pattern: "subject1"}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "missing subjects, fails",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+			},
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "too many subject names, fails",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+			},
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+				Subjects: []*rbacpb.SubjectPattern{
+					{Pattern: "subject1"},
+					{Pattern: "subject2"},
+					{Pattern: "subject3"},
+				},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "invalid regular expression, fails",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+			},
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+				Subjects: []*rbacpb.SubjectPattern{{
+					Pattern:   "subject[",
+					MatchType: rbacpb.MatchType_MATCH_TYPE_REGEX,
+				}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "enumerator error, fails",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				ctrl := gomock.NewController(t)
+				mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+				mockEnumerator.EXPECT().EnumberateByRoleBindings(nsDefault, gomock.Any()).Return(nil, errors.New("some error")).Times(1)
+				return mockEnumerator
+			},
+			req: &rbacpb.EnumerateBindingsRequest{
+				Namespace: nsDefault,
+				Subjects:  []*rbacpb.SubjectPattern{{Pattern: "subject1"}},
+			},
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dial(t, tt.rbac(t), WithMaxSubjectNames(2))
+			resp, err := client.EnumerateBindings(context.Background(), tt.req)
+			if tt.wantCode != codes.OK {
+				assert.Equal(t, tt.wantCode, status.Code(err), "code did not match expectation")
+				return
+			}
+			require.NoError(t, err)
+			got := []string{}
+			for _, roleBinding := range resp.RoleBindings {
+				got = append(got, roleBinding.Name)
+			}
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestServer_StreamBindings(t *testing.T) {
+	client := dial(t, staticEnumerator(t))
+	stream, err := client.StreamBindings(context.Background(), &rbacpb.EnumerateBindingsRequest{
+		Namespace: nsDefault,
+		Subjects: []*rbacpb.SubjectPattern{{
+			Pattern:   "subject*",
+			MatchType: rbacpb.MatchType_MATCH_TYPE_GLOB,
+		}},
+	})
+	require.NoError(t, err)
+
+	got := []*rbacpb.RoleBinding{}
+	for {
+		roleBinding, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, roleBinding)
+	}
+	require.Len(t, got, 3)
+	assert.True(t, proto.Equal(&rbacpb.RoleBinding{
+		Namespace: nsDefault,
+		Name:      "role1-for-subject1",
+		RoleRef:   &rbacpb.RoleRef{Name: "role1"},
+		Subjects:  []*rbacpb.Subject{{Kind: "User", Name: "subject1"}},
+	}, got[0]), "first role binding did not match expectation")
+}
+
+func TestServer_EffectivePermissions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+	mockEnumerator.EXPECT().State().Return(&state, nil).Times(2)
+	client := dial(t, mockEnumerator)
+
+	req := &rbacpb.EffectivePermissionsRequest{
+		Subjects: []*rbacpb.SubjectKey{{Kind: "User", Name: "subject1"}},
+	}
+	wantPermissions := []*rbacpb.Permission{
+		{Verb: "get", NonResourceUrl: "/metrics"},
+		{Namespace: nsDefault, Verb: "get", Resource: "pods"},
+		{Namespace: nsDefault, Verb: "list", Resource: "pods"},
+	}
+
+	resp, err := client.EffectivePermissions(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(&rbacpb.EffectivePermissionsResponse{
+		Permissions: wantPermissions,
+		Bindings:    []*rbacpb.Key{clusterRoleBinding1, roleBinding1},
+	}, resp), "response did not match expectation")
+
+	// streamed in the order the bindings grant them rather than sorted
+	stream, err := client.StreamEffectivePermissions(context.Background(), req)
+	require.NoError(t, err)
+	streamed := []*rbacpb.Permission{}
+	for {
+		permission, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		streamed = append(streamed, permission)
+	}
+	require.Len(t, streamed, len(wantPermissions))
+	for _, want := range wantPermissions {
+		found := false
+		for _, got := range streamed {
+			found = found || proto.Equal(want, got)
+		}
+		assert.True(t, found, "permission %v was not streamed", want)
+	}
+
+	_, err = client.EffectivePermissions(context.Background(), &rbacpb.EffectivePermissionsRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "code did not match expectation")
+
+	// permissions in a namespace only retrieve its state
+	client = dial(t, scopedEnumerator(t, nsDefault))
+	resp, err = client.EffectivePermissions(context.Background(), &rbacpb.EffectivePermissionsRequest{
+		Subjects:  req.Subjects,
+		Namespace: nsDefault,
+	})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(&rbacpb.EffectivePermissionsResponse{
+		Permissions: wantPermissions,
+		Bindings:    []*rbacpb.Key{clusterRoleBinding1, roleBinding1},
+	}, resp), "response did not match expectation")
+}
+
+func TestServer_WhoCan(t *testing.T) {
+	tests := []struct {
+		name     string
+		rbac     func(t *testing.T) rbac.Enumerator
+		req      *rbacpb.WhoCanRequest
+		want     []*rbacpb.SubjectBindings
+		wantCode codes.Code
+	}{
+		{
+			name: "resource in namespace, success",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				return scopedEnumerator(t, nsDefault)
+			},
+			req: &rbacpb.WhoCanRequest{
+				Namespace:  nsDefault,
+				Attributes: &rbacpb.Attributes{Verb: "list", Resource: "pods"},
+			},
+			want: []*rbacpb.SubjectBindings{{
+				Subject:  &rbacpb.SubjectKey{Kind: "User", Name: "subject1"},
+				Bindings: []*rbacpb.Key{roleBinding1},
+			}},
+		},
+		{
+			name: "non-resource url, success",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				return scopedEnumerator(t, "")
+			},
+			req: &rbacpb.WhoCanRequest{
+				Attributes: &rbacpb.Attributes{Verb: "get", NonResourceUrl: "/metrics"},
+			},
+			want: []*rbacpb.SubjectBindings{{
+				Subject:  &rbacpb.SubjectKey{Kind: "User", Name: "subject1"},
+				Bindings: []*rbacpb.Key{clusterRoleBinding1},
+			}},
+		},
+		{
+			name: "missing verb, fails",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				return rbacmocks.NewMockEnumerator(gomock.NewController(t))
+			},
+			req: &rbacpb.WhoCanRequest{
+				Attributes: &rbacpb.Attributes{Resource: "pods"},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "state error, fails",
+			rbac: func(t *testing.T) rbac.Enumerator {
+				ctrl := gomock.NewController(t)
+				mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+				mockEnumerator.EXPECT().ClusterState().Return(nil, errors.New("some error")).Times(1)
+				return mockEnumerator
+			},
+			req: &rbacpb.WhoCanRequest{
+				Attributes: &rbacpb.Attributes{Verb: "get", Resource: "pods"},
+			},
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dial(t, tt.rbac(t))
+			resp, err := client.WhoCan(context.Background(), tt.req)
+			if tt.wantCode != codes.OK {
+				assert.Equal(t, tt.wantCode, status.Code(err), "code did not match expectation")
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(&rbacpb.WhoCanResponse{Subjects: tt.want}, resp), "response did not match expectation")
+		})
+	}
+}
+
+func TestServer_StreamWhoCan(t *testing.T) {
+	client := dial(t, scopedEnumerator(t, nsDefault))
+
+	stream, err := client.StreamWhoCan(context.Background(), &rbacpb.WhoCanRequest{
+		Namespace:  nsDefault,
+		Attributes: &rbacpb.Attributes{Verb: "get", Resource: "pods"},
+	})
+	require.NoError(t, err)
+
+	got, err := stream.Recv()
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(&rbacpb.SubjectBindings{
+		Subject:  &rbacpb.SubjectKey{Kind: "User", Name: "subject1"},
+		Bindings: []*rbacpb.Key{roleBinding1},
+	}, got), "streamed subject did not match expectation")
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestServer_asOf(t *testing.T) {
+	asOf := time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC)
+	taken := time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+	snapshots := snapshotsFunc(func(at time.Time) (*snapshot.Snapshot, error) {
+		if at.Before(taken) {
+			return nil, snapshot.ErrNotFound
+		}
+		return &snapshot.Snapshot{
+			Timestamp: taken,
+			State: rbac.State{
+				Roles:        state.Roles,
+				RoleBindings: []v1.RoleBinding{fixtures.RoleBindingRole1Subject1},
+			},
+		}, nil
+	})
+	// the live cluster is not queried
+	live := rbacmocks.NewMockEnumerator(gomock.NewController(t))
+	client := dial(t, live, WithSnapshots(snapshots))
+
+	header := metadata.MD{}
+	resp, err := client.EnumerateBindings(context.Background(), &rbacpb.EnumerateBindingsRequest{
+		Namespace: nsDefault,
+		Subjects:  []*rbacpb.SubjectPattern{{Pattern: "subject", MatchType: rbacpb.MatchType_MATCH_TYPE_PREFIX}},
+		AsOf:      timestamppb.New(asOf),
+	}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, resp.RoleBindings, 1)
+	assert.Equal(t, "role1-for-subject1", resp.RoleBindings[0].Name)
+	assert.Equal(t, []string{taken.Format(time.RFC3339)}, header.Get(snapshotTimestampHeader))
+
+	whoCan, err := client.WhoCan(context.Background(), &rbacpb.WhoCanRequest{
+		Namespace:  nsDefault,
+		Attributes: &rbacpb.Attributes{Verb: "list", Resource: "pods"},
+		AsOf:       timestamppb.New(asOf),
+	})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(&rbacpb.WhoCanResponse{
+		Subjects: []*rbacpb.SubjectBindings{{
+			Subject:  &rbacpb.SubjectKey{Kind: "User", Name: "subject1"},
+			Bindings: []*rbacpb.Key{roleBinding1},
+		}},
+	}, whoCan), "response did not match expectation")
+
+	stream, err := client.StreamEffectivePermissions(context.Background(), &rbacpb.EffectivePermissionsRequest{
+		Subjects: []*rbacpb.SubjectKey{{Kind: "User", Name: "subject1"}},
+		AsOf:     timestamppb.New(asOf),
+	})
+	require.NoError(t, err)
+	streamed := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		streamed++
+	}
+	assert.Equal(t, 2, streamed, "permissions of the snapshot's role binding only")
+	streamHeader, err := stream.Header()
+	require.NoError(t, err)
+	assert.Equal(t, []string{taken.Format(time.RFC3339)}, streamHeader.Get(snapshotTimestampHeader))
+
+	// no snapshot that old
+	_, err = client.EnumerateBindings(context.Background(), &rbacpb.EnumerateBindingsRequest{
+		Namespace: nsDefault,
+		Subjects:  []*rbacpb.SubjectPattern{{Pattern: "subject1"}},
+		AsOf:      timestamppb.New(taken.Add(-time.Hour)),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err), "code did not match expectation")
+
+	// snapshots not enabled
+	client = dial(t, live)
+	_, err = client.EnumerateBindings(context.Background(), &rbacpb.EnumerateBindingsRequest{
+		Namespace: nsDefault,
+		Subjects:  []*rbacpb.SubjectPattern{{Pattern: "subject1"}},
+		AsOf:      timestamppb.New(asOf),
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "code did not match expectation")
+}
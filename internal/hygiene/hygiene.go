@@ -0,0 +1,78 @@
+package hygiene
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// aggregateToLabelPrefix is the label prefix of cluster roles that are
+	// aggregated into other cluster roles, they are used without bindings
+	aggregateToLabelPrefix = "rbac.authorization.k8s.io/aggregate-to-"
+)
+
+type (
+	// Report lists the bindings and roles that are most likely leftovers
+	Report struct {
+		// DanglingBindings refer to roles that do not exist
+		DanglingBindings []rbac.Binding `json:"danglingBindings" yaml:"danglingBindings"`
+		// OrphanedRoles are roles and cluster roles without any bindings
+		OrphanedRoles []rbac.Key `json:"orphanedRoles" yaml:"orphanedRoles"`
+		// EmptyBindings have no subjects
+		EmptyBindings []rbac.Binding `json:"emptyBindings" yaml:"emptyBindings"`
+	}
+)
+
+// New checks the state for dangling bindings, orphaned roles and bindings
+// without subjects
+func New(state rbac.State) Report {
+	report := Report{
+		DanglingBindings: []rbac.Binding{},
+		OrphanedRoles:    []rbac.Key{},
+		EmptyBindings:    []rbac.Binding{},
+	}
+
+	roles := state.RoleRules()
+
+	// bindings are sorted, so the results will be too
+	bound := map[rbac.Key]bool{}
+	for _, binding := range state.Bindings() {
+		roleKey := binding.RoleKey()
+		bound[roleKey] = true
+		if _, ok := roles[roleKey]; !ok {
+			report.DanglingBindings = append(report.DanglingBindings, binding)
+		}
+		if len(binding.Subjects) == 0 {
+			report.EmptyBindings = append(report.EmptyBindings, binding)
+		}
+	}
+
+	aggregated := map[rbac.Key]bool{}
+	for _, clusterRole := range state.ClusterRoles {
+		for label := range clusterRole.Labels {
+			if strings.HasPrefix(label, aggregateToLabelPrefix) {
+				aggregated[rbac.Key{Kind: rbac.KindClusterRole, Name: clusterRole.Name}] = true
+			}
+		}
+	}
+
+	for role := range roles {
+		if !bound[role] && !aggregated[role] {
+			report.OrphanedRoles = append(report.OrphanedRoles, role)
+		}
+	}
+	sort.Slice(report.OrphanedRoles, func(i, j int) bool {
+		return report.OrphanedRoles[i].Less(report.OrphanedRoles[j])
+	})
+
+	return report
+}
+
+// Empty checks if no issues were found
+func (r Report) Empty() bool {
+	return len(r.DanglingBindings) == 0 &&
+		len(r.OrphanedRoles) == 0 &&
+		len(r.EmptyBindings) == 0
+}
@@ -0,0 +1,127 @@
+package hygiene
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+// role returns a role in the default namespace
+func role(name string) v1.Role {
+	return v1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	// role binding 1 without any subjects
+	roleBindingRole1NoSubjects := fixtures.RoleBindingRole1Subject1
+	roleBindingRole1NoSubjects.Name = "role1-for-nobody"
+	roleBindingRole1NoSubjects.Subjects = nil
+
+	tests := []struct {
+		name     string
+		state    rbac.State
+		want     Report
+		wantText string
+	}{
+		{
+			name: "no issues",
+			state: rbac.State{
+				Roles:        []v1.Role{role("role1")},
+				RoleBindings: []v1.RoleBinding{fixtures.RoleBindingRole1Subject1},
+			},
+			want: Report{
+				DanglingBindings: []rbac.Binding{},
+				OrphanedRoles:    []rbac.Key{},
+				EmptyBindings:    []rbac.Binding{},
+			},
+			wantText: "No issues found\n",
+		},
+		{
+			name: "dangling bindings, orphaned roles and empty bindings",
+			state: rbac.State{
+				Roles: []v1.Role{role("role1"), role("role3")},
+				ClusterRoles: []v1.ClusterRole{
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "clusterrole2"},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "aggregated",
+							Labels: map[string]string{
+								"rbac.authorization.k8s.io/aggregate-to-view": "true",
+							},
+						},
+					},
+				},
+				RoleBindings: []v1.RoleBinding{
+					fixtures.RoleBindingRole1Subject1,
+					fixtures.RoleBindingRole2Subject2,
+					roleBindingRole1NoSubjects,
+				},
+				ClusterRoleBindings: []v1.ClusterRoleBinding{
+					fixtures.ClusterRoleBindingClusterRole1Subject1,
+				},
+			},
+			want: Report{
+				DanglingBindings: []rbac.Binding{
+					{
+						Kind:     rbac.KindClusterRoleBinding,
+						Name:     "clusterrole1-for-subject1",
+						RoleRef:  fixtures.ClusterRoleBindingClusterRole1Subject1.RoleRef,
+						Subjects: fixtures.ClusterRoleBindingClusterRole1Subject1.Subjects,
+					},
+					{
+						Kind:      rbac.KindRoleBinding,
+						Namespace: "default",
+						Name:      "role2-for-subject2",
+						RoleRef:   fixtures.RoleBindingRole2Subject2.RoleRef,
+						Subjects:  fixtures.RoleBindingRole2Subject2.Subjects,
+					},
+				},
+				OrphanedRoles: []rbac.Key{
+					{Kind: rbac.KindClusterRole, Name: "clusterrole2"},
+					{Kind: rbac.KindRole, Namespace: "default", Name: "role3"},
+				},
+				EmptyBindings: []rbac.Binding{
+					{
+						Kind:      rbac.KindRoleBinding,
+						Namespace: "default",
+						Name:      "role1-for-nobody",
+						RoleRef:   fixtures.RoleBindingRole1Subject1.RoleRef,
+					},
+				},
+			},
+			wantText: "Bindings to missing roles:\n" +
+				"  ClusterRoleBinding/clusterrole1-for-subject1 -> ClusterRole/clusterrole1\n" +
+				"  RoleBinding/default/role2-for-subject2 -> Role/default/role2\n" +
+				"Roles without bindings:\n" +
+				"  ClusterRole/clusterrole2\n" +
+				"  Role/default/role3\n" +
+				"Bindings without subjects:\n" +
+				"  RoleBinding/default/role1-for-nobody\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.state)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+
+			text := &bytes.Buffer{}
+			err := got.WriteText(text)
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.wantText, text.String(), "text did not match expectation")
+		})
+	}
+}
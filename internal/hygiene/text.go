@@ -0,0 +1,40 @@
+package hygiene
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteText writes a human-readable description of the report
+func (r Report) WriteText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	if r.Empty() {
+		fmt.Fprintln(b, "No issues found")
+		return b.Flush()
+	}
+
+	if len(r.DanglingBindings) > 0 {
+		fmt.Fprintln(b, "Bindings to missing roles:")
+		for _, binding := range r.DanglingBindings {
+			fmt.Fprintf(b, "  %s -> %s\n", binding.Key(), binding.RoleKey())
+		}
+	}
+
+	if len(r.OrphanedRoles) > 0 {
+		fmt.Fprintln(b, "Roles without bindings:")
+		for _, role := range r.OrphanedRoles {
+			fmt.Fprintf(b, "  %s\n", role)
+		}
+	}
+
+	if len(r.EmptyBindings) > 0 {
+		fmt.Fprintln(b, "Bindings without subjects:")
+		for _, binding := range r.EmptyBindings {
+			fmt.Fprintf(b, "  %s\n", binding.Key())
+		}
+	}
+
+	return b.Flush()
+}
@@ -0,0 +1,356 @@
+// Package limits protects the service, and the API server behind it, from
+// callers sending too many or too large HTTP requests and gRPC calls
+package limits
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/geoah/go-kube-api/internal/auth"
+	"github.com/geoah/go-kube-api/internal/respond"
+)
+
+const (
+	// sweepInterval is how often callers that have been idle long enough to
+	// refill their bucket are forgotten
+	sweepInterval = time.Minute
+)
+
+type (
+	// RateLimiter limits how many requests each caller can make, using a
+	// token bucket per caller
+	RateLimiter struct {
+		rate           rate.Limit
+		burst          int
+		callerHeader   string
+		trustedProxies []*net.IPNet
+		now            func() time.Time
+		mutex          sync.Mutex
+		callers        map[string]*caller
+		lastSweep      time.Time
+	}
+	// Option configures optional features of the RateLimiter
+	Option func(*RateLimiter)
+	// BodySizeLimiter limits the size of HTTP request bodies. gRPC messages
+	// are limited with grpc.MaxRecvMsgSize instead, since interceptors only
+	// get them once they have been received and decoded, and that can't be
+	// changed without restarting.
+	BodySizeLimiter struct {
+		maxBytes int64
+	}
+	// caller is the token bucket of a caller and when they last made a
+	// request
+	caller struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+)
+
+// NewRateLimiter given how many requests per second each caller can make on
+// average, and how many they can make at once
+func NewRateLimiter(requestsPerSecond float64, burst int, options ...Option) (*RateLimiter, error) {
+	if err := validateRate(requestsPerSecond, burst); err != nil {
+		return nil, err
+	}
+	l := &RateLimiter{
+		rate:    rate.Limit(requestsPerSecond),
+		burst:   burst,
+		now:     time.Now,
+		callers: map[string]*caller{},
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l, nil
+}
+
+// validateRate checks that callers can make requests
+func validateRate(requestsPerSecond float64, burst int) error {
+	if requestsPerSecond <= 0 {
+		return errors.New("requests per second must be positive")
+	}
+	if burst <= 0 {
+		return errors.New("burst must be positive")
+	}
+	return nil
+}
+
+// WithCallerHeader identifies callers by the given request header, such as
+// one set by an authenticating proxy, instead of their IP. The header is only
+// honoured on requests from trusted proxies, since anyone else could set it,
+// requests without it are still limited by IP.
+func WithCallerHeader(header string) Option {
+	return func(l *RateLimiter) {
+		l.callerHeader = header
+	}
+}
+
+// WithTrustedProxies trusts the proxies in the given networks to set the
+// caller header and X-Forwarded-For, callers are identified by the address
+// requests come from otherwise
+func WithTrustedProxies(proxies []*net.IPNet) Option {
+	return func(l *RateLimiter) {
+		l.trustedProxies = proxies
+	}
+}
+
+// ParseProxies parses the IPs or CIDRs of proxies
+func ParseProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, len(proxies))
+	for i, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy %q", proxy)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q", proxy)
+		}
+		networks[i] = network
+	}
+	return networks, nil
+}
+
+// SetLimits changes how many requests per second callers can make on average
+// and at once, including callers that have already made requests
+func (l *RateLimiter) SetLimits(requestsPerSecond float64, burst int) error {
+	if err := validateRate(requestsPerSecond, burst); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.rate = rate.Limit(requestsPerSecond)
+	l.burst = burst
+	for _, c := range l.callers {
+		c.limiter.SetLimitAt(now, l.rate)
+		c.limiter.SetBurstAt(now, l.burst)
+	}
+	return nil
+}
+
+// SetCallerHeader changes the request header callers are identified by,
+// callers are identified by their IP if empty
+func (l *RateLimiter) SetCallerHeader(header string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.callerHeader = header
+}
+
+// Limit handles requests by letting them through if the caller has requests
+// left, or responding with too many requests and when to retry otherwise
+func (l *RateLimiter) Limit(c *gin.Context) {
+	key := l.key(c.GetString(auth.CallerKey), c.Request.RemoteAddr, func(name string) []string {
+		return c.Request.Header[http.CanonicalHeaderKey(name)]
+	})
+	if wait, ok := l.allow(key); !ok {
+		c.Header("Retry-After", retryAfter(wait))
+		respond.Abort(c, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	c.Next()
+}
+
+// UnaryServerInterceptor limits gRPC calls the same way as HTTP requests,
+// callers over the limit get a resource exhausted error
+func (l *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.limitCall(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor limits gRPC streams the same way as HTTP requests,
+// callers over the limit get a resource exhausted error
+func (l *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.limitCall(stream.Context()); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// limitCall takes a token from the bucket of the gRPC call's caller, or
+// returns a resource exhausted error with when to retry
+func (l *RateLimiter) limitCall(ctx context.Context) error {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	caller, _ := auth.CallerFromContext(ctx)
+	md, _ := metadata.FromIncomingContext(ctx)
+	if wait, ok := l.allow(l.key(caller, remoteAddr, md.Get)); !ok {
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(wait)))
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// key identifies the caller of a request, by the name it authenticated as if
+// any, or else from the given address with the given headers. Requests from
+// trusted proxies are identified by the caller header if set, or by the last
+// address in X-Forwarded-For that isn't a trusted proxy, anything else by the
+// address it comes from.
+func (l *RateLimiter) key(authenticated, remoteAddr string, header func(name string) []string) string {
+	if authenticated != "" {
+		return "auth:" + authenticated
+	}
+
+	l.mutex.Lock()
+	callerHeader := l.callerHeader
+	l.mutex.Unlock()
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !l.trusted(ip) {
+		return "ip:" + host
+	}
+
+	if callerHeader != "" {
+		if callers := header(callerHeader); len(callers) > 0 && callers[0] != "" {
+			return "caller:" + callers[0]
+		}
+	}
+	// each proxy appends the address it got the request from
+	forwarded := strings.Split(strings.Join(header("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && l.trusted(ip); i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+	}
+	return "ip:" + ip.String()
+}
+
+// trusted checks if the address is one of a trusted proxy
+func (l *RateLimiter) trusted(ip net.IP) bool {
+	for _, network := range l.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter returns how many seconds to wait, rounded up so that callers
+// don't retry too early
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// allow takes a token from the caller's bucket, or returns how long until
+// there will be one
+func (l *RateLimiter) allow(key string) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	c, ok := l.callers[key]
+	if !ok {
+		c = &caller{
+			limiter: rate.NewLimiter(l.rate, l.burst),
+		}
+		l.callers[key] = c
+	}
+	c.lastSeen = now
+
+	reservation := c.limiter.ReserveN(now, 1)
+	if wait := reservation.DelayFrom(now); wait > 0 {
+		// give the token back, the request isn't going to be made
+		reservation.CancelAt(now)
+		return wait, false
+	}
+	return 0, true
+}
+
+// sweep forgets callers whose buckets have refilled since their last
+// request, they'd get a full bucket anyway
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	refill := time.Duration(float64(l.burst) / float64(l.rate) * float64(time.Second))
+	for key, c := range l.callers {
+		if now.Sub(c.lastSeen) > refill {
+			delete(l.callers, key)
+		}
+	}
+}
+
+// NewBodySizeLimiter given the largest request body allowed, in bytes
+func NewBodySizeLimiter(maxBytes int64) *BodySizeLimiter {
+	return &BodySizeLimiter{
+		maxBytes: maxBytes,
+	}
+}
+
+// SetMaxBytes changes the largest request body allowed, in bytes
+func (l *BodySizeLimiter) SetMaxBytes(maxBytes int64) {
+	atomic.StoreInt64(&l.maxBytes, maxBytes)
+}
+
+// Limit handles requests by responding with request entity too large if
+// their body is larger than allowed
+func (l *BodySizeLimiter) Limit(c *gin.Context) {
+	maxBytes := atomic.LoadInt64(&l.maxBytes)
+	if c.Request.ContentLength > maxBytes {
+		respond.Abort(c, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		c.Next()
+		return
+	}
+
+	// the content length can be missing, read one more byte than allowed to
+	// know if the body is too large
+	body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxBytes+1))
+	c.Request.Body.Close()
+	if err != nil {
+		respond.Abort(c, http.StatusBadRequest, "could not read request")
+		return
+	}
+	if int64(len(body)) > maxBytes {
+		respond.Abort(c, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.Next()
+}
@@ -0,0 +1,307 @@
+package limits
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/geoah/go-kube-api/internal/auth"
+)
+
+func TestRateLimiter_Limit(t *testing.T) {
+	trustedProxies, err := ParseProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	type request struct {
+		after      time.Duration
+		caller     string
+		headers    http.Header
+		remoteAddr string
+		wantCode   int
+		wantRetry  string
+	}
+	tests := []struct {
+		name     string
+		options  []Option
+		requests []request
+	}{
+		{
+			name: "by ip, burst then limited, success",
+			requests: []request{
+				{remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{remoteAddr: "10.0.0.1:1234", wantCode: http.StatusTooManyRequests, wantRetry: "2"},
+				{remoteAddr: "10.0.0.2:1234", wantCode: http.StatusOK},
+				{after: 2 * time.Second, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{remoteAddr: "10.0.0.1:1234", wantCode: http.StatusTooManyRequests, wantRetry: "2"},
+			},
+		},
+		{
+			name: "forwarded for and caller header from untrusted callers, ignored",
+			options: []Option{
+				WithCallerHeader("X-Remote-User"),
+				WithTrustedProxies(trustedProxies),
+			},
+			requests: []request{
+				{headers: http.Header{"X-Forwarded-For": {"1.1.1.1"}}, remoteAddr: "192.168.0.1:1234", wantCode: http.StatusOK},
+				{headers: http.Header{"X-Forwarded-For": {"2.2.2.2"}}, remoteAddr: "192.168.0.1:1234", wantCode: http.StatusOK},
+				{headers: http.Header{"X-Remote-User": {"alice"}}, remoteAddr: "192.168.0.1:1234", wantCode: http.StatusTooManyRequests, wantRetry: "2"},
+			},
+		},
+		{
+			name:    "forwarded for from trusted proxies, success",
+			options: []Option{WithTrustedProxies(trustedProxies)},
+			requests: []request{
+				// the client is the last address that isn't a trusted proxy
+				{headers: http.Header{"X-Forwarded-For": {"1.1.1.1, 192.168.0.1, 10.0.0.2"}}, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{headers: http.Header{"X-Forwarded-For": {"3.3.3.3", "192.168.0.1"}}, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{remoteAddr: "192.168.0.1:1234", wantCode: http.StatusTooManyRequests, wantRetry: "2"},
+				{headers: http.Header{"X-Forwarded-For": {"192.168.0.2"}}, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+			},
+		},
+		{
+			name: "by caller header from trusted proxies, falling back to ip, success",
+			options: []Option{
+				WithCallerHeader("X-Remote-User"),
+				WithTrustedProxies(trustedProxies),
+			},
+			requests: []request{
+				{headers: http.Header{"X-Remote-User": {"alice"}}, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{headers: http.Header{"X-Remote-User": {"alice"}}, remoteAddr: "10.0.0.2:1234", wantCode: http.StatusOK},
+				{headers: http.Header{"X-Remote-User": {"alice"}}, remoteAddr: "10.0.0.3:1234", wantCode: http.StatusTooManyRequests, wantRetry: "2"},
+				{headers: http.Header{"X-Remote-User": {"bob"}}, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+			},
+		},
+		{
+			name: "by authenticated caller over caller header and ip, success",
+			options: []Option{
+				WithCallerHeader("X-Remote-User"),
+				WithTrustedProxies(trustedProxies),
+			},
+			requests: []request{
+				{caller: "ci", headers: http.Header{"X-Remote-User": {"alice"}}, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+				{caller: "ci", headers: http.Header{"X-Remote-User": {"bob"}}, remoteAddr: "10.0.0.2:1234", wantCode: http.StatusOK},
+				{caller: "ci", remoteAddr: "192.168.0.1:1234", wantCode: http.StatusTooManyRequests, wantRetry: "2"},
+				{caller: "dashboard", remoteAddr: "192.168.0.1:1234", wantCode: http.StatusOK},
+				{headers: http.Header{"X-Remote-User": {"alice"}}, remoteAddr: "10.0.0.1:1234", wantCode: http.StatusOK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// half a request per second, two at once
+			l, err := NewRateLimiter(0.5, 2, tt.options...)
+			require.NoError(t, err)
+			now := time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC)
+			l.now = func() time.Time {
+				return now
+			}
+
+			// authenticates requests as the caller of the request being made
+			caller := ""
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if caller != "" {
+					c.Set(auth.CallerKey, caller)
+				}
+			})
+			r.Use(l.Limit)
+			r.GET("/", func(c *gin.Context) {
+				c.String(http.StatusOK, "OK")
+			})
+
+			for i, request := range tt.requests {
+				now = now.Add(request.after)
+				caller = request.caller
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/", nil)
+				if request.headers != nil {
+					req.Header = request.headers
+				}
+				req.RemoteAddr = request.remoteAddr
+				r.ServeHTTP(w, req)
+				assert.Equal(t, request.wantCode, w.Code, "request %d", i)
+				assert.Equal(t, request.wantRetry, w.Header().Get("Retry-After"), "request %d", i)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_sweep(t *testing.T) {
+	// buckets take 100 seconds to refill
+	l, err := NewRateLimiter(1, 100)
+	require.NoError(t, err)
+	now := time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time {
+		return now
+	}
+
+	_, ok := l.allow("ip:10.0.0.1")
+	assert.True(t, ok)
+	now = now.Add(50 * time.Second)
+	_, ok = l.allow("ip:10.0.0.2")
+	assert.True(t, ok)
+
+	// only the first caller's bucket has refilled
+	now = now.Add(55 * time.Second)
+	_, ok = l.allow("ip:10.0.0.3")
+	assert.True(t, ok)
+	assert.Len(t, l.callers, 2)
+	assert.NotContains(t, l.callers, "ip:10.0.0.1")
+}
+
+func TestRateLimiter_SetLimits(t *testing.T) {
+	l, err := NewRateLimiter(0.5, 1)
+	require.NoError(t, err)
+	now := time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time {
+		return now
+	}
+
+	_, ok := l.allow("ip:10.0.0.1")
+	assert.True(t, ok)
+	wait, ok := l.allow("ip:10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// existing callers get the new limits too
+	require.NoError(t, l.SetLimits(10, 1))
+	now = now.Add(100 * time.Millisecond)
+	_, ok = l.allow("ip:10.0.0.1")
+	assert.True(t, ok)
+
+	assert.Error(t, l.SetLimits(0, 1))
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	_, err := NewRateLimiter(0, 1)
+	assert.Error(t, err)
+	_, err = NewRateLimiter(1, 0)
+	assert.Error(t, err)
+}
+
+func TestBodySizeLimiter_Limit(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		contentType   string
+		wantCode      int
+		wantBody      string
+	}{
+		{
+			name:          "within limit, success",
+			body:          "0123456789",
+			contentLength: 10,
+			wantCode:      http.StatusOK,
+			wantBody:      "0123456789",
+		},
+		{
+			name:          "content length too large, failure",
+			body:          "0123456789a",
+			contentLength: 11,
+			wantCode:      http.StatusRequestEntityTooLarge,
+			wantBody:      "\"request body too large\"\n",
+		},
+		{
+			name:          "unknown content length, too large, yaml, failure",
+			body:          strings.Repeat("a", 100),
+			contentLength: -1,
+			contentType:   "application/x-yaml",
+			wantCode:      http.StatusRequestEntityTooLarge,
+			wantBody:      "request body too large\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			l := NewBodySizeLimiter(100)
+			l.SetMaxBytes(10)
+			r.Use(l.Limit)
+			r.POST("/", func(c *gin.Context) {
+				body, err := ioutil.ReadAll(c.Request.Body)
+				require.NoError(t, err)
+				c.String(http.StatusOK, string(body))
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			req.Header.Set("Content-Type", tt.contentType)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+	require.NoError(t, err)
+	got := []string{}
+	for _, proxy := range proxies {
+		got = append(got, proxy.String())
+	}
+	assert.Equal(t, []string{"10.0.0.1/32", "192.168.0.0/16", "::1/128"}, got)
+
+	_, err = ParseProxies([]string{"proxy.local"})
+	assert.EqualError(t, err, `invalid proxy "proxy.local"`)
+	_, err = ParseProxies([]string{"10.0.0.0/33"})
+	assert.EqualError(t, err, `invalid proxy "10.0.0.0/33"`)
+}
+
+func TestRateLimiter_UnaryServerInterceptor(t *testing.T) {
+	l, err := NewRateLimiter(0.5, 2)
+	require.NoError(t, err)
+	l.now = func() time.Time {
+		return time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC)
+	}
+	interceptor := l.UnaryServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "OK", nil
+	}
+	call := func(ip string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234},
+		})
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		return err
+	}
+
+	assert.NoError(t, call("10.0.0.1"))
+	assert.NoError(t, call("10.0.0.1"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("10.0.0.1")))
+	assert.NoError(t, call("10.0.0.2"))
+
+	// authenticated callers are limited by name, wherever they call from
+	tokens, err := auth.NewTokens([]auth.Caller{{Name: "ci", Token: "token1"}})
+	require.NoError(t, err)
+	authenticate := tokens.UnaryServerInterceptor()
+	callAuthenticated := func(ip string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234},
+		})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer token1"))
+		_, err := authenticate(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{}, handler)
+		})
+		return err
+	}
+	assert.NoError(t, callAuthenticated("10.0.0.3"))
+	assert.NoError(t, callAuthenticated("10.0.0.4"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(callAuthenticated("10.0.0.5")))
+}
@@ -0,0 +1,166 @@
+package matrix
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+const (
+	// FormatJSON renders the matrix like any other response
+	FormatJSON Format = "json"
+	// FormatCSV is plain comma separated values
+	FormatCSV Format = "csv"
+	// FormatExcelCSV is comma separated values that spreadsheet applications
+	// such as excel open correctly, with a byte order mark, crlf line endings
+	// and cells that could be mistaken for formulas escaped
+	FormatExcelCSV Format = "excel-csv"
+	// FormatHTML is a standalone html page
+	FormatHTML Format = "html"
+)
+
+const (
+	// utf8BOM tells spreadsheet applications the file is utf-8
+	utf8BOM = "\xef\xbb\xbf"
+	// denied is the text of cells whose permission is not granted
+	denied = "denied"
+)
+
+type (
+	// Format the matrix can be written in
+	Format string
+)
+
+var (
+	// htmlTemplate renders the matrix as a table, granted cells show the
+	// bindings that grant them on hover
+	htmlTemplate = template.Must(template.New("matrix").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>RBAC permission matrix{{ if .Namespace }} for {{ .Namespace }}{{ end }}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 6px; }
+thead th { position: sticky; top: 0; background: #fff; writing-mode: vertical-rl; transform: rotate(180deg); }
+tbody th { text-align: left; white-space: nowrap; }
+td.granted { background: #f8d7da; text-align: center; }
+td.denied { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>RBAC permission matrix{{ if .Namespace }} for {{ .Namespace }}{{ else }} for the cluster{{ end }}</h1>
+<table>
+<thead>
+<tr><th>subject</th>{{ range .Columns }}<th>{{ . }}</th>{{ end }}</tr>
+</thead>
+<tbody>
+{{- range .Rows }}
+<tr><th>{{ .Subject }}</th>{{ range .Cells }}{{ if .Granted }}<td class="granted" title="{{ range $i, $b := .Bindings }}{{ if $i }}, {{ end }}{{ $b }}{{ end }}">&#10003;</td>{{ else }}<td class="denied"></td>{{ end }}{{ end }}</tr>
+{{- end }}
+</tbody>
+</table>
+</body>
+</html>
+`))
+)
+
+// ParseFormat validates a format, empty defaults to json
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCSV, FormatExcelCSV, FormatHTML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid matrix format %q", s)
+	}
+}
+
+// ContentType returns the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV, FormatExcelCSV:
+		return "text/csv; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+// Write writes the matrix in one of the csv or html formats
+func (m Matrix) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatCSV:
+		return m.WriteCSV(w, false)
+	case FormatExcelCSV:
+		return m.WriteCSV(w, true)
+	case FormatHTML:
+		return m.WriteHTML(w)
+	}
+	return fmt.Errorf("invalid matrix format %q", format)
+}
+
+// WriteCSV writes a header row of permissions and a row for every subject,
+// cells are either "denied" or "granted by" followed by the bindings that
+// grant the permission
+func (m Matrix) WriteCSV(w io.Writer, excel bool) error {
+	b := bufio.NewWriter(w)
+	if excel {
+		b.WriteString(utf8BOM)
+	}
+	writer := csv.NewWriter(b)
+	writer.UseCRLF = excel
+
+	// escape returns the cell as is, or for excel prevents it from being
+	// interpreted as a formula
+	escape := func(cell string) string {
+		if excel && cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			return "'" + cell
+		}
+		return cell
+	}
+
+	header := make([]string, 0, len(m.Columns)+1)
+	header = append(header, "subject")
+	for _, column := range m.Columns {
+		header = append(header, escape(column.String()))
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range m.Rows {
+		record := make([]string, 0, len(row.Cells)+1)
+		record = append(record, escape(row.Subject.String()))
+		for _, cell := range row.Cells {
+			if !cell.Granted {
+				record = append(record, denied)
+				continue
+			}
+			bindings := make([]string, len(cell.Bindings))
+			for i, binding := range cell.Bindings {
+				bindings[i] = binding.String()
+			}
+			record = append(record, escape("granted by "+strings.Join(bindings, ", ")))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return b.Flush()
+}
+
+// WriteHTML writes the matrix as a standalone html page
+func (m Matrix) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, m)
+}
@@ -0,0 +1,140 @@
+package matrix
+
+import (
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+type (
+	// Matrix of subjects against the permissions any of them are granted
+	Matrix struct {
+		// Namespace the matrix is for, the whole cluster if empty
+		Namespace string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		Columns   []rbac.Permission `json:"columns" yaml:"columns"`
+		Rows      []Row             `json:"rows" yaml:"rows"`
+	}
+	// Row of a subject, with a cell for each column
+	Row struct {
+		Subject rbac.SubjectKey `json:"subject" yaml:"subject"`
+		Cells   []Cell          `json:"cells" yaml:"cells"`
+	}
+	// Cell says if the subject is granted the column's permission, and by
+	// which bindings
+	Cell struct {
+		Granted  bool       `json:"granted" yaml:"granted"`
+		Bindings []rbac.Key `json:"bindings,omitempty" yaml:"bindings,omitempty"`
+	}
+	// grant is a binding's rules and the namespace they apply to, empty for
+	// cluster-wide
+	grant struct {
+		binding   rbac.Key
+		namespace string
+		rules     []v1.PolicyRule
+	}
+)
+
+// New builds the matrix of the state's bindings in the namespace, cluster
+// role bindings included, or the whole cluster if empty.
+// Permissions are matched the same way the kubernetes authorizer matches
+// them, so wildcard rules grant every column they cover.
+func New(state rbac.State, namespace string) Matrix {
+	roles := state.RoleRules()
+
+	grants := map[rbac.SubjectKey][]grant{}
+	columns := map[rbac.Permission]bool{}
+	for _, binding := range state.FilterBindings(namespace) {
+		rules := roles[binding.RoleKey()]
+		g := grant{
+			binding:   binding.Key(),
+			namespace: binding.Namespace,
+			rules:     rules,
+		}
+		// within a namespace cluster role bindings grant the same as role
+		// bindings
+		if namespace != "" {
+			g.namespace = namespace
+		}
+		for _, permission := range rbac.Permissions(g.namespace, rules) {
+			columns[permission] = true
+		}
+		for _, subject := range binding.Subjects {
+			key := rbac.NewSubjectKey(subject)
+			grants[key] = append(grants[key], g)
+		}
+	}
+
+	matrix := Matrix{
+		Namespace: namespace,
+		Columns:   make([]rbac.Permission, 0, len(columns)),
+		Rows:      make([]Row, 0, len(grants)),
+	}
+	for permission := range columns {
+		matrix.Columns = append(matrix.Columns, permission)
+	}
+	rbac.SortPermissions(matrix.Columns)
+
+	for subject, subjectGrants := range grants {
+		row := Row{
+			Subject: subject,
+			Cells:   make([]Cell, len(matrix.Columns)),
+		}
+		for i, column := range matrix.Columns {
+			attributes := attributes(column)
+			for _, g := range subjectGrants {
+				// cluster-wide grants apply to all namespaces, and non-resource
+				// urls are never namespaced
+				if g.namespace != "" && g.namespace != column.Namespace && column.NonResourceURL == "" {
+					continue
+				}
+				if !rbac.RulesAllow(g.rules, attributes) {
+					continue
+				}
+				row.Cells[i].Granted = true
+				if !containsKey(row.Cells[i].Bindings, g.binding) {
+					row.Cells[i].Bindings = append(row.Cells[i].Bindings, g.binding)
+				}
+			}
+		}
+		matrix.Rows = append(matrix.Rows, row)
+	}
+	sort.Slice(matrix.Rows, func(i, j int) bool {
+		return matrix.Rows[i].Subject.String() < matrix.Rows[j].Subject.String()
+	})
+
+	return matrix
+}
+
+// attributes returns the request the permission describes
+func attributes(permission rbac.Permission) rbac.Attributes {
+	if permission.NonResourceURL != "" {
+		return rbac.Attributes{
+			Verb:           permission.Verb,
+			NonResourceURL: permission.NonResourceURL,
+		}
+	}
+	resource, subresource := permission.Resource, ""
+	if i := strings.Index(resource, "/"); i >= 0 {
+		resource, subresource = resource[:i], resource[i+1:]
+	}
+	return rbac.Attributes{
+		Verb:        permission.Verb,
+		APIGroup:    permission.APIGroup,
+		Resource:    resource,
+		Subresource: subresource,
+		Name:        permission.ResourceName,
+	}
+}
+
+// containsKey checks if the key is in the slice
+func containsKey(keys []rbac.Key, key rbac.Key) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package matrix
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+var (
+	state = rbac.State{
+		Roles: []v1.Role{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "default"},
+				Rules: []v1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"list"},
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role2", Namespace: "default"},
+				Rules: []v1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"get"},
+				}},
+			},
+		},
+		ClusterRoles: []v1.ClusterRole{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "clusterrole1"},
+				Rules: []v1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"*"},
+				}},
+			},
+		},
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+		},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{
+			fixtures.ClusterRoleBindingClusterRole1Subject1,
+		},
+	}
+
+	subject1 = rbac.SubjectKey{Kind: "User", Name: "subject1"}
+	subject2 = rbac.SubjectKey{Kind: "User", Name: "subject2"}
+
+	clusterRoleBinding1 = rbac.Key{Kind: rbac.KindClusterRoleBinding, Name: "clusterrole1-for-subject1"}
+	roleBinding1        = rbac.Key{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-subject1"}
+	roleBinding2        = rbac.Key{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role2-for-subject2"}
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		want      Matrix
+	}{
+		{
+			name:      "namespace",
+			namespace: "default",
+			want: Matrix{
+				Namespace: "default",
+				Columns: []rbac.Permission{
+					{Namespace: "default", Verb: "*", Resource: "pods"},
+					{Namespace: "default", Verb: "get", Resource: "pods"},
+					{Namespace: "default", Verb: "list", Resource: "pods"},
+				},
+				Rows: []Row{
+					{
+						Subject: subject1,
+						Cells: []Cell{
+							{Granted: true, Bindings: []rbac.Key{clusterRoleBinding1}},
+							{Granted: true, Bindings: []rbac.Key{clusterRoleBinding1}},
+							{Granted: true, Bindings: []rbac.Key{clusterRoleBinding1, roleBinding1}},
+						},
+					},
+					{
+						Subject: subject2,
+						Cells: []Cell{
+							{},
+							{Granted: true, Bindings: []rbac.Key{roleBinding2}},
+							{},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "cluster",
+			want: Matrix{
+				Columns: []rbac.Permission{
+					{Verb: "*", Resource: "pods"},
+					{Namespace: "default", Verb: "get", Resource: "pods"},
+					{Namespace: "default", Verb: "list", Resource: "pods"},
+				},
+				Rows: []Row{
+					{
+						Subject: subject1,
+						Cells: []Cell{
+							{Granted: true, Bindings: []rbac.Key{clusterRoleBinding1}},
+							{Granted: true, Bindings: []rbac.Key{clusterRoleBinding1}},
+							{Granted: true, Bindings: []rbac.Key{clusterRoleBinding1, roleBinding1}},
+						},
+					},
+					{
+						Subject: subject2,
+						Cells: []Cell{
+							{},
+							{Granted: true, Bindings: []rbac.Key{roleBinding2}},
+							{},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(state, tt.namespace)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestMatrix_Write(t *testing.T) {
+	m := Matrix{
+		Columns: []rbac.Permission{
+			{Verb: "get", Resource: "pods", Namespace: "default"},
+		},
+		Rows: []Row{
+			{
+				Subject: rbac.SubjectKey{Kind: "User", Name: "subject1"},
+				Cells:   []Cell{{Granted: true, Bindings: []rbac.Key{roleBinding1}}},
+			},
+			{
+				Subject: rbac.SubjectKey{Kind: "User", Name: "=cmd"},
+				Cells:   []Cell{{}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		format Format
+		want   string
+	}{
+		{
+			name:   "csv",
+			format: FormatCSV,
+			want: "subject,get pods in default\n" +
+				"User/subject1,granted by RoleBinding/default/role1-for-subject1\n" +
+				"User/=cmd,denied\n",
+		},
+		{
+			name:   "excel csv",
+			format: FormatExcelCSV,
+			want: "\xef\xbb\xbfsubject,get pods in default\r\n" +
+				"User/subject1,granted by RoleBinding/default/role1-for-subject1\r\n" +
+				"User/=cmd,denied\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			err := m.Write(b, tt.format)
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+
+	t.Run("excel csv escapes formulas", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		err := Matrix{
+			Columns: []rbac.Permission{},
+			Rows:    []Row{{Subject: rbac.SubjectKey{Kind: "=HYPERLINK()"}}},
+		}.Write(b, FormatExcelCSV)
+		require.NoError(t, err, "did not expect error")
+		assert.True(t, strings.HasSuffix(b.String(), "'=HYPERLINK()/\r\n"), b.String())
+	})
+
+	t.Run("html", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		err := m.Write(b, FormatHTML)
+		require.NoError(t, err, "did not expect error")
+		assert.Contains(t, b.String(), "<th>get pods in default</th>")
+		assert.Contains(t, b.String(), `<td class="granted" title="RoleBinding/default/role1-for-subject1">`)
+		assert.Contains(t, b.String(), `<tr><th>User/=cmd</th><td class="denied"></td></tr>`)
+	})
+}
@@ -0,0 +1,158 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// SeverityLow for changes that are worth knowing about
+	SeverityLow Severity = "low"
+	// SeverityMedium for changes that should be reviewed
+	SeverityMedium Severity = "medium"
+	// SeverityHigh for changes that should be reviewed immediately
+	SeverityHigh Severity = "high"
+	// SeverityCritical for changes that should never happen
+	SeverityCritical Severity = "critical"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultTimeout        = 10 * time.Second
+)
+
+type (
+	// Severity of a rule's notifications
+	Severity string
+	// Config of the notifier, usually loaded from a yaml file
+	Config struct {
+		Webhooks []Webhook `yaml:"webhooks"`
+		Rules    []Rule    `yaml:"rules"`
+	}
+	// Webhook that notifications are POSTed to
+	Webhook struct {
+		Name string `yaml:"name"`
+		URL  string `yaml:"url"`
+		// Secret used to sign payloads, if empty payloads are not signed
+		Secret string `yaml:"secret"`
+		// MaxAttempts before a notification is dead-lettered
+		MaxAttempts int `yaml:"maxAttempts"`
+		// InitialBackoff between attempts, doubles after every attempt
+		InitialBackoff time.Duration `yaml:"initialBackoff"`
+		// MaxBackoff between attempts
+		MaxBackoff time.Duration `yaml:"maxBackoff"`
+		// Timeout of each attempt
+		Timeout time.Duration `yaml:"timeout"`
+	}
+	// Rule describes which binding changes should be notified about
+	Rule struct {
+		Name string `yaml:"name"`
+		// Namespace whose role bindings are watched, all namespaces if empty,
+		// cluster role bindings are always watched
+		Namespace string `yaml:"namespace"`
+		// SubjectNames are either exact names or regular expressions, same
+		// as the enumeration api
+		SubjectNames []string `yaml:"subjectNames"`
+		// Subjects are matched as their match type says, in addition to
+		// subject names
+		Subjects []rbac.Pattern `yaml:"subjects"`
+		Severity Severity       `yaml:"severity"`
+		// Webhooks to notify, all webhooks if empty
+		Webhooks []string `yaml:"webhooks"`
+	}
+)
+
+// LoadConfig reads and validates the notifier's yaml config file
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(b, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return config, nil
+}
+
+// Validate checks the config for errors and sets defaults where needed
+func (config *Config) Validate() error {
+	webhooks := map[string]bool{}
+	for i := range config.Webhooks {
+		webhook := &config.Webhooks[i]
+		if webhook.Name == "" {
+			return errors.New("webhook is missing a name")
+		}
+		if webhooks[webhook.Name] {
+			return fmt.Errorf("duplicate webhook %s", webhook.Name)
+		}
+		if webhook.URL == "" {
+			return fmt.Errorf("webhook %s is missing a url", webhook.Name)
+		}
+		if webhook.MaxAttempts == 0 {
+			webhook.MaxAttempts = defaultMaxAttempts
+		}
+		if webhook.InitialBackoff == 0 {
+			webhook.InitialBackoff = defaultInitialBackoff
+		}
+		if webhook.MaxBackoff == 0 {
+			webhook.MaxBackoff = defaultMaxBackoff
+		}
+		if webhook.Timeout == 0 {
+			webhook.Timeout = defaultTimeout
+		}
+		webhooks[webhook.Name] = true
+	}
+
+	for _, rule := range config.Rules {
+		if rule.Name == "" {
+			return errors.New("rule is missing a name")
+		}
+		switch rule.Severity {
+		case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+		default:
+			return fmt.Errorf("rule %s has invalid severity %q", rule.Name, rule.Severity)
+		}
+		if len(rule.SubjectNames) == 0 && len(rule.Subjects) == 0 {
+			return fmt.Errorf("rule %s is missing subject names", rule.Name)
+		}
+		if _, err := rule.filters(); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		for _, webhook := range rule.Webhooks {
+			if !webhooks[webhook] {
+				return fmt.Errorf("rule %s references unknown webhook %s", rule.Name, webhook)
+			}
+		}
+	}
+
+	return nil
+}
+
+// filters constructs the rbac filters for the rule's subject names and
+// patterns
+func (rule Rule) filters() ([]rbac.RoleBindingFilter, error) {
+	filters, err := rbac.FiltersBySubjectNames(rule.SubjectNames)
+	if err != nil {
+		return nil, err
+	}
+	patternFilters, err := rbac.FiltersBySubjectPatterns(rule.Subjects)
+	if err != nil {
+		return nil, err
+	}
+	return append(filters, patternFilters...), nil
+}
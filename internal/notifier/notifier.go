@@ -0,0 +1,278 @@
+package notifier
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// queueSize is the number of notifications each webhook can have pending
+	// before watches start blocking
+	queueSize = 100
+	// rewatchInterval is how long to wait before restarting a failed watch
+	rewatchInterval = 5 * time.Second
+)
+
+type (
+	// Notifier watches bindings and notifies webhooks about changes that
+	// match its rules
+	Notifier struct {
+		rbac             rbac.Enumerator
+		config           Config
+		client           *http.Client
+		deadLetters      io.Writer
+		deadLettersMutex sync.Mutex
+		logger           *zap.Logger
+		now              func() time.Time
+		rewatchInterval  time.Duration
+	}
+	// Notification is the json payload POSTed to webhooks
+	Notification struct {
+		ID        string     `json:"id"`
+		Rule      string     `json:"rule"`
+		Severity  Severity   `json:"severity"`
+		Timestamp time.Time  `json:"timestamp"`
+		Event     rbac.Event `json:"event"`
+	}
+	// DeadLetter is written as a json line for every notification that could
+	// not be delivered
+	DeadLetter struct {
+		Webhook      string       `json:"webhook"`
+		Attempts     int          `json:"attempts"`
+		Error        string       `json:"error"`
+		Timestamp    time.Time    `json:"timestamp"`
+		Notification Notification `json:"notification"`
+	}
+)
+
+// New Notifier given an rbac enumerator and a valid config, notifications
+// that cannot be delivered are written to the dead letters writer
+func New(rbac rbac.Enumerator, config Config, deadLetters io.Writer, logger *zap.Logger) (*Notifier, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &Notifier{
+		rbac:            rbac,
+		config:          config,
+		client:          &http.Client{},
+		deadLetters:     deadLetters,
+		logger:          logger,
+		now:             time.Now,
+		rewatchInterval: rewatchInterval,
+	}, nil
+}
+
+// Run watches bindings for every rule and delivers notifications until the
+// context is done, pending notifications are dropped on exit
+func (n *Notifier) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+
+	// start a worker for each webhook so slow webhooks don't hold back others
+	queues := map[string]chan Notification{}
+	for _, webhook := range n.config.Webhooks {
+		queue := make(chan Notification, queueSize)
+		queues[webhook.Name] = queue
+		wg.Add(1)
+		go func(webhook Webhook) {
+			defer wg.Done()
+			n.work(ctx, webhook, queue)
+		}(webhook)
+	}
+
+	// start watching for each rule
+	for _, rule := range n.config.Rules {
+		ruleQueues := []chan Notification{}
+		for _, webhook := range n.config.Webhooks {
+			if len(rule.Webhooks) == 0 || contains(rule.Webhooks, webhook.Name) {
+				ruleQueues = append(ruleQueues, queues[webhook.Name])
+			}
+		}
+		wg.Add(1)
+		go func(rule Rule) {
+			defer wg.Done()
+			n.watch(ctx, rule, ruleQueues)
+		}(rule)
+	}
+
+	wg.Wait()
+}
+
+// watch the rule's bindings and queue notifications for their changes,
+// restarting the watch if it fails
+func (n *Notifier) watch(ctx context.Context, rule Rule, queues []chan Notification) {
+	logger := n.logger.With(zap.String("rule", rule.Name))
+
+	// subject names and patterns have already been validated
+	filters, _ := rule.filters()
+
+	resourceVersions := rbac.ResourceVersions{}
+	for {
+		// only changes after we start watching are of interest, so if we
+		// don't know where to resume from we start from the latest versions
+		if resourceVersions == (rbac.ResourceVersions{}) {
+			latest, err := n.rbac.LatestResourceVersions(rule.Namespace)
+			if err != nil {
+				logger.Error("error getting latest resource versions", zap.Error(err))
+				if !n.sleep(ctx) {
+					return
+				}
+				continue
+			}
+			resourceVersions = latest
+		}
+
+		events, err := n.rbac.WatchRoleBindings(ctx, rule.Namespace, resourceVersions, filters...)
+		if err != nil {
+			logger.Error("error watching bindings", zap.Error(err))
+			if !n.sleep(ctx) {
+				return
+			}
+			continue
+		}
+
+		resourceVersions = n.notify(ctx, logger, rule, events, queues, resourceVersions)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if !n.sleep(ctx) {
+			return
+		}
+	}
+}
+
+// notify queues notifications for the watch's events until it ends, returns
+// the resource versions to resume from
+func (n *Notifier) notify(
+	ctx context.Context,
+	logger *zap.Logger,
+	rule Rule,
+	events <-chan rbac.Event,
+	queues []chan Notification,
+	resourceVersions rbac.ResourceVersions,
+) rbac.ResourceVersions {
+	for {
+		var (
+			event rbac.Event
+			ok    bool
+		)
+		select {
+		case <-ctx.Done():
+			return resourceVersions
+		case event, ok = <-events:
+			if !ok {
+				return resourceVersions
+			}
+		}
+
+		if event.Type == watch.Error {
+			// most likely our resource versions are too old, changes
+			// between them and the latest versions will be missed
+			logger.Warn("watch failed, restarting from latest resource versions", zap.String("error", event.Error))
+			return rbac.ResourceVersions{}
+		}
+
+		resourceVersions = event.ResourceVersions
+		notification := Notification{
+			ID:        newID(),
+			Rule:      rule.Name,
+			Severity:  rule.Severity,
+			Timestamp: n.now(),
+			Event:     event,
+		}
+		for _, queue := range queues {
+			select {
+			case queue <- notification:
+			case <-ctx.Done():
+				return resourceVersions
+			}
+		}
+	}
+}
+
+// work delivers the queued notifications to the webhook
+func (n *Notifier) work(ctx context.Context, webhook Webhook, queue <-chan Notification) {
+	logger := n.logger.With(zap.String("webhook", webhook.Name))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-queue:
+			payload, err := json.Marshal(notification)
+			if err != nil {
+				logger.Error("error marshaling notification", zap.Error(err))
+				continue
+			}
+			attempts, err := n.deliver(ctx, webhook, notification.ID, payload)
+			if err != nil && ctx.Err() != nil {
+				// we are shutting down, same as any other pending notification
+				logger.Warn("dropping notification", zap.String("notification", notification.ID))
+				return
+			}
+			if err != nil {
+				logger.Error(
+					"error delivering notification",
+					zap.String("notification", notification.ID),
+					zap.Int("attempts", attempts),
+					zap.Error(err),
+				)
+				n.deadLetter(webhook, attempts, err, notification)
+			}
+		}
+	}
+}
+
+// deadLetter writes an undeliverable notification to the dead letters
+func (n *Notifier) deadLetter(webhook Webhook, attempts int, err error, notification Notification) {
+	n.deadLettersMutex.Lock()
+	defer n.deadLettersMutex.Unlock()
+	deadLetter := DeadLetter{
+		Webhook:      webhook.Name,
+		Attempts:     attempts,
+		Error:        err.Error(),
+		Timestamp:    n.now(),
+		Notification: notification,
+	}
+	if err := json.NewEncoder(n.deadLetters).Encode(deadLetter); err != nil {
+		n.logger.Error("error writing dead letter", zap.Error(err))
+	}
+}
+
+// sleep waits before retrying a watch, returns false if the context is done
+func (n *Notifier) sleep(ctx context.Context) bool {
+	select {
+	case <-time.After(n.rewatchInterval):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// newID returns a random notification id
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contains checks if the string is in the slice
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,320 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	rbacmocks "github.com/geoah/go-kube-api/internal/rbac/mocks"
+)
+
+const (
+	nsDefault = "default"
+	secret    = "shh"
+)
+
+// receiver records the notifications it receives, responding with the given
+// status codes in order and the last one after that
+type receiver struct {
+	mutex         sync.Mutex
+	statusCodes   []int
+	attempts      int
+	notifications []Notification
+	signatures    []bool
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	payload, _ := ioutil.ReadAll(req.Body)
+	timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	r.signatures = append(r.signatures, req.Header.Get(HeaderSignature) == Sign(secret, timestamp, payload))
+
+	statusCode := r.statusCodes[len(r.statusCodes)-1]
+	if r.attempts < len(r.statusCodes) {
+		statusCode = r.statusCodes[r.attempts]
+	}
+	r.attempts++
+
+	if statusCode == http.StatusOK {
+		notification := Notification{}
+		json.Unmarshal(payload, &notification)
+		r.notifications = append(r.notifications, notification)
+	}
+
+	w.WriteHeader(statusCode)
+}
+
+func (r *receiver) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.attempts
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func TestNotifier_Run(t *testing.T) {
+	event := rbac.Event{
+		Type:        watch.Added,
+		Kind:        rbac.KindRoleBinding,
+		RoleBinding: &fixtures.RoleBindingRole1Subject1,
+		ResourceVersions: rbac.ResourceVersions{
+			RoleBindings:        "2",
+			ClusterRoleBindings: "1",
+		},
+	}
+	tests := []struct {
+		name            string
+		statusCodes     []int
+		maxAttempts     int
+		wantAttempts    int
+		wantDelivered   bool
+		wantDeadLetters bool
+	}{
+		{
+			name:          "delivered first time, success",
+			statusCodes:   []int{http.StatusOK},
+			maxAttempts:   3,
+			wantAttempts:  1,
+			wantDelivered: true,
+		},
+		{
+			name:          "delivered after retries, success",
+			statusCodes:   []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK},
+			maxAttempts:   3,
+			wantAttempts:  3,
+			wantDelivered: true,
+		},
+		{
+			name:            "out of attempts, dead-lettered",
+			statusCodes:     []int{http.StatusServiceUnavailable},
+			maxAttempts:     3,
+			wantAttempts:    3,
+			wantDeadLetters: true,
+		},
+		{
+			name:            "client error, dead-lettered without retrying",
+			statusCodes:     []int{http.StatusBadRequest},
+			maxAttempts:     3,
+			wantAttempts:    1,
+			wantDeadLetters: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recv := &receiver{
+				statusCodes: tt.statusCodes,
+			}
+			srv := httptest.NewServer(recv)
+			defer srv.Close()
+
+			events := make(chan rbac.Event, 1)
+			events <- event
+
+			ctrl := gomock.NewController(t)
+			mockEnumerator := rbacmocks.NewMockEnumerator(ctrl)
+			mockEnumerator.EXPECT().LatestResourceVersions(
+				nsDefault,
+			).Return(rbac.ResourceVersions{
+				RoleBindings:        "1",
+				ClusterRoleBindings: "1",
+			}, nil)
+			mockEnumerator.EXPECT().WatchRoleBindings(
+				gomock.Any(),
+				nsDefault,
+				rbac.ResourceVersions{
+					RoleBindings:        "1",
+					ClusterRoleBindings: "1",
+				},
+				gomock.Any(),
+			).Return((<-chan rbac.Event)(events), nil)
+
+			deadLetters := &syncBuffer{}
+			n, err := New(mockEnumerator, Config{
+				Webhooks: []Webhook{
+					{
+						Name:           "receiver",
+						URL:            srv.URL,
+						Secret:         secret,
+						MaxAttempts:    tt.maxAttempts,
+						InitialBackoff: time.Millisecond,
+					},
+				},
+				Rules: []Rule{
+					{
+						Name:         "subject1",
+						Namespace:    nsDefault,
+						SubjectNames: []string{"subject1"},
+						Severity:     SeverityHigh,
+					},
+				},
+			}, deadLetters, zap.NewNop())
+			require.NoError(t, err, "failed to create notifier")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				n.Run(ctx)
+				close(done)
+			}()
+
+			require.Eventually(t, func() bool {
+				if tt.wantDeadLetters {
+					return deadLetters.String() != ""
+				}
+				return recv.count() == tt.wantAttempts
+			}, time.Second, time.Millisecond, "timed out waiting for delivery")
+
+			cancel()
+			<-done
+
+			assert.Equal(t, tt.wantAttempts, recv.attempts)
+			for _, signed := range recv.signatures {
+				assert.True(t, signed, "invalid signature")
+			}
+			if tt.wantDelivered {
+				require.Len(t, recv.notifications, 1)
+				assert.Equal(t, "subject1", recv.notifications[0].Rule)
+				assert.Equal(t, SeverityHigh, recv.notifications[0].Severity)
+				assert.Equal(t, event, recv.notifications[0].Event)
+			}
+			if tt.wantDeadLetters {
+				deadLetter := DeadLetter{}
+				err := json.Unmarshal([]byte(deadLetters.String()), &deadLetter)
+				require.NoError(t, err, "could not unmarshal dead letter")
+				assert.Equal(t, "receiver", deadLetter.Webhook)
+				assert.Equal(t, tt.wantAttempts, deadLetter.Attempts)
+				assert.Equal(t, event, deadLetter.Notification.Event)
+			} else {
+				assert.Empty(t, deadLetters.String())
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name: "valid with defaults, success",
+			config: Config{
+				Webhooks: []Webhook{
+					{
+						Name: "receiver",
+						URL:  "http://localhost",
+					},
+				},
+				Rules: []Rule{
+					{
+						Name:         "rule",
+						SubjectNames: []string{"subject[3,4]"},
+						Severity:     SeverityLow,
+						Webhooks:     []string{"receiver"},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid severity, failure",
+			config: Config{
+				Rules: []Rule{
+					{
+						Name:         "rule",
+						SubjectNames: []string{"subject1"},
+						Severity:     "whatever",
+					},
+				},
+			},
+			wantErr: "invalid severity",
+		},
+		{
+			name: "invalid subject name, failure",
+			config: Config{
+				Rules: []Rule{
+					{
+						Name:         "rule",
+						SubjectNames: []string{"[["},
+						Severity:     SeverityLow,
+					},
+				},
+			},
+			wantErr: "invalid regular expression",
+		},
+		{
+			name: "unknown webhook, failure",
+			config: Config{
+				Rules: []Rule{
+					{
+						Name:         "rule",
+						SubjectNames: []string{"subject1"},
+						Severity:     SeverityLow,
+						Webhooks:     []string{"receiver"},
+					},
+				},
+			},
+			wantErr: "unknown webhook",
+		},
+		{
+			name: "missing url, failure",
+			config: Config{
+				Webhooks: []Webhook{
+					{
+						Name: "receiver",
+					},
+				},
+			},
+			wantErr: "missing a url",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr != "" {
+				require.Error(t, err, "expected error but got none")
+				assert.True(t, strings.Contains(err.Error(), tt.wantErr), "unexpected error %v", err)
+				return
+			}
+			require.NoError(t, err, "did not expect error")
+			for _, webhook := range tt.config.Webhooks {
+				assert.Equal(t, defaultMaxAttempts, webhook.MaxAttempts)
+				assert.Equal(t, defaultTimeout, webhook.Timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderID holds the notification's unique id, retries share the same id
+	HeaderID = "X-Notification-Id"
+	// HeaderTimestamp holds the unix timestamp the payload was signed at
+	HeaderTimestamp = "X-Notification-Timestamp"
+	// HeaderSignature holds the hex encoded HMAC-SHA256 of the timestamp, a
+	// dot, and the payload, prefixed with "sha256="
+	HeaderSignature = "X-Notification-Signature"
+)
+
+// Sign computes the signature header value of a payload signed at the given
+// unix timestamp, receivers should compute the same and compare
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver POSTs the payload to the webhook, retrying with exponential backoff
+// until it succeeds, fails permanently, or runs out of attempts.
+// Returns the number of attempts made and the last error, if any.
+func (n *Notifier) deliver(ctx context.Context, webhook Webhook, id string, payload []byte) (int, error) {
+	backoff := webhook.InitialBackoff
+	attempt := 0
+	for {
+		attempt++
+		retry, err := n.post(ctx, webhook, id, payload)
+		if err == nil {
+			return attempt, nil
+		}
+		if !retry || attempt >= webhook.MaxAttempts {
+			return attempt, err
+		}
+
+		n.logger.Sugar().Debugw(
+			"retrying webhook delivery",
+			"webhook", webhook.Name,
+			"notification", id,
+			"attempt", attempt,
+			"backoff", backoff,
+			"error", err,
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempt, fmt.Errorf("gave up retrying: %w", ctx.Err())
+		}
+
+		backoff *= 2
+		if backoff > webhook.MaxBackoff {
+			backoff = webhook.MaxBackoff
+		}
+	}
+}
+
+// post makes a single delivery attempt, returns whether failures are worth
+// retrying
+func (n *Notifier) post(ctx context.Context, webhook Webhook, id string, payload []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("failed to construct request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := n.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if webhook.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, payload))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer res.Body.Close()
+	// drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, res.Body)
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests,
+		res.StatusCode == http.StatusRequestTimeout,
+		res.StatusCode >= 500:
+		return true, fmt.Errorf("webhook responded with %s", res.Status)
+	default:
+		return false, fmt.Errorf("webhook responded with %s", res.Status)
+	}
+}
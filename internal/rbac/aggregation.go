@@ -0,0 +1,96 @@
+package rbac
+
+import (
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// clusterRoleRules returns the rules of every cluster role, including the
+// rules aggregated into cluster roles with an aggregation rule.
+// Live clusters already have the aggregated rules filled in by the
+// controller, manifests and old snapshots may not, so they are evaluated
+// here the same way the controller does, including aggregates of aggregates.
+func (s State) clusterRoleRules() map[string][]v1.PolicyRule {
+	clusterRoles := make(map[string]v1.ClusterRole, len(s.ClusterRoles))
+	for _, clusterRole := range s.ClusterRoles {
+		clusterRoles[clusterRole.Name] = clusterRole
+	}
+
+	resolved := make(map[string][]v1.PolicyRule, len(s.ClusterRoles))
+	resolving := map[string]bool{}
+
+	var resolve func(name string) []v1.PolicyRule
+	resolve = func(name string) []v1.PolicyRule {
+		if rules, ok := resolved[name]; ok {
+			return rules
+		}
+		clusterRole := clusterRoles[name]
+		if clusterRole.AggregationRule == nil || resolving[name] {
+			// aggregation cycles can only use the rules we already know of
+			return clusterRole.Rules
+		}
+		resolving[name] = true
+		defer delete(resolving, name)
+
+		rules := newRuleSet(clusterRole.Rules)
+		for _, other := range s.ClusterRoles {
+			if other.Name == name || !aggregates(*clusterRole.AggregationRule, other) {
+				continue
+			}
+			rules.add(resolve(other.Name))
+		}
+		resolved[name] = rules.rules
+		return rules.rules
+	}
+
+	for _, clusterRole := range s.ClusterRoles {
+		resolved[clusterRole.Name] = resolve(clusterRole.Name)
+	}
+	return resolved
+}
+
+// aggregates checks if the aggregation rule selects the cluster role, invalid
+// selectors select nothing
+func aggregates(aggregationRule v1.AggregationRule, clusterRole v1.ClusterRole) bool {
+	for _, labelSelector := range aggregationRule.ClusterRoleSelectors {
+		selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(clusterRole.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+type (
+	// ruleSet is a list of policy rules without duplicates
+	ruleSet struct {
+		rules []v1.PolicyRule
+		seen  map[string]bool
+	}
+)
+
+// newRuleSet returns a rule set with the given rules
+func newRuleSet(rules []v1.PolicyRule) *ruleSet {
+	set := &ruleSet{
+		rules: []v1.PolicyRule{},
+		seen:  map[string]bool{},
+	}
+	set.add(rules)
+	return set
+}
+
+// add appends the rules that are not already in the set
+func (s *ruleSet) add(rules []v1.PolicyRule) {
+	for _, rule := range rules {
+		key := rule.String()
+		if s.seen[key] {
+			continue
+		}
+		s.seen[key] = true
+		s.rules = append(s.rules, rule)
+	}
+}
@@ -0,0 +1,168 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+type (
+	// Attributes describe a request to check against policy rules, they are
+	// a subset of the kubernetes authorizer's attributes.
+	// Requests without a non-resource url are resource requests.
+	Attributes struct {
+		Verb           string `json:"verb" yaml:"verb"`
+		APIGroup       string `json:"apiGroup,omitempty" yaml:"apiGroup,omitempty"`
+		Resource       string `json:"resource,omitempty" yaml:"resource,omitempty"`
+		Subresource    string `json:"subresource,omitempty" yaml:"subresource,omitempty"`
+		Name           string `json:"name,omitempty" yaml:"name,omitempty"`
+		NonResourceURL string `json:"nonResourceURL,omitempty" yaml:"nonResourceURL,omitempty"`
+	}
+	// SubjectBindings is a subject along with the bindings that allow it a
+	// request
+	SubjectBindings struct {
+		Subject  SubjectKey `json:"subject" yaml:"subject"`
+		Bindings []Key      `json:"bindings" yaml:"bindings"`
+	}
+)
+
+// RuleAllows checks if the rule allows the request, using the same wildcard
+// semantics as the kubernetes rbac authorizer
+func RuleAllows(rule v1.PolicyRule, attributes Attributes) bool {
+	if attributes.NonResourceURL != "" {
+		return verbMatches(rule, attributes.Verb) &&
+			nonResourceURLMatches(rule, attributes.NonResourceURL)
+	}
+
+	combinedResource := attributes.Resource
+	if attributes.Subresource != "" {
+		combinedResource += "/" + attributes.Subresource
+	}
+
+	return verbMatches(rule, attributes.Verb) &&
+		apiGroupMatches(rule, attributes.APIGroup) &&
+		resourceMatches(rule, combinedResource, attributes.Subresource) &&
+		resourceNameMatches(rule, attributes.Name)
+}
+
+// RulesAllow checks if any of the rules allows the request
+func RulesAllow(rules []v1.PolicyRule, attributes Attributes) bool {
+	for _, rule := range rules {
+		if RuleAllows(rule, attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+// WhoCan returns the subjects allowed to make the request in the given
+// namespace, or cluster-wide if empty, sorted by kind, namespace and name.
+// Role bindings only allow requests in their own namespace and, as with the
+// kubernetes authorizer, non-resource urls are only allowed through cluster
+// role bindings.
+func (s State) WhoCan(namespace string, attributes Attributes) []SubjectBindings {
+	allowed := map[SubjectKey][]Key{}
+	s.EachWhoCan(namespace, attributes, func(subject SubjectKey, binding Key) error {
+		allowed[subject] = append(allowed[subject], binding)
+		return nil
+	})
+
+	subjects := make([]SubjectBindings, 0, len(allowed))
+	for subject, bindings := range allowed {
+		subjects = append(subjects, SubjectBindings{
+			Subject:  subject,
+			Bindings: bindings,
+		})
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].Subject.Less(subjects[j].Subject)
+	})
+	return subjects
+}
+
+// EachWhoCan calls f with every subject allowed to make the request, as
+// WhoCan, and a binding that allows it, as soon as the binding is found
+// rather than sorted. Subjects allowed by several bindings are called with
+// each of them. Stops at the first error f returns, and returns it.
+func (s State) EachWhoCan(namespace string, attributes Attributes, f func(subject SubjectKey, binding Key) error) error {
+	roles := s.RoleRules()
+	for _, binding := range s.Bindings() {
+		if binding.Namespace != "" && (binding.Namespace != namespace || attributes.NonResourceURL != "") {
+			continue
+		}
+		if !RulesAllow(roles[binding.RoleKey()], attributes) {
+			continue
+		}
+		// subjects can be listed more than once in the same binding
+		seen := map[SubjectKey]bool{}
+		for _, subject := range binding.Subjects {
+			key := NewSubjectKey(subject)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := f(key, binding.Key()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func verbMatches(rule v1.PolicyRule, verb string) bool {
+	for _, ruleVerb := range rule.Verbs {
+		if ruleVerb == v1.VerbAll || ruleVerb == verb {
+			return true
+		}
+	}
+	return false
+}
+
+func apiGroupMatches(rule v1.PolicyRule, apiGroup string) bool {
+	for _, ruleGroup := range rule.APIGroups {
+		if ruleGroup == v1.APIGroupAll || ruleGroup == apiGroup {
+			return true
+		}
+	}
+	return false
+}
+
+func resourceMatches(rule v1.PolicyRule, combinedResource, subresource string) bool {
+	for _, ruleResource := range rule.Resources {
+		if ruleResource == v1.ResourceAll || ruleResource == combinedResource {
+			return true
+		}
+		// rules can also match any resource's subresource using */subresource
+		if subresource != "" && ruleResource == "*/"+subresource {
+			return true
+		}
+	}
+	return false
+}
+
+func resourceNameMatches(rule v1.PolicyRule, name string) bool {
+	// rules without resource names apply to all of them
+	if len(rule.ResourceNames) == 0 {
+		return true
+	}
+	for _, ruleName := range rule.ResourceNames {
+		if ruleName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func nonResourceURLMatches(rule v1.PolicyRule, url string) bool {
+	for _, ruleURL := range rule.NonResourceURLs {
+		if ruleURL == v1.NonResourceAll || ruleURL == url {
+			return true
+		}
+		// trailing wildcards match any url with the same prefix
+		if strings.HasSuffix(ruleURL, "*") && strings.HasPrefix(url, strings.TrimSuffix(ruleURL, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package rbac
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	// KindRole is the kind of namespaced roles
+	KindRole = "Role"
+	// KindClusterRole is the kind of cluster roles
+	KindClusterRole = "ClusterRole"
+)
+
+type (
+	// Binding is either a role binding or a cluster role binding, cluster
+	// role bindings have no namespace
+	Binding struct {
+		Kind      string       `json:"kind" yaml:"kind"`
+		Namespace string       `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		Name      string       `json:"name" yaml:"name"`
+		RoleRef   v1.RoleRef   `json:"roleRef" yaml:"roleRef"`
+		Subjects  []v1.Subject `json:"subjects" yaml:"subjects"`
+	}
+	// Key identifies a role, cluster role, role binding or cluster role
+	// binding, cluster scoped objects have no namespace
+	Key struct {
+		Kind      string `json:"kind" yaml:"kind"`
+		Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		Name      string `json:"name" yaml:"name"`
+	}
+)
+
+// SortRoleBindings sorts role bindings by role name, and then by namespace
+// and name, so that pages and streams of them are stable
+func SortRoleBindings(roleBindings []v1.RoleBinding) {
+	sort.Slice(roleBindings, func(i, j int) bool {
+		a, b := roleBindings[i], roleBindings[j]
+		if a.RoleRef.Name != b.RoleRef.Name {
+			return a.RoleRef.Name < b.RoleRef.Name
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+}
+
+// Bindings returns the state's role bindings and cluster role bindings,
+// sorted by kind, namespace and name
+func (s State) Bindings() []Binding {
+	bindings := make([]Binding, 0, len(s.RoleBindings)+len(s.ClusterRoleBindings))
+	for _, roleBinding := range s.RoleBindings {
+		bindings = append(bindings, Binding{
+			Kind:      KindRoleBinding,
+			Namespace: roleBinding.Namespace,
+			Name:      roleBinding.Name,
+			RoleRef:   roleBinding.RoleRef,
+			Subjects:  roleBinding.Subjects,
+		})
+	}
+	for _, clusterRoleBinding := range s.ClusterRoleBindings {
+		bindings = append(bindings, Binding{
+			Kind:     KindClusterRoleBinding,
+			Name:     clusterRoleBinding.Name,
+			RoleRef:  clusterRoleBinding.RoleRef,
+			Subjects: clusterRoleBinding.Subjects,
+		})
+	}
+	sort.SliceStable(bindings, func(i, j int) bool {
+		return bindings[i].Key().Less(bindings[j].Key())
+	})
+	return bindings
+}
+
+// FilterBindings returns the state's role bindings in the given namespace,
+// or all namespaces if empty, and cluster role bindings that match any of the
+// filters, or all of them if there are no filters.
+// Cluster role bindings are matched as role bindings without a namespace.
+func (s State) FilterBindings(namespace string, filters ...RoleBindingFilter) []Binding {
+	filtered := State{}
+	for _, roleBinding := range s.RoleBindings {
+		if namespace != "" && roleBinding.Namespace != namespace {
+			continue
+		}
+		if len(filters) == 0 || matchesAny(roleBinding, filters) {
+			filtered.RoleBindings = append(filtered.RoleBindings, roleBinding)
+		}
+	}
+	for _, clusterRoleBinding := range s.ClusterRoleBindings {
+		if len(filters) == 0 || matchesAny(roleBindingFromClusterRoleBinding(clusterRoleBinding), filters) {
+			filtered.ClusterRoleBindings = append(filtered.ClusterRoleBindings, clusterRoleBinding)
+		}
+	}
+	return filtered.Bindings()
+}
+
+// Key identifies the binding
+func (b Binding) Key() Key {
+	return Key{
+		Kind:      b.Kind,
+		Namespace: b.Namespace,
+		Name:      b.Name,
+	}
+}
+
+// RoleKey identifies the role the binding refers to, role bindings can refer
+// to roles in their namespace or to cluster roles
+func (b Binding) RoleKey() Key {
+	if b.RoleRef.Kind == KindClusterRole {
+		return Key{
+			Kind: KindClusterRole,
+			Name: b.RoleRef.Name,
+		}
+	}
+	return Key{
+		Kind:      KindRole,
+		Namespace: b.Namespace,
+		Name:      b.RoleRef.Name,
+	}
+}
+
+// Less orders keys by kind, namespace and name
+func (k Key) Less(other Key) bool {
+	if k.Kind != other.Kind {
+		return k.Kind < other.Kind
+	}
+	if k.Namespace != other.Namespace {
+		return k.Namespace < other.Namespace
+	}
+	return k.Name < other.Name
+}
+
+// String returns kind/name or kind/namespace/name
+func (k Key) String() string {
+	if k.Namespace == "" {
+		return k.Kind + "/" + k.Name
+	}
+	return k.Kind + "/" + k.Namespace + "/" + k.Name
+}
+
+// RoleRules returns the rules of every role and cluster role in the state,
+// cluster roles with an aggregation rule include the rules of the cluster
+// roles they select
+func (s State) RoleRules() map[Key][]v1.PolicyRule {
+	roles := make(map[Key][]v1.PolicyRule, len(s.Roles)+len(s.ClusterRoles))
+	for _, role := range s.Roles {
+		roles[Key{
+			Kind:      KindRole,
+			Namespace: role.Namespace,
+			Name:      role.Name,
+		}] = role.Rules
+	}
+	for name, rules := range s.clusterRoleRules() {
+		roles[Key{
+			Kind: KindClusterRole,
+			Name: name,
+		}] = rules
+	}
+	return roles
+}
+
+// RulesFor resolves the rules granted by the binding's role, returns false if
+// the role does not exist.
+// Use RoleRules when resolving the rules of many bindings.
+func (s State) RulesFor(binding Binding) ([]v1.PolicyRule, bool) {
+	rules, ok := s.RoleRules()[binding.RoleKey()]
+	return rules, ok
+}
@@ -0,0 +1,91 @@
+package rbac
+
+import (
+	"expvar"
+	"fmt"
+
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	// listMetrics counts the lists requested from the API server, and how
+	// many of them were coalesced with an identical list already in flight
+	listMetrics = expvar.NewMap("rbac_lists")
+)
+
+// coalesce lists using the given func, unless an identical list with the same
+// key is already in flight in which case its result is shared. Shared results
+// are copied, so that callers can't affect each other.
+func (e *enumerator) coalesce(key string, list func() (runtime.Object, error)) (runtime.Object, error) {
+	listMetrics.Add("requests", 1)
+	listed := false
+	v, err, shared := e.lists.Do(key, func() (interface{}, error) {
+		listed = true
+		return list()
+	})
+	if !listed {
+		listMetrics.Add("coalesced", 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	object := v.(runtime.Object)
+	if shared {
+		object = object.DeepCopyObject()
+	}
+	return object, nil
+}
+
+// listKey identifies a list of a resource in a namespace with its options
+func listKey(resource, namespace string, options metav1.ListOptions) string {
+	return fmt.Sprintf("%s/%s?%s", resource, namespace, options.String())
+}
+
+// listRoles lists roles, coalescing identical concurrent lists
+func (e *enumerator) listRoles(namespace string, options metav1.ListOptions) (*v1.RoleList, error) {
+	object, err := e.coalesce(listKey("roles", namespace, options), func() (runtime.Object, error) {
+		return e.client.Roles(namespace).List(options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.(*v1.RoleList), nil
+}
+
+// listClusterRoles lists cluster roles, coalescing identical concurrent
+// lists
+func (e *enumerator) listClusterRoles(options metav1.ListOptions) (*v1.ClusterRoleList, error) {
+	object, err := e.coalesce(listKey("clusterroles", "", options), func() (runtime.Object, error) {
+		return e.client.ClusterRoles().List(options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.(*v1.ClusterRoleList), nil
+}
+
+// listRoleBindings lists role bindings, coalescing identical concurrent
+// lists
+func (e *enumerator) listRoleBindings(namespace string, options metav1.ListOptions) (*v1.RoleBindingList, error) {
+	object, err := e.coalesce(listKey("rolebindings", namespace, options), func() (runtime.Object, error) {
+		return e.client.RoleBindings(namespace).List(options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.(*v1.RoleBindingList), nil
+}
+
+// listClusterRoleBindings lists cluster role bindings, coalescing identical
+// concurrent lists
+func (e *enumerator) listClusterRoleBindings(options metav1.ListOptions) (*v1.ClusterRoleBindingList, error) {
+	object, err := e.coalesce(listKey("clusterrolebindings", "", options), func() (runtime.Object, error) {
+		return e.client.ClusterRoleBindings().List(options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.(*v1.ClusterRoleBindingList), nil
+}
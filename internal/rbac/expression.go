@@ -0,0 +1,277 @@
+package rbac
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/overloads"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter/functions"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"google.golang.org/protobuf/proto"
+	v1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	// MaxExpressionLength is the longest expression that will be compiled
+	MaxExpressionLength = 4096
+	// ExpressionCostLimit is the most an expression may cost evaluating a
+	// single binding, expressions estimated to cost more are rejected when
+	// compiled and expressions actually costing more don't match
+	ExpressionCostLimit = 100000
+	// expressionMaxSize is the size of lists, maps and strings assumed when
+	// estimating the cost of expressions
+	expressionMaxSize = 256
+)
+
+var (
+	// expressionTypes are the object types bindings are exposed as, with
+	// their fields named as in the kubernetes api
+	expressionTypes = map[string]map[string]*exprpb.Type{
+		"rbac.Binding": {
+			"kind":        decls.String,
+			"namespace":   decls.String,
+			"name":        decls.String,
+			"labels":      decls.NewMapType(decls.String, decls.String),
+			"annotations": decls.NewMapType(decls.String, decls.String),
+			"roleRef":     decls.NewObjectType("rbac.RoleRef"),
+			"subjects":    decls.NewListType(decls.NewObjectType("rbac.Subject")),
+		},
+		"rbac.RoleRef": {
+			"apiGroup": decls.String,
+			"kind":     decls.String,
+			"name":     decls.String,
+		},
+		"rbac.Subject": {
+			"apiGroup":  decls.String,
+			"kind":      decls.String,
+			"namespace": decls.String,
+			"name":      decls.String,
+		},
+	}
+)
+
+type (
+	// expressionTypeProvider declares the binding types on top of the
+	// builtin ones, for type checking only since bindings are evaluated as
+	// maps
+	expressionTypeProvider struct {
+		ref.TypeProvider
+	}
+	// expressionCostEstimator assumes every list, map and string is of the
+	// same maximum size
+	expressionCostEstimator struct{}
+)
+
+// FilterByExpression allows filtering rolebindings by a CEL expression over
+// the `binding` variable, such as
+// `binding.roleRef.kind == "ClusterRole" && binding.subjects.exists(s, s.kind == "Group")`.
+// The expression is type checked and must evaluate to a bool, expressions
+// that fail to evaluate for a binding, or exceed the cost limit, don't match.
+// Regular expressions of `matches` are compiled within the same limits as
+// subject patterns, constant ones when the expression is compiled.
+func FilterByExpression(expression string) (RoleBindingFilter, error) {
+	if len(expression) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", MaxExpressionLength)
+	}
+
+	registry, err := types.NewRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct expression types: %w", err)
+	}
+	env, err := cel.NewEnv(
+		cel.CustomTypeProvider(expressionTypeProvider{registry}),
+		cel.Declarations(decls.NewVar("binding", decls.NewObjectType("rbac.Binding"))),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct expression environment: %w", err)
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression: %w", issues.Err())
+	}
+	if !proto.Equal(ast.ResultType(), decls.Bool) {
+		return nil, fmt.Errorf("invalid expression: must evaluate to bool, not %s", checker.FormatCheckedType(ast.ResultType()))
+	}
+
+	if err := validateMatches(ast.Expr()); err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+
+	cost, err := env.EstimateCost(ast, expressionCostEstimator{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate expression cost: %w", err)
+	}
+	if cost.Max > ExpressionCostLimit {
+		return nil, fmt.Errorf("expression is too expensive, estimated cost %d exceeds limit %d", cost.Max, ExpressionCostLimit)
+	}
+
+	program, err := env.Program(ast,
+		cel.CostLimit(ExpressionCostLimit),
+		cel.Functions(&functions.Overload{
+			Operator: overloads.MatchesString,
+			Binary:   matchesString,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct expression program: %w", err)
+	}
+
+	return func(roleBinding v1.RoleBinding) bool {
+		out, _, err := program.Eval(map[string]interface{}{
+			"binding": expressionBinding(roleBinding),
+		})
+		if err != nil {
+			return false
+		}
+		matches, ok := out.Value().(bool)
+		return ok && matches
+	}, nil
+}
+
+// matchesString implements `matches`, compiling the regular expression within
+// the limits of the regular expressions of filters
+func matchesString(lhs, rhs ref.Val) ref.Val {
+	s, ok := lhs.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(lhs)
+	}
+	pattern, ok := rhs.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(rhs)
+	}
+	compiled, err := regexps.Compile(string(pattern))
+	if err != nil {
+		return types.NewErr("invalid regular expression %s: %v", quote(string(pattern)), err)
+	}
+	return types.Bool(compiled.MatchString(string(s)))
+}
+
+// validateMatches compiles the constant regular expressions of every
+// `matches` in the expression, so invalid ones are rejected rather than never
+// matching
+func validateMatches(expr *exprpb.Expr) error {
+	if expr == nil {
+		return nil
+	}
+	children := []*exprpb.Expr{}
+	switch {
+	case expr.GetCallExpr() != nil:
+		call := expr.GetCallExpr()
+		if call.Function == overloads.Matches && len(call.Args) > 0 {
+			pattern := call.Args[len(call.Args)-1].GetConstExpr()
+			if _, ok := pattern.GetConstantKind().(*exprpb.Constant_StringValue); ok {
+				if _, err := regexps.Compile(pattern.GetStringValue()); err != nil {
+					return fmt.Errorf("invalid regular expression %s: %w", quote(pattern.GetStringValue()), err)
+				}
+			}
+		}
+		children = append(children, call.Target)
+		children = append(children, call.Args...)
+	case expr.GetSelectExpr() != nil:
+		children = append(children, expr.GetSelectExpr().Operand)
+	case expr.GetListExpr() != nil:
+		children = append(children, expr.GetListExpr().Elements...)
+	case expr.GetStructExpr() != nil:
+		for _, entry := range expr.GetStructExpr().Entries {
+			children = append(children, entry.GetMapKey(), entry.Value)
+		}
+	case expr.GetComprehensionExpr() != nil:
+		comprehension := expr.GetComprehensionExpr()
+		children = append(children,
+			comprehension.IterRange,
+			comprehension.AccuInit,
+			comprehension.LoopCondition,
+			comprehension.LoopStep,
+			comprehension.Result,
+		)
+	}
+	for _, child := range children {
+		if err := validateMatches(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expressionBinding represents the role binding as declared by the binding
+// type, cluster role bindings are role bindings without a namespace
+func expressionBinding(roleBinding v1.RoleBinding) map[string]interface{} {
+	kind := KindRoleBinding
+	if roleBinding.Namespace == "" {
+		kind = KindClusterRoleBinding
+	}
+	subjects := make([]interface{}, len(roleBinding.Subjects))
+	for i, subject := range roleBinding.Subjects {
+		subjects[i] = map[string]interface{}{
+			"apiGroup":  subject.APIGroup,
+			"kind":      subject.Kind,
+			"namespace": subject.Namespace,
+			"name":      subject.Name,
+		}
+	}
+	return map[string]interface{}{
+		"kind":        kind,
+		"namespace":   roleBinding.Namespace,
+		"name":        roleBinding.Name,
+		"labels":      stringMap(roleBinding.Labels),
+		"annotations": stringMap(roleBinding.Annotations),
+		"roleRef": map[string]interface{}{
+			"apiGroup": roleBinding.RoleRef.APIGroup,
+			"kind":     roleBinding.RoleRef.Kind,
+			"name":     roleBinding.RoleRef.Name,
+		},
+		"subjects": subjects,
+	}
+}
+
+// stringMap returns the map, or an empty map if it is nil
+func stringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// FindType implements ref.TypeProvider
+func (p expressionTypeProvider) FindType(typeName string) (*exprpb.Type, bool) {
+	if _, ok := expressionTypes[typeName]; ok {
+		return decls.NewTypeType(decls.NewObjectType(typeName)), true
+	}
+	return p.TypeProvider.FindType(typeName)
+}
+
+// FindFieldType implements ref.TypeProvider
+func (p expressionTypeProvider) FindFieldType(typeName, fieldName string) (*ref.FieldType, bool) {
+	fields, ok := expressionTypes[typeName]
+	if !ok {
+		return p.TypeProvider.FindFieldType(typeName, fieldName)
+	}
+	fieldType, ok := fields[fieldName]
+	if !ok {
+		return nil, false
+	}
+	return &ref.FieldType{Type: fieldType}, true
+}
+
+// NewValue implements ref.TypeProvider, bindings can't be constructed
+func (p expressionTypeProvider) NewValue(typeName string, fields map[string]ref.Val) ref.Val {
+	if _, ok := expressionTypes[typeName]; ok {
+		return types.NewErr("%s can not be constructed", typeName)
+	}
+	return p.TypeProvider.NewValue(typeName, fields)
+}
+
+// EstimateSize implements checker.CostEstimator
+func (expressionCostEstimator) EstimateSize(element checker.AstNode) *checker.SizeEstimate {
+	return &checker.SizeEstimate{Min: 0, Max: expressionMaxSize}
+}
+
+// EstimateCallCost implements checker.CostEstimator
+func (expressionCostEstimator) EstimateCallCost(function, overloadID string, target *checker.AstNode, args []checker.AstNode) *checker.CallEstimate {
+	return nil
+}
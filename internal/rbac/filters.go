@@ -1,9 +1,13 @@
 package rbac
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type (
@@ -23,6 +27,32 @@ func FilterBySubjectName(subjectName string) RoleBindingFilter {
 	}
 }
 
+// FilterBySubjectNamePrefix allows filtering rolebindings by the prefix of
+// their subject names
+func FilterBySubjectNamePrefix(prefix string) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		for _, subject := range roleBinding.Subjects {
+			if strings.HasPrefix(subject.Name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterBySubject allows filtering rolebindings by the exact kind and name of
+// one of their subjects
+func FilterBySubject(kind, name string) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		for _, subject := range roleBinding.Subjects {
+			if subject.Kind == kind && subject.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // FilterBySubjectNameRegex allows filtering rolebindings by a regular expression
 func FilterBySubjectNameRegex(subjectNameRegexp regexp.Regexp) RoleBindingFilter {
 	return func(roleBinding v1.RoleBinding) bool {
@@ -34,3 +64,139 @@ func FilterBySubjectNameRegex(subjectNameRegexp regexp.Regexp) RoleBindingFilter
 		return false
 	}
 }
+
+// FiltersBySubjectNames constructs a filter for each of the given subject
+// names, each a regular expression that has to match the whole name, the
+// same as the regex match type, so names without any metacharacters such as
+// "team-a" are matched exactly. Returns a PatternError if any of them is
+// invalid.
+// Use FiltersBySubjectPatterns to choose how names are matched.
+func FiltersBySubjectNames(subjectNames []string) ([]RoleBindingFilter, error) {
+	filters := make([]RoleBindingFilter, len(subjectNames))
+	for i, subjectName := range subjectNames {
+		subjectNameRegexp, err := regexps.compile(subjectName, regexExpr(subjectName))
+		if err != nil {
+			return nil, &PatternError{
+				Index: i,
+				Err:   fmt.Errorf("invalid regular expression or subject name %s: %w", quote(subjectName), err),
+			}
+		}
+		filters[i] = FilterBySubjectNameRegex(*subjectNameRegexp)
+	}
+	return filters, nil
+}
+
+// FilterAny allows filtering rolebindings matching any of the filters
+func FilterAny(filters ...RoleBindingFilter) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		return matchesAny(roleBinding, filters)
+	}
+}
+
+// FilterAll allows filtering rolebindings matching all of the filters
+func FilterAll(filters ...RoleBindingFilter) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		for _, filter := range filters {
+			if !filter(roleBinding) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FilterByRoleRef allows filtering rolebindings by the kind of the role they
+// refer to, any kind if empty, and its name matching the pattern
+func FilterByRoleRef(kind string, name Pattern) (RoleBindingFilter, error) {
+	matches, err := name.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	return func(roleBinding v1.RoleBinding) bool {
+		if kind != "" && roleRefKind(roleBinding.RoleRef) != kind {
+			return false
+		}
+		return matches(roleBinding.RoleRef.Name)
+	}, nil
+}
+
+// FilterByLabelSelector allows filtering rolebindings by their labels
+func FilterByLabelSelector(selector labels.Selector) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		return selector.Matches(labels.Set(roleBinding.Labels))
+	}
+}
+
+// FilterByAnnotations allows filtering rolebindings that have all of the
+// given annotations with the same values
+func FilterByAnnotations(annotations map[string]string) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		for key, value := range annotations {
+			if actual, ok := roleBinding.Annotations[key]; !ok || actual != value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FilterByOwner allows filtering rolebindings by the kind and name of one of
+// their owner references, either can be empty to match any
+func FilterByOwner(kind, name string) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		for _, owner := range roleBinding.OwnerReferences {
+			if (kind == "" || owner.Kind == kind) && (name == "" || owner.Name == name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterByCreationTimestamp allows filtering rolebindings created at or after
+// the first and before the second time, either can be zero to not bound it
+func FilterByCreationTimestamp(after, before time.Time) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		created := roleBinding.CreationTimestamp.Time
+		if !after.IsZero() && created.Before(after) {
+			return false
+		}
+		if !before.IsZero() && !created.Before(before) {
+			return false
+		}
+		return true
+	}
+}
+
+// roleRefKind returns the kind of role referred to, which is a role unless
+// it's a cluster role
+func roleRefKind(roleRef v1.RoleRef) string {
+	if roleRef.Kind == KindClusterRole {
+		return KindClusterRole
+	}
+	return KindRole
+}
+
+// FilterByPermissions allows filtering rolebindings whose role allows all of
+// the requests, given the rules of every role such as returned by
+// State.RoleRules.
+// As with the kubernetes authorizer, non-resource urls are only allowed
+// through cluster role bindings.
+func FilterByPermissions(roles map[Key][]v1.PolicyRule, attributes ...Attributes) RoleBindingFilter {
+	return func(roleBinding v1.RoleBinding) bool {
+		binding := Binding{
+			Namespace: roleBinding.Namespace,
+			RoleRef:   roleBinding.RoleRef,
+		}
+		rules := roles[binding.RoleKey()]
+		for _, attribute := range attributes {
+			if attribute.NonResourceURL != "" && roleBinding.Namespace != "" {
+				return false
+			}
+			if !RulesAllow(rules, attribute) {
+				return false
+			}
+		}
+		return true
+	}
+}
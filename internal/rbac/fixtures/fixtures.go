@@ -62,4 +62,20 @@ var (
 			Name: "role3",
 		},
 	}
+	// ClusterRoleBindingClusterRole1Subject1 sample cluster role binding
+	ClusterRoleBindingClusterRole1Subject1 = v1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "clusterrole1-for-subject1",
+		},
+		Subjects: []v1.Subject{
+			v1.Subject{
+				Kind: "User",
+				Name: "subject1",
+			},
+		},
+		RoleRef: v1.RoleRef{
+			Kind: "ClusterRole",
+			Name: "clusterrole1",
+		},
+	}
 )
@@ -0,0 +1,160 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// manifestBufferSize is how far the decoder looks ahead to decide if a
+	// manifest is json or yaml
+	manifestBufferSize = 4096
+)
+
+// LoadManifests reads the RBAC objects of yaml or json manifests, such as the
+// ones given to kubectl apply, into a State.
+// Multiple documents and lists are supported, other kinds are ignored.
+// Namespaced objects without a namespace are placed in the default namespace.
+func LoadManifests(r io.Reader, defaultNamespace string) (*State, error) {
+	state := &State{}
+	err := decodeManifests(r, func(typeMeta metav1.TypeMeta, manifest json.RawMessage) error {
+		return state.addManifest(typeMeta, manifest, defaultNamespace)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// LoadServiceAccountManifests reads the service accounts of yaml or json
+// manifests, the same way as LoadManifests reads RBAC objects, so bindings
+// loaded from manifests can be checked against the service accounts that
+// come with them
+func LoadServiceAccountManifests(r io.Reader, defaultNamespace string) ([]SubjectKey, error) {
+	serviceAccounts := []SubjectKey{}
+	err := decodeManifests(r, func(typeMeta metav1.TypeMeta, manifest json.RawMessage) error {
+		if typeMeta.APIVersion != "v1" || typeMeta.Kind != v1.ServiceAccountKind {
+			return nil
+		}
+		serviceAccount := struct {
+			metav1.ObjectMeta `json:"metadata"`
+		}{}
+		if err := json.Unmarshal(manifest, &serviceAccount); err != nil {
+			return fmt.Errorf("failed to decode service account: %w", err)
+		}
+		if serviceAccount.Namespace == "" {
+			serviceAccount.Namespace = defaultNamespace
+		}
+		serviceAccounts = append(serviceAccounts, SubjectKey{
+			Kind:      v1.ServiceAccountKind,
+			Namespace: serviceAccount.Namespace,
+			Name:      serviceAccount.Name,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return serviceAccounts, nil
+}
+
+// decodeManifests calls add with every object of the manifests, and of the
+// lists among them
+func decodeManifests(r io.Reader, add func(typeMeta metav1.TypeMeta, manifest json.RawMessage) error) error {
+	decoder := yaml.NewYAMLOrJSONDecoder(r, manifestBufferSize)
+	for {
+		manifest := json.RawMessage{}
+		if err := decoder.Decode(&manifest); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		if err := decodeManifest(manifest, add); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeManifest calls add with the manifest's object, or with each item if
+// it's a list
+func decodeManifest(manifest json.RawMessage, add func(typeMeta metav1.TypeMeta, manifest json.RawMessage) error) error {
+	// empty documents decode to null
+	if len(manifest) == 0 || string(manifest) == "null" {
+		return nil
+	}
+
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(manifest, &typeMeta); err != nil {
+		return fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	if typeMeta.Kind == "List" {
+		list := struct {
+			Items []json.RawMessage `json:"items"`
+		}{}
+		if err := json.Unmarshal(manifest, &list); err != nil {
+			return fmt.Errorf("failed to decode list: %w", err)
+		}
+		for _, item := range list.Items {
+			if err := decodeManifest(item, add); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return add(typeMeta, manifest)
+}
+
+// addManifest adds the manifest's object to the state if it's an RBAC one
+func (s *State) addManifest(typeMeta metav1.TypeMeta, manifest json.RawMessage, defaultNamespace string) error {
+	if !strings.HasPrefix(typeMeta.APIVersion, v1.GroupName+"/") {
+		return nil
+	}
+
+	// namespace returns the given namespace or the default one
+	namespace := func(namespace string) string {
+		if namespace == "" {
+			return defaultNamespace
+		}
+		return namespace
+	}
+
+	switch typeMeta.Kind {
+	case KindRole:
+		role := v1.Role{}
+		if err := json.Unmarshal(manifest, &role); err != nil {
+			return fmt.Errorf("failed to decode role: %w", err)
+		}
+		role.Namespace = namespace(role.Namespace)
+		s.Roles = append(s.Roles, role)
+	case KindClusterRole:
+		clusterRole := v1.ClusterRole{}
+		if err := json.Unmarshal(manifest, &clusterRole); err != nil {
+			return fmt.Errorf("failed to decode cluster role: %w", err)
+		}
+		s.ClusterRoles = append(s.ClusterRoles, clusterRole)
+	case KindRoleBinding:
+		roleBinding := v1.RoleBinding{}
+		if err := json.Unmarshal(manifest, &roleBinding); err != nil {
+			return fmt.Errorf("failed to decode role binding: %w", err)
+		}
+		roleBinding.Namespace = namespace(roleBinding.Namespace)
+		s.RoleBindings = append(s.RoleBindings, roleBinding)
+	case KindClusterRoleBinding:
+		clusterRoleBinding := v1.ClusterRoleBinding{}
+		if err := json.Unmarshal(manifest, &clusterRoleBinding); err != nil {
+			return fmt.Errorf("failed to decode cluster role binding: %w", err)
+		}
+		s.ClusterRoleBindings = append(s.ClusterRoleBindings, clusterRoleBinding)
+	}
+
+	return nil
+}
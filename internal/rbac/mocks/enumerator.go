@@ -5,6 +5,7 @@
 package rbacmocks
 
 import (
+	context "context"
 	rbac "github.com/geoah/go-kube-api/internal/rbac"
 	gomock "github.com/golang/mock/gomock"
 	v1 "k8s.io/api/rbac/v1"
@@ -55,6 +56,86 @@ func (mr *MockEnumeratorMockRecorder) EnumberateByRoleBindings(namespace interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnumberateByRoleBindings", reflect.TypeOf((*MockEnumerator)(nil).EnumberateByRoleBindings), varargs...)
 }
 
+// WatchRoleBindings mocks base method
+func (m *MockEnumerator) WatchRoleBindings(ctx context.Context, namespace string, resourceVersions rbac.ResourceVersions, filters ...rbac.RoleBindingFilter) (<-chan rbac.Event, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, namespace, resourceVersions}
+	for _, a := range filters {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "WatchRoleBindings", varargs...)
+	ret0, _ := ret[0].(<-chan rbac.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WatchRoleBindings indicates an expected call of WatchRoleBindings
+func (mr *MockEnumeratorMockRecorder) WatchRoleBindings(ctx, namespace, resourceVersions interface{}, filters ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, namespace, resourceVersions}, filters...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WatchRoleBindings", reflect.TypeOf((*MockEnumerator)(nil).WatchRoleBindings), varargs...)
+}
+
+// LatestResourceVersions mocks base method
+func (m *MockEnumerator) LatestResourceVersions(namespace string) (rbac.ResourceVersions, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LatestResourceVersions", namespace)
+	ret0, _ := ret[0].(rbac.ResourceVersions)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LatestResourceVersions indicates an expected call of LatestResourceVersions
+func (mr *MockEnumeratorMockRecorder) LatestResourceVersions(namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LatestResourceVersions", reflect.TypeOf((*MockEnumerator)(nil).LatestResourceVersions), namespace)
+}
+
+// State mocks base method
+func (m *MockEnumerator) State() (*rbac.State, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "State")
+	ret0, _ := ret[0].(*rbac.State)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// State indicates an expected call of State
+func (mr *MockEnumeratorMockRecorder) State() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "State", reflect.TypeOf((*MockEnumerator)(nil).State))
+}
+
+// NamespaceState mocks base method
+func (m *MockEnumerator) NamespaceState(namespace string) (*rbac.State, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NamespaceState", namespace)
+	ret0, _ := ret[0].(*rbac.State)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NamespaceState indicates an expected call of NamespaceState
+func (mr *MockEnumeratorMockRecorder) NamespaceState(namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NamespaceState", reflect.TypeOf((*MockEnumerator)(nil).NamespaceState), namespace)
+}
+
+// ClusterState mocks base method
+func (m *MockEnumerator) ClusterState() (*rbac.State, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClusterState")
+	ret0, _ := ret[0].(*rbac.State)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClusterState indicates an expected call of ClusterState
+func (mr *MockEnumeratorMockRecorder) ClusterState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClusterState", reflect.TypeOf((*MockEnumerator)(nil).ClusterState))
+}
+
 // MockrbacV1Interface is a mock of rbacV1Interface interface
 type MockrbacV1Interface struct {
 	ctrl     *gomock.Controller
@@ -105,3 +186,31 @@ func (mr *MockrbacV1InterfaceMockRecorder) RoleBindings(namespace interface{}) *
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RoleBindings", reflect.TypeOf((*MockrbacV1Interface)(nil).RoleBindings), namespace)
 }
+
+// ClusterRoles mocks base method
+func (m *MockrbacV1Interface) ClusterRoles() v10.ClusterRoleInterface {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClusterRoles")
+	ret0, _ := ret[0].(v10.ClusterRoleInterface)
+	return ret0
+}
+
+// ClusterRoles indicates an expected call of ClusterRoles
+func (mr *MockrbacV1InterfaceMockRecorder) ClusterRoles() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClusterRoles", reflect.TypeOf((*MockrbacV1Interface)(nil).ClusterRoles))
+}
+
+// ClusterRoleBindings mocks base method
+func (m *MockrbacV1Interface) ClusterRoleBindings() v10.ClusterRoleBindingInterface {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClusterRoleBindings")
+	ret0, _ := ret[0].(v10.ClusterRoleBindingInterface)
+	return ret0
+}
+
+// ClusterRoleBindings indicates an expected call of ClusterRoleBindings
+func (mr *MockrbacV1InterfaceMockRecorder) ClusterRoleBindings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClusterRoleBindings", reflect.TypeOf((*MockrbacV1Interface)(nil).ClusterRoleBindings))
+}
@@ -0,0 +1,119 @@
+package rbac
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	// MatchExact matches subject names equal to the pattern
+	MatchExact MatchType = "exact"
+	// MatchPrefix matches subject names starting with the pattern
+	MatchPrefix MatchType = "prefix"
+	// MatchGlob matches subject names against a pattern where * matches any
+	// characters and ? a single one
+	MatchGlob MatchType = "glob"
+	// MatchRegex matches subject names against a regular expression that has
+	// to match the whole name
+	MatchRegex MatchType = "regex"
+)
+
+type (
+	// MatchType is how a pattern is matched against names
+	MatchType string
+	// Pattern matches names, exactly if no match type is given
+	Pattern struct {
+		Pattern   string    `json:"pattern" yaml:"pattern"`
+		MatchType MatchType `json:"matchType,omitempty" yaml:"matchType,omitempty"`
+	}
+)
+
+// IsExact checks if the pattern only matches the name it contains
+func (p Pattern) IsExact() bool {
+	return p.MatchType == "" || p.MatchType == MatchExact
+}
+
+// Matcher constructs the func that checks if names match the pattern
+func (p Pattern) Matcher() (func(name string) bool, error) {
+	switch p.MatchType {
+	case "", MatchExact:
+		return func(name string) bool {
+			return name == p.Pattern
+		}, nil
+	case MatchPrefix:
+		return func(name string) bool {
+			return strings.HasPrefix(name, p.Pattern)
+		}, nil
+	case MatchGlob:
+		globRegexp, err := regexps.compile(p.Pattern, globExpr(p.Pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %w", quote(p.Pattern), err)
+		}
+		return globRegexp.MatchString, nil
+	case MatchRegex:
+		nameRegexp, err := regexps.compile(p.Pattern, regexExpr(p.Pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %w", quote(p.Pattern), err)
+		}
+		return nameRegexp.MatchString, nil
+	}
+	return nil, fmt.Errorf("invalid match type %q for %s", p.MatchType, quote(p.Pattern))
+}
+
+// FilterBySubjectPattern allows filtering rolebindings by subject names
+// matching the pattern
+func FilterBySubjectPattern(pattern Pattern) (RoleBindingFilter, error) {
+	matches, err := pattern.Matcher()
+	if err != nil {
+		return nil, err
+	}
+	return func(roleBinding v1.RoleBinding) bool {
+		for _, subject := range roleBinding.Subjects {
+			if matches(subject.Name) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// FiltersBySubjectPatterns constructs a filter for each of the given subject
+// patterns, returning a PatternError if any of them is invalid
+func FiltersBySubjectPatterns(patterns []Pattern) ([]RoleBindingFilter, error) {
+	filters := make([]RoleBindingFilter, len(patterns))
+	for i, pattern := range patterns {
+		filter, err := FilterBySubjectPattern(pattern)
+		if err != nil {
+			return nil, &PatternError{Index: i, Err: err}
+		}
+		filters[i] = filter
+	}
+	return filters, nil
+}
+
+// regexExpr anchors a regular expression so it has to match the whole name
+func regexExpr(expr string) string {
+	return "^(?:" + expr + ")$"
+}
+
+// globExpr converts a glob pattern to an anchored regular expression,
+// anything but * and ? is matched literally
+func globExpr(glob string) string {
+	b := strings.Builder{}
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
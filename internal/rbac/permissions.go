@@ -0,0 +1,250 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+type (
+	// Permission is a single verb granted on a single resource or non-resource
+	// url, as flattened from policy rules.
+	// Wildcards are kept as they are.
+	Permission struct {
+		// Namespace the permission applies to, empty for cluster-wide
+		Namespace      string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		Verb           string `json:"verb" yaml:"verb"`
+		APIGroup       string `json:"apiGroup,omitempty" yaml:"apiGroup,omitempty"`
+		Resource       string `json:"resource,omitempty" yaml:"resource,omitempty"`
+		ResourceName   string `json:"resourceName,omitempty" yaml:"resourceName,omitempty"`
+		NonResourceURL string `json:"nonResourceURL,omitempty" yaml:"nonResourceURL,omitempty"`
+	}
+	// SubjectKey identifies a subject, only service accounts have namespaces
+	SubjectKey struct {
+		Kind      string `json:"kind" yaml:"kind"`
+		Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		Name      string `json:"name" yaml:"name"`
+	}
+)
+
+// Permissions flattens policy rules into the permissions they grant in the
+// given namespace, or cluster-wide if empty
+func Permissions(namespace string, rules []v1.PolicyRule) []Permission {
+	permissions := []Permission{}
+	for _, rule := range rules {
+		for _, verb := range rule.Verbs {
+			for _, apiGroup := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					if len(rule.ResourceNames) == 0 {
+						permissions = append(permissions, Permission{
+							Namespace: namespace,
+							Verb:      verb,
+							APIGroup:  apiGroup,
+							Resource:  resource,
+						})
+						continue
+					}
+					for _, resourceName := range rule.ResourceNames {
+						permissions = append(permissions, Permission{
+							Namespace:    namespace,
+							Verb:         verb,
+							APIGroup:     apiGroup,
+							Resource:     resource,
+							ResourceName: resourceName,
+						})
+					}
+				}
+			}
+			// non-resource urls are never namespaced
+			for _, nonResourceURL := range rule.NonResourceURLs {
+				permissions = append(permissions, Permission{
+					Verb:           verb,
+					NonResourceURL: nonResourceURL,
+				})
+			}
+		}
+	}
+	return permissions
+}
+
+// SubjectPermissions returns the permissions every bound subject has been
+// granted, bindings to missing roles grant nothing
+func (s State) SubjectPermissions() map[SubjectKey]map[Permission]bool {
+	subjectPermissions := map[SubjectKey]map[Permission]bool{}
+	roles := s.RoleRules()
+	for _, binding := range s.Bindings() {
+		rules := roles[binding.RoleKey()]
+		permissions := Permissions(binding.Namespace, rules)
+		for _, subject := range binding.Subjects {
+			key := NewSubjectKey(subject)
+			if subjectPermissions[key] == nil {
+				subjectPermissions[key] = map[Permission]bool{}
+			}
+			for _, permission := range permissions {
+				subjectPermissions[key][permission] = true
+			}
+		}
+	}
+	return subjectPermissions
+}
+
+// EffectivePermissions returns the sorted permissions granted to any of the
+// subjects, and the bindings that grant them
+func (s State) EffectivePermissions(subjects ...SubjectKey) ([]Permission, []Key) {
+	set := map[Permission]bool{}
+	bindings := []Key{}
+	s.eachGrant(subjects, func(binding Binding, permissions []Permission) error {
+		bindings = append(bindings, binding.Key())
+		for _, permission := range permissions {
+			set[permission] = true
+		}
+		return nil
+	})
+
+	permissions := make([]Permission, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	SortPermissions(permissions)
+	return permissions, bindings
+}
+
+// EachEffectivePermission calls f with every permission granted to any of
+// the subjects, once each, as soon as the first binding that grants it is
+// found rather than sorted. Stops at the first error f returns, and returns
+// it.
+func (s State) EachEffectivePermission(f func(permission Permission) error, subjects ...SubjectKey) error {
+	seen := map[Permission]bool{}
+	return s.eachGrant(subjects, func(binding Binding, permissions []Permission) error {
+		for _, permission := range permissions {
+			if seen[permission] {
+				continue
+			}
+			seen[permission] = true
+			if err := f(permission); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// eachGrant calls f with every binding that binds any of the subjects, and
+// the permissions it grants. Stops at the first error f returns, and
+// returns it.
+func (s State) eachGrant(subjects []SubjectKey, f func(binding Binding, permissions []Permission) error) error {
+	wanted := map[SubjectKey]bool{}
+	for _, subject := range subjects {
+		wanted[subject] = true
+	}
+
+	roles := s.RoleRules()
+	for _, binding := range s.Bindings() {
+		bound := false
+		for _, subject := range binding.Subjects {
+			if wanted[NewSubjectKey(subject)] {
+				bound = true
+				break
+			}
+		}
+		if !bound {
+			continue
+		}
+		if err := f(binding, Permissions(binding.Namespace, roles[binding.RoleKey()])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServiceAccountSubjects returns the subjects a service account authenticates
+// as, itself as a service account and a user, and the groups it's a member of
+func ServiceAccountSubjects(namespace, name string) []SubjectKey {
+	return []SubjectKey{
+		{Kind: v1.ServiceAccountKind, Namespace: namespace, Name: name},
+		{Kind: v1.UserKind, Name: "system:serviceaccount:" + namespace + ":" + name},
+		{Kind: v1.GroupKind, Name: "system:serviceaccounts"},
+		{Kind: v1.GroupKind, Name: "system:serviceaccounts:" + namespace},
+		{Kind: v1.GroupKind, Name: "system:authenticated"},
+	}
+}
+
+// NewSubjectKey identifies the given subject
+func NewSubjectKey(subject v1.Subject) SubjectKey {
+	key := SubjectKey{
+		Kind: subject.Kind,
+		Name: subject.Name,
+	}
+	if subject.Kind == v1.ServiceAccountKind {
+		key.Namespace = subject.Namespace
+	}
+	return key
+}
+
+// String returns kind/name or kind/namespace/name
+func (k SubjectKey) String() string {
+	if k.Namespace == "" {
+		return k.Kind + "/" + k.Name
+	}
+	return k.Kind + "/" + k.Namespace + "/" + k.Name
+}
+
+// Less orders subject keys by kind, namespace and name
+func (k SubjectKey) Less(other SubjectKey) bool {
+	if k.Kind != other.Kind {
+		return k.Kind < other.Kind
+	}
+	if k.Namespace != other.Namespace {
+		return k.Namespace < other.Namespace
+	}
+	return k.Name < other.Name
+}
+
+// String describes the permission, for example "get deployments.apps/name in
+// default" or "get /healthz"
+func (p Permission) String() string {
+	if p.NonResourceURL != "" {
+		return p.Verb + " " + p.NonResourceURL
+	}
+	b := strings.Builder{}
+	b.WriteString(p.Verb)
+	b.WriteString(" ")
+	b.WriteString(p.Resource)
+	if p.APIGroup != "" {
+		b.WriteString(".")
+		b.WriteString(p.APIGroup)
+	}
+	if p.ResourceName != "" {
+		b.WriteString("/")
+		b.WriteString(p.ResourceName)
+	}
+	if p.Namespace != "" {
+		b.WriteString(" in ")
+		b.WriteString(p.Namespace)
+	} else {
+		b.WriteString(" cluster-wide")
+	}
+	return b.String()
+}
+
+// SortPermissions sorts permissions by namespace, api group, resource,
+// resource name, non-resource url and verb
+func SortPermissions(permissions []Permission) {
+	sort.Slice(permissions, func(i, j int) bool {
+		a, b := permissions[i], permissions[j]
+		switch {
+		case a.Namespace != b.Namespace:
+			return a.Namespace < b.Namespace
+		case a.APIGroup != b.APIGroup:
+			return a.APIGroup < b.APIGroup
+		case a.Resource != b.Resource:
+			return a.Resource < b.Resource
+		case a.ResourceName != b.ResourceName:
+			return a.ResourceName < b.ResourceName
+		case a.NonResourceURL != b.NonResourceURL:
+			return a.NonResourceURL < b.NonResourceURL
+		}
+		return a.Verb < b.Verb
+	})
+}
@@ -1,8 +1,10 @@
 package rbac
 
 import (
+	"context"
 	"fmt"
 
+	"golang.org/x/sync/singleflight"
 	v1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	rbacv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
@@ -15,15 +17,24 @@ type (
 	// zero or more filters
 	Enumerator interface {
 		EnumberateByRoleBindings(namespace string, filters ...RoleBindingFilter) ([]v1.RoleBinding, error)
+		WatchRoleBindings(ctx context.Context, namespace string, resourceVersions ResourceVersions, filters ...RoleBindingFilter) (<-chan Event, error)
+		LatestResourceVersions(namespace string) (ResourceVersions, error)
+		State() (*State, error)
+		NamespaceState(namespace string) (*State, error)
+		ClusterState() (*State, error)
 	}
-	// enumerator is the concrete implementation of the Enumerator interface
+	// enumerator is the concrete implementation of the Enumerator interface,
+	// identical concurrent lists are coalesced into one
 	enumerator struct {
 		client rbacV1Interface
+		lists  singleflight.Group
 	}
 	// rbacV1Interface is a simplified rbacv1.RbacV1Interface
 	rbacV1Interface interface {
 		Roles(namespace string) rbacv1.RoleInterface
 		RoleBindings(namespace string) rbacv1.RoleBindingInterface
+		ClusterRoles() rbacv1.ClusterRoleInterface
+		ClusterRoleBindings() rbacv1.ClusterRoleBindingInterface
 	}
 )
 
@@ -37,20 +48,27 @@ func New(client rbacV1Interface) (Enumerator, error) {
 // EnumberateByRoleBindings returns role bindings that match the given filters
 func (e *enumerator) EnumberateByRoleBindings(namespace string, filters ...RoleBindingFilter) ([]v1.RoleBinding, error) {
 	roleBindingsOptions := metav1.ListOptions{}
-	roleBindings, err := e.client.RoleBindings(namespace).List(roleBindingsOptions)
+	roleBindings, err := e.listRoleBindings(namespace, roleBindingsOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get role bindings: %w", err)
 	}
 
 	filteredRoleBindings := []v1.RoleBinding{}
 	for _, roleBinding := range roleBindings.Items {
-		for _, filter := range filters {
-			if filter(roleBinding) {
-				filteredRoleBindings = append(filteredRoleBindings, roleBinding)
-				continue
-			}
+		if matchesAny(roleBinding, filters) {
+			filteredRoleBindings = append(filteredRoleBindings, roleBinding)
 		}
 	}
 
 	return filteredRoleBindings, nil
 }
+
+// matchesAny checks if the role binding matches at least one of the filters
+func matchesAny(roleBinding v1.RoleBinding, filters []RoleBindingFilter) bool {
+	for _, filter := range filters {
+		if filter(roleBinding) {
+			return true
+		}
+	}
+	return false
+}
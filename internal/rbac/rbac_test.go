@@ -1,16 +1,23 @@
 package rbac
 
 import (
+	"context"
 	"errors"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	kruntime "k8s.io/apimachinery/pkg/runtime"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 	kfake "k8s.io/client-go/kubernetes/fake"
 	ktesting "k8s.io/client-go/testing"
 
@@ -116,3 +123,1406 @@ func Test_enumerator_EnumberateByRoleBindings(t *testing.T) {
 		})
 	}
 }
+
+func Test_enumerator_coalesce(t *testing.T) {
+	fakeClient := kfake.NewSimpleClientset(&fixtures.RoleBindingRole1Subject1)
+	listed := make(chan struct{}, 10)
+	release := make(chan struct{})
+	fakeClient.PrependReactor("list", "rolebindings", func(action ktesting.Action) (bool, kruntime.Object, error) {
+		listed <- struct{}{}
+		<-release
+		// fall through to the default reactor
+		return false, nil, nil
+	})
+	e, err := New(fakeClient.RbacV1())
+	require.NoError(t, err)
+
+	// identical lists while the first one is in flight share its result
+	results := make([][]v1.RoleBinding, 5)
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			roleBindings, err := e.EnumberateByRoleBindings(nsDefault, FilterBySubjectName("subject1"))
+			assert.NoError(t, err)
+			results[i] = roleBindings
+		}(i)
+	}
+	<-listed
+	// give the other lists time to join the one in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Len(t, listed, 0, "lists were not coalesced")
+	for _, roleBindings := range results {
+		assert.Equal(t, []v1.RoleBinding{fixtures.RoleBindingRole1Subject1}, roleBindings)
+	}
+
+	// lists that are not in flight are not coalesced
+	_, err = e.EnumberateByRoleBindings(nsDefault, FilterBySubjectName("subject1"))
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+}
+
+func Test_enumerator_WatchRoleBindings(t *testing.T) {
+	type args struct {
+		namespace string
+		filters   []RoleBindingFilter
+	}
+	// role binding 1 without subject 1, which no longer matches
+	roleBindingRole1WithoutSubject1 := fixtures.RoleBindingRole1Subject1
+	roleBindingRole1WithoutSubject1.Subjects = fixtures.RoleBindingRole2Subject2.Subjects
+	tests := []struct {
+		name             string
+		objects          []kruntime.Object
+		resourceVersions ResourceVersions
+		args             args
+		changes          func(t *testing.T, client *kfake.Clientset)
+		want             []Event
+	}{
+		{
+			name: "existing bindings are added, success",
+			objects: []kruntime.Object{
+				&fixtures.RoleBindingRole1Subject1,
+				&fixtures.RoleBindingRole2Subject2,
+			},
+			args: args{
+				namespace: nsDefault,
+				filters: []RoleBindingFilter{
+					FilterBySubjectName("subject1"),
+				},
+			},
+			changes: func(t *testing.T, client *kfake.Clientset) {},
+			want: []Event{
+				{
+					Type:        watch.Added,
+					Kind:        KindRoleBinding,
+					RoleBinding: &fixtures.RoleBindingRole1Subject1,
+				},
+			},
+		},
+		{
+			name: "resumed watch does not add existing bindings, success",
+			objects: []kruntime.Object{
+				&fixtures.RoleBindingRole1Subject1,
+			},
+			resourceVersions: ResourceVersions{
+				RoleBindings:        "1",
+				ClusterRoleBindings: "1",
+			},
+			args: args{
+				namespace: nsDefault,
+				filters: []RoleBindingFilter{
+					FilterBySubjectName("subject1"),
+				},
+			},
+			changes: func(t *testing.T, client *kfake.Clientset) {
+				_, err := client.RbacV1().ClusterRoleBindings().Create(&fixtures.ClusterRoleBindingClusterRole1Subject1)
+				require.NoError(t, err, "failed to create sample cluster role binding")
+			},
+			want: []Event{
+				{
+					Type: watch.Added,
+					Kind: KindClusterRoleBinding,
+					RoleBinding: func() *v1.RoleBinding {
+						roleBinding := roleBindingFromClusterRoleBinding(fixtures.ClusterRoleBindingClusterRole1Subject1)
+						return &roleBinding
+					}(),
+					// the fake client doesn't set resource versions
+					ResourceVersions: ResourceVersions{
+						RoleBindings:        "1",
+						ClusterRoleBindings: "",
+					},
+				},
+			},
+		},
+		{
+			name: "binding that stops matching is deleted, success",
+			objects: []kruntime.Object{
+				&fixtures.RoleBindingRole1Subject1,
+			},
+			resourceVersions: ResourceVersions{
+				RoleBindings:        "1",
+				ClusterRoleBindings: "1",
+			},
+			args: args{
+				namespace: nsDefault,
+				filters: []RoleBindingFilter{
+					FilterBySubjectName("subject1"),
+				},
+			},
+			changes: func(t *testing.T, client *kfake.Clientset) {
+				fakeRbac := client.RbacV1()
+				_, err := fakeRbac.RoleBindings(nsDefault).Update(&roleBindingRole1WithoutSubject1)
+				require.NoError(t, err, "failed to update sample role binding")
+				// no longer matched, so its deletion isn't emitted
+				err = fakeRbac.RoleBindings(nsDefault).Delete(fixtures.RoleBindingRole1Subject1.Name, nil)
+				require.NoError(t, err, "failed to delete sample role binding")
+				_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+				require.NoError(t, err, "failed to create sample role binding")
+			},
+			want: []Event{
+				{
+					Type:        watch.Deleted,
+					Kind:        KindRoleBinding,
+					RoleBinding: &roleBindingRole1WithoutSubject1,
+					ResourceVersions: ResourceVersions{
+						RoleBindings:        "",
+						ClusterRoleBindings: "1",
+					},
+				},
+				{
+					Type:        watch.Added,
+					Kind:        KindRoleBinding,
+					RoleBinding: &fixtures.RoleBindingRole1Subject1,
+					ResourceVersions: ResourceVersions{
+						RoleBindings:        "",
+						ClusterRoleBindings: "1",
+					},
+				},
+			},
+		},
+		{
+			name: "resumed across a change that stops a binding matching, deleted, success",
+			// the binding already doesn't match when the watch is resumed
+			objects: []kruntime.Object{
+				&roleBindingRole1WithoutSubject1,
+			},
+			resourceVersions: ResourceVersions{
+				RoleBindings:        "1",
+				ClusterRoleBindings: "1",
+			},
+			args: args{
+				namespace: nsDefault,
+				filters: []RoleBindingFilter{
+					FilterBySubjectName("subject1"),
+				},
+			},
+			changes: func(t *testing.T, client *kfake.Clientset) {
+				// the fake client doesn't replay the changes since the
+				// resource versions, so the change is made again instead
+				fakeRbac := client.RbacV1()
+				_, err := fakeRbac.RoleBindings(nsDefault).Update(&roleBindingRole1WithoutSubject1)
+				require.NoError(t, err, "failed to update sample role binding")
+				// known not to match, so neither is emitted
+				_, err = fakeRbac.RoleBindings(nsDefault).Update(&roleBindingRole1WithoutSubject1)
+				require.NoError(t, err, "failed to update sample role binding")
+				err = fakeRbac.RoleBindings(nsDefault).Delete(fixtures.RoleBindingRole1Subject1.Name, nil)
+				require.NoError(t, err, "failed to delete sample role binding")
+				_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+				require.NoError(t, err, "failed to create sample role binding")
+			},
+			want: []Event{
+				{
+					Type:        watch.Deleted,
+					Kind:        KindRoleBinding,
+					RoleBinding: &roleBindingRole1WithoutSubject1,
+					ResourceVersions: ResourceVersions{
+						RoleBindings:        "",
+						ClusterRoleBindings: "1",
+					},
+				},
+				{
+					Type:        watch.Added,
+					Kind:        KindRoleBinding,
+					RoleBinding: &fixtures.RoleBindingRole1Subject1,
+					ResourceVersions: ResourceVersions{
+						RoleBindings:        "",
+						ClusterRoleBindings: "1",
+					},
+				},
+			},
+		},
+		{
+			name: "role binding and cluster role binding changes, success",
+			args: args{
+				namespace: nsDefault,
+				filters: []RoleBindingFilter{
+					FilterBySubjectName("subject1"),
+					FilterBySubjectNameRegex(*regexp.MustCompile("subject[3,4]")),
+				},
+			},
+			changes: func(t *testing.T, client *kfake.Clientset) {
+				fakeRbac := client.RbacV1()
+				_, err := fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+				require.NoError(t, err, "failed to create sample role binding")
+				// does not match any filter
+				_, err = fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole2Subject2)
+				require.NoError(t, err, "failed to create sample role binding")
+				_, err = fakeRbac.ClusterRoleBindings().Create(&fixtures.ClusterRoleBindingClusterRole1Subject1)
+				require.NoError(t, err, "failed to create sample cluster role binding")
+				err = fakeRbac.RoleBindings(nsDefault).Delete(fixtures.RoleBindingRole1Subject1.Name, nil)
+				require.NoError(t, err, "failed to delete sample role binding")
+			},
+			want: []Event{
+				{
+					Type:        watch.Added,
+					Kind:        KindRoleBinding,
+					RoleBinding: &fixtures.RoleBindingRole1Subject1,
+				},
+				{
+					Type: watch.Added,
+					Kind: KindClusterRoleBinding,
+					RoleBinding: func() *v1.RoleBinding {
+						roleBinding := roleBindingFromClusterRoleBinding(fixtures.ClusterRoleBindingClusterRole1Subject1)
+						return &roleBinding
+					}(),
+				},
+				{
+					Type:        watch.Deleted,
+					Kind:        KindRoleBinding,
+					RoleBinding: &fixtures.RoleBindingRole1Subject1,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClient := kfake.NewSimpleClientset(tt.objects...)
+			e, err := New(fakeClient.RbacV1())
+			require.NoError(t, err, "failed to create new rbac enumerator")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			events, err := e.WatchRoleBindings(ctx, tt.args.namespace, tt.resourceVersions, tt.args.filters...)
+			require.NoError(t, err, "did not expect error")
+
+			tt.changes(t, fakeClient)
+
+			got := []Event{}
+			for range tt.want {
+				select {
+				case event := <-events:
+					got = append(got, event)
+				case <-time.After(time.Second):
+					require.FailNow(t, "timed out waiting for events")
+				}
+			}
+			// events from different resources can arrive in any order
+			assert.ElementsMatch(t, tt.want, got, "events did not match expectation")
+
+			// the channel should be closed once the context is done
+			cancel()
+			for range events {
+			}
+		})
+	}
+}
+
+func Test_enumerator_NamespaceState(t *testing.T) {
+	clusterRole := func(name string, labels map[string]string, aggregateLabel string) *v1.ClusterRole {
+		clusterRole := &v1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		}
+		if aggregateLabel != "" {
+			clusterRole.AggregationRule = &v1.AggregationRule{
+				ClusterRoleSelectors: []metav1.LabelSelector{{
+					MatchLabels: map[string]string{aggregateLabel: "true"},
+				}},
+			}
+		}
+		return clusterRole
+	}
+	bindingTo := func(namespace, name, clusterRoleName string) *v1.RoleBinding {
+		return &v1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			RoleRef: v1.RoleRef{
+				Kind: KindClusterRole,
+				Name: clusterRoleName,
+			},
+		}
+	}
+	fakeClient := kfake.NewSimpleClientset(
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: nsDefault}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "other"}},
+		&fixtures.RoleBindingRole1Subject1,
+		// edit aggregates view, which aggregates pods-reader
+		clusterRole("edit", nil, "aggregate-to-edit"),
+		clusterRole("view", map[string]string{"aggregate-to-edit": "true"}, "aggregate-to-view"),
+		clusterRole("pods-reader", map[string]string{"aggregate-to-view": "true"}, ""),
+		clusterRole("admin", nil, ""),
+		bindingTo(nsDefault, "edit-binding", "edit"),
+		bindingTo(nsDefault, "missing-binding", "missing"),
+		bindingTo("other", "admin-binding", "admin"),
+		&fixtures.ClusterRoleBindingClusterRole1Subject1,
+	)
+	e, err := New(fakeClient.RbacV1())
+	require.NoError(t, err, "failed to create new rbac enumerator")
+
+	state, err := e.NamespaceState(nsDefault)
+	require.NoError(t, err, "did not expect error")
+
+	roles := []string{}
+	for _, role := range state.Roles {
+		roles = append(roles, role.Namespace+"/"+role.Name)
+	}
+	assert.Equal(t, []string{"default/role1"}, roles)
+	roleBindings := []string{}
+	for _, roleBinding := range state.RoleBindings {
+		roleBindings = append(roleBindings, roleBinding.Name)
+	}
+	assert.ElementsMatch(t, []string{fixtures.RoleBindingRole1Subject1.Name, "edit-binding", "missing-binding"}, roleBindings)
+	// only the referenced cluster roles and the ones aggregated into them
+	clusterRoles := []string{}
+	for _, clusterRole := range state.ClusterRoles {
+		clusterRoles = append(clusterRoles, clusterRole.Name)
+	}
+	assert.ElementsMatch(t, []string{"edit", "view", "pods-reader"}, clusterRoles)
+	assert.Empty(t, state.ClusterRoleBindings)
+}
+
+func TestPermissionsState(t *testing.T) {
+	otherNamespaceRoleBinding := fixtures.RoleBindingRole2Subject2
+	otherNamespaceRoleBinding.Namespace = "other"
+	fakeClient := kfake.NewSimpleClientset(
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: nsDefault}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Name: "role2", Namespace: "other"}},
+		&fixtures.RoleBindingRole1Subject1,
+		&otherNamespaceRoleBinding,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "clusterRole1"}},
+		&fixtures.ClusterRoleBindingClusterRole1Subject1,
+	)
+	e, err := New(fakeClient.RbacV1())
+	require.NoError(t, err, "failed to create new rbac enumerator")
+
+	names := func(state *State) []string {
+		names := []string{}
+		for _, role := range state.Roles {
+			names = append(names, "Role/"+role.Namespace+"/"+role.Name)
+		}
+		for _, roleBinding := range state.RoleBindings {
+			names = append(names, "RoleBinding/"+roleBinding.Namespace+"/"+roleBinding.Name)
+		}
+		for _, clusterRole := range state.ClusterRoles {
+			names = append(names, "ClusterRole/"+clusterRole.Name)
+		}
+		for _, clusterRoleBinding := range state.ClusterRoleBindings {
+			names = append(names, "ClusterRoleBinding/"+clusterRoleBinding.Name)
+		}
+		return names
+	}
+
+	// the namespace's roles and role bindings, and the cluster-wide ones
+	state, err := PermissionsState(e, nsDefault)
+	require.NoError(t, err, "did not expect error")
+	assert.ElementsMatch(t, []string{
+		"Role/default/role1",
+		"RoleBinding/default/" + fixtures.RoleBindingRole1Subject1.Name,
+		"ClusterRole/clusterRole1",
+		"ClusterRoleBinding/" + fixtures.ClusterRoleBindingClusterRole1Subject1.Name,
+	}, names(state))
+
+	// only the cluster-wide ones
+	state, err = PermissionsState(e, "")
+	require.NoError(t, err, "did not expect error")
+	assert.ElementsMatch(t, []string{
+		"ClusterRole/clusterRole1",
+		"ClusterRoleBinding/" + fixtures.ClusterRoleBindingClusterRole1Subject1.Name,
+	}, names(state))
+}
+
+func Test_staticEnumerator_EnumberateByRoleBindings(t *testing.T) {
+	otherNamespaceRoleBinding := fixtures.RoleBindingRole1Subject1
+	otherNamespaceRoleBinding.Namespace = "other"
+	state := State{
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+			otherNamespaceRoleBinding,
+		},
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		filters   []RoleBindingFilter
+		want      []v1.RoleBinding
+	}{
+		{
+			name:      "single namespace, success",
+			namespace: nsDefault,
+			filters: []RoleBindingFilter{
+				FilterBySubjectName("subject1"),
+			},
+			want: []v1.RoleBinding{
+				fixtures.RoleBindingRole1Subject1,
+			},
+		},
+		{
+			name:      "all namespaces, success",
+			namespace: "",
+			filters: []RoleBindingFilter{
+				FilterBySubjectName("subject1"),
+			},
+			want: []v1.RoleBinding{
+				fixtures.RoleBindingRole1Subject1,
+				otherNamespaceRoleBinding,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewStatic(state)
+			got, err := e.EnumberateByRoleBindings(tt.namespace, tt.filters...)
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestLoadManifests(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests string
+		want      *State
+		wantErr   bool
+	}{
+		{
+			name: "multiple documents and lists, success",
+			manifests: `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: subject1
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: role1
+rules:
+- apiGroups: [""]
+  resources: [pods]
+  verbs: [list]
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: ClusterRoleBinding
+  metadata:
+    name: clusterrole1-for-subject1
+  roleRef:
+    kind: ClusterRole
+    name: clusterrole1
+  subjects:
+  - kind: User
+    name: subject1
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: role1-for-subject1
+    namespace: other
+  roleRef:
+    name: role1
+  subjects:
+  - kind: User
+    name: subject1
+---
+`,
+			want: &State{
+				Roles: []v1.Role{
+					{
+						TypeMeta: metav1.TypeMeta{
+							APIVersion: "rbac.authorization.k8s.io/v1",
+							Kind:       KindRole,
+						},
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "role1",
+							Namespace: nsDefault,
+						},
+						Rules: []v1.PolicyRule{
+							{
+								APIGroups: []string{""},
+								Resources: []string{"pods"},
+								Verbs:     []string{"list"},
+							},
+						},
+					},
+				},
+				RoleBindings: []v1.RoleBinding{
+					{
+						TypeMeta: metav1.TypeMeta{
+							APIVersion: "rbac.authorization.k8s.io/v1",
+							Kind:       KindRoleBinding,
+						},
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "role1-for-subject1",
+							Namespace: "other",
+						},
+						RoleRef: v1.RoleRef{
+							Name: "role1",
+						},
+						Subjects: []v1.Subject{
+							{
+								Kind: "User",
+								Name: "subject1",
+							},
+						},
+					},
+				},
+				ClusterRoleBindings: []v1.ClusterRoleBinding{
+					{
+						TypeMeta: metav1.TypeMeta{
+							APIVersion: "rbac.authorization.k8s.io/v1",
+							Kind:       KindClusterRoleBinding,
+						},
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "clusterrole1-for-subject1",
+						},
+						RoleRef: v1.RoleRef{
+							Kind: KindClusterRole,
+							Name: "clusterrole1",
+						},
+						Subjects: []v1.Subject{
+							{
+								Kind: "User",
+								Name: "subject1",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:      "invalid yaml, fails",
+			manifests: "{{",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadManifests(strings.NewReader(tt.manifests), nsDefault)
+			if tt.wantErr {
+				require.Error(t, err, "expected error but got none")
+				return
+			}
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestLoadServiceAccountManifests(t *testing.T) {
+	manifests := `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: deployer
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ServiceAccount
+  metadata:
+    name: builder
+    namespace: ci
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: config
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: role1
+`
+	got, err := LoadServiceAccountManifests(strings.NewReader(manifests), nsDefault)
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, []SubjectKey{
+		{Kind: v1.ServiceAccountKind, Namespace: nsDefault, Name: "deployer"},
+		{Kind: v1.ServiceAccountKind, Namespace: "ci", Name: "builder"},
+	}, got)
+
+	// manifests without service accounts have none, rather than unknown
+	got, err = LoadServiceAccountManifests(strings.NewReader(""), nsDefault)
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, []SubjectKey{}, got)
+}
+
+func TestRuleAllows(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       v1.PolicyRule
+		attributes Attributes
+		want       bool
+	}{
+		{
+			name: "exact match, allowed",
+			rule: v1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get"},
+			},
+			attributes: Attributes{Verb: "get", Resource: "pods"},
+			want:       true,
+		},
+		{
+			name: "wildcards, allowed",
+			rule: v1.PolicyRule{
+				APIGroups: []string{"*"},
+				Resources: []string{"*"},
+				Verbs:     []string{"*"},
+			},
+			attributes: Attributes{Verb: "create", APIGroup: "apps", Resource: "pods", Subresource: "exec"},
+			want:       true,
+		},
+		{
+			name: "different verb, denied",
+			rule: v1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get"},
+			},
+			attributes: Attributes{Verb: "delete", Resource: "pods"},
+			want:       false,
+		},
+		{
+			name: "different api group, denied",
+			rule: v1.PolicyRule{
+				APIGroups: []string{"apps"},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get"},
+			},
+			attributes: Attributes{Verb: "get", Resource: "pods"},
+			want:       false,
+		},
+		{
+			name: "resource does not include subresources, denied",
+			rule: v1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"create"},
+			},
+			attributes: Attributes{Verb: "create", Resource: "pods", Subresource: "exec"},
+			want:       false,
+		},
+		{
+			name: "subresource, allowed",
+			rule: v1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"pods/exec"},
+				Verbs:     []string{"create"},
+			},
+			attributes: Attributes{Verb: "create", Resource: "pods", Subresource: "exec"},
+			want:       true,
+		},
+		{
+			name: "wildcard resource subresource, allowed",
+			rule: v1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"*/exec"},
+				Verbs:     []string{"create"},
+			},
+			attributes: Attributes{Verb: "create", Resource: "pods", Subresource: "exec"},
+			want:       true,
+		},
+		{
+			name: "resource names without name, denied",
+			rule: v1.PolicyRule{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{"secret1"},
+				Verbs:         []string{"get"},
+			},
+			attributes: Attributes{Verb: "get", Resource: "secrets"},
+			want:       false,
+		},
+		{
+			name: "resource names with name, allowed",
+			rule: v1.PolicyRule{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{"secret1"},
+				Verbs:         []string{"get"},
+			},
+			attributes: Attributes{Verb: "get", Resource: "secrets", Name: "secret1"},
+			want:       true,
+		},
+		{
+			name: "non-resource url prefix, allowed",
+			rule: v1.PolicyRule{
+				NonResourceURLs: []string{"/logs/*"},
+				Verbs:           []string{"get"},
+			},
+			attributes: Attributes{Verb: "get", NonResourceURL: "/logs/kubelet"},
+			want:       true,
+		},
+		{
+			name: "non-resource url on resource rule, denied",
+			rule: v1.PolicyRule{
+				APIGroups: []string{"*"},
+				Resources: []string{"*"},
+				Verbs:     []string{"get"},
+			},
+			attributes: Attributes{Verb: "get", NonResourceURL: "/healthz"},
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RuleAllows(tt.rule, tt.attributes)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestState_RoleRules_aggregation(t *testing.T) {
+	podsRule := v1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"get"},
+	}
+	secretsRule := v1.PolicyRule{
+		APIGroups: []string{""},
+		Resources: []string{"secrets"},
+		Verbs:     []string{"get"},
+	}
+	aggregationRule := func(label string) *v1.AggregationRule {
+		return &v1.AggregationRule{
+			ClusterRoleSelectors: []metav1.LabelSelector{{
+				MatchLabels: map[string]string{label: "true"},
+			}},
+		}
+	}
+	state := State{
+		ClusterRoles: []v1.ClusterRole{{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "view",
+				Labels: map[string]string{
+					"aggregate-to-edit": "true",
+				},
+			},
+			AggregationRule: aggregationRule("aggregate-to-view"),
+		}, {
+			ObjectMeta:      metav1.ObjectMeta{Name: "edit"},
+			AggregationRule: aggregationRule("aggregate-to-edit"),
+			// live cluster roles already contain the aggregated rules
+			Rules: []v1.PolicyRule{podsRule},
+		}, {
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pods-reader",
+				Labels: map[string]string{
+					"aggregate-to-view": "true",
+				},
+			},
+			Rules: []v1.PolicyRule{podsRule},
+		}, {
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "secrets-reader",
+				Labels: map[string]string{
+					"aggregate-to-edit": "true",
+				},
+			},
+			Rules: []v1.PolicyRule{secretsRule},
+		}},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{{
+			ObjectMeta: metav1.ObjectMeta{Name: "edit-for-subject1"},
+			RoleRef: v1.RoleRef{
+				Kind: KindClusterRole,
+				Name: "edit",
+			},
+			Subjects: []v1.Subject{{
+				Kind: v1.UserKind,
+				Name: "subject1",
+			}},
+		}},
+	}
+
+	roles := state.RoleRules()
+	assert.Equal(t, []v1.PolicyRule{podsRule}, roles[Key{Kind: KindClusterRole, Name: "view"}])
+	assert.Equal(t, []v1.PolicyRule{podsRule, secretsRule}, roles[Key{Kind: KindClusterRole, Name: "edit"}])
+	assert.Equal(t, []v1.PolicyRule{secretsRule}, roles[Key{Kind: KindClusterRole, Name: "secrets-reader"}])
+
+	permissions, bindings := state.EffectivePermissions(SubjectKey{Kind: v1.UserKind, Name: "subject1"})
+	assert.Equal(t, []Key{{Kind: KindClusterRoleBinding, Name: "edit-for-subject1"}}, bindings)
+	assert.Equal(t, []Permission{
+		{Verb: "get", Resource: "pods"},
+		{Verb: "get", Resource: "secrets"},
+	}, permissions)
+
+	// each permission is only called back once, in the order it is granted
+	each := []Permission{}
+	err := state.EachEffectivePermission(func(permission Permission) error {
+		each = append(each, permission)
+		return nil
+	}, SubjectKey{Kind: v1.UserKind, Name: "subject1"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, permissions, each)
+}
+
+func TestFilterBySubjectPattern(t *testing.T) {
+	roleBinding := v1.RoleBinding{
+		Subjects: []v1.Subject{{
+			Kind: v1.UserKind,
+			Name: "system:serviceaccount:ci:deployer",
+		}},
+	}
+	tests := []struct {
+		name    string
+		pattern Pattern
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "default is exact, matches",
+			pattern: Pattern{Pattern: "system:serviceaccount:ci:deployer"},
+			want:    true,
+		},
+		{
+			name:    "exact, does not match substring",
+			pattern: Pattern{Pattern: "ci:deployer", MatchType: MatchExact},
+			want:    false,
+		},
+		{
+			name:    "prefix, matches",
+			pattern: Pattern{Pattern: "system:serviceaccount:ci:", MatchType: MatchPrefix},
+			want:    true,
+		},
+		{
+			name:    "glob, matches",
+			pattern: Pattern{Pattern: "system:serviceaccount:*:deploye?", MatchType: MatchGlob},
+			want:    true,
+		},
+		{
+			name:    "glob, dots are literal",
+			pattern: Pattern{Pattern: "system.serviceaccount.*", MatchType: MatchGlob},
+			want:    false,
+		},
+		{
+			name:    "regex, anchored, does not match substring",
+			pattern: Pattern{Pattern: "ci:deployer", MatchType: MatchRegex},
+			want:    false,
+		},
+		{
+			name:    "regex, matches",
+			pattern: Pattern{Pattern: "system:serviceaccount:(ci|cd):.+", MatchType: MatchRegex},
+			want:    true,
+		},
+		{
+			name:    "invalid regex, failure",
+			pattern: Pattern{Pattern: "[[", MatchType: MatchRegex},
+			wantErr: true,
+		},
+		{
+			name:    "invalid match type, failure",
+			pattern: Pattern{Pattern: "deployer", MatchType: "fuzzy"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := FilterBySubjectPattern(tt.pattern)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, filter(roleBinding), "response did not match expectation")
+		})
+	}
+}
+
+func TestFiltersBySubjectNames(t *testing.T) {
+	roleBinding := v1.RoleBinding{
+		Subjects: []v1.Subject{{
+			Kind: v1.GroupKind,
+			Name: "team-abc",
+		}},
+	}
+	tests := []struct {
+		name        string
+		subjectName string
+		want        bool
+	}{
+		{
+			name:        "plain name, matches exactly",
+			subjectName: "team-abc",
+			want:        true,
+		},
+		{
+			name:        "plain name, does not match longer name",
+			subjectName: "team-a",
+			want:        false,
+		},
+		{
+			name:        "regular expression, matches whole name",
+			subjectName: "team-a.*",
+			want:        true,
+		},
+		{
+			name:        "regular expression, does not match part of the name",
+			subjectName: "a-b",
+			want:        false,
+		},
+		{
+			name:        "alternation, anchored as a whole",
+			subjectName: "team-x|team-abc",
+			want:        true,
+		},
+		{
+			name:        "alternation, does not match part of the name",
+			subjectName: "team-abc-x|team",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := FiltersBySubjectNames([]string{tt.subjectName})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, matchesAny(roleBinding, filters), "response did not match expectation")
+		})
+	}
+}
+
+func TestFilterByExpression(t *testing.T) {
+	tests := []struct {
+		name        string
+		expression  string
+		roleBinding v1.RoleBinding
+		want        bool
+		wantErr     string
+	}{
+		{
+			name:        "subjects, matches",
+			expression:  `binding.subjects.exists(s, s.name == "subject1")`,
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			want:        true,
+		},
+		{
+			name:        "role ref and group subjects, does not match",
+			expression:  `binding.roleRef.kind == "ClusterRole" && binding.subjects.exists(s, s.kind == "Group")`,
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			want:        false,
+		},
+		{
+			name:        "cluster role binding kind, matches",
+			expression:  `binding.kind == "ClusterRoleBinding" && binding.roleRef.name == "clusterrole1"`,
+			roleBinding: roleBindingFromClusterRoleBinding(fixtures.ClusterRoleBindingClusterRole1Subject1),
+			want:        true,
+		},
+		{
+			name:        "missing label, does not match",
+			expression:  `binding.labels["team"] == "a"`,
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			want:        false,
+		},
+		{
+			name:        "matches, matches",
+			expression:  `binding.subjects.exists(s, s.name.matches("^subject[0-9]$"))`,
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			want:        true,
+		},
+		{
+			name:        "non constant matches pattern over the limits, does not match",
+			expression:  `binding.name.matches(binding.name + "|` + strings.Repeat("a", 2000) + `")`,
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			want:        false,
+		},
+		{
+			name:       "invalid matches pattern, failure",
+			expression: `binding.subjects.exists(s, s.name.matches("subject("))`,
+			wantErr:    `invalid regular expression "subject("`,
+		},
+		{
+			name:       "matches pattern over the limits, failure",
+			expression: `binding.name.matches("` + strings.Repeat("a", 2000) + `")`,
+			wantErr:    "regular expression is too long",
+		},
+		{
+			name:       "undefined field, failure",
+			expression: `binding.subject.exists(s, s.name == "subject1")`,
+			wantErr:    "undefined field 'subject'",
+		},
+		{
+			name:       "not a bool, failure",
+			expression: `binding.name`,
+			wantErr:    "must evaluate to bool",
+		},
+		{
+			name:       "too expensive, failure",
+			expression: `binding.subjects.exists(s, binding.subjects.exists(o, o.name == s.name))`,
+			wantErr:    "too expensive",
+		},
+		{
+			name:       "too long, failure",
+			expression: strings.Repeat(" ", MaxExpressionLength+1) + "true",
+			wantErr:    "longer than",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := FilterByExpression(tt.expression)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, filter(tt.roleBinding), "response did not match expectation")
+		})
+	}
+}
+
+func TestMetadataFilters(t *testing.T) {
+	now := time.Now()
+	roleBinding := v1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "admin-for-team-a",
+			Namespace: nsDefault,
+			Labels: map[string]string{
+				"team": "a",
+				"env":  "prod",
+			},
+			Annotations: map[string]string{
+				"owner": "team-a@example.com",
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				Kind: "Namespace",
+				Name: "default",
+			}},
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+		},
+		RoleRef: v1.RoleRef{
+			Kind: KindClusterRole,
+			Name: "admin",
+		},
+	}
+	mustFilter := func(filter RoleBindingFilter, err error) RoleBindingFilter {
+		require.NoError(t, err)
+		return filter
+	}
+	mustSelector := func(selector string) labels.Selector {
+		s, err := labels.Parse(selector)
+		require.NoError(t, err)
+		return s
+	}
+	tests := []struct {
+		name   string
+		filter RoleBindingFilter
+		want   bool
+	}{
+		{
+			name:   "role ref kind and name, matches",
+			filter: mustFilter(FilterByRoleRef(KindClusterRole, Pattern{Pattern: "admin"})),
+			want:   true,
+		},
+		{
+			name:   "role ref any kind and glob, matches",
+			filter: mustFilter(FilterByRoleRef("", Pattern{Pattern: "adm*", MatchType: MatchGlob})),
+			want:   true,
+		},
+		{
+			name:   "role ref different kind, does not match",
+			filter: mustFilter(FilterByRoleRef(KindRole, Pattern{Pattern: "admin"})),
+			want:   false,
+		},
+		{
+			name:   "label selector, matches",
+			filter: FilterByLabelSelector(mustSelector("team=a,env in (prod,staging)")),
+			want:   true,
+		},
+		{
+			name:   "label selector, does not match",
+			filter: FilterByLabelSelector(mustSelector("team!=a")),
+			want:   false,
+		},
+		{
+			name:   "annotations, matches",
+			filter: FilterByAnnotations(map[string]string{"owner": "team-a@example.com"}),
+			want:   true,
+		},
+		{
+			name:   "annotations, different value, does not match",
+			filter: FilterByAnnotations(map[string]string{"owner": "team-b@example.com"}),
+			want:   false,
+		},
+		{
+			name:   "owner kind, matches",
+			filter: FilterByOwner("Namespace", ""),
+			want:   true,
+		},
+		{
+			name:   "owner kind and name, does not match",
+			filter: FilterByOwner("Namespace", "kube-system"),
+			want:   false,
+		},
+		{
+			name:   "created in the last day, matches",
+			filter: FilterByCreationTimestamp(now.Add(-24*time.Hour), time.Time{}),
+			want:   true,
+		},
+		{
+			name:   "created in the last minute, does not match",
+			filter: FilterByCreationTimestamp(now.Add(-time.Minute), time.Time{}),
+			want:   false,
+		},
+		{
+			name:   "created before two hours ago, does not match",
+			filter: FilterByCreationTimestamp(time.Time{}, now.Add(-2*time.Hour)),
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter(roleBinding), "response did not match expectation")
+		})
+	}
+}
+
+func TestFilterByPermissions(t *testing.T) {
+	roles := map[Key][]v1.PolicyRule{
+		{Kind: KindRole, Namespace: nsDefault, Name: "role1"}: {{
+			APIGroups: []string{"apps"},
+			Resources: []string{"*"},
+			Verbs:     []string{"delete", "get"},
+		}},
+		{Kind: KindClusterRole, Name: "clusterrole1"}: {{
+			NonResourceURLs: []string{"/metrics"},
+			Verbs:           []string{"get"},
+		}},
+	}
+	roleBindingClusterRole1 := fixtures.RoleBindingRole1Subject1
+	roleBindingClusterRole1.RoleRef = fixtures.ClusterRoleBindingClusterRole1Subject1.RoleRef
+	tests := []struct {
+		name        string
+		roleBinding v1.RoleBinding
+		attributes  []Attributes
+		want        bool
+	}{
+		{
+			name:        "wildcard resource, matches",
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			attributes:  []Attributes{{Verb: "delete", APIGroup: "apps", Resource: "deployments"}},
+			want:        true,
+		},
+		{
+			name:        "all of the permissions, matches",
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			attributes: []Attributes{
+				{Verb: "delete", APIGroup: "apps", Resource: "deployments"},
+				{Verb: "get", APIGroup: "apps", Resource: "replicasets"},
+			},
+			want: true,
+		},
+		{
+			name:        "one of the permissions, does not match",
+			roleBinding: fixtures.RoleBindingRole1Subject1,
+			attributes: []Attributes{
+				{Verb: "delete", APIGroup: "apps", Resource: "deployments"},
+				{Verb: "create", APIGroup: "apps", Resource: "deployments"},
+			},
+			want: false,
+		},
+		{
+			name:        "missing role, does not match",
+			roleBinding: fixtures.RoleBindingRole2Subject2,
+			attributes:  []Attributes{{Verb: "get", APIGroup: "apps", Resource: "deployments"}},
+			want:        false,
+		},
+		{
+			name:        "non-resource url through cluster role binding, matches",
+			roleBinding: roleBindingFromClusterRoleBinding(fixtures.ClusterRoleBindingClusterRole1Subject1),
+			attributes:  []Attributes{{Verb: "get", NonResourceURL: "/metrics"}},
+			want:        true,
+		},
+		{
+			name:        "non-resource url through role binding, does not match",
+			roleBinding: roleBindingClusterRole1,
+			attributes:  []Attributes{{Verb: "get", NonResourceURL: "/metrics"}},
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FilterByPermissions(roles, tt.attributes...)(tt.roleBinding)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+		})
+	}
+}
+
+func TestState_WhoCan(t *testing.T) {
+	state := State{
+		Roles: []v1.Role{{
+			ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: nsDefault},
+			Rules: []v1.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get"},
+			}},
+		}, {
+			ObjectMeta: metav1.ObjectMeta{Name: "role3", Namespace: nsDefault},
+			Rules: []v1.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"pods", "secrets"},
+				Verbs:     []string{"get"},
+			}},
+		}},
+		ClusterRoles: []v1.ClusterRole{{
+			ObjectMeta: metav1.ObjectMeta{Name: "clusterrole1"},
+			Rules: []v1.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"*"},
+			}, {
+				NonResourceURLs: []string{"/metrics"},
+				Verbs:           []string{"get"},
+			}},
+		}},
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+			fixtures.RoleBindingRole3Subject3and4,
+		},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{
+			fixtures.ClusterRoleBindingClusterRole1Subject1,
+		},
+	}
+	roleBinding1 := Key{Kind: KindRoleBinding, Namespace: nsDefault, Name: "role1-for-subject1"}
+	roleBinding3 := Key{Kind: KindRoleBinding, Namespace: nsDefault, Name: "role3-for-subject3and4"}
+	clusterRoleBinding1 := Key{Kind: KindClusterRoleBinding, Name: "clusterrole1-for-subject1"}
+	tests := []struct {
+		name       string
+		namespace  string
+		attributes Attributes
+		want       []SubjectBindings
+	}{
+		{
+			name:       "role bindings and cluster role bindings",
+			namespace:  nsDefault,
+			attributes: Attributes{Verb: "get", Resource: "pods"},
+			want: []SubjectBindings{
+				{Subject: SubjectKey{Name: "subject4"}, Bindings: []Key{roleBinding3}},
+				{Subject: SubjectKey{Kind: "User", Name: "subject1"}, Bindings: []Key{clusterRoleBinding1, roleBinding1}},
+				{Subject: SubjectKey{Kind: "User", Name: "subject3"}, Bindings: []Key{roleBinding3}},
+			},
+		},
+		{
+			name:       "other namespace, only cluster role bindings",
+			namespace:  "other",
+			attributes: Attributes{Verb: "get", Resource: "pods"},
+			want: []SubjectBindings{
+				{Subject: SubjectKey{Kind: "User", Name: "subject1"}, Bindings: []Key{clusterRoleBinding1}},
+			},
+		},
+		{
+			name:       "non-resource url, only cluster role bindings",
+			namespace:  nsDefault,
+			attributes: Attributes{Verb: "get", NonResourceURL: "/metrics"},
+			want: []SubjectBindings{
+				{Subject: SubjectKey{Kind: "User", Name: "subject1"}, Bindings: []Key{clusterRoleBinding1}},
+			},
+		},
+		{
+			name:       "nobody",
+			namespace:  nsDefault,
+			attributes: Attributes{Verb: "delete", Resource: "secrets"},
+			want:       []SubjectBindings{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := state.WhoCan(tt.namespace, tt.attributes)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+
+			// the same subjects and bindings are called back one at a time
+			each := map[SubjectKey][]Key{}
+			err := state.EachWhoCan(tt.namespace, tt.attributes, func(subject SubjectKey, binding Key) error {
+				each[subject] = append(each[subject], binding)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Len(t, each, len(tt.want))
+			for _, subject := range tt.want {
+				assert.Equal(t, subject.Bindings, each[subject.Subject], "bindings did not match expectation")
+			}
+		})
+	}
+
+	// stops at the first error
+	calls := 0
+	err := state.EachWhoCan(nsDefault, Attributes{Verb: "get", Resource: "pods"}, func(SubjectKey, Key) error {
+		calls++
+		return errors.New("some error")
+	})
+	assert.EqualError(t, err, "some error")
+	assert.Equal(t, 1, calls)
+}
+
+func TestRegexpCompiler_Compile(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr error
+	}{
+		{
+			name: "within limits, success",
+			expr: "subject[0-9]+",
+		},
+		{
+			name:    "too long, failure",
+			expr:    strings.Repeat("a", 33),
+			wantErr: ErrRegexpTooLong,
+		},
+		{
+			name:    "too complex, failure",
+			expr:    "(a{10}){10}",
+			wantErr: ErrRegexpTooComplex,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewRegexpCompiler(RegexpLimits{
+				MaxLength:      32,
+				MaxProgramSize: 50,
+				CacheSize:      10,
+			})
+			got, err := c.Compile(tt.expr)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "unexpected error %v", err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expr, got.String())
+		})
+	}
+}
+
+func TestRegexpCompiler_cache(t *testing.T) {
+	c := NewRegexpCompiler(RegexpLimits{CacheSize: 2})
+
+	a, err := c.Compile("a+")
+	require.NoError(t, err)
+	b, err := c.Compile("b+")
+	require.NoError(t, err)
+
+	// cached regular expressions are reused, the least recently used one is
+	// evicted
+	again, err := c.Compile("a+")
+	require.NoError(t, err)
+	assert.True(t, a == again, "a+ was not cached")
+	_, err = c.Compile("c+")
+	require.NoError(t, err)
+	again, err = c.Compile("b+")
+	require.NoError(t, err)
+	assert.False(t, b == again, "b+ was not evicted")
+
+	// changing the limits forgets compiled regular expressions
+	c.SetLimits(RegexpLimits{MaxLength: 1, CacheSize: 2})
+	_, err = c.Compile("a+")
+	assert.True(t, errors.Is(err, ErrRegexpTooLong), "unexpected error %v", err)
+}
+
+func TestFiltersBySubjectPatterns_PatternError(t *testing.T) {
+	_, err := FiltersBySubjectPatterns([]Pattern{
+		{Pattern: "subject1"},
+		{Pattern: strings.Repeat("a", DefaultMaxRegexpLength+1), MatchType: MatchGlob},
+	})
+	patternErr := &PatternError{}
+	require.True(t, errors.As(err, &patternErr), "unexpected error %v", err)
+	assert.Equal(t, 1, patternErr.Index)
+	assert.True(t, errors.Is(err, ErrRegexpTooLong), "unexpected error %v", err)
+	assert.Equal(t, `invalid glob "`+strings.Repeat("a", 64)+`"...: regular expression is too long, 1025 bytes is more than 1024`, err.Error())
+}
@@ -0,0 +1,173 @@
+package rbac
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sync"
+)
+
+const (
+	// DefaultMaxRegexpLength is the default maximum length of regular
+	// expressions and globs, in bytes
+	DefaultMaxRegexpLength = 1024
+	// DefaultMaxRegexpProgramSize is the default maximum number of
+	// instructions regular expressions can compile to
+	DefaultMaxRegexpProgramSize = 10000
+	// DefaultRegexpCacheSize is the default number of compiled regular
+	// expressions that are kept
+	DefaultRegexpCacheSize = 1000
+
+	// maxQuotedLength is how much of a pattern is quoted in errors, so that
+	// long patterns aren't echoed back in full
+	maxQuotedLength = 64
+)
+
+var (
+	// ErrRegexpTooLong is returned when a regular expression or glob is
+	// longer than allowed
+	ErrRegexpTooLong = errors.New("regular expression is too long")
+	// ErrRegexpTooComplex is returned when a regular expression compiles to
+	// a larger program than allowed
+	ErrRegexpTooComplex = errors.New("regular expression is too complex")
+
+	// regexps compiles the regular expressions of filters
+	regexps = NewRegexpCompiler(RegexpLimits{
+		MaxLength:      DefaultMaxRegexpLength,
+		MaxProgramSize: DefaultMaxRegexpProgramSize,
+		CacheSize:      DefaultRegexpCacheSize,
+	})
+)
+
+type (
+	// RegexpLimits bound the regular expressions that can be compiled, and
+	// how many compiled ones are kept, zero for no limit or no cache
+	RegexpLimits struct {
+		MaxLength      int
+		MaxProgramSize int
+		CacheSize      int
+	}
+	// RegexpCompiler compiles regular expressions within limits, and keeps
+	// the most recently used ones so they aren't compiled for every request
+	RegexpCompiler struct {
+		mutex   sync.Mutex
+		limits  RegexpLimits
+		recent  *list.List
+		entries map[string]*list.Element
+	}
+	// compiledRegexp is a cached regular expression
+	compiledRegexp struct {
+		expr   string
+		regexp *regexp.Regexp
+	}
+	// PatternError is returned when one of many patterns is invalid, with
+	// its index
+	PatternError struct {
+		Index int
+		Err   error
+	}
+)
+
+// NewRegexpCompiler given the limits of the regular expressions it compiles
+func NewRegexpCompiler(limits RegexpLimits) *RegexpCompiler {
+	return &RegexpCompiler{
+		limits:  limits,
+		recent:  list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// SetRegexpLimits changes the limits of the regular expressions of filters,
+// and how many compiled ones are kept
+func SetRegexpLimits(limits RegexpLimits) {
+	regexps.SetLimits(limits)
+}
+
+// SetLimits changes the limits, forgetting the compiled regular expressions
+// since they were checked against the previous ones
+func (c *RegexpCompiler) SetLimits(limits RegexpLimits) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.limits = limits
+	c.recent.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// Compile compiles the regular expression if it's within the limits
+func (c *RegexpCompiler) Compile(expr string) (*regexp.Regexp, error) {
+	return c.compile(expr, expr)
+}
+
+// compile compiles the regular expression constructed from the pattern, the
+// pattern's length and the expression's program size have to be within the
+// limits
+func (c *RegexpCompiler) compile(pattern, expr string) (*regexp.Regexp, error) {
+	c.mutex.Lock()
+	limits := c.limits
+	if element, ok := c.entries[expr]; ok {
+		c.recent.MoveToFront(element)
+		c.mutex.Unlock()
+		return element.Value.(*compiledRegexp).regexp, nil
+	}
+	c.mutex.Unlock()
+
+	// check the limits before compiling
+	if limits.MaxLength > 0 && len(pattern) > limits.MaxLength {
+		return nil, fmt.Errorf("%w, %d bytes is more than %d", ErrRegexpTooLong, len(pattern), limits.MaxLength)
+	}
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxProgramSize > 0 {
+		program, err := syntax.Compile(parsed.Simplify())
+		if err != nil {
+			return nil, err
+		}
+		if len(program.Inst) > limits.MaxProgramSize {
+			return nil, fmt.Errorf("%w, %d instructions is more than %d", ErrRegexpTooComplex, len(program.Inst), limits.MaxProgramSize)
+		}
+	}
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.limits != limits || c.limits.CacheSize <= 0 {
+		return compiled, nil
+	}
+	if _, ok := c.entries[expr]; !ok {
+		c.entries[expr] = c.recent.PushFront(&compiledRegexp{
+			expr:   expr,
+			regexp: compiled,
+		})
+		for c.recent.Len() > c.limits.CacheSize {
+			oldest := c.recent.Back()
+			c.recent.Remove(oldest)
+			delete(c.entries, oldest.Value.(*compiledRegexp).expr)
+		}
+	}
+	return compiled, nil
+}
+
+// Error returns the error of the pattern
+func (e *PatternError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the pattern
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// quote quotes the pattern for errors, shortening it if it's long
+func quote(pattern string) string {
+	if len(pattern) > maxQuotedLength {
+		return fmt.Sprintf("%q...", pattern[:maxQuotedLength])
+	}
+	return fmt.Sprintf("%q", pattern)
+}
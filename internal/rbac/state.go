@@ -0,0 +1,269 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// ErrStatic is returned by static enumerators for operations that need a
+	// live cluster
+	ErrStatic = errors.New("not supported on static rbac state")
+)
+
+type (
+	// State holds the full RBAC graph of a cluster, across all namespaces
+	State struct {
+		Roles               []v1.Role               `json:"roles" yaml:"roles"`
+		ClusterRoles        []v1.ClusterRole        `json:"clusterRoles" yaml:"clusterRoles"`
+		RoleBindings        []v1.RoleBinding        `json:"roleBindings" yaml:"roleBindings"`
+		ClusterRoleBindings []v1.ClusterRoleBinding `json:"clusterRoleBindings" yaml:"clusterRoleBindings"`
+	}
+	// staticEnumerator implements the Enumerator interface on top of a State
+	// that never changes, for example a snapshot
+	staticEnumerator struct {
+		state State
+	}
+)
+
+// State retrieves the roles, cluster roles, role bindings and cluster role
+// bindings of all namespaces
+func (e *enumerator) State() (*State, error) {
+	listOptions := metav1.ListOptions{}
+
+	roles, err := e.listRoles("", listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	clusterRoles, err := e.listClusterRoles(listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster roles: %w", err)
+	}
+
+	roleBindings, err := e.listRoleBindings("", listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role bindings: %w", err)
+	}
+
+	clusterRoleBindings, err := e.listClusterRoleBindings(listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster role bindings: %w", err)
+	}
+
+	return &State{
+		Roles:               roles.Items,
+		ClusterRoles:        clusterRoles.Items,
+		RoleBindings:        roleBindings.Items,
+		ClusterRoleBindings: clusterRoleBindings.Items,
+	}, nil
+}
+
+// NamespaceState retrieves the roles and role bindings of the namespace, and
+// only the cluster roles its role bindings refer to along with the cluster
+// roles aggregated into them, which is enough to resolve the rules of the
+// namespace's role bindings without listing the whole cluster
+func (e *enumerator) NamespaceState(namespace string) (*State, error) {
+	listOptions := metav1.ListOptions{}
+
+	roles, err := e.listRoles(namespace, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	roleBindings, err := e.listRoleBindings(namespace, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role bindings: %w", err)
+	}
+
+	clusterRoles, err := e.referencedClusterRoles(roleBindings.Items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster roles: %w", err)
+	}
+
+	return &State{
+		Roles:               roles.Items,
+		ClusterRoles:        clusterRoles,
+		RoleBindings:        roleBindings.Items,
+		ClusterRoleBindings: []v1.ClusterRoleBinding{},
+	}, nil
+}
+
+// ClusterState retrieves the cluster roles and cluster role bindings, which
+// is enough to resolve the permissions granted cluster-wide without listing
+// the roles and role bindings of every namespace
+func (e *enumerator) ClusterState() (*State, error) {
+	listOptions := metav1.ListOptions{}
+
+	clusterRoles, err := e.listClusterRoles(listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster roles: %w", err)
+	}
+
+	clusterRoleBindings, err := e.listClusterRoleBindings(listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster role bindings: %w", err)
+	}
+
+	return &State{
+		Roles:               []v1.Role{},
+		ClusterRoles:        clusterRoles.Items,
+		RoleBindings:        []v1.RoleBinding{},
+		ClusterRoleBindings: clusterRoleBindings.Items,
+	}, nil
+}
+
+// PermissionsState retrieves what grants permissions in the namespace, its
+// roles and role bindings along with the cluster roles and cluster role
+// bindings, or only the cluster roles and cluster role bindings if the
+// namespace is empty. Permissions granted in other namespaces are left out.
+func PermissionsState(e Enumerator, namespace string) (*State, error) {
+	state, err := e.ClusterState()
+	if err != nil || namespace == "" {
+		return state, err
+	}
+	namespaceState, err := e.NamespaceState(namespace)
+	if err != nil {
+		return nil, err
+	}
+	state.Roles = namespaceState.Roles
+	state.RoleBindings = namespaceState.RoleBindings
+	return state, nil
+}
+
+// referencedClusterRoles gets the cluster roles the role bindings refer to,
+// and lists the cluster roles aggregated into them by their aggregation
+// rules' selectors, including aggregates of aggregates
+func (e *enumerator) referencedClusterRoles(roleBindings []v1.RoleBinding) ([]v1.ClusterRole, error) {
+	seen := map[string]bool{}
+	pending := []v1.ClusterRole{}
+	for _, roleBinding := range roleBindings {
+		name := roleBinding.RoleRef.Name
+		if roleRefKind(roleBinding.RoleRef) != KindClusterRole || seen[name] {
+			continue
+		}
+		seen[name] = true
+		clusterRole, err := e.client.ClusterRoles().Get(name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			// bindings to missing cluster roles grant nothing
+			continue
+		case err != nil:
+			return nil, err
+		}
+		pending = append(pending, *clusterRole)
+	}
+
+	clusterRoles := []v1.ClusterRole{}
+	selectors := map[string]bool{}
+	for len(pending) > 0 {
+		clusterRole := pending[0]
+		pending = pending[1:]
+		clusterRoles = append(clusterRoles, clusterRole)
+		if clusterRole.AggregationRule == nil {
+			continue
+		}
+		for _, labelSelector := range clusterRole.AggregationRule.ClusterRoleSelectors {
+			// invalid selectors select nothing
+			selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+			if err != nil || selectors[selector.String()] {
+				continue
+			}
+			selectors[selector.String()] = true
+			aggregated, err := e.listClusterRoles(metav1.ListOptions{
+				LabelSelector: selector.String(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, other := range aggregated.Items {
+				if !seen[other.Name] {
+					seen[other.Name] = true
+					pending = append(pending, other)
+				}
+			}
+		}
+	}
+	return clusterRoles, nil
+}
+
+// NewStatic given a State returns an Enumerator that only knows about it,
+// operations that need a live cluster return ErrStatic
+func NewStatic(state State) Enumerator {
+	return &staticEnumerator{
+		state: state,
+	}
+}
+
+// EnumberateByRoleBindings returns the state's role bindings in the given
+// namespace, or all namespaces if empty, that match the given filters
+func (e *staticEnumerator) EnumberateByRoleBindings(namespace string, filters ...RoleBindingFilter) ([]v1.RoleBinding, error) {
+	filteredRoleBindings := []v1.RoleBinding{}
+	for _, roleBinding := range e.state.RoleBindings {
+		if namespace != "" && roleBinding.Namespace != namespace {
+			continue
+		}
+		if matchesAny(roleBinding, filters) {
+			filteredRoleBindings = append(filteredRoleBindings, roleBinding)
+		}
+	}
+	return filteredRoleBindings, nil
+}
+
+// WatchRoleBindings is not supported as the state never changes
+func (e *staticEnumerator) WatchRoleBindings(
+	ctx context.Context,
+	namespace string,
+	resourceVersions ResourceVersions,
+	filters ...RoleBindingFilter,
+) (<-chan Event, error) {
+	return nil, ErrStatic
+}
+
+// LatestResourceVersions is not supported as the state never changes
+func (e *staticEnumerator) LatestResourceVersions(namespace string) (ResourceVersions, error) {
+	return ResourceVersions{}, ErrStatic
+}
+
+// State returns the enumerator's state
+func (e *staticEnumerator) State() (*State, error) {
+	state := e.state
+	return &state, nil
+}
+
+// NamespaceState returns the state's roles and role bindings in the given
+// namespace, and all of its cluster roles
+func (e *staticEnumerator) NamespaceState(namespace string) (*State, error) {
+	state := State{
+		Roles:               []v1.Role{},
+		ClusterRoles:        e.state.ClusterRoles,
+		RoleBindings:        []v1.RoleBinding{},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{},
+	}
+	for _, role := range e.state.Roles {
+		if role.Namespace == namespace {
+			state.Roles = append(state.Roles, role)
+		}
+	}
+	for _, roleBinding := range e.state.RoleBindings {
+		if roleBinding.Namespace == namespace {
+			state.RoleBindings = append(state.RoleBindings, roleBinding)
+		}
+	}
+	return &state, nil
+}
+
+// ClusterState returns the state's cluster roles and cluster role bindings
+func (e *staticEnumerator) ClusterState() (*State, error) {
+	return &State{
+		Roles:               []v1.Role{},
+		ClusterRoles:        e.state.ClusterRoles,
+		RoleBindings:        []v1.RoleBinding{},
+		ClusterRoleBindings: e.state.ClusterRoleBindings,
+	}, nil
+}
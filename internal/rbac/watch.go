@@ -0,0 +1,328 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	// KindRoleBinding is the kind of namespaced role bindings
+	KindRoleBinding = "RoleBinding"
+	// KindClusterRoleBinding is the kind of cluster role bindings
+	KindClusterRoleBinding = "ClusterRoleBinding"
+)
+
+type (
+	// Event describes a change to a role binding or cluster role binding that
+	// matched the watch's filters
+	Event struct {
+		// Type is one of ADDED, MODIFIED, DELETED or ERROR
+		Type watch.EventType `json:"type" yaml:"type"`
+		// Kind is either RoleBinding or ClusterRoleBinding
+		Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+		// RoleBinding that changed, cluster role bindings are represented as
+		// role bindings without a namespace
+		RoleBinding *v1.RoleBinding `json:"roleBinding,omitempty" yaml:"roleBinding,omitempty"`
+		// ResourceVersions the watch can be resumed from after this event
+		ResourceVersions ResourceVersions `json:"resourceVersions" yaml:"resourceVersions"`
+		// Error is only set for ERROR events, after which the watch ends
+		Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	}
+	// ResourceVersions holds the last seen resource versions of the role
+	// bindings and cluster role bindings, used to resume watches
+	ResourceVersions struct {
+		RoleBindings        string `json:"roleBindings,omitempty" yaml:"roleBindings,omitempty"`
+		ClusterRoleBindings string `json:"clusterRoleBindings,omitempty" yaml:"clusterRoleBindings,omitempty"`
+	}
+)
+
+// WatchRoleBindings watches the role bindings of the given namespace as well
+// as the cluster role bindings, and emits an event for every change to a
+// binding that matches any of the given filters. Bindings that stop matching
+// are emitted as DELETED, since they no longer bind the watched subjects, as
+// are the first changes to bindings that don't match after resuming.
+// Empty resource versions start the watch with an ADDED event for every
+// existing binding, use LatestResourceVersions to only watch for new changes.
+// The returned channel is closed when the context is done or the watch
+// fails, in which case an ERROR event is emitted first.
+func (e *enumerator) WatchRoleBindings(
+	ctx context.Context,
+	namespace string,
+	resourceVersions ResourceVersions,
+	filters ...RoleBindingFilter,
+) (<-chan Event, error) {
+	// list the bindings to know which of them already match, and to start
+	// watching from the lists' resource versions rather than from scratch,
+	// so that resumed watches don't emit every existing binding again.
+	// Resumed watches don't know which bindings matched when the previous
+	// watch ended, since the lists are of the bindings now, so the
+	// bindings of resumed kinds are only known to match once there's an
+	// event for them.
+	roleBindings, err := e.listRoleBindings(namespace, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role bindings: %w", err)
+	}
+	clusterRoleBindings, err := e.listClusterRoleBindings(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster role bindings: %w", err)
+	}
+	resumed := map[string]bool{
+		KindRoleBinding:        resourceVersions.RoleBindings != "",
+		KindClusterRoleBinding: resourceVersions.ClusterRoleBindings != "",
+	}
+	matched := map[string]bool{}
+	initial := []Event{}
+	if !resumed[KindRoleBinding] {
+		for _, roleBinding := range roleBindings.Items {
+			if matchesAny(roleBinding, filters) {
+				matched[bindingKey(KindRoleBinding, roleBinding)] = true
+				initial = append(initial, addedEvent(KindRoleBinding, roleBinding))
+			}
+		}
+	}
+	if !resumed[KindClusterRoleBinding] {
+		for _, clusterRoleBinding := range clusterRoleBindings.Items {
+			roleBinding := roleBindingFromClusterRoleBinding(clusterRoleBinding)
+			if matchesAny(roleBinding, filters) {
+				matched[bindingKey(KindClusterRoleBinding, roleBinding)] = true
+				initial = append(initial, addedEvent(KindClusterRoleBinding, roleBinding))
+			}
+		}
+	}
+	// the initial events can be resumed from the previous resource versions,
+	// only the last one is resumed from the lists' ones so that resuming
+	// part way doesn't miss any of them
+	for i := range initial {
+		initial[i].ResourceVersions = resourceVersions
+	}
+	if resourceVersions.RoleBindings == "" {
+		resourceVersions.RoleBindings = roleBindings.ResourceVersion
+	}
+	if resourceVersions.ClusterRoleBindings == "" {
+		resourceVersions.ClusterRoleBindings = clusterRoleBindings.ResourceVersion
+	}
+	if len(initial) > 0 {
+		initial[len(initial)-1].ResourceVersions = resourceVersions
+	}
+
+	// both watches are started before returning so callers can rely on not
+	// missing any changes that happen after this returns
+	roleBindingsWatch, err := e.watchRoleBindings(namespace, resourceVersions.RoleBindings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch role bindings: %w", err)
+	}
+	clusterRoleBindingsWatch, err := e.watchClusterRoleBindings(resourceVersions.ClusterRoleBindings)
+	if err != nil {
+		roleBindingsWatch.Stop()
+		return nil, fmt.Errorf("failed to watch cluster role bindings: %w", err)
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer func() {
+			// either watch might have failed to resume
+			if roleBindingsWatch != nil {
+				roleBindingsWatch.Stop()
+			}
+			if clusterRoleBindingsWatch != nil {
+				clusterRoleBindingsWatch.Stop()
+			}
+		}()
+
+		// send emits an event unless the context is done, returns whether
+		// the watch should keep going
+		send := func(event Event) bool {
+			select {
+			case events <- event:
+				return event.Type != watch.Error
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, event := range initial {
+			if !send(event) {
+				return
+			}
+		}
+
+		for {
+			var (
+				watchEvent watch.Event
+				ok         bool
+			)
+			select {
+			case <-ctx.Done():
+				return
+			case watchEvent, ok = <-roleBindingsWatch.ResultChan():
+				if !ok {
+					// the api server closes watches periodically, resume
+					// from the last resource version we have seen
+					roleBindingsWatch, err = e.watchRoleBindings(namespace, resourceVersions.RoleBindings)
+					if err != nil {
+						send(errorEvent(resourceVersions, fmt.Errorf("failed to resume role bindings watch: %w", err)))
+						return
+					}
+					continue
+				}
+			case watchEvent, ok = <-clusterRoleBindingsWatch.ResultChan():
+				if !ok {
+					clusterRoleBindingsWatch, err = e.watchClusterRoleBindings(resourceVersions.ClusterRoleBindings)
+					if err != nil {
+						send(errorEvent(resourceVersions, fmt.Errorf("failed to resume cluster role bindings watch: %w", err)))
+						return
+					}
+					continue
+				}
+			}
+
+			if watchEvent.Type == watch.Error {
+				send(errorEvent(resourceVersions, apierrors.FromObject(watchEvent.Object)))
+				return
+			}
+
+			roleBinding, kind, resourceVersion, ok := toRoleBinding(watchEvent.Object)
+			if !ok {
+				continue
+			}
+
+			// keep track of the latest resource versions, including the
+			// ones we get from bookmarks
+			switch kind {
+			case KindRoleBinding:
+				resourceVersions.RoleBindings = resourceVersion
+			case KindClusterRoleBinding:
+				resourceVersions.ClusterRoleBindings = resourceVersion
+			}
+
+			if watchEvent.Type == watch.Bookmark {
+				continue
+			}
+
+			// bindings that stop matching are deleted as far as the
+			// watched subjects are concerned. Bindings of resumed kinds
+			// without an event yet might have matched before the watch was
+			// resumed, such as when it is resumed across the change that
+			// made them stop matching, so they are deleted too.
+			eventType := watchEvent.Type
+			key := bindingKey(kind, roleBinding)
+			wasMatched, known := matched[key]
+			if !known {
+				wasMatched = resumed[kind]
+			}
+			matches := matchesAny(roleBinding, filters)
+			switch {
+			case !matches && !wasMatched:
+				matched[key] = false
+				continue
+			case !matches, eventType == watch.Deleted:
+				eventType = watch.Deleted
+				matched[key] = false
+			default:
+				matched[key] = true
+			}
+
+			if !send(Event{
+				Type:             eventType,
+				Kind:             kind,
+				RoleBinding:      &roleBinding,
+				ResourceVersions: resourceVersions,
+			}) {
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// LatestResourceVersions returns the current resource versions of the
+// namespace's role bindings and the cluster role bindings, allowing watches
+// to start without first receiving every existing binding
+func (e *enumerator) LatestResourceVersions(namespace string) (ResourceVersions, error) {
+	// we only care about the list's metadata
+	listOptions := metav1.ListOptions{
+		Limit: 1,
+	}
+	roleBindings, err := e.listRoleBindings(namespace, listOptions)
+	if err != nil {
+		return ResourceVersions{}, fmt.Errorf("failed to get role bindings: %w", err)
+	}
+	clusterRoleBindings, err := e.listClusterRoleBindings(listOptions)
+	if err != nil {
+		return ResourceVersions{}, fmt.Errorf("failed to get cluster role bindings: %w", err)
+	}
+	return ResourceVersions{
+		RoleBindings:        roleBindings.ResourceVersion,
+		ClusterRoleBindings: clusterRoleBindings.ResourceVersion,
+	}, nil
+}
+
+// watchRoleBindings starts a watch on the namespace's role bindings
+func (e *enumerator) watchRoleBindings(namespace, resourceVersion string) (watch.Interface, error) {
+	return e.client.RoleBindings(namespace).Watch(metav1.ListOptions{
+		ResourceVersion:     resourceVersion,
+		AllowWatchBookmarks: true,
+	})
+}
+
+// watchClusterRoleBindings starts a watch on the cluster role bindings
+func (e *enumerator) watchClusterRoleBindings(resourceVersion string) (watch.Interface, error) {
+	return e.client.ClusterRoleBindings().Watch(metav1.ListOptions{
+		ResourceVersion:     resourceVersion,
+		AllowWatchBookmarks: true,
+	})
+}
+
+// errorEvent constructs an ERROR event for the given error
+func errorEvent(resourceVersions ResourceVersions, err error) Event {
+	return Event{
+		Type:             watch.Error,
+		ResourceVersions: resourceVersions,
+		Error:            err.Error(),
+	}
+}
+
+// addedEvent constructs an ADDED event for an existing binding
+func addedEvent(kind string, roleBinding v1.RoleBinding) Event {
+	return Event{
+		Type:        watch.Added,
+		Kind:        kind,
+		RoleBinding: &roleBinding,
+	}
+}
+
+// bindingKey identifies a binding of the given kind
+func bindingKey(kind string, roleBinding v1.RoleBinding) string {
+	return kind + "/" + roleBinding.Namespace + "/" + roleBinding.Name
+}
+
+// toRoleBinding converts watched objects into role bindings, returning their
+// kind and resource version
+func toRoleBinding(obj runtime.Object) (v1.RoleBinding, string, string, bool) {
+	switch binding := obj.(type) {
+	case *v1.RoleBinding:
+		return *binding, KindRoleBinding, binding.ResourceVersion, true
+	case *v1.ClusterRoleBinding:
+		return roleBindingFromClusterRoleBinding(*binding), KindClusterRoleBinding, binding.ResourceVersion, true
+	}
+	return v1.RoleBinding{}, "", "", false
+}
+
+// roleBindingFromClusterRoleBinding represents a cluster role binding as a
+// role binding so the same filters can be applied to both
+func roleBindingFromClusterRoleBinding(clusterRoleBinding v1.ClusterRoleBinding) v1.RoleBinding {
+	return v1.RoleBinding{
+		TypeMeta:   clusterRoleBinding.TypeMeta,
+		ObjectMeta: clusterRoleBinding.ObjectMeta,
+		Subjects:   clusterRoleBinding.Subjects,
+		RoleRef:    clusterRoleBinding.RoleRef,
+	}
+}
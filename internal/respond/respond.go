@@ -0,0 +1,21 @@
+// Package respond renders the responses of HTTP middleware in the format of
+// the request
+package respond
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Abort stops the request from being handled further, and responds with the
+// error message, in yaml if the request is yaml
+func Abort(c *gin.Context, status int, message string) {
+	c.Abort()
+	if strings.Contains(strings.ToLower(c.ContentType()), "yaml") {
+		c.Render(status, render.YAML{Data: message})
+		return
+	}
+	c.Render(status, render.JSON{Data: message})
+}
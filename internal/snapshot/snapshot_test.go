@@ -0,0 +1,237 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+	"github.com/geoah/go-kube-api/internal/subjects"
+)
+
+const (
+	nsDefault = "default"
+)
+
+var (
+	t1 = time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	t2 = time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+	t3 = time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC)
+)
+
+// newStore returns a store in a temporary directory, and a cleanup func
+func newStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	require.NoError(t, err, "failed to create temp dir")
+	store, err := New(filepath.Join(dir, "snapshots.db"))
+	require.NoError(t, err, "failed to create store")
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// stateWith returns a state containing the given role bindings
+func stateWith(roleBindings ...v1.RoleBinding) rbac.State {
+	return rbac.State{
+		RoleBindings: roleBindings,
+	}
+}
+
+func TestStore_At(t *testing.T) {
+	tests := []struct {
+		name    string
+		asOf    time.Time
+		want    *Snapshot
+		wantErr error
+	}{
+		{
+			name:    "before first snapshot, not found",
+			asOf:    t1.Add(-time.Hour),
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "exactly at snapshot, success",
+			asOf: t2,
+			want: &Snapshot{
+				Timestamp: t2,
+				State:     stateWith(fixtures.RoleBindingRole1Subject1, fixtures.RoleBindingRole2Subject2),
+			},
+		},
+		{
+			name: "between snapshots, success",
+			asOf: t2.Add(time.Hour),
+			want: &Snapshot{
+				Timestamp: t2,
+				State:     stateWith(fixtures.RoleBindingRole1Subject1, fixtures.RoleBindingRole2Subject2),
+			},
+		},
+		{
+			name: "after last snapshot, success",
+			asOf: t3.Add(time.Hour),
+			want: &Snapshot{
+				Timestamp: t3,
+				State:     stateWith(fixtures.RoleBindingRole3Subject3and4),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, cleanup := newStore(t)
+			defer cleanup()
+
+			// saved out of order
+			for _, snapshot := range []Snapshot{
+				{
+					Timestamp: t3,
+					State:     stateWith(fixtures.RoleBindingRole3Subject3and4),
+				},
+				{
+					Timestamp: t1,
+					State:     stateWith(fixtures.RoleBindingRole1Subject1),
+				},
+				{
+					Timestamp: t2,
+					State:     stateWith(fixtures.RoleBindingRole1Subject1, fixtures.RoleBindingRole2Subject2),
+				},
+			} {
+				require.NoError(t, store.Save(snapshot), "failed to save snapshot")
+			}
+
+			got, err := store.At(tt.asOf)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	// consecutive hourly snapshots from t1
+	timestamps := []time.Time{}
+	for i := 0; i < 6; i++ {
+		timestamps = append(timestamps, t1.Add(time.Duration(i)*time.Hour))
+	}
+	tests := []struct {
+		name        string
+		before      time.Time
+		wantDeleted int
+		wantKept    []time.Time
+	}{
+		{
+			name:        "before first snapshot, nothing deleted",
+			before:      t1,
+			wantDeleted: 0,
+			wantKept:    timestamps,
+		},
+		{
+			name:        "several consecutive snapshots, success",
+			before:      timestamps[4],
+			wantDeleted: 4,
+			wantKept:    timestamps[4:],
+		},
+		{
+			name:        "between snapshots, success",
+			before:      timestamps[2].Add(time.Minute),
+			wantDeleted: 3,
+			wantKept:    timestamps[3:],
+		},
+		{
+			name:        "after last snapshot, everything deleted",
+			before:      t2,
+			wantDeleted: 6,
+			wantKept:    []time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, cleanup := newStore(t)
+			defer cleanup()
+
+			for i, timestamp := range timestamps {
+				require.NoError(t, store.Save(Snapshot{
+					Timestamp: timestamp,
+					State:     stateWith(fixtures.RoleBindingRole1Subject1),
+				}), "failed to save snapshot %d", i)
+			}
+
+			deleted, err := store.Prune(tt.before)
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.wantDeleted, deleted)
+
+			kept, err := store.List()
+			require.NoError(t, err, "failed to list snapshots")
+			assert.Equal(t, tt.wantKept, kept)
+
+			// the kept snapshots still resolve, and pruned ones don't
+			for _, timestamp := range tt.wantKept {
+				snapshot, err := store.At(timestamp.Add(time.Minute))
+				require.NoError(t, err, "failed to get snapshot")
+				assert.Equal(t, timestamp, snapshot.Timestamp)
+			}
+			if tt.wantDeleted > 0 {
+				_, err := store.At(timestamps[tt.wantDeleted-1])
+				assert.Equal(t, ErrNotFound, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotter_Snapshot(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+
+	fakeClient := kfake.NewSimpleClientset()
+	fakeRbac := fakeClient.RbacV1()
+	_, err := fakeRbac.RoleBindings(nsDefault).Create(&fixtures.RoleBindingRole1Subject1)
+	require.NoError(t, err, "failed to create sample role binding")
+	_, err = fakeRbac.ClusterRoleBindings().Create(&fixtures.ClusterRoleBindingClusterRole1Subject1)
+	require.NoError(t, err, "failed to create sample cluster role binding")
+	_, err = fakeClient.CoreV1().ServiceAccounts(nsDefault).Create(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nsDefault, Name: "deployer"},
+	})
+	require.NoError(t, err, "failed to create sample service account")
+	enumerator, err := rbac.New(fakeRbac)
+	require.NoError(t, err)
+
+	// an old snapshot that should be pruned
+	require.NoError(t, store.Save(Snapshot{Timestamp: t1}), "failed to save snapshot")
+
+	snapshotter, err := NewSnapshotter(store, enumerator, time.Hour, 24*time.Hour, zap.NewNop(),
+		WithServiceAccounts(subjects.NewServiceAccounts(fakeClient.CoreV1())))
+	require.NoError(t, err, "failed to create snapshotter")
+	snapshotter.now = func() time.Time {
+		return t3
+	}
+	require.NoError(t, snapshotter.Snapshot(), "failed to take snapshot")
+
+	timestamps, err := store.List()
+	require.NoError(t, err, "failed to list snapshots")
+	assert.Equal(t, []time.Time{t3}, timestamps)
+
+	snapshot, err := store.At(t3)
+	require.NoError(t, err, "failed to get snapshot")
+	assert.Equal(t, []v1.RoleBinding{fixtures.RoleBindingRole1Subject1}, snapshot.State.RoleBindings)
+	assert.Equal(t, []v1.ClusterRoleBinding{fixtures.ClusterRoleBindingClusterRole1Subject1}, snapshot.State.ClusterRoleBindings)
+	assert.Equal(t, []rbac.SubjectKey{{Kind: v1.ServiceAccountKind, Namespace: nsDefault, Name: "deployer"}}, snapshot.ServiceAccounts)
+
+	// snapshots saved without service accounts don't have any recorded
+	require.NoError(t, store.Save(Snapshot{Timestamp: t2}), "failed to save snapshot")
+	snapshot, err = store.At(t2)
+	require.NoError(t, err, "failed to get snapshot")
+	assert.Nil(t, snapshot.ServiceAccounts)
+}
@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+type (
+	// Snapshotter periodically saves the RBAC state into a store
+	Snapshotter struct {
+		store     *Store
+		rbac      rbac.Enumerator
+		interval  time.Duration
+		retention time.Duration
+		logger    *zap.Logger
+		now       func() time.Time
+		// serviceAccounts are recorded along with the state, if set
+		serviceAccounts ServiceAccounts
+	}
+	// SnapshotterOption configures optional features of the Snapshotter
+	SnapshotterOption func(*Snapshotter)
+	// ServiceAccounts lists the service accounts that currently exist
+	ServiceAccounts interface {
+		List() (map[rbac.SubjectKey]bool, error)
+	}
+)
+
+// NewSnapshotter given a store and an enumerator to take snapshots from every
+// interval, snapshots older than the retention are deleted unless it is zero
+func NewSnapshotter(
+	store *Store,
+	rbac rbac.Enumerator,
+	interval time.Duration,
+	retention time.Duration,
+	logger *zap.Logger,
+	options ...SnapshotterOption,
+) (*Snapshotter, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid snapshot interval %s", interval)
+	}
+	s := &Snapshotter{
+		store:     store,
+		rbac:      rbac,
+		interval:  interval,
+		retention: retention,
+		logger:    logger,
+		now:       time.Now,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
+}
+
+// WithServiceAccounts records the service accounts that exist along with
+// every snapshot, so the subjects of past bindings can be checked against
+// them
+func WithServiceAccounts(serviceAccounts ServiceAccounts) SnapshotterOption {
+	return func(s *Snapshotter) {
+		s.serviceAccounts = serviceAccounts
+	}
+}
+
+// Run takes a snapshot immediately and then every interval, until the context
+// is done
+func (s *Snapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Snapshot(); err != nil {
+			s.logger.Error("error taking snapshot", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snapshot saves the current RBAC state, and service accounts if recorded,
+// and prunes old snapshots
+func (s *Snapshotter) Snapshot() error {
+	now := s.now().UTC()
+
+	state, err := s.rbac.State()
+	if err != nil {
+		return fmt.Errorf("failed to get rbac state: %w", err)
+	}
+
+	snapshot := Snapshot{
+		Timestamp: now,
+		State:     *state,
+	}
+	if s.serviceAccounts != nil {
+		serviceAccounts, err := s.serviceAccounts.List()
+		if err != nil {
+			return fmt.Errorf("failed to get service accounts: %w", err)
+		}
+		snapshot.ServiceAccounts = make([]rbac.SubjectKey, 0, len(serviceAccounts))
+		for serviceAccount := range serviceAccounts {
+			snapshot.ServiceAccounts = append(snapshot.ServiceAccounts, serviceAccount)
+		}
+		sort.Slice(snapshot.ServiceAccounts, func(i, j int) bool {
+			return snapshot.ServiceAccounts[i].Less(snapshot.ServiceAccounts[j])
+		})
+	}
+
+	if err := s.store.Save(snapshot); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	if s.retention > 0 {
+		if _, err := s.store.Prune(now.Add(-s.retention)); err != nil {
+			return fmt.Errorf("failed to prune snapshots: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+var (
+	// ErrNotFound is returned when there are no snapshots for a given time
+	ErrNotFound = errors.New("no snapshot found")
+	// snapshotsBucket holds the snapshots keyed by their timestamp
+	snapshotsBucket = []byte("snapshots")
+)
+
+type (
+	// Snapshot of the RBAC state at a point in time
+	Snapshot struct {
+		Timestamp time.Time  `json:"timestamp" yaml:"timestamp"`
+		State     rbac.State `json:"state" yaml:"state"`
+		// ServiceAccounts that existed when the snapshot was taken, nil if
+		// they weren't recorded
+		ServiceAccounts []rbac.SubjectKey `json:"serviceAccounts" yaml:"serviceAccounts"`
+	}
+	// Store persists snapshots in an embedded bolt database
+	Store struct {
+		db *bolt.DB
+	}
+)
+
+// New Store given the path of its database file, which is created if it
+// does not exist
+func New(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		// don't wait forever if another process has the database open
+		Timeout: time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	return &Store{
+		db: db,
+	}, nil
+}
+
+// Close the underlying database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save a snapshot, replacing any other snapshot with the same timestamp
+func (s *Store) Save(snapshot Snapshot) error {
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).Put(key(snapshot.Timestamp), value)
+	})
+}
+
+// At returns the latest snapshot taken at or before the given time, or
+// ErrNotFound if there is none
+func (s *Store) At(asOf time.Time) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(snapshotsBucket).Cursor()
+		// seek positions the cursor at the first key at or after the given
+		// one, so unless it's an exact match we need the previous one
+		asOfKey := key(asOf)
+		k, v := cursor.Seek(asOfKey)
+		switch {
+		case k == nil:
+			k, v = cursor.Last()
+		case string(k) != string(asOfKey):
+			k, v = cursor.Prev()
+		}
+		if k == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, snapshot)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// List the timestamps of all snapshots, oldest first
+func (s *Store) List() ([]time.Time, error) {
+	timestamps := []time.Time{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).ForEach(func(k, _ []byte) error {
+			timestamps = append(timestamps, timestamp(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return timestamps, nil
+}
+
+// Prune deletes snapshots taken before the given time, returns the number of
+// snapshots deleted
+func (s *Store) Prune(before time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(snapshotsBucket).Cursor()
+		beforeKey := key(before)
+		for k, _ := cursor.First(); k != nil && string(k) < string(beforeKey); k, _ = cursor.Next() {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// key encodes a timestamp so that keys sort chronologically
+func key(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return k
+}
+
+// timestamp decodes a key
+func timestamp(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k))).UTC()
+}
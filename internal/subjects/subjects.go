@@ -0,0 +1,158 @@
+package subjects
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// systemPrefix is the prefix of users and groups that are managed by
+	// kubernetes itself and never appear in directories
+	systemPrefix = "system:"
+)
+
+type (
+	// Directory lists the users and groups that exist, usually loaded from a
+	// yaml file exported from an identity provider
+	Directory struct {
+		Users  []string `yaml:"users"`
+		Groups []string `yaml:"groups"`
+	}
+	// ServiceAccounts lists the service accounts of a cluster
+	ServiceAccounts struct {
+		client serviceAccountsGetter
+	}
+	// serviceAccountsGetter is a simplified corev1.ServiceAccountsGetter
+	serviceAccountsGetter interface {
+		ServiceAccounts(namespace string) corev1.ServiceAccountInterface
+	}
+	// Report lists the subjects that bindings refer to but do not exist
+	Report struct {
+		Subjects []DanglingSubject `json:"subjects" yaml:"subjects"`
+	}
+	// DanglingSubject is a subject that does not exist, and the bindings
+	// that refer to it
+	DanglingSubject struct {
+		Subject  rbac.SubjectKey `json:"subject" yaml:"subject"`
+		Bindings []rbac.Key      `json:"bindings" yaml:"bindings"`
+	}
+)
+
+// LoadDirectory reads the directory's yaml file
+func LoadDirectory(path string) (*Directory, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	directory := &Directory{}
+	if err := yaml.UnmarshalStrict(b, directory); err != nil {
+		return nil, fmt.Errorf("failed to parse directory: %w", err)
+	}
+	return directory, nil
+}
+
+// NewServiceAccounts given a core v1 client returns a ServiceAccounts
+func NewServiceAccounts(client serviceAccountsGetter) *ServiceAccounts {
+	return &ServiceAccounts{
+		client: client,
+	}
+}
+
+// List returns the keys of the service accounts of all namespaces
+func (s *ServiceAccounts) List() (map[rbac.SubjectKey]bool, error) {
+	serviceAccounts, err := s.client.ServiceAccounts("").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service accounts: %w", err)
+	}
+	keys := make(map[rbac.SubjectKey]bool, len(serviceAccounts.Items))
+	for _, serviceAccount := range serviceAccounts.Items {
+		keys[rbac.SubjectKey{
+			Kind:      v1.ServiceAccountKind,
+			Namespace: serviceAccount.Namespace,
+			Name:      serviceAccount.Name,
+		}] = true
+	}
+	return keys, nil
+}
+
+// Set returns the set of the subjects, or nil if they are nil
+func Set(keys []rbac.SubjectKey) map[rbac.SubjectKey]bool {
+	if keys == nil {
+		return nil
+	}
+	set := make(map[rbac.SubjectKey]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+// Dangling finds the subjects of the state's bindings that do not exist.
+// Service accounts are only checked if serviceAccounts is not nil, and users
+// and groups only if directory is not nil.
+// System users and groups are assumed to always exist.
+func Dangling(state rbac.State, serviceAccounts map[rbac.SubjectKey]bool, directory *Directory) Report {
+	users := map[string]bool{}
+	groups := map[string]bool{}
+	if directory != nil {
+		for _, user := range directory.Users {
+			users[user] = true
+		}
+		for _, group := range directory.Groups {
+			groups[group] = true
+		}
+	}
+
+	// exists checks if the subject exists, or cannot be checked
+	exists := func(subject rbac.SubjectKey) bool {
+		switch subject.Kind {
+		case v1.ServiceAccountKind:
+			return serviceAccounts == nil || serviceAccounts[subject]
+		case v1.UserKind:
+			return directory == nil || strings.HasPrefix(subject.Name, systemPrefix) || users[subject.Name]
+		case v1.GroupKind:
+			return directory == nil || strings.HasPrefix(subject.Name, systemPrefix) || groups[subject.Name]
+		}
+		return true
+	}
+
+	// bindings are sorted, so each subject's bindings will be too
+	bindings := map[rbac.SubjectKey][]rbac.Key{}
+	for _, binding := range state.Bindings() {
+		for _, subject := range binding.Subjects {
+			key := rbac.NewSubjectKey(subject)
+			if exists(key) {
+				continue
+			}
+			// subjects can be listed more than once in the same binding
+			keys := bindings[key]
+			if len(keys) > 0 && keys[len(keys)-1] == binding.Key() {
+				continue
+			}
+			bindings[key] = append(keys, binding.Key())
+		}
+	}
+
+	report := Report{
+		Subjects: []DanglingSubject{},
+	}
+	for subject, keys := range bindings {
+		report.Subjects = append(report.Subjects, DanglingSubject{
+			Subject:  subject,
+			Bindings: keys,
+		})
+	}
+	sort.Slice(report.Subjects, func(i, j int) bool {
+		return report.Subjects[i].Subject.String() < report.Subjects[j].Subject.String()
+	})
+	return report
+}
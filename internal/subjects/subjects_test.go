@@ -0,0 +1,170 @@
+package subjects
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+func TestServiceAccounts_List(t *testing.T) {
+	fakeClient := kfake.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "subject4",
+			Namespace: "default",
+		},
+	})
+	got, err := NewServiceAccounts(fakeClient.CoreV1()).List()
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, map[rbac.SubjectKey]bool{
+		{Kind: v1.ServiceAccountKind, Namespace: "default", Name: "subject4"}: true,
+	}, got)
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subjects")
+	require.NoError(t, err, "did not expect error")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "directory.yaml")
+	err = ioutil.WriteFile(path, []byte("users: [subject1]\ngroups: [group1]\n"), 0600)
+	require.NoError(t, err, "did not expect error")
+	got, err := LoadDirectory(path)
+	require.NoError(t, err, "did not expect error")
+	assert.Equal(t, &Directory{
+		Users:  []string{"subject1"},
+		Groups: []string{"group1"},
+	}, got)
+
+	err = ioutil.WriteFile(path, []byte("people: [subject1]\n"), 0600)
+	require.NoError(t, err, "did not expect error")
+	_, err = LoadDirectory(path)
+	require.Error(t, err, "expected error but got none")
+}
+
+func TestDangling(t *testing.T) {
+	// subject 4 is a service account in the default namespace
+	subject4 := rbac.SubjectKey{Kind: v1.ServiceAccountKind, Namespace: "default", Name: "subject4"}
+
+	// cluster role binding for a system group and a regular one
+	clusterRoleBindingGroups := v1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "clusterrole1-for-groups"},
+		RoleRef:    v1.RoleRef{Kind: rbac.KindClusterRole, Name: "clusterrole1"},
+		Subjects: []v1.Subject{
+			{Kind: v1.GroupKind, Name: "system:masters"},
+			{Kind: v1.GroupKind, Name: "group1"},
+		},
+	}
+
+	// role binding 3 with subject 4 as a service account
+	roleBindingRole3Subject3and4 := fixtures.RoleBindingRole3Subject3and4
+	roleBindingRole3Subject3and4.Subjects = []v1.Subject{
+		{Kind: v1.UserKind, Name: "subject3"},
+		{Kind: v1.ServiceAccountKind, Namespace: "default", Name: "subject4"},
+	}
+
+	// role binding 1 with subject 4 as a service account
+	roleBindingRole1Subject4 := fixtures.RoleBindingRole1Subject1
+	roleBindingRole1Subject4.Subjects = []v1.Subject{
+		{Kind: v1.ServiceAccountKind, Namespace: "default", Name: "subject4"},
+	}
+
+	state := rbac.State{
+		RoleBindings: []v1.RoleBinding{
+			roleBindingRole1Subject4,
+			fixtures.RoleBindingRole2Subject2,
+			roleBindingRole3Subject3and4,
+		},
+		ClusterRoleBindings: []v1.ClusterRoleBinding{
+			clusterRoleBindingGroups,
+		},
+	}
+
+	tests := []struct {
+		name            string
+		serviceAccounts map[rbac.SubjectKey]bool
+		directory       *Directory
+		want            Report
+		wantText        string
+	}{
+		{
+			name:     "nothing to check against",
+			want:     Report{Subjects: []DanglingSubject{}},
+			wantText: "No dangling subjects\n",
+		},
+		{
+			name:            "service account exists",
+			serviceAccounts: map[rbac.SubjectKey]bool{subject4: true},
+			want:            Report{Subjects: []DanglingSubject{}},
+			wantText:        "No dangling subjects\n",
+		},
+		{
+			name:            "deleted service account",
+			serviceAccounts: map[rbac.SubjectKey]bool{},
+			want: Report{
+				Subjects: []DanglingSubject{
+					{
+						Subject: subject4,
+						Bindings: []rbac.Key{
+							{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-subject1"},
+							{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role3-for-subject3and4"},
+						},
+					},
+				},
+			},
+			wantText: "Dangling subjects:\n" +
+				"  ServiceAccount/default/subject4\n" +
+				"      RoleBinding/default/role1-for-subject1\n" +
+				"      RoleBinding/default/role3-for-subject3and4\n",
+		},
+		{
+			name: "users and groups missing from the directory",
+			directory: &Directory{
+				Users: []string{"subject2"},
+			},
+			want: Report{
+				Subjects: []DanglingSubject{
+					{
+						Subject: rbac.SubjectKey{Kind: v1.GroupKind, Name: "group1"},
+						Bindings: []rbac.Key{
+							{Kind: rbac.KindClusterRoleBinding, Name: "clusterrole1-for-groups"},
+						},
+					},
+					{
+						Subject: rbac.SubjectKey{Kind: v1.UserKind, Name: "subject3"},
+						Bindings: []rbac.Key{
+							{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role3-for-subject3and4"},
+						},
+					},
+				},
+			},
+			wantText: "Dangling subjects:\n" +
+				"  Group/group1\n" +
+				"      ClusterRoleBinding/clusterrole1-for-groups\n" +
+				"  User/subject3\n" +
+				"      RoleBinding/default/role3-for-subject3and4\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Dangling(state, tt.serviceAccounts, tt.directory)
+			assert.Equal(t, tt.want, got, "response did not match expectation")
+
+			text := &bytes.Buffer{}
+			err := got.WriteText(text)
+			require.NoError(t, err, "did not expect error")
+			assert.Equal(t, tt.wantText, text.String(), "text did not match expectation")
+		})
+	}
+}
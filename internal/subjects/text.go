@@ -0,0 +1,27 @@
+package subjects
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteText writes a human-readable description of the report
+func (r Report) WriteText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	if len(r.Subjects) == 0 {
+		fmt.Fprintln(b, "No dangling subjects")
+		return b.Flush()
+	}
+
+	fmt.Fprintln(b, "Dangling subjects:")
+	for _, subject := range r.Subjects {
+		fmt.Fprintf(b, "  %s\n", subject.Subject)
+		for _, binding := range subject.Bindings {
+			fmt.Fprintf(b, "      %s\n", binding)
+		}
+	}
+
+	return b.Flush()
+}
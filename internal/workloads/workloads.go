@@ -0,0 +1,201 @@
+package workloads
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+)
+
+const (
+	// KindPod is the kind of pod workloads
+	KindPod = "Pod"
+	// KindDeployment is the kind of deployment workloads, described by their
+	// pod template
+	KindDeployment = "Deployment"
+	// defaultServiceAccount is used by pods that don't specify one
+	defaultServiceAccount = "default"
+)
+
+var (
+	// ErrNotFound is returned when a pod or deployment does not exist
+	ErrNotFound = errors.New("workload not found")
+)
+
+type (
+	// Workload is a pod or deployment and the service account it runs as
+	Workload struct {
+		Kind           string `json:"kind" yaml:"kind"`
+		Namespace      string `json:"namespace" yaml:"namespace"`
+		Name           string `json:"name" yaml:"name"`
+		ServiceAccount string `json:"serviceAccount" yaml:"serviceAccount"`
+		// AutomountToken is false if the service account's token is not
+		// mounted, in which case the workload can't use its permissions
+		// unless it gets a token some other way
+		AutomountToken bool `json:"automountToken" yaml:"automountToken"`
+		// Permissions the service account is granted, directly or through
+		// its groups
+		Permissions []rbac.Permission `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+		// Bindings that grant the permissions
+		Bindings []rbac.Key `json:"bindings,omitempty" yaml:"bindings,omitempty"`
+	}
+	// Lister retrieves workloads from the cluster
+	Lister struct {
+		core coreV1Interface
+		apps appsV1Interface
+	}
+	// coreV1Interface is a simplified corev1.CoreV1Interface
+	coreV1Interface interface {
+		Pods(namespace string) corev1client.PodInterface
+		ServiceAccounts(namespace string) corev1client.ServiceAccountInterface
+	}
+	// appsV1Interface is a simplified appsv1.AppsV1Interface
+	appsV1Interface interface {
+		Deployments(namespace string) appsv1client.DeploymentInterface
+	}
+)
+
+// New given core and apps v1 clients returns a Lister
+func New(core coreV1Interface, apps appsV1Interface) *Lister {
+	return &Lister{
+		core: core,
+		apps: apps,
+	}
+}
+
+// Pods returns the workloads of the pods in the namespace, or all namespaces
+// if empty
+func (l *Lister) Pods(namespace string) ([]Workload, error) {
+	pods, err := l.core.Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods: %w", err)
+	}
+	serviceAccounts, err := l.serviceAccounts(namespace)
+	if err != nil {
+		return nil, err
+	}
+	workloads := make([]Workload, len(pods.Items))
+	for i, pod := range pods.Items {
+		workloads[i] = newWorkload(KindPod, pod.ObjectMeta, pod.Spec, serviceAccounts)
+	}
+	return workloads, nil
+}
+
+// Pod returns the workload of a pod, or ErrNotFound
+func (l *Lister) Pod(namespace, name string) (*Workload, error) {
+	pod, err := l.core.Pods(namespace).Get(name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod: %w", err)
+	}
+	serviceAccounts, err := l.serviceAccounts(namespace)
+	if err != nil {
+		return nil, err
+	}
+	workload := newWorkload(KindPod, pod.ObjectMeta, pod.Spec, serviceAccounts)
+	return &workload, nil
+}
+
+// Deployment returns the workload of a deployment's pod template, or
+// ErrNotFound
+func (l *Lister) Deployment(namespace, name string) (*Workload, error) {
+	deployment, err := l.apps.Deployments(namespace).Get(name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+	serviceAccounts, err := l.serviceAccounts(namespace)
+	if err != nil {
+		return nil, err
+	}
+	workload := newWorkload(KindDeployment, deployment.ObjectMeta, deployment.Spec.Template.Spec, serviceAccounts)
+	return &workload, nil
+}
+
+// serviceAccounts returns the service accounts of the namespace, or all
+// namespaces if empty, keyed by namespace and name
+func (l *Lister) serviceAccounts(namespace string) (map[rbac.SubjectKey]corev1.ServiceAccount, error) {
+	serviceAccounts, err := l.core.ServiceAccounts(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service accounts: %w", err)
+	}
+	keyed := make(map[rbac.SubjectKey]corev1.ServiceAccount, len(serviceAccounts.Items))
+	for _, serviceAccount := range serviceAccounts.Items {
+		keyed[serviceAccountKey(serviceAccount.Namespace, serviceAccount.Name)] = serviceAccount
+	}
+	return keyed, nil
+}
+
+// newWorkload resolves the service account a pod spec runs as, and if its
+// token is mounted
+func newWorkload(
+	kind string,
+	meta metav1.ObjectMeta,
+	spec corev1.PodSpec,
+	serviceAccounts map[rbac.SubjectKey]corev1.ServiceAccount,
+) Workload {
+	serviceAccountName := spec.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = spec.DeprecatedServiceAccount
+	}
+	if serviceAccountName == "" {
+		serviceAccountName = defaultServiceAccount
+	}
+
+	// the pod's setting takes precedence over the service account's, tokens
+	// are mounted unless either disables it
+	automountToken := true
+	if spec.AutomountServiceAccountToken != nil {
+		automountToken = *spec.AutomountServiceAccountToken
+	} else if serviceAccount, ok := serviceAccounts[serviceAccountKey(meta.Namespace, serviceAccountName)]; ok &&
+		serviceAccount.AutomountServiceAccountToken != nil {
+		automountToken = *serviceAccount.AutomountServiceAccountToken
+	}
+
+	return Workload{
+		Kind:           kind,
+		Namespace:      meta.Namespace,
+		Name:           meta.Name,
+		ServiceAccount: serviceAccountName,
+		AutomountToken: automountToken,
+	}
+}
+
+// ResolvePermissions sets the permissions the workload's service account is
+// granted in the state, and the bindings that grant them
+func (w *Workload) ResolvePermissions(state rbac.State) {
+	w.Permissions, w.Bindings = state.EffectivePermissions(
+		rbac.ServiceAccountSubjects(w.Namespace, w.ServiceAccount)...,
+	)
+}
+
+// RunsAs checks if the workload's service account authenticates as the
+// subject, either the service account itself or one of its groups
+func (w Workload) RunsAs(subject rbac.SubjectKey) bool {
+	for _, key := range rbac.ServiceAccountSubjects(w.Namespace, w.ServiceAccount) {
+		if key == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceAccountKey identifies a service account
+func serviceAccountKey(namespace, name string) rbac.SubjectKey {
+	return rbac.SubjectKey{
+		Kind:      rbacv1.ServiceAccountKind,
+		Namespace: namespace,
+		Name:      name,
+	}
+}
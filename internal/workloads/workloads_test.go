@@ -0,0 +1,172 @@
+package workloads
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+func TestLister(t *testing.T) {
+	disabled := false
+	fakeClient := kfake.NewSimpleClientset(
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "subject4", Namespace: "default"},
+		},
+		&corev1.ServiceAccount{
+			ObjectMeta:                   metav1.ObjectMeta{Name: "no-token", Namespace: "default"},
+			AutomountServiceAccountToken: &disabled,
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+			Spec:       corev1.PodSpec{ServiceAccountName: "subject4"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "default"},
+			Spec:       corev1.PodSpec{ServiceAccountName: "no-token"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod3", Namespace: "default"},
+			Spec: corev1.PodSpec{
+				AutomountServiceAccountToken: &disabled,
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "deployment1", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{ServiceAccountName: "subject4"},
+				},
+			},
+		},
+	)
+	lister := New(fakeClient.CoreV1(), fakeClient.AppsV1())
+
+	t.Run("pods", func(t *testing.T) {
+		got, err := lister.Pods("default")
+		require.NoError(t, err, "did not expect error")
+		assert.ElementsMatch(t, []Workload{
+			{Kind: KindPod, Namespace: "default", Name: "pod1", ServiceAccount: "subject4", AutomountToken: true},
+			{Kind: KindPod, Namespace: "default", Name: "pod2", ServiceAccount: "no-token", AutomountToken: false},
+			{Kind: KindPod, Namespace: "default", Name: "pod3", ServiceAccount: "default", AutomountToken: false},
+		}, got)
+	})
+
+	t.Run("pod", func(t *testing.T) {
+		got, err := lister.Pod("default", "pod2")
+		require.NoError(t, err, "did not expect error")
+		assert.Equal(t, &Workload{Kind: KindPod, Namespace: "default", Name: "pod2", ServiceAccount: "no-token"}, got)
+
+		_, err = lister.Pod("default", "missing")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("deployment", func(t *testing.T) {
+		got, err := lister.Deployment("default", "deployment1")
+		require.NoError(t, err, "did not expect error")
+		assert.Equal(t, &Workload{Kind: KindDeployment, Namespace: "default", Name: "deployment1", ServiceAccount: "subject4", AutomountToken: true}, got)
+
+		_, err = lister.Deployment("default", "missing")
+		assert.Equal(t, ErrNotFound, err)
+	})
+}
+
+func TestWorkload_ResolvePermissions(t *testing.T) {
+	// role 1 is bound to every service account in the default namespace
+	roleBindingRole1ServiceAccounts := fixtures.RoleBindingRole1Subject1
+	roleBindingRole1ServiceAccounts.Subjects = []rbacv1.Subject{
+		{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:default"},
+	}
+
+	state := rbac.State{
+		Roles: []rbacv1.Role{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role1", Namespace: "default"},
+				Rules: []rbacv1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"pods"},
+					Verbs:     []string{"list"},
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "role3", Namespace: "default"},
+				Rules: []rbacv1.PolicyRule{{
+					APIGroups: []string{""},
+					Resources: []string{"secrets"},
+					Verbs:     []string{"get"},
+				}},
+			},
+		},
+		RoleBindings: []rbacv1.RoleBinding{
+			roleBindingRole1ServiceAccounts,
+			fixtures.RoleBindingRole2Subject2,
+			fixtures.RoleBindingRole3Subject3and4,
+		},
+	}
+
+	// fixtures bind role 3 to subject 4 without a kind, make it a service
+	// account
+	state.RoleBindings[2].RoleRef.Name = "role3"
+	state.RoleBindings[2].Subjects = []rbacv1.Subject{
+		{Kind: rbacv1.ServiceAccountKind, Namespace: "default", Name: "subject4"},
+	}
+
+	workload := Workload{Kind: KindPod, Namespace: "default", Name: "pod1", ServiceAccount: "subject4", AutomountToken: true}
+	workload.ResolvePermissions(state)
+	assert.Equal(t, []rbac.Permission{
+		{Namespace: "default", Verb: "list", Resource: "pods"},
+		{Namespace: "default", Verb: "get", Resource: "secrets"},
+	}, workload.Permissions)
+	assert.Equal(t, []rbac.Key{
+		{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role1-for-subject1"},
+		{Kind: rbac.KindRoleBinding, Namespace: "default", Name: "role3-for-subject3and4"},
+	}, workload.Bindings)
+}
+
+func TestWorkload_RunsAs(t *testing.T) {
+	workload := Workload{Kind: KindPod, Namespace: "default", Name: "pod1", ServiceAccount: "subject4"}
+	tests := []struct {
+		name    string
+		subject rbac.SubjectKey
+		want    bool
+	}{
+		{
+			name:    "service account",
+			subject: rbac.SubjectKey{Kind: rbacv1.ServiceAccountKind, Namespace: "default", Name: "subject4"},
+			want:    true,
+		},
+		{
+			name:    "service account in other namespace",
+			subject: rbac.SubjectKey{Kind: rbacv1.ServiceAccountKind, Namespace: "other", Name: "subject4"},
+			want:    false,
+		},
+		{
+			name:    "service account user",
+			subject: rbac.SubjectKey{Kind: rbacv1.UserKind, Name: "system:serviceaccount:default:subject4"},
+			want:    true,
+		},
+		{
+			name:    "namespace group",
+			subject: rbac.SubjectKey{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:default"},
+			want:    true,
+		},
+		{
+			name:    "other user",
+			subject: rbac.SubjectKey{Kind: rbacv1.UserKind, Name: "subject4"},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, workload.RunsAs(tt.subject))
+		})
+	}
+}
@@ -0,0 +1,334 @@
+// Package client is a typed client for the go-kube-api HTTP API, so that
+// consumers don't have to copy its request and response types
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ContentTypeJSON sends requests and receives responses as JSON
+	ContentTypeJSON ContentType = "application/json"
+	// ContentTypeYAML sends requests and receives responses as YAML
+	ContentTypeYAML ContentType = "application/x-yaml"
+
+	// DefaultTimeout is the default timeout of each attempt of a request
+	DefaultTimeout = 30 * time.Second
+	// DefaultRetries is the default number of times failed requests are
+	// retried
+	DefaultRetries = 3
+	// DefaultBackoff is the default time to wait before the first retry,
+	// it's doubled for every retry after that
+	DefaultBackoff = 100 * time.Millisecond
+	// DefaultMaxWait is the default longest time to wait before a retry,
+	// however long the backoff or the service's Retry-After header
+	DefaultMaxWait = 30 * time.Second
+)
+
+type (
+	// ContentType is the format requests and responses are encoded as, the
+	// API responds in the format of the request
+	ContentType string
+	// Client calls the API of a go-kube-api service
+	Client struct {
+		baseURL     string
+		httpClient  *http.Client
+		contentType ContentType
+		retries     int
+		backoff     time.Duration
+		maxWait     time.Duration
+		token       string
+	}
+	// Option configures optional features of the Client
+	Option func(*Client)
+	// Error is returned when the API responds with an error
+	Error struct {
+		StatusCode int
+		Message    string
+	}
+)
+
+// New Client given the base url of the service, such as
+// "http://go-kube-api:8080", and any options
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url scheme %q", u.Scheme)
+	}
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		contentType: ContentTypeJSON,
+		retries:     DefaultRetries,
+		backoff:     DefaultBackoff,
+		maxWait:     DefaultMaxWait,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// WithHTTPClient uses the given HTTP client, its timeout is used as is
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout sets the timeout of each attempt of a request, the context
+// passed to the client's methods bounds all of them
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		// copy the client rather than changing one we were given
+		httpClient := *c.httpClient
+		httpClient.Timeout = timeout
+		c.httpClient = &httpClient
+	}
+}
+
+// WithContentType sets the format requests and responses are encoded as
+func WithContentType(contentType ContentType) Option {
+	return func(c *Client) {
+		c.contentType = contentType
+	}
+}
+
+// WithBearerToken authenticates requests with the token, for services that
+// require callers to authenticate
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries sets how many times requests are retried if they fail to be
+// sent or the service is unavailable or rate limited, and how long to wait
+// before the first retry unless the service says how long to wait
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithMaxWait sets the longest time to wait before a retry, longer backoffs
+// and Retry-After headers are cut short so a misbehaving service can't stall
+// requests
+func WithMaxWait(maxWait time.Duration) Option {
+	return func(c *Client) {
+		c.maxWait = maxWait
+	}
+}
+
+// Error returns the status code and message of the error
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Enumerate returns a page of the role bindings matching the request, all
+// of them unless it has a limit
+func (c *Client) Enumerate(ctx context.Context, req EnumerateRequest) (*RoleBindingPage, error) {
+	roleBindings := []RoleBindingMatch{}
+	header, err := c.do(ctx, "/v1/rbac/enumerateBySubjectNames", req, &roleBindings)
+	if err != nil {
+		return nil, err
+	}
+	return &RoleBindingPage{
+		RoleBindings: roleBindings,
+		Continue:     header.Get("X-Continue"),
+	}, nil
+}
+
+// EnumeratePages calls f with every page of the role bindings matching the
+// request, starting from its continue token if any, until there are no more
+// pages or f returns an error
+func (c *Client) EnumeratePages(ctx context.Context, req EnumerateRequest, f func(page *RoleBindingPage) error) error {
+	for {
+		page, err := c.Enumerate(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err := f(page); err != nil {
+			return err
+		}
+		if page.Continue == "" {
+			return nil
+		}
+		req.Continue = page.Continue
+	}
+}
+
+// EnumerateAll returns all of the role bindings matching the request,
+// retrieving them a page at a time if the request has a limit
+func (c *Client) EnumerateAll(ctx context.Context, req EnumerateRequest) ([]RoleBindingMatch, error) {
+	roleBindings := []RoleBindingMatch{}
+	err := c.EnumeratePages(ctx, req, func(page *RoleBindingPage) error {
+		roleBindings = append(roleBindings, page.RoleBindings...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return roleBindings, nil
+}
+
+// Batch runs many enumeration requests at once, queries that fail have an
+// error in their result instead of failing the batch
+func (c *Client) Batch(ctx context.Context, req BatchRequest) (*BatchResponse, error) {
+	resp := &BatchResponse{}
+	if _, err := c.do(ctx, "/v1/rbac/batch", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// do posts the request to the path and decodes the response into resp,
+// retrying if it fails to be sent or the service is unavailable.
+// Returns the response's headers.
+func (c *Client) do(ctx context.Context, path string, req, resp interface{}) (http.Header, error) {
+	body, err := c.marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct request: %w", err)
+		}
+		httpReq = httpReq.WithContext(ctx)
+		httpReq.Header.Set("Content-Type", string(c.contentType))
+		httpReq.Header.Set("Accept", string(c.contentType))
+		if c.token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		httpResp, err := c.httpClient.Do(httpReq)
+		if err == nil && !retryable(httpResp.StatusCode) {
+			defer httpResp.Body.Close()
+			return httpResp.Header, c.decode(httpResp, resp)
+		}
+
+		// give up once out of retries, or if the context is done
+		if attempt == c.retries || ctx.Err() != nil {
+			if err != nil {
+				return nil, fmt.Errorf("failed to send request: %w", err)
+			}
+			defer httpResp.Body.Close()
+			return nil, c.decode(httpResp, resp)
+		}
+
+		// wait as long as the service asks us to, or back off exponentially,
+		// up to the longest wait
+		wait := c.backoff << uint(attempt)
+		if err == nil {
+			if retryAfter, ok := parseRetryAfter(httpResp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+			httpResp.Body.Close()
+		}
+		if wait > c.maxWait || wait < 0 {
+			wait = c.maxWait
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("failed to send request: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// marshal encodes the request in the client's content type
+func (c *Client) marshal(req interface{}) ([]byte, error) {
+	if c.contentType == ContentTypeYAML {
+		return yaml.Marshal(req)
+	}
+	return json.Marshal(req)
+}
+
+// decode decodes a successful response into resp, or returns the error the
+// service responded with
+func (c *Client) decode(httpResp *http.Response, resp interface{}) error {
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	unmarshal := json.Unmarshal
+	if strings.Contains(httpResp.Header.Get("Content-Type"), "yaml") {
+		unmarshal = yaml.Unmarshal
+	}
+
+	// errors are rendered as a message
+	if httpResp.StatusCode != http.StatusOK {
+		apiErr := &Error{
+			StatusCode: httpResp.StatusCode,
+		}
+		if err := unmarshal(body, &apiErr.Message); err != nil {
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return apiErr
+	}
+
+	if err := unmarshal(body, resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// retryable checks if requests that failed with the status code could
+// succeed if retried
+func retryable(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as a date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// IsStatus checks if the error is an API error with the status code
+func IsStatus(err error, statusCode int) bool {
+	apiErr := &Error{}
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
@@ -0,0 +1,267 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/rbac/v1"
+
+	"github.com/geoah/go-kube-api/internal/api"
+	"github.com/geoah/go-kube-api/internal/auth"
+	"github.com/geoah/go-kube-api/internal/rbac"
+	"github.com/geoah/go-kube-api/internal/rbac/fixtures"
+)
+
+const (
+	nsDefault = "default"
+)
+
+// newRouter returns the service's router, serving the sample role bindings
+func newRouter(t *testing.T) *gin.Engine {
+	a, err := api.New(rbac.NewStatic(rbac.State{
+		RoleBindings: []v1.RoleBinding{
+			fixtures.RoleBindingRole1Subject1,
+			fixtures.RoleBindingRole2Subject2,
+			fixtures.RoleBindingRole3Subject3and4,
+		},
+	}))
+	require.NoError(t, err, "failed to create new api")
+
+	r := gin.Default()
+	a.RegisterRoutes(r)
+	return r
+}
+
+// matches wraps role bindings as matches without group paths
+func matches(roleBindings ...v1.RoleBinding) []RoleBindingMatch {
+	m := make([]RoleBindingMatch, len(roleBindings))
+	for i, roleBinding := range roleBindings {
+		m[i].RoleBinding = roleBinding
+	}
+	return m
+}
+
+// yamlRoundTrip encodes and decodes matches as yaml
+func yamlRoundTrip(t *testing.T, m []RoleBindingMatch) []RoleBindingMatch {
+	b, err := yaml.Marshal(m)
+	require.NoError(t, err)
+	r := []RoleBindingMatch{}
+	require.NoError(t, yaml.Unmarshal(b, &r))
+	return r
+}
+
+func TestClient_Enumerate(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType ContentType
+	}{
+		{
+			name:        "json",
+			contentType: ContentTypeJSON,
+		},
+		{
+			name:        "yaml",
+			contentType: ContentTypeYAML,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(newRouter(t))
+			defer srv.Close()
+
+			c, err := New(srv.URL, WithContentType(tt.contentType))
+			require.NoError(t, err)
+
+			page, err := c.Enumerate(context.Background(), EnumerateRequest{
+				Namespace: nsDefault,
+				Subjects:  []Pattern{{Pattern: "subject", MatchType: MatchPrefix}},
+				BindingFilters: BindingFilters{
+					RoleRef: &RoleRefFilter{Name: "role[12]", MatchType: MatchRegex},
+				},
+			})
+			require.NoError(t, err)
+			want := &RoleBindingPage{
+				RoleBindings: matches(fixtures.RoleBindingRole1Subject1, fixtures.RoleBindingRole2Subject2),
+			}
+			if tt.contentType == ContentTypeYAML {
+				// metadata has no yaml tags, so empty fields are rendered
+				// and decoded as empty rather than nil
+				want.RoleBindings = yamlRoundTrip(t, want.RoleBindings)
+			}
+			assert.Equal(t, want, page)
+
+			_, err = c.Enumerate(context.Background(), EnumerateRequest{
+				SubjectNames: []string{"subject1"},
+			})
+			assert.Equal(t, &Error{
+				StatusCode: http.StatusBadRequest,
+				Message:    "missing namespace in request",
+			}, err)
+			assert.True(t, IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
+
+func TestClient_EnumerateAll(t *testing.T) {
+	requests := int32(0)
+	router := newRouter(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		router.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	require.NoError(t, err)
+
+	roleBindings, err := c.EnumerateAll(context.Background(), EnumerateRequest{
+		Namespace:    nsDefault,
+		SubjectNames: []string{"subject1", "subject2", "subject3"},
+		Limit:        2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, matches(
+		fixtures.RoleBindingRole1Subject1,
+		fixtures.RoleBindingRole2Subject2,
+		fixtures.RoleBindingRole3Subject3and4,
+	), roleBindings)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestClient_Batch(t *testing.T) {
+	srv := httptest.NewServer(newRouter(t))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	require.NoError(t, err)
+
+	resp, err := c.Batch(context.Background(), BatchRequest{
+		Queries: []EnumerateRequest{
+			{Namespace: nsDefault, SubjectNames: []string{"subject2"}},
+			{Namespace: nsDefault},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &BatchResponse{
+		Results: []BatchResult{
+			{RoleBindings: matches(fixtures.RoleBindingRole2Subject2)},
+			{Error: "missing subject names in request"},
+		},
+	}, resp)
+}
+
+func TestClient_bearerToken(t *testing.T) {
+	tokens, err := auth.NewTokens([]auth.Caller{{Name: "ci", Token: "token1"}})
+	require.NoError(t, err)
+	// middleware only applies to the routes registered after it
+	r := newRouter(t)
+	r.Use(tokens.Authenticate)
+	r.POST("/v1/rbac/authenticated", func(c *gin.Context) {
+		c.JSON(http.StatusOK, BatchResponse{})
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithBearerToken("token1"))
+	require.NoError(t, err)
+	_, err = c.do(context.Background(), "/v1/rbac/authenticated", BatchRequest{}, &BatchResponse{})
+	assert.NoError(t, err)
+
+	c, err = New(srv.URL, WithBearerToken("token2"))
+	require.NoError(t, err)
+	_, err = c.do(context.Background(), "/v1/rbac/authenticated", BatchRequest{}, &BatchResponse{})
+	assert.True(t, IsStatus(err, http.StatusUnauthorized))
+}
+
+func TestClient_retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		retryAfter   string
+		retries      int
+		wantRequests int32
+		wantErr      bool
+	}{
+		{
+			name:         "unavailable then available, success",
+			failures:     2,
+			retryAfter:   "0",
+			retries:      3,
+			wantRequests: 3,
+		},
+		{
+			name:         "retry after longer than the longest wait, cut short, success",
+			failures:     1,
+			retryAfter:   "3600",
+			retries:      1,
+			wantRequests: 2,
+		},
+		{
+			name:         "out of retries, failure",
+			failures:     5,
+			retryAfter:   "0",
+			retries:      2,
+			wantRequests: 3,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := int32(0)
+			router := newRouter(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				router.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+
+			c, err := New(srv.URL, WithRetries(tt.retries, time.Hour), WithMaxWait(10*time.Millisecond))
+			require.NoError(t, err)
+
+			// waits past the longest one fail rather than stall the test
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = c.Enumerate(ctx, EnumerateRequest{
+				Namespace:    nsDefault,
+				SubjectNames: []string{"subject1"},
+			})
+			if tt.wantErr {
+				assert.True(t, IsStatus(err, http.StatusServiceUnavailable), "unexpected error %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRequests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestClient_timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithTimeout(10*time.Millisecond), WithRetries(0, 0))
+	require.NoError(t, err)
+
+	_, err = c.Enumerate(context.Background(), EnumerateRequest{
+		Namespace:    nsDefault,
+		SubjectNames: []string{"subject1"},
+	})
+	assert.Error(t, err)
+}
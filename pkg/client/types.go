@@ -0,0 +1,136 @@
+package client
+
+import (
+	"time"
+
+	v1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	// MatchExact matches names that are equal to the pattern
+	MatchExact MatchType = "exact"
+	// MatchPrefix matches names that start with the pattern
+	MatchPrefix MatchType = "prefix"
+	// MatchGlob matches names against a pattern where * matches any
+	// characters and ? matches a single one
+	MatchGlob MatchType = "glob"
+	// MatchRegex matches names against an anchored regular expression
+	MatchRegex MatchType = "regex"
+)
+
+type (
+	// MatchType is how a pattern is matched against names
+	MatchType string
+	// Pattern matches names, exactly unless a match type is given
+	Pattern struct {
+		Pattern   string    `json:"pattern" yaml:"pattern"`
+		MatchType MatchType `json:"matchType,omitempty" yaml:"matchType,omitempty"`
+	}
+	// RoleRefFilter matches the kind of role, any if empty, and its name
+	RoleRefFilter struct {
+		Kind      string    `json:"kind,omitempty" yaml:"kind,omitempty"`
+		Name      string    `json:"name" yaml:"name"`
+		MatchType MatchType `json:"matchType,omitempty" yaml:"matchType,omitempty"`
+	}
+	// OwnerFilter matches the kind and name of owner references, either can
+	// be empty to match any
+	OwnerFilter struct {
+		Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+		Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	}
+	// Attributes describe a request the roles of bindings have to allow,
+	// requests without a non-resource url are resource requests
+	Attributes struct {
+		Verb           string `json:"verb" yaml:"verb"`
+		APIGroup       string `json:"apiGroup,omitempty" yaml:"apiGroup,omitempty"`
+		Resource       string `json:"resource,omitempty" yaml:"resource,omitempty"`
+		Subresource    string `json:"subresource,omitempty" yaml:"subresource,omitempty"`
+		Name           string `json:"name,omitempty" yaml:"name,omitempty"`
+		NonResourceURL string `json:"nonResourceURL,omitempty" yaml:"nonResourceURL,omitempty"`
+	}
+	// BindingFilters narrow down the bindings matched by subjects, bindings
+	// have to match all of them
+	BindingFilters struct {
+		// RoleRef bindings have to refer to
+		RoleRef *RoleRefFilter `json:"roleRef,omitempty" yaml:"roleRef,omitempty"`
+		// LabelSelector bindings' labels have to match, such as
+		// "team=a,env in (prod)"
+		LabelSelector string `json:"labelSelector,omitempty" yaml:"labelSelector,omitempty"`
+		// Annotations bindings have to have, with the same values
+		Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+		// Owner one of the bindings' owner references has to match
+		Owner *OwnerFilter `json:"owner,omitempty" yaml:"owner,omitempty"`
+		// CreatedAfter and CreatedBefore bound when bindings were created
+		CreatedAfter  *time.Time `json:"createdAfter,omitempty" yaml:"createdAfter,omitempty"`
+		CreatedBefore *time.Time `json:"createdBefore,omitempty" yaml:"createdBefore,omitempty"`
+		// CreatedWithin is how long ago bindings were created at most, such
+		// as "24h"
+		CreatedWithin string `json:"createdWithin,omitempty" yaml:"createdWithin,omitempty"`
+		// Expression is a CEL expression bindings have to match
+		Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
+		// Permissions bindings' roles have to grant all of
+		Permissions []Attributes `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	}
+	// EnumerateRequest enumerates the role bindings of a namespace that refer
+	// to any of the subjects, narrowed down by the binding filters
+	EnumerateRequest struct {
+		Namespace string `json:"namespace" yaml:"namespace"`
+		// SubjectNames are regular expressions that have to match the whole
+		// name, so names without metacharacters are matched exactly
+		SubjectNames []string `json:"subjectNames" yaml:"subjectNames"`
+		// Subjects are matched as their match type says, in addition to
+		// subject names
+		Subjects []Pattern `json:"subjects,omitempty" yaml:"subjects,omitempty"`
+		// BindingFilters narrow down the bindings matching the subjects
+		BindingFilters `json:",inline" yaml:",inline"`
+		// AsOf queries the latest snapshot taken at or before the given time
+		// instead of the live cluster
+		AsOf *time.Time `json:"asOf,omitempty" yaml:"asOf,omitempty"`
+		// ExpandGroups also matches bindings to the groups of subject names
+		// that are not regular expressions, and of exact subjects
+		ExpandGroups bool `json:"expandGroups,omitempty" yaml:"expandGroups,omitempty"`
+		// Limit is how many role bindings to return at most, all if zero
+		Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
+		// Continue is the token returned with the previous page, to get the
+		// role bindings after it
+		Continue string `json:"continue,omitempty" yaml:"continue,omitempty"`
+	}
+	// RoleBindingMatch is a matching role binding, with the groups it was
+	// matched through if groups were expanded
+	RoleBindingMatch struct {
+		v1.RoleBinding `json:",inline" yaml:",inline"`
+		Via            []GroupPath `json:"via,omitempty" yaml:"via,omitempty"`
+	}
+	// GroupPath is a user's membership of a group
+	GroupPath struct {
+		User  string `json:"user" yaml:"user"`
+		Group string `json:"group" yaml:"group"`
+	}
+	// RoleBindingPage is a page of matching role bindings, sorted by role
+	// name, namespace and name
+	RoleBindingPage struct {
+		RoleBindings []RoleBindingMatch
+		// Continue is the token to get the next page with, empty if this is
+		// the last one
+		Continue string
+	}
+	// BatchRequest runs many enumeration requests at once
+	BatchRequest struct {
+		// AsOf queries the latest snapshot taken at or before the given time
+		// instead of the live cluster, for all queries
+		AsOf *time.Time `json:"asOf,omitempty" yaml:"asOf,omitempty"`
+		// Queries are enumeration requests, without AsOf
+		Queries []EnumerateRequest `json:"queries" yaml:"queries"`
+	}
+	// BatchResponse has a result for each query, in the same order
+	BatchResponse struct {
+		Results []BatchResult `json:"results" yaml:"results"`
+	}
+	// BatchResult is either the role bindings a query matched, with the
+	// token to continue from if there are more, or the error it failed with
+	BatchResult struct {
+		RoleBindings []RoleBindingMatch `json:"roleBindings,omitempty" yaml:"roleBindings,omitempty"`
+		Continue     string             `json:"continue,omitempty" yaml:"continue,omitempty"`
+		Error        string             `json:"error,omitempty" yaml:"error,omitempty"`
+	}
+)